@@ -0,0 +1,181 @@
+// Command apikey issues, lists, and revokes the API keys of the
+// service. It uses the service configuration to connect to MongoDB.
+//
+// Usage:
+//
+//	apikey issue -name NAME [-tenant TENANT] [-owner OWNER [-team TEAM]] [-admin] [-scopes links:write,stats:read]
+//	apikey list
+//	apikey revoke ID
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/apikey"
+	"github.com/dwrz/url-shortener/internal/config"
+	"github.com/dwrz/url-shortener/internal/db"
+	"github.com/dwrz/url-shortener/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const usage = `usage:
+  apikey issue -name NAME [-tenant TENANT] [-owner OWNER [-team TEAM]] [-admin] [-scopes SCOPES]
+  apikey list
+  apikey revoke ID`
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+
+	cfg := config.New()
+	ctx := context.Background()
+
+	client, err := db.Connect(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatalf("failed to connect to mongo: %v", err)
+	}
+	defer client.Disconnect(ctx)
+
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "issue":
+		err = issue(ctx, client, cfg.Environment, args)
+	case "list":
+		err = list(ctx, client, cfg.Environment)
+	case "revoke":
+		err = revoke(ctx, client, cfg.Environment, args)
+	default:
+		err = fmt.Errorf("unknown command %q\n%s", cmd, usage)
+	}
+	if err != nil {
+		client.Disconnect(ctx)
+		log.Fatal(err)
+	}
+}
+
+// issue issues a new key, and prints it. The key cannot be shown again.
+// Keys of a tenant are issued within its quota.
+func issue(ctx context.Context, client *mongo.Client, env string, args []string) error {
+	fs := flag.NewFlagSet("issue", flag.ExitOnError)
+	name := fs.String("name", "", "name of the key's holder or use")
+	tenantID := fs.String("tenant", tenant.DefaultID, "ID of the tenant the key belongs to")
+	owner := fs.String("owner", "", "ID of the principal the key acts for")
+	team := fs.String("team", "", "team of the owner")
+	admin := fs.Bool("admin", false, "allow access to every short URL of the tenant")
+	scopes := fs.String(
+		"scopes",
+		strings.Join([]string{apikey.ScopeLinksWrite, apikey.ScopeStatsRead}, ","),
+		"comma separated scopes of the key",
+	)
+	fs.Parse(args)
+
+	if *name == "" {
+		return fmt.Errorf("missing -name")
+	}
+	s := apikey.ParseScopes(*scopes)
+	if err := apikey.ValidateScopes(s); err != nil {
+		return err
+	}
+
+	t, err := tenant.Get(ctx, tenant.GetParams{
+		DB:          client,
+		Environment: env,
+		ID:          *tenantID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get tenant %q: %v", *tenantID, err)
+	}
+
+	if err := apikey.EnsureIndexes(ctx, client, env); err != nil {
+		return err
+	}
+	key, k, err := apikey.Issue(ctx, apikey.IssueParams{
+		DB:          client,
+		Environment: env,
+		Tenant:      t.ID,
+		MaxKeys:     t.Quotas.Keys,
+		Name:        *name,
+		Owner:       *owner,
+		Team:        *team,
+		Admin:       *admin,
+		Scopes:      s,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to issue key: %v", err)
+	}
+
+	log.Printf("issued key %s with scopes %s", k.ID.Hex(), strings.Join(k.Scopes, ","))
+	log.Println("store the key now; it cannot be shown again")
+	fmt.Println(key)
+
+	return nil
+}
+
+// list prints all keys, without the keys themselves.
+func list(ctx context.Context, client *mongo.Client, env string) error {
+	keys, err := apikey.List(ctx, apikey.ListParams{
+		DB:          client,
+		Environment: env,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list keys: %v", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tPREFIX\tNAME\tTENANT\tPRINCIPAL\tTEAM\tADMIN\tSCOPES\tCREATED\tREVOKED")
+	for _, k := range keys {
+		p := k.Principal()
+		tenantID := p.Tenant
+		if tenantID == "" {
+			tenantID = "-"
+		}
+		team := p.Team
+		if team == "" {
+			team = "-"
+		}
+		revoked := "-"
+		if k.Revoked != nil {
+			revoked = k.Revoked.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(
+			tw, "%s\t%s\t%s\t%s\t%s\t%s\t%t\t%s\t%s\t%s\n",
+			k.ID.Hex(), k.Prefix, k.Name, tenantID, p.ID, team, k.Admin,
+			strings.Join(k.Scopes, ","),
+			k.Created.UTC().Format(time.RFC3339), revoked,
+		)
+	}
+
+	return tw.Flush()
+}
+
+// revoke revokes the key with an ID.
+func revoke(ctx context.Context, client *mongo.Client, env string, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("missing ID\n%s", usage)
+	}
+	id, err := primitive.ObjectIDFromHex(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid ID %q", args[0])
+	}
+
+	if err := apikey.Revoke(ctx, apikey.RevokeParams{
+		DB:          client,
+		Environment: env,
+		ID:          id,
+	}); err != nil {
+		return fmt.Errorf("failed to revoke key: %v", err)
+	}
+	log.Printf("revoked key %s", id.Hex())
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/shorturl"
+	"github.com/dwrz/url-shortener/internal/visit"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// backfillInterval is how often the rollup backfill is attempted, until
+// it has completed.
+const backfillInterval = 1 * time.Hour
+
+type backfillParams struct {
+	db          *mongo.Client
+	done        chan struct{}
+	environment string
+}
+
+func (p backfillParams) validate() error {
+	if p.db == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.done == nil {
+		return fmt.Errorf("missing done channel")
+	}
+	if p.environment == "" {
+		return fmt.Errorf("missing environment")
+	}
+
+	return nil
+}
+
+// backfill periodically attempts to backfill rollups from visit records,
+// until it has completed, or the main context is canceled. Concurrent
+// attempts by other instances write the same rollups.
+func backfill(ctx context.Context, p backfillParams) {
+	if err := p.validate(); err != nil {
+		log.Fatalf("invalid backfill configuration parameters: %v", err)
+	}
+	defer close(p.done)
+
+	ticker := time.NewTicker(backfillInterval)
+	defer ticker.Stop()
+
+	for {
+		ready, err := visit.RollupsReady(ctx, p.db, p.environment)
+		if err != nil {
+			log.Printf("failed to check rollups: %v", err)
+		}
+		if ready {
+			return
+		}
+
+		err = visit.BackfillRollups(ctx, visit.BackfillRollupsParams{
+			DB:          p.db,
+			Environment: p.environment,
+			URLs:        shorturl.Collection,
+		})
+		switch err {
+		case nil:
+			log.Println("backfilled rollups")
+			return
+		case visit.ErrBackfillNotDue:
+		default:
+			log.Printf("failed to backfill rollups: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("stopped backfilling rollups")
+			return
+
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/cache"
+	"github.com/dwrz/url-shortener/internal/shorturl"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// expireInterval is how often short URLs are checked for expiry.
+const expireInterval = 1 * time.Minute
+
+type expireParams struct {
+	cache       cache.Cache
+	db          *mongo.Client
+	done        chan struct{}
+	environment string
+}
+
+func (p expireParams) validate() error {
+	if p.cache == nil {
+		return fmt.Errorf("missing cache")
+	}
+	if p.db == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.done == nil {
+		return fmt.Errorf("missing done channel")
+	}
+	if p.environment == "" {
+		return fmt.Errorf("missing environment")
+	}
+
+	return nil
+}
+
+// expire periodically marks expired short URLs, until the main context
+// is canceled.
+func expire(ctx context.Context, p expireParams) {
+	if err := p.validate(); err != nil {
+		log.Fatalf("invalid expiry configuration parameters: %v", err)
+	}
+
+	ticker := time.NewTicker(expireInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("stopped expiring short urls")
+			close(p.done)
+			return
+
+		case <-ticker.C:
+			n, err := shorturl.Expire(ctx, shorturl.ExpireParams{
+				Cache:       p.cache,
+				DB:          p.db,
+				Environment: p.environment,
+			})
+			if err != nil {
+				log.Printf("failed to expire short urls: %v", err)
+			}
+			if n > 0 {
+				log.Printf("expired %d short urls", n)
+			}
+		}
+	}
+}
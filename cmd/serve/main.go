@@ -6,9 +6,20 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/dwrz/url-shortener/internal/apikey"
+	"github.com/dwrz/url-shortener/internal/cache"
 	"github.com/dwrz/url-shortener/internal/config"
+	"github.com/dwrz/url-shortener/internal/conversion"
 	"github.com/dwrz/url-shortener/internal/db"
+	"github.com/dwrz/url-shortener/internal/handlers"
+	"github.com/dwrz/url-shortener/internal/oidc"
+	"github.com/dwrz/url-shortener/internal/shorturl"
+	"github.com/dwrz/url-shortener/internal/tenant"
+	"github.com/dwrz/url-shortener/internal/visit"
+	"github.com/dwrz/url-shortener/pkg/geoip"
+	"github.com/dwrz/url-shortener/pkg/iphash"
 )
 
 func main() {
@@ -27,13 +38,197 @@ func main() {
 		log.Fatalf("failed to connect to mongo: %v", err)
 	}
 
+	// Setup the cache.
+	// Without a Redis server, fall back to an in-process cache.
+	var c cache.Cache
+	if cfg.RedisAddr != "" {
+		log.Println("connecting to redis")
+		c, err = cache.NewRedis(ctx, cache.RedisParams{
+			Addr: cfg.RedisAddr,
+		})
+		if err != nil {
+			log.Fatalf("failed to connect to redis: %v", err)
+		}
+		log.Println("connected to redis")
+	} else {
+		log.Println("using in-process cache")
+		c = cache.NewLocal(0)
+	}
+
+	// Load the GeoIP database, if configured.
+	var geoipDB *geoip.DB
+	if cfg.GeoIPDB != "" {
+		geoipDB, err = geoip.Open(cfg.GeoIPDB)
+		if err != nil {
+			log.Fatalf("failed to load geoip database: %v", err)
+		}
+		log.Printf("loaded %d geoip ranges", geoipDB.Len())
+	}
+
+	// Create the visitor IP hasher.
+	// Without a secret shared by every instance, each would hash the
+	// same address differently, so visitor IPs are not hashed.
+	var ipHasher *iphash.Hasher
+	if cfg.IPHashSecret == "" {
+		log.Println("IP_HASH_SECRET not set; visitor IPs are not hashed")
+	} else {
+		ipHasher, err = iphash.New([]byte(cfg.IPHashSecret))
+		if err != nil {
+			log.Fatalf("failed to create ip hasher: %v", err)
+		}
+	}
+
+	// Create the click ID signer, and index conversions.
+	// Without a secret shared by every instance, click IDs could not
+	// be verified by other instances, or after a restart, so
+	// conversions are not tracked.
+	var clickIDs *conversion.Signer
+	if cfg.ClickIDSecret == "" {
+		log.Println("CLICK_ID_SECRET not set; conversions are not tracked")
+	} else {
+		clickIDs, err = conversion.NewSigner([]byte(cfg.ClickIDSecret))
+		if err != nil {
+			log.Fatalf("failed to create click id signer: %v", err)
+		}
+		if err := conversion.EnsureIndexes(ctx, db, cfg.Environment); err != nil {
+			log.Printf("failed to set up conversion indexes: %v", err)
+		}
+	}
+
+	// Index API keys, which authorize management and stats requests.
+	if err := apikey.EnsureIndexes(ctx, db, cfg.Environment); err != nil {
+		log.Printf("failed to set up api key indexes: %v", err)
+	}
+
+	if len(cfg.Domains) == 0 {
+		log.Println("DOMAINS not set; serving every host")
+	}
+
+	// Index custom domains, and short URLs, whose short codes are
+	// unique per domain.
+	if err := tenant.EnsureIndexes(ctx, db, cfg.Environment); err != nil {
+		log.Printf("failed to set up tenant indexes: %v", err)
+	}
+	if err := shorturl.EnsureIndexes(ctx, db, cfg.Environment); err != nil {
+		log.Printf("failed to set up short url indexes: %v", err)
+	}
+
+	// Index rollups and unique visitor sketches, which stats are read
+	// from.
+	if err := visit.EnsureRollupIndexes(ctx, db, cfg.Environment); err != nil {
+		log.Printf("failed to set up rollup indexes: %v", err)
+	}
+	if err := visit.EnsureUniquesIndex(ctx, db, cfg.Environment); err != nil {
+		log.Printf("failed to set up uniques index: %v", err)
+	}
+
+	// Record when rollups were first recorded, so that earlier visits
+	// can be backfilled; until then, stats are counted from visit
+	// records.
+	if cutoff, err := visit.StartRollups(ctx, db, cfg.Environment); err != nil {
+		log.Printf("failed to start rollups: %v", err)
+	} else if ready, _ := visit.RollupsReady(ctx, db, cfg.Environment); !ready {
+		log.Printf("rollups are backfilled after %v", cutoff.UTC())
+	}
+
+	// Load the key set for OIDC tokens, if configured.
+	var tokens *oidc.Authenticator
+	if cfg.OIDCJWKS != "" {
+		tokens, err = oidc.New(ctx, oidc.Params{
+			JWKS:        cfg.OIDCJWKS,
+			Issuer:      cfg.OIDCIssuer,
+			Audience:    cfg.OIDCAudience,
+			OwnerClaim:  cfg.OIDCOwnerClaim,
+			TeamClaim:   cfg.OIDCTeamClaim,
+			TenantClaim: cfg.OIDCTenantClaim,
+		})
+		if err != nil {
+			log.Fatalf("failed to set up oidc: %v", err)
+		}
+		log.Printf("loaded %d oidc keys", tokens.Len())
+	}
+
+	// Parse the trusted proxies.
+	trustedProxies, err := handlers.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatalf("invalid trusted proxies: %v", err)
+	}
+
 	// Start and run the HTTP server.
 	serverDone := make(chan struct{})
 	go serve(ctx, serveParams{
+		cache:          c,
+		clickIDs:       clickIDs,
+		db:             db,
+		domains:        cfg.Domains,
+		done:           serverDone,
+		environment:    cfg.Environment,
+		geoip:          geoipDB,
+		ipHasher:       ipHasher,
+		port:           cfg.Port,
+		tenants:        tenant.NewResolver(db, cfg.Environment),
+		tokens:         tokens,
+		trustedProxies: trustedProxies,
+		urlScheme:      cfg.URLScheme,
+	})
+
+	// Periodically mark expired short URLs.
+	expireDone := make(chan struct{})
+	go expire(ctx, expireParams{
+		cache:       c,
+		db:          db,
+		done:        expireDone,
+		environment: cfg.Environment,
+	})
+
+	// Backfill rollups from visit records, if needed.
+	backfillDone := make(chan struct{})
+	go backfill(ctx, backfillParams{
 		db:          db,
-		done:        serverDone,
+		done:        backfillDone,
 		environment: cfg.Environment,
-		port:        cfg.Port,
+	})
+
+	// Delete visit records past retention with a TTL index on their
+	// time, or, for other stores, or if the index cannot be set up,
+	// with a periodic job. Without a TTL index, visit records are still
+	// indexed by time, for the job. Until rollups are backfilled, a
+	// TTL index is replaced by a plain one, and the job deletes
+	// nothing.
+	ttl, pruneRetention := cfg.VisitRetention, time.Duration(0)
+	if cfg.VisitRetentionMode == config.RetentionPrune {
+		ttl, pruneRetention = 0, cfg.VisitRetention
+	}
+	if err := visit.EnsureTimeIndex(ctx, visit.EnsureTimeIndexParams{
+		DB:          db,
+		Environment: cfg.Environment,
+		TTL:         ttl,
+	}); err == visit.ErrRollupsNotReady {
+		log.Println("visit records are kept until rollups are backfilled")
+		pruneRetention = cfg.VisitRetention
+		if err := visit.EnsureTimeIndex(ctx, visit.EnsureTimeIndexParams{
+			DB:          db,
+			Environment: cfg.Environment,
+		}); err != nil {
+			log.Printf("failed to set up visit time index: %v", err)
+		}
+	} else if err != nil {
+		log.Printf("failed to set up visit time index: %v", err)
+		pruneRetention = cfg.VisitRetention
+	} else if ttl > 0 {
+		log.Printf("visit records expire after %v", ttl)
+	}
+	if cfg.VisitRetention == 0 {
+		log.Println("visit records are kept indefinitely")
+	}
+
+	// Periodically delete visit records past retention, if needed.
+	pruneDone := make(chan struct{})
+	go prune(ctx, pruneParams{
+		db:          db,
+		done:        pruneDone,
+		environment: cfg.Environment,
+		retention:   pruneRetention,
 	})
 
 	// Listen for OS signals.
@@ -48,8 +243,15 @@ func main() {
 	log.Printf("received signal: %s", s)
 	cancel()
 
-	// Wait for the server to report shutdown.
+	// Wait for the server and background jobs to report shutdown.
 	<-serverDone
+	<-expireDone
+	<-backfillDone
+	<-pruneDone
+
+	if err := c.Close(); err != nil {
+		log.Printf("failed to close cache: %v", err)
+	}
 
 	log.Println("terminating")
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/visit"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// pruneInterval is how often visit records past retention are deleted.
+const pruneInterval = 1 * time.Hour
+
+type pruneParams struct {
+	db          *mongo.Client
+	done        chan struct{}
+	environment string
+
+	// retention is how long visit records are kept.
+	// Zero disables pruning; e.g., if a TTL index deletes them.
+	retention time.Duration
+}
+
+func (p pruneParams) validate() error {
+	if p.db == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.done == nil {
+		return fmt.Errorf("missing done channel")
+	}
+	if p.environment == "" {
+		return fmt.Errorf("missing environment")
+	}
+	if p.retention < 0 {
+		return fmt.Errorf("invalid retention")
+	}
+
+	return nil
+}
+
+// prune periodically deletes visit records older than the retention
+// window, until the main context is canceled.
+func prune(ctx context.Context, p pruneParams) {
+	if err := p.validate(); err != nil {
+		log.Fatalf("invalid prune configuration parameters: %v", err)
+	}
+	defer close(p.done)
+
+	if p.retention == 0 {
+		return
+	}
+	log.Printf("pruning visit records older than %v", p.retention)
+
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("stopped pruning visits")
+			return
+
+		case <-ticker.C:
+			n, err := visit.Prune(ctx, visit.PruneParams{
+				DB:          p.db,
+				Environment: p.environment,
+				Before:      time.Now().Add(-p.retention),
+			})
+			// Visits are kept until rollups are backfilled.
+			if err != nil && err != visit.ErrRollupsNotReady {
+				log.Printf("failed to prune visits: %v", err)
+			}
+			if n > 0 {
+				log.Printf("pruned %d visits", n)
+			}
+		}
+	}
+}
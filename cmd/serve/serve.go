@@ -4,10 +4,18 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"time"
 
+	"github.com/dwrz/url-shortener/internal/cache"
+	"github.com/dwrz/url-shortener/internal/conversion"
 	"github.com/dwrz/url-shortener/internal/handlers"
+	"github.com/dwrz/url-shortener/internal/live"
+	"github.com/dwrz/url-shortener/internal/oidc"
+	"github.com/dwrz/url-shortener/internal/tenant"
+	"github.com/dwrz/url-shortener/pkg/geoip"
+	"github.com/dwrz/url-shortener/pkg/iphash"
 
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -19,13 +27,25 @@ import (
 const shutdownTimeout = 30 * time.Second
 
 type serveParams struct {
-	db          *mongo.Client
-	done        chan struct{}
-	environment string
-	port        string
+	cache          cache.Cache
+	clickIDs       *conversion.Signer
+	db             *mongo.Client
+	domains        []string
+	done           chan struct{}
+	environment    string
+	geoip          *geoip.DB
+	ipHasher       *iphash.Hasher
+	port           string
+	tenants        *tenant.Resolver
+	tokens         *oidc.Authenticator
+	trustedProxies []*net.IPNet
+	urlScheme      string
 }
 
 func (p serveParams) validate() error {
+	if p.cache == nil {
+		return fmt.Errorf("missing cache")
+	}
 	if p.db == nil {
 		return fmt.Errorf("missing db client")
 	}
@@ -50,10 +70,24 @@ func serve(ctx context.Context, p serveParams) {
 	// Create the HTTP router and attach the handlers.
 	router := mux.NewRouter()
 
+	// Live stats streams receive visits from the hub, and end when it
+	// is closed on shutdown.
+	hub := live.NewHub(0)
+
 	if err := handlers.AddRoutes(handlers.AddRoutesParams{
-		DB:          p.db,
-		Environment: p.environment,
-		Router:      router,
+		Cache:          p.cache,
+		ClickIDs:       p.clickIDs,
+		DB:             p.db,
+		Domains:        p.domains,
+		Environment:    p.environment,
+		GeoIP:          p.geoip,
+		IPHasher:       p.ipHasher,
+		Live:           hub,
+		Router:         router,
+		Tenants:        p.tenants,
+		Tokens:         p.tokens,
+		TrustedProxies: p.trustedProxies,
+		URLScheme:      p.urlScheme,
 	}); err != nil {
 		log.Fatalf("failed to add handlers to mux router: %v", err)
 	}
@@ -63,6 +97,9 @@ func serve(ctx context.Context, p serveParams) {
 		Addr:    fmt.Sprintf(":%s", p.port),
 		Handler: router,
 	}
+	// Shutdown waits for active connections to become idle, which live
+	// stats streams never do. Close the hub to end them.
+	server.RegisterOnShutdown(hub.Close)
 
 	go func() {
 		log.Println("starting http server")
@@ -0,0 +1,161 @@
+// Command tenant creates, lists, and updates the tenants of the service.
+// It uses the service configuration to connect to MongoDB.
+//
+// Usage:
+//
+//	tenant create -id ID -name NAME [-max-links N] [-max-keys N]
+//	tenant list
+//	tenant update -id ID [-name NAME] [-max-links N -max-keys N]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/config"
+	"github.com/dwrz/url-shortener/internal/db"
+	"github.com/dwrz/url-shortener/internal/tenant"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const usage = `usage:
+  tenant create -id ID -name NAME [-max-links N] [-max-keys N]
+  tenant list
+  tenant update -id ID [-name NAME] [-max-links N -max-keys N]`
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+
+	cfg := config.New()
+	ctx := context.Background()
+
+	client, err := db.Connect(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatalf("failed to connect to mongo: %v", err)
+	}
+	defer client.Disconnect(ctx)
+
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "create":
+		err = create(ctx, client, cfg.Environment, args)
+	case "list":
+		err = list(ctx, client, cfg.Environment)
+	case "update":
+		err = update(ctx, client, cfg.Environment, args)
+	default:
+		err = fmt.Errorf("unknown command %q\n%s", cmd, usage)
+	}
+	if err != nil {
+		client.Disconnect(ctx)
+		log.Fatal(err)
+	}
+}
+
+// create creates a new tenant.
+func create(ctx context.Context, client *mongo.Client, env string, args []string) error {
+	fs := flag.NewFlagSet("create", flag.ExitOnError)
+	id := fs.String("id", "", "ID of the tenant; e.g., acme")
+	name := fs.String("name", "", "name of the tenant")
+	maxLinks := fs.Int64("max-links", 0, "maximum number of short URLs; 0 for no limit")
+	maxKeys := fs.Int64("max-keys", 0, "maximum number of API keys; 0 for no limit")
+	fs.Parse(args)
+
+	if err := tenant.ValidateID(*id); err != nil {
+		return fmt.Errorf("invalid -id: %v", err)
+	}
+	if *name == "" {
+		return fmt.Errorf("missing -name")
+	}
+
+	if err := tenant.EnsureIndexes(ctx, client, env); err != nil {
+		return err
+	}
+	t, err := tenant.Create(ctx, tenant.CreateParams{
+		DB:          client,
+		Environment: env,
+		ID:          *id,
+		Name:        *name,
+		Quotas:      tenant.Quotas{Links: *maxLinks, Keys: *maxKeys},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create tenant: %v", err)
+	}
+	log.Printf("created tenant %s", t.ID)
+
+	return nil
+}
+
+// list prints all tenants.
+func list(ctx context.Context, client *mongo.Client, env string) error {
+	tenants, err := tenant.List(ctx, tenant.ListParams{
+		DB:          client,
+		Environment: env,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list tenants: %v", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tMAX LINKS\tMAX KEYS\tCREATED")
+	for _, t := range tenants {
+		fmt.Fprintf(
+			tw, "%s\t%s\t%s\t%s\t%s\n",
+			t.ID, t.Name,
+			limit(t.Quotas.Links), limit(t.Quotas.Keys),
+			t.Created.UTC().Format(time.RFC3339),
+		)
+	}
+
+	return tw.Flush()
+}
+
+// limit formats a quota, where zero means no limit.
+func limit(n int64) string {
+	if n <= 0 {
+		return "-"
+	}
+
+	return strconv.FormatInt(n, 10)
+}
+
+// update updates the flags which are set on an existing tenant.
+// Quotas are replaced together.
+func update(ctx context.Context, client *mongo.Client, env string, args []string) error {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	id := fs.String("id", "", "ID of the tenant")
+	name := fs.String("name", "", "name of the tenant")
+	maxLinks := fs.Int64("max-links", 0, "maximum number of short URLs; 0 for no limit")
+	maxKeys := fs.Int64("max-keys", 0, "maximum number of API keys; 0 for no limit")
+	fs.Parse(args)
+
+	params := tenant.UpdateParams{
+		DB:          client,
+		Environment: env,
+		ID:          *id,
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "name":
+			params.Name = name
+		case "max-links", "max-keys":
+			params.Quotas = &tenant.Quotas{Links: *maxLinks, Keys: *maxKeys}
+		}
+	})
+
+	if err := tenant.Update(ctx, params); err != nil {
+		return fmt.Errorf("failed to update tenant: %v", err)
+	}
+	log.Printf("updated tenant %s", *id)
+
+	return nil
+}
@@ -6,5 +6,5 @@ require (
 	github.com/gorilla/mux v1.8.0
 	github.com/stretchr/testify v1.4.0 // indirect
 	go.mongodb.org/mongo-driver v1.3.1
-	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550 // indirect
+	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550
 )
@@ -0,0 +1,205 @@
+// Package apikey issues, revokes, and authenticates API keys, which
+// authorize callers to manage the short URLs of their tenant, and read
+// their stats.
+//
+// Keys are random, and only their SHA-256 hashes are stored; a key is
+// shown once, when it is issued. Each key carries scopes, which limit
+// the endpoints it may call.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/principal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// Collection is the MongoDB collection for Key documents.
+	Collection = "apikeys"
+
+	// keyPrefix starts every key, so that keys can be recognized;
+	// e.g., by secret scanners.
+	keyPrefix = "usk_"
+
+	// keySize is the number of random bytes in a key.
+	keySize = 32
+
+	// prefixLength is the number of characters of a key stored in
+	// the clear, to identify it in listings.
+	prefixLength = len(keyPrefix) + 8
+
+	// maxNameLength is the maximum length of a key name.
+	maxNameLength = 100
+
+	// Context timeouts for DB operations.
+	findTimeout   = 1 * time.Second
+	indexTimeout  = 30 * time.Second
+	insertTimeout = 1 * time.Second
+	updateTimeout = 1 * time.Second
+)
+
+// Scopes limit what a key may do.
+const (
+	// ScopeDomainsWrite allows listing, adding, and removing the custom
+	// domains of the key's tenant.
+	ScopeDomainsWrite = "domains:write"
+
+	// ScopeLinksWrite allows creating, updating, and deleting short
+	// URLs.
+	ScopeLinksWrite = "links:write"
+
+	// ScopeStatsRead allows reading the stats of short URLs.
+	ScopeStatsRead = "stats:read"
+)
+
+// scopes are the valid scopes.
+var scopes = map[string]bool{
+	ScopeDomainsWrite: true,
+	ScopeLinksWrite:   true,
+	ScopeStatsRead:    true,
+}
+
+var (
+	// ErrInvalidKey is returned for keys which do not exist, or have
+	// been revoked.
+	ErrInvalidKey = fmt.Errorf("invalid api key")
+
+	// ErrNotFound is returned when a key to revoke does not exist, or
+	// is already revoked.
+	ErrNotFound = fmt.Errorf("api key not found")
+)
+
+// Key represents a document storing an API key.
+type Key struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Created time.Time          `bson:"created" json:"created"`
+
+	// Name describes the key's holder or use.
+	Name string `bson:"name" json:"name"`
+
+	// Tenant is the ID of the tenant the key belongs to; empty for the
+	// default tenant. See package tenant.
+	Tenant string `bson:"tenant,omitempty" json:"tenant,omitempty"`
+
+	// Owner is the ID of the principal the key acts for; e.g., a
+	// user. Short URLs created with the key are owned by it.
+	Owner string `bson:"owner,omitempty" json:"owner,omitempty"`
+
+	// Team is the team of the owner, if any.
+	Team string `bson:"team,omitempty" json:"team,omitempty"`
+
+	// Admin is set for keys which may access every short URL of their
+	// tenant, whatever its owner.
+	Admin bool `bson:"admin,omitempty" json:"admin,omitempty"`
+
+	// Prefix is the start of the key, to identify it.
+	Prefix string `bson:"prefix" json:"prefix"`
+
+	// Hash is the hex encoded SHA-256 hash of the key.
+	Hash string `bson:"hash" json:"-"`
+
+	// Scopes are what the key may do.
+	Scopes []string `bson:"scopes" json:"scopes"`
+
+	// Revoked is when the key was revoked, if it has been.
+	Revoked *time.Time `bson:"revoked,omitempty" json:"revoked,omitempty"`
+}
+
+// Principal returns the principal the key authenticates. Keys without
+// an owner, such as those issued before ownership, act as their own
+// principal. Only admin keys may access every short URL of their
+// tenant.
+func (k Key) Principal() principal.Principal {
+	id := k.Owner
+	if id == "" {
+		id = "apikey:" + k.ID.Hex()
+	}
+
+	return principal.Principal{
+		ID:     id,
+		Tenant: k.Tenant,
+		Team:   k.Team,
+		Scopes: k.Scopes,
+		All:    k.Admin,
+	}
+}
+
+// ParseScopes returns the scopes in a comma separated list, without
+// blanks or repeats.
+func ParseScopes(s string) []string {
+	var parsed []string
+	seen := map[string]bool{}
+	for _, scope := range strings.Split(s, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope == "" || seen[scope] {
+			continue
+		}
+		seen[scope] = true
+		parsed = append(parsed, scope)
+	}
+
+	return parsed
+}
+
+// ValidateScopes returns an error if there are no scopes, or any scope
+// is unknown.
+func ValidateScopes(s []string) error {
+	if len(s) == 0 {
+		return fmt.Errorf("missing scopes")
+	}
+	for _, scope := range s {
+		if !scopes[scope] {
+			return fmt.Errorf("invalid scope %q", scope)
+		}
+	}
+
+	return nil
+}
+
+// hash returns the hex encoded SHA-256 hash of a key.
+// Keys hold 256 random bits, so a fast hash is enough to keep them from
+// being recovered from the database.
+func hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// generate returns a new random key.
+func generate() (string, error) {
+	b := make([]byte, keySize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate key: %v", err)
+	}
+
+	return keyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// EnsureIndexes creates the index keys are authenticated with, if it
+// does not exist.
+func EnsureIndexes(ctx context.Context, db *mongo.Client, env string) error {
+	indexContext, cancel := context.WithTimeout(ctx, indexTimeout)
+	defer cancel()
+
+	if _, err := db.Database(env).Collection(Collection).Indexes().CreateOne(
+		indexContext, mongo.IndexModel{
+			Keys:    bson.D{{Key: "hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	return nil
+}
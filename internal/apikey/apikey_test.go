@@ -0,0 +1,106 @@
+package apikey
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestPrincipal checks that keys act for their owner, or for
+// themselves if they have none, and that only admin keys may access the
+// short URLs of other owners.
+func TestPrincipal(t *testing.T) {
+	k := Key{
+		ID:     primitive.NewObjectID(),
+		Tenant: "acme",
+		Owner:  "ana",
+		Team:   "ads",
+		Scopes: []string{ScopeStatsRead},
+	}
+	p := k.Principal()
+	if p.ID != "ana" || p.Tenant != "acme" || p.Team != "ads" ||
+		!p.HasScope(ScopeStatsRead) || p.All {
+		t.Errorf("expected principal ana of tenant acme, team ads but got %v", p)
+	}
+
+	k.Owner, k.Team = "", ""
+	if p := k.Principal(); p.ID != "apikey:"+k.ID.Hex() || p.All {
+		t.Errorf("expected principal apikey:%s but got %v", k.ID.Hex(), p)
+	}
+	if k.Principal().CanAccess("acme", "bo", "ads") {
+		t.Errorf("expected key without an owner not to access a short url of bo")
+	}
+
+	k.Admin = true
+	if p := k.Principal(); !p.All || !p.CanAccess("acme", "bo", "ads") {
+		t.Errorf("expected admin key to access a short url of bo but got %v", p)
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	var tests = []struct {
+		Input    string
+		Expected []string
+	}{
+		{Input: "", Expected: nil},
+		{Input: "stats:read", Expected: []string{"stats:read"}},
+		{
+			Input:    " links:write, stats:read,,links:write",
+			Expected: []string{"links:write", "stats:read"},
+		},
+	}
+
+	for _, test := range tests {
+		if got := ParseScopes(test.Input); !reflect.DeepEqual(got, test.Expected) {
+			t.Errorf("%q: expected %v but got %v", test.Input, test.Expected, got)
+		}
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	var tests = []struct {
+		Scopes []string
+		Valid  bool
+	}{
+		{Scopes: []string{ScopeLinksWrite, ScopeStatsRead}, Valid: true},
+		{Scopes: []string{ScopeStatsRead}, Valid: true},
+		{Scopes: []string{ScopeDomainsWrite}, Valid: true},
+		{Scopes: nil, Valid: false},
+		{Scopes: []string{"links:read"}, Valid: false},
+		{Scopes: []string{ScopeStatsRead, "*"}, Valid: false},
+	}
+
+	for _, test := range tests {
+		if err := ValidateScopes(test.Scopes); (err == nil) != test.Valid {
+			t.Errorf("%v: expected valid %t but got error %v", test.Scopes, test.Valid, err)
+		}
+	}
+}
+
+// TestGenerate checks that keys are prefixed, distinct, and hashed
+// consistently.
+func TestGenerate(t *testing.T) {
+	a, err := generate()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	b, err := generate()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	if !strings.HasPrefix(a, keyPrefix) {
+		t.Errorf("expected key with prefix %s but got %s", keyPrefix, a)
+	}
+	if a == b {
+		t.Errorf("expected distinct keys but got %s twice", a)
+	}
+	if hash(a) != hash(a) || hash(a) == hash(b) {
+		t.Errorf("expected hashes to match keys")
+	}
+	if strings.Contains(hash(a), a[len(keyPrefix):]) {
+		t.Errorf("expected hash not to contain key")
+	}
+}
@@ -0,0 +1,64 @@
+package apikey
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AuthenticateParams struct {
+	DB          *mongo.Client
+	Environment string
+	Key         string
+}
+
+func (p AuthenticateParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+
+	return nil
+}
+
+// IsKey reports whether a token looks like an API key, rather than
+// another kind of bearer token. It does not check that the key exists.
+func IsKey(token string) bool {
+	return strings.HasPrefix(token, keyPrefix)
+}
+
+// Authenticate returns the Key document for an API key. It returns
+// ErrInvalidKey if the key does not exist, or has been revoked.
+// Keys are looked up by hash, so lookups do not depend on how much of
+// a key matches a stored one.
+func Authenticate(ctx context.Context, p AuthenticateParams) (*Key, error) {
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid params: %v", err)
+	}
+	if !IsKey(p.Key) {
+		return nil, ErrInvalidKey
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+	findContext, cancel := context.WithTimeout(ctx, findTimeout)
+	defer cancel()
+
+	var k Key
+	err := coll.FindOne(findContext, bson.M{
+		"hash":    hash(p.Key),
+		"revoked": bson.M{"$exists": false},
+	}).Decode(&k)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find: %v", err)
+	}
+
+	return &k, nil
+}
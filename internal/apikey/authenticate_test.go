@@ -0,0 +1,28 @@
+package apikey
+
+import "testing"
+
+func TestAuthenticateParamsValidate(t *testing.T) {
+	t.Skip("TODO")
+}
+
+func TestAuthenticate(t *testing.T) {
+	t.Skip("TODO")
+}
+
+func TestIsKey(t *testing.T) {
+	var tests = []struct {
+		Token    string
+		Expected bool
+	}{
+		{Token: "", Expected: false},
+		{Token: "usk_abc", Expected: true},
+		{Token: "eyJhbGciOiJSUzI1NiJ9.e30.c2ln", Expected: false},
+	}
+
+	for _, test := range tests {
+		if got := IsKey(test.Token); got != test.Expected {
+			t.Errorf("%q: expected %t but got %t", test.Token, test.Expected, got)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package apikey
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type IssueParams struct {
+	DB          *mongo.Client
+	Environment string
+
+	// Name describes the key's holder or use.
+	Name string
+
+	// Tenant is the ID of the tenant the key belongs to; empty for
+	// the default tenant.
+	Tenant string
+
+	// MaxKeys is the maximum number of keys of the tenant which are
+	// not revoked, from its quotas. Zero means no limit.
+	MaxKeys int64
+
+	// Owner is the ID of the principal the key acts for, and Team its
+	// team. Optional; a key without an owner acts for itself.
+	Owner string
+	Team  string
+
+	// Admin allows the key to access every short URL of its tenant,
+	// whatever its owner.
+	Admin bool
+
+	// Scopes are what the key may do.
+	// They should be checked with ValidateScopes.
+	Scopes []string
+}
+
+func (p IssueParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if p.Name == "" || len(p.Name) > maxNameLength {
+		return fmt.Errorf("invalid name")
+	}
+	if p.Tenant != "" {
+		if err := tenant.ValidateID(p.Tenant); err != nil {
+			return fmt.Errorf("invalid tenant: %v", err)
+		}
+	}
+	if p.MaxKeys < 0 {
+		return fmt.Errorf("invalid max keys")
+	}
+	if p.Team != "" && p.Owner == "" {
+		return fmt.Errorf("missing owner of team")
+	}
+	if err := ValidateScopes(p.Scopes); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Issue creates a new API key, and returns it with its Key document.
+// The key is not stored, and cannot be retrieved again. The key is
+// counted against the tenant's quota; Issue returns
+// tenant.ErrQuotaExceeded if the tenant has MaxKeys keys.
+func Issue(ctx context.Context, p IssueParams) (key string, k *Key, err error) {
+	if err := p.validate(); err != nil {
+		return "", nil, fmt.Errorf("invalid params: %v", err)
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+
+	key, err = generate()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := tenant.Reserve(ctx, tenant.ReserveParams{
+		DB:          p.DB,
+		Environment: p.Environment,
+		ID:          p.Tenant,
+		Resource:    tenant.ResourceKeys,
+		Limit:       p.MaxKeys,
+		Count: func(ctx context.Context) (int64, error) {
+			countContext, cancel := context.WithTimeout(ctx, findTimeout)
+			defer cancel()
+
+			return coll.CountDocuments(countContext, bson.M{
+				"tenant":  tenant.Match(p.Tenant),
+				"revoked": bson.M{"$exists": false},
+			})
+		},
+	}); err != nil {
+		return "", nil, err
+	}
+
+	k = &Key{
+		ID:      primitive.NewObjectID(),
+		Created: time.Now(),
+		Name:    p.Name,
+		Tenant:  p.Tenant,
+		Owner:   p.Owner,
+		Team:    p.Team,
+		Admin:   p.Admin,
+		Prefix:  key[:prefixLength],
+		Hash:    hash(key),
+		Scopes:  p.Scopes,
+	}
+
+	insertContext, cancel := context.WithTimeout(ctx, insertTimeout)
+	defer cancel()
+
+	if _, err := coll.InsertOne(insertContext, k); err != nil {
+		if err := tenant.Release(ctx, tenant.ReleaseParams{
+			DB:          p.DB,
+			Environment: p.Environment,
+			ID:          p.Tenant,
+			Resource:    tenant.ResourceKeys,
+		}); err != nil {
+			log.Printf("failed to release key quota: %v", err)
+		}
+		return "", nil, fmt.Errorf("failed to insert: %v", err)
+	}
+
+	return key, k, nil
+}
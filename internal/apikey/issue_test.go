@@ -0,0 +1,120 @@
+package apikey
+
+import (
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestIssueParamsValidate(t *testing.T) {
+	db := &mongo.Client{}
+	scopes := []string{ScopeLinksWrite}
+
+	var tests = []struct {
+		Name   string
+		Params IssueParams
+		Valid  bool
+	}{
+		{
+			Name: "valid",
+			Params: IssueParams{
+				DB: db, Environment: "test", Name: "ci", Scopes: scopes,
+			},
+			Valid: true,
+		},
+		{
+			Name: "tenant with quota",
+			Params: IssueParams{
+				DB: db, Environment: "test", Name: "ci", Scopes: scopes,
+				Tenant: "acme", MaxKeys: 2,
+			},
+			Valid: true,
+		},
+		{
+			Name: "owner and team",
+			Params: IssueParams{
+				DB: db, Environment: "test", Name: "ci", Scopes: scopes,
+				Owner: "alice", Team: "growth",
+			},
+			Valid: true,
+		},
+		{
+			Name: "admin",
+			Params: IssueParams{
+				DB: db, Environment: "test", Name: "ci", Scopes: scopes,
+				Admin: true,
+			},
+			Valid: true,
+		},
+		{
+			Name: "missing db",
+			Params: IssueParams{
+				Environment: "test", Name: "ci", Scopes: scopes,
+			},
+		},
+		{
+			Name: "missing env",
+			Params: IssueParams{
+				DB: db, Name: "ci", Scopes: scopes,
+			},
+		},
+		{
+			Name: "missing name",
+			Params: IssueParams{
+				DB: db, Environment: "test", Scopes: scopes,
+			},
+		},
+		{
+			Name: "long name",
+			Params: IssueParams{
+				DB: db, Environment: "test", Scopes: scopes,
+				Name: strings.Repeat("a", maxNameLength+1),
+			},
+		},
+		{
+			Name: "invalid tenant",
+			Params: IssueParams{
+				DB: db, Environment: "test", Name: "ci", Scopes: scopes,
+				Tenant: "Acme",
+			},
+		},
+		{
+			Name: "negative max keys",
+			Params: IssueParams{
+				DB: db, Environment: "test", Name: "ci", Scopes: scopes,
+				MaxKeys: -1,
+			},
+		},
+		{
+			Name: "team without owner",
+			Params: IssueParams{
+				DB: db, Environment: "test", Name: "ci", Scopes: scopes,
+				Team: "growth",
+			},
+		},
+		{
+			Name: "missing scopes",
+			Params: IssueParams{
+				DB: db, Environment: "test", Name: "ci",
+			},
+		},
+		{
+			Name: "unknown scope",
+			Params: IssueParams{
+				DB: db, Environment: "test", Name: "ci",
+				Scopes: []string{"links:read"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		if err := test.Params.validate(); (err == nil) != test.Valid {
+			t.Errorf("%s: expected valid %t but got %v", test.Name, test.Valid, err)
+		}
+	}
+}
+
+func TestIssue(t *testing.T) {
+	t.Skip("TODO")
+}
@@ -0,0 +1,52 @@
+package apikey
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ListParams struct {
+	DB          *mongo.Client
+	Environment string
+}
+
+func (p ListParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+
+	return nil
+}
+
+// List returns all API keys, including revoked keys, in the order they
+// were issued.
+func List(ctx context.Context, p ListParams) ([]Key, error) {
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid params: %v", err)
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+	findContext, cancel := context.WithTimeout(ctx, findTimeout)
+	defer cancel()
+
+	cursor, err := coll.Find(
+		findContext, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find: %v", err)
+	}
+
+	var keys []Key
+	if err := cursor.All(findContext, &keys); err != nil {
+		return nil, fmt.Errorf("failed to decode: %v", err)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,35 @@
+package apikey
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestListParamsValidate(t *testing.T) {
+	db := &mongo.Client{}
+
+	var tests = []struct {
+		Name   string
+		Params ListParams
+		Valid  bool
+	}{
+		{
+			Name:   "valid",
+			Params: ListParams{DB: db, Environment: "test"},
+			Valid:  true,
+		},
+		{Name: "missing db", Params: ListParams{Environment: "test"}},
+		{Name: "missing env", Params: ListParams{DB: db}},
+	}
+
+	for _, test := range tests {
+		if err := test.Params.validate(); (err == nil) != test.Valid {
+			t.Errorf("%s: expected valid %t but got %v", test.Name, test.Valid, err)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	t.Skip("TODO")
+}
@@ -0,0 +1,71 @@
+package apikey
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type RevokeParams struct {
+	DB          *mongo.Client
+	Environment string
+	ID          primitive.ObjectID
+}
+
+func (p RevokeParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if p.ID.IsZero() {
+		return fmt.Errorf("missing document id")
+	}
+
+	return nil
+}
+
+// Revoke revokes an API key, which is rejected from then on, and
+// releases it from its tenant's quota. The key document is kept, as a
+// record. It returns ErrNotFound if the key does not exist, or is
+// already revoked.
+func Revoke(ctx context.Context, p RevokeParams) error {
+	if err := p.validate(); err != nil {
+		return fmt.Errorf("invalid params: %v", err)
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+	updateContext, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	var k Key
+	err := coll.FindOneAndUpdate(
+		updateContext,
+		bson.M{"_id": p.ID, "revoked": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked": time.Now()}},
+	).Decode(&k)
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update: %v", err)
+	}
+
+	if err := tenant.Release(ctx, tenant.ReleaseParams{
+		DB:          p.DB,
+		Environment: p.Environment,
+		ID:          k.Tenant,
+		Resource:    tenant.ResourceKeys,
+	}); err != nil {
+		log.Printf("failed to release key quota: %v", err)
+	}
+
+	return nil
+}
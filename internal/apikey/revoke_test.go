@@ -0,0 +1,37 @@
+package apikey
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestRevokeParamsValidate(t *testing.T) {
+	db, id := &mongo.Client{}, primitive.NewObjectID()
+
+	var tests = []struct {
+		Name   string
+		Params RevokeParams
+		Valid  bool
+	}{
+		{
+			Name:   "valid",
+			Params: RevokeParams{DB: db, Environment: "test", ID: id},
+			Valid:  true,
+		},
+		{Name: "missing db", Params: RevokeParams{Environment: "test", ID: id}},
+		{Name: "missing env", Params: RevokeParams{DB: db, ID: id}},
+		{Name: "missing id", Params: RevokeParams{DB: db, Environment: "test"}},
+	}
+
+	for _, test := range tests {
+		if err := test.Params.validate(); (err == nil) != test.Valid {
+			t.Errorf("%s: expected valid %t but got %v", test.Name, test.Valid, err)
+		}
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	t.Skip("TODO")
+}
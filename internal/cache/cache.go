@@ -0,0 +1,33 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrMiss is returned when a key is not present in the cache.
+var ErrMiss = errors.New("cache miss")
+
+// Cache stores values which may be shared between service instances.
+// Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the value stored at key, or ErrMiss.
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Set stores a value at key. A ttl of zero or less stores the
+	// value without an expiry.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// IncrBy increments the integer stored at key by delta, and
+	// returns the result. A missing key is treated as zero; if the
+	// key is created by this call, it expires after ttl.
+	IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+
+	// Invalidate removes the value stored at key, and ensures that
+	// no service instance continues to serve a stale copy of it.
+	Invalidate(ctx context.Context, key string) error
+
+	// Close releases any resources held by the cache.
+	Close() error
+}
@@ -0,0 +1,192 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultMaxEntries is the number of entries a Local cache holds, if
+// not otherwise specified.
+const defaultMaxEntries = 10000
+
+// Local is an in-process Cache.
+// It is suitable for a single service instance; with several instances,
+// invalidations are not seen by other processes. Use Redis instead.
+type Local struct {
+	mu         sync.Mutex
+	entries    map[string]localEntry
+	maxEntries int
+
+	// invalidations counts the calls to Invalidate and Flush; see
+	// setUnlessInvalidated.
+	invalidations uint64
+}
+
+type localEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+func (e localEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// NewLocal returns a Local cache holding at most maxEntries values.
+// A maxEntries of zero or less uses defaultMaxEntries.
+func NewLocal(maxEntries int) *Local {
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxEntries
+	}
+
+	return &Local{
+		entries:    map[string]localEntry{},
+		maxEntries: maxEntries,
+	}
+}
+
+// Get returns the value stored at key, or ErrMiss.
+func (l *Local) Get(ctx context.Context, key string) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.entries[key]
+	if !ok {
+		return nil, ErrMiss
+	}
+	if e.expired(time.Now()) {
+		delete(l.entries, key)
+		return nil, ErrMiss
+	}
+
+	return e.value, nil
+}
+
+// Set stores a value at key.
+// If the cache is full, expired entries are removed. If it is still
+// full, an arbitrary entry is evicted to make room.
+func (l *Local) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.set(key, value, ttl)
+
+	return nil
+}
+
+// invalidated returns the number of invalidations so far, to pass to
+// setUnlessInvalidated.
+func (l *Local) invalidated() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.invalidations
+}
+
+// setUnlessInvalidated stores a value at key, unless any value has been
+// invalidated since invalidated returned n; the value may then be
+// stale. It reports whether the value was stored.
+func (l *Local) setUnlessInvalidated(key string, value []byte, ttl time.Duration, n uint64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.invalidations != n {
+		return false
+	}
+	l.set(key, value, ttl)
+
+	return true
+}
+
+// set stores a value at key. The caller must hold the lock.
+func (l *Local) set(key string, value []byte, ttl time.Duration) {
+	now := time.Now()
+
+	if _, ok := l.entries[key]; !ok && len(l.entries) >= l.maxEntries {
+		l.evict(now)
+	}
+
+	e := localEntry{value: value}
+	if ttl > 0 {
+		e.expires = now.Add(ttl)
+	}
+	l.entries[key] = e
+}
+
+// IncrBy increments the integer stored at key by delta.
+func (l *Local) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	e, ok := l.entries[key]
+	if ok && e.expired(now) {
+		ok = false
+	}
+	if !ok {
+		if len(l.entries) >= l.maxEntries {
+			l.evict(now)
+		}
+		e = localEntry{value: []byte("0")}
+		if ttl > 0 {
+			e.expires = now.Add(ttl)
+		}
+	}
+
+	n, err := strconv.ParseInt(string(e.value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("value is not an integer")
+	}
+	n += delta
+
+	e.value = []byte(strconv.FormatInt(n, 10))
+	l.entries[key] = e
+
+	return n, nil
+}
+
+// Invalidate removes the value stored at key.
+func (l *Local) Invalidate(ctx context.Context, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.entries, key)
+	l.invalidations++
+
+	return nil
+}
+
+// Flush removes all values from the cache.
+func (l *Local) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = map[string]localEntry{}
+	l.invalidations++
+}
+
+// Close is a no-op; it exists to implement Cache.
+func (l *Local) Close() error { return nil }
+
+// evict removes expired entries, or an arbitrary entry if none have
+// expired. The caller must hold the lock.
+func (l *Local) evict(now time.Time) {
+	for key, e := range l.entries {
+		if e.expired(now) {
+			delete(l.entries, key)
+		}
+	}
+	if len(l.entries) < l.maxEntries {
+		return
+	}
+
+	// Map iteration order is unspecified, which is close enough to
+	// random eviction for our purposes.
+	for key := range l.entries {
+		delete(l.entries, key)
+		return
+	}
+}
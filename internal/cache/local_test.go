@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLocal(t *testing.T) {
+	t.Run("get set", testLocalGetSet)
+	t.Run("expiry", testLocalExpiry)
+	t.Run("eviction", testLocalEviction)
+	t.Run("set unless invalidated", testLocalSetUnlessInvalidated)
+}
+
+func testLocalGetSet(t *testing.T) {
+	ctx := context.Background()
+	l := NewLocal(0)
+
+	if _, err := l.Get(ctx, "key"); err != ErrMiss {
+		t.Errorf("expected ErrMiss for missing key, but got %v", err)
+	}
+
+	l.Set(ctx, "key", []byte("value"), 0)
+	value, err := l.Get(ctx, "key")
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	if string(value) != "value" {
+		t.Errorf("expected %q but got %q", "value", value)
+	}
+
+	l.Invalidate(ctx, "key")
+	if _, err := l.Get(ctx, "key"); err != ErrMiss {
+		t.Errorf("expected ErrMiss after invalidation, but got %v", err)
+	}
+}
+
+func testLocalExpiry(t *testing.T) {
+	ctx := context.Background()
+	l := NewLocal(0)
+
+	l.Set(ctx, "key", []byte("value"), time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+
+	if _, err := l.Get(ctx, "key"); err != ErrMiss {
+		t.Errorf("expected ErrMiss for expired key, but got %v", err)
+	}
+}
+
+func testLocalEviction(t *testing.T) {
+	ctx := context.Background()
+	l := NewLocal(2)
+
+	l.Set(ctx, "a", []byte("a"), 0)
+	l.Set(ctx, "b", []byte("b"), 0)
+	l.Set(ctx, "c", []byte("c"), 0)
+
+	if n := len(l.entries); n != 2 {
+		t.Errorf("expected 2 entries but got %d", n)
+	}
+	if _, err := l.Get(ctx, "c"); err != nil {
+		t.Errorf("expected most recent entry to be kept: %v", err)
+	}
+}
+
+func TestLocalIncrBy(t *testing.T) {
+	ctx := context.Background()
+	l := NewLocal(0)
+
+	for i, expected := range []int64{1, 3, 6} {
+		n, err := l.IncrBy(ctx, "counter", int64(i+1), time.Minute)
+		if err != nil {
+			t.Fatalf("failed to increment: %v", err)
+		}
+		if n != expected {
+			t.Errorf("expected %d but got %d", expected, n)
+		}
+	}
+
+	l.Set(ctx, "text", []byte("text"), 0)
+	if _, err := l.IncrBy(ctx, "text", 1, 0); err == nil {
+		t.Error("expected error incrementing non-integer value")
+	}
+}
+
+func testLocalSetUnlessInvalidated(t *testing.T) {
+	ctx := context.Background()
+	l := NewLocal(0)
+
+	n := l.invalidated()
+	if !l.setUnlessInvalidated("key", []byte("value"), 0, n) {
+		t.Errorf("expected value to be set")
+	}
+
+	// An invalidation between reading the value and setting it.
+	n = l.invalidated()
+	l.Invalidate(ctx, "key")
+	if l.setUnlessInvalidated("key", []byte("stale"), 0, n) {
+		t.Errorf("expected value not to be set after invalidation")
+	}
+	if _, err := l.Get(ctx, "key"); err != ErrMiss {
+		t.Errorf("expected ErrMiss, but got %v", err)
+	}
+
+	n = l.invalidated()
+	l.Flush()
+	if l.setUnlessInvalidated("key", []byte("stale"), 0, n) {
+		t.Errorf("expected value not to be set after flush")
+	}
+}
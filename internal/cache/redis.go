@@ -0,0 +1,237 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/dwrz/url-shortener/pkg/resp"
+)
+
+const (
+	// invalidationChannel is the channel used to notify service
+	// instances of invalidated keys.
+	invalidationChannel = "url-shortener:invalidate"
+
+	// localTTL is the longest a value is held in the in-process cache
+	// in front of Redis. Invalidations should remove stale values
+	// well before then; this bounds staleness if a message is lost.
+	localTTL = 1 * time.Minute
+
+	// resubscribeDelay is how long to wait before resubscribing to
+	// invalidations after the subscription fails.
+	resubscribeDelay = 1 * time.Second
+)
+
+type RedisParams struct {
+	// Addr is the address of a server speaking the Redis protocol.
+	Addr string
+
+	// MaxLocalEntries is the size of the in-process cache.
+	// Zero uses the Local default.
+	MaxLocalEntries int
+}
+
+func (p RedisParams) validate() error {
+	if p.Addr == "" {
+		return fmt.Errorf("missing addr")
+	}
+
+	return nil
+}
+
+// Redis is a Cache backed by a server speaking the Redis protocol.
+// Values are also held in an in-process cache, to avoid a network round
+// trip on every Get. Invalidations are published to all instances, so
+// that every in-process cache drops stale values.
+type Redis struct {
+	client *resp.Client
+	local  *Local
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewRedis connects to the Redis server and subscribes to
+// invalidations. The subscription is maintained until the context is
+// canceled, or Close is called.
+func NewRedis(ctx context.Context, p RedisParams) (*Redis, error) {
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid params: %v", err)
+	}
+
+	client, err := resp.Dial(ctx, p.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %v", err)
+	}
+
+	// Subscribe before returning, so that no invalidation published
+	// after NewRedis returns is missed.
+	sub, err := client.Subscribe(ctx, invalidationChannel)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to subscribe: %v", err)
+	}
+
+	listenCtx, cancel := context.WithCancel(ctx)
+	r := &Redis{
+		client: client,
+		local:  NewLocal(p.MaxLocalEntries),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go r.listen(listenCtx, sub)
+
+	return r, nil
+}
+
+// Get returns the value stored at key, or ErrMiss.
+// The in-process cache is checked before Redis. Values read from Redis
+// are held in the in-process cache, unless an invalidation was received
+// while they were read, since they may then be stale.
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	if value, err := r.local.Get(ctx, key); err == nil {
+		return value, nil
+	}
+
+	invalidated := r.local.invalidated()
+	value, err := resp.Bytes(r.client.Do(ctx, "GET", key))
+	if err == resp.ErrNil {
+		return nil, ErrMiss
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get: %v", err)
+	}
+
+	r.local.setUnlessInvalidated(key, value, localTTL, invalidated)
+
+	return value, nil
+}
+
+// Set stores a value at key in Redis and the in-process cache.
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", milliseconds(ttl))
+	}
+
+	if _, err := r.client.Do(ctx, args...); err != nil {
+		return fmt.Errorf("failed to set: %v", err)
+	}
+
+	localExpiry := localTTL
+	if ttl > 0 && ttl < localExpiry {
+		localExpiry = ttl
+	}
+	r.local.Set(ctx, key, value, localExpiry)
+
+	return nil
+}
+
+// milliseconds formats a positive ttl as a number of milliseconds for
+// PX arguments. It rounds up, since Redis rejects a PX of zero.
+func milliseconds(ttl time.Duration) string {
+	ms := int64((ttl + time.Millisecond - 1) / time.Millisecond)
+
+	return strconv.FormatInt(ms, 10)
+}
+
+// IncrBy increments the integer stored at key in Redis.
+// Counters are not held in the in-process cache, since they are
+// expected to change on every call.
+// A missing key is created at zero, with its expiry, before it is
+// incremented, so that a counter never exists without one; SET with NX
+// leaves an existing key as it is, with a nil reply.
+func (r *Redis) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	if ttl > 0 {
+		if _, err := r.client.Do(
+			ctx, "SET", key, "0", "PX", milliseconds(ttl), "NX",
+		); err != nil && err != resp.ErrNil {
+			return 0, fmt.Errorf("failed to create counter: %v", err)
+		}
+	}
+
+	n, err := resp.Int64(r.client.Do(
+		ctx, "INCRBY", key, strconv.FormatInt(delta, 10),
+	))
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment: %v", err)
+	}
+
+	return n, nil
+}
+
+// Invalidate deletes the key from Redis, and publishes the key so that
+// every instance removes it from its in-process cache.
+func (r *Redis) Invalidate(ctx context.Context, key string) error {
+	r.local.Invalidate(ctx, key)
+
+	if _, err := r.client.Do(ctx, "DEL", key); err != nil {
+		return fmt.Errorf("failed to delete: %v", err)
+	}
+	if _, err := r.client.Do(ctx, "PUBLISH", invalidationChannel, key); err != nil {
+		return fmt.Errorf("failed to publish invalidation: %v", err)
+	}
+
+	return nil
+}
+
+// Close stops listening for invalidations, and closes connections to
+// Redis.
+func (r *Redis) Close() error {
+	r.cancel()
+	<-r.done
+
+	return r.client.Close()
+}
+
+// listen removes invalidated keys from the in-process cache.
+// If the subscription fails, the in-process cache is flushed -- since
+// invalidations may have been missed -- and the subscription is
+// reestablished.
+func (r *Redis) listen(ctx context.Context, sub *resp.Subscription) {
+	defer close(r.done)
+
+	for {
+		r.receive(ctx, sub)
+		r.local.Flush()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(resubscribeDelay):
+			}
+
+			var err error
+			sub, err = r.client.Subscribe(ctx, invalidationChannel)
+			if err == nil {
+				break
+			}
+			log.Printf("failed to resubscribe to invalidations: %v", err)
+		}
+
+		// Anything cached while we were resubscribing may be stale.
+		r.local.Flush()
+	}
+}
+
+// receive processes invalidations until the subscription fails, or the
+// context is canceled.
+func (r *Redis) receive(ctx context.Context, sub *resp.Subscription) {
+	defer sub.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-sub.Messages:
+			if !ok {
+				log.Println("lost subscription to invalidations")
+				return
+			}
+			r.local.Invalidate(ctx, msg.Payload)
+		}
+	}
+}
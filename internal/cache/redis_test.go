@@ -0,0 +1,166 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dwrz/url-shortener/pkg/resp/resptest"
+)
+
+func TestRedisParamsValidate(t *testing.T) {
+	if err := (RedisParams{}).validate(); err == nil {
+		t.Error("expected error for missing addr")
+	}
+	if err := (RedisParams{Addr: "localhost:6379"}).validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// TestRedisInvalidate checks that an invalidation on one instance
+// removes the value from another instance's in-process cache.
+func TestRedisInvalidate(t *testing.T) {
+	s := resptest.NewServer()
+	defer s.Close()
+
+	ctx := context.Background()
+
+	a, err := NewRedis(ctx, RedisParams{Addr: s.Addr})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	defer a.Close()
+
+	b, err := NewRedis(ctx, RedisParams{Addr: s.Addr})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	defer b.Close()
+
+	if _, err := b.Get(ctx, "key"); err != ErrMiss {
+		t.Errorf("expected ErrMiss for missing key, but got %v", err)
+	}
+
+	if err := a.Set(ctx, "key", []byte("value"), time.Minute); err != nil {
+		t.Fatalf("failed to set: %v", err)
+	}
+
+	// Load the value into b's in-process cache.
+	value, err := b.Get(ctx, "key")
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	if string(value) != "value" {
+		t.Errorf("expected %q but got %q", "value", value)
+	}
+	if _, err := b.local.Get(ctx, "key"); err != nil {
+		t.Fatalf("expected value in local cache: %v", err)
+	}
+
+	if err := a.Invalidate(ctx, "key"); err != nil {
+		t.Fatalf("failed to invalidate: %v", err)
+	}
+	if _, ok := s.Get("key"); ok {
+		t.Error("expected key to be deleted from server")
+	}
+
+	// The invalidation is delivered asynchronously.
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := b.local.Get(ctx, "key"); err == ErrMiss {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stale value was not invalidated")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := b.Get(ctx, "key"); err != ErrMiss {
+		t.Errorf("expected ErrMiss after invalidation, but got %v", err)
+	}
+}
+
+func TestRedisIncrBy(t *testing.T) {
+	s := resptest.NewServer()
+	defer s.Close()
+
+	ctx := context.Background()
+
+	r, err := NewRedis(ctx, RedisParams{Addr: s.Addr})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	defer r.Close()
+
+	for i, expected := range []int64{1, 3, 6} {
+		n, err := r.IncrBy(ctx, "counter", int64(i+1), time.Minute)
+		if err != nil {
+			t.Fatalf("failed to increment: %v", err)
+		}
+		if n != expected {
+			t.Errorf("expected %d but got %d", expected, n)
+		}
+	}
+
+	if _, err := r.IncrBy(ctx, "expiring", 1, time.Millisecond); err != nil {
+		t.Fatalf("failed to increment: %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if _, ok := s.Get("expiring"); ok {
+		t.Error("expected counter to expire")
+	}
+
+	// Later increments keep the expiry of the counter.
+	if _, err := r.IncrBy(ctx, "kept", 1, 5*time.Millisecond); err != nil {
+		t.Fatalf("failed to increment: %v", err)
+	}
+	if n, err := r.IncrBy(ctx, "kept", -1, time.Minute); err != nil || n != 0 {
+		t.Fatalf("expected 0 but got %d, %v", n, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, ok := s.Get("kept"); ok {
+		t.Error("expected counter to expire after its first ttl")
+	}
+}
+
+func TestMilliseconds(t *testing.T) {
+	var tests = []struct {
+		TTL      time.Duration
+		Expected string
+	}{
+		{TTL: time.Nanosecond, Expected: "1"},
+		{TTL: time.Millisecond, Expected: "1"},
+		{TTL: time.Millisecond + time.Microsecond, Expected: "2"},
+		{TTL: time.Minute, Expected: "60000"},
+	}
+
+	for _, test := range tests {
+		if got := milliseconds(test.TTL); got != test.Expected {
+			t.Errorf("%v: expected %q but got %q", test.TTL, test.Expected, got)
+		}
+	}
+}
+
+// TestRedisSetShortTTL checks that ttls under a millisecond are stored
+// with an expiry, rather than rejected.
+func TestRedisSetShortTTL(t *testing.T) {
+	s := resptest.NewServer()
+	defer s.Close()
+
+	ctx := context.Background()
+
+	r, err := NewRedis(ctx, RedisParams{Addr: s.Addr})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	defer r.Close()
+
+	if err := r.Set(ctx, "key", []byte("value"), time.Microsecond); err != nil {
+		t.Fatalf("failed to set: %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if _, ok := s.Get("key"); ok {
+		t.Error("expected value to expire")
+	}
+}
@@ -1,51 +1,211 @@
 package config
 
-import "os"
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
 
 const (
 	defaultEnvironment = "development"
 	defaultMongoURI    = "mongodb://localhost:27017/?readConcernLevel=majority&retryWrites=true&w=majority"
 	defaultPort        = "8080"
+	defaultURLScheme   = "https"
+
+	// defaultVisitRetentionDays is how long visit records are kept,
+	// after they have been counted in rollups. Zero keeps them
+	// indefinitely; deleting them is opt-in.
+	defaultVisitRetentionDays = 0
+)
+
+// Visit retention modes.
+const (
+	// RetentionTTL deletes visit records with a MongoDB TTL index.
+	RetentionTTL = "ttl"
+
+	// RetentionPrune deletes visit records with a periodic job, for
+	// stores without TTL indexes.
+	RetentionPrune = "prune"
 )
 
 // Config represents a service configuration.
 type Config struct {
+	// ClickIDSecret is the secret used to sign click IDs, which
+	// attribute conversions to visits. If empty, conversions are not
+	// tracked.
+	ClickIDSecret string
+
+	// Domains are the service's own domains, which short URLs without
+	// a custom domain are served from. The first is used in their
+	// absolute URLs. Optional; if empty, requests on any host which is
+	// not a custom domain are served.
+	Domains []string
+
 	// Environment is the service deployment environment.
 	Environment string
 
+	// GeoIPDB is the path to a GeoIP Country CSV database, used to
+	// resolve client IP addresses to countries. Optional.
+	GeoIPDB string
+
+	// IPHashSecret is the secret used to hash visitor IP addresses.
+	// If empty, visitor IP addresses are not hashed, and unique
+	// visitors are not counted.
+	IPHashSecret string
+
 	// MongoURI is a MongoDB URI connection string.
 	MongoURI string
 
+	// OIDCAudience is the audience OIDC tokens must be issued for.
+	// Required with OIDCJWKS.
+	OIDCAudience string
+
+	// OIDCIssuer is the issuer OIDC tokens must be issued by.
+	// Required with OIDCJWKS.
+	OIDCIssuer string
+
+	// OIDCJWKS is the path, or http(s) URL, of the JSON Web Key Set
+	// used to verify OIDC tokens. If empty, only API keys are
+	// accepted.
+	OIDCJWKS string
+
+	// OIDCOwnerClaim is the claim of OIDC tokens identifying their
+	// principal. Optional; defaults to "sub".
+	OIDCOwnerClaim string
+
+	// OIDCTeamClaim is the claim of OIDC tokens naming the team of
+	// their principal. Optional.
+	OIDCTeamClaim string
+
+	// OIDCTenantClaim is the claim of OIDC tokens naming the tenant of
+	// their principal. Optional; without it, OIDC principals belong to
+	// the default tenant.
+	OIDCTenantClaim string
+
 	// Port is the port used to listen for HTTP requests.
 	Port string
+
+	// RedisAddr is the address of a Redis server used for caching.
+	// If empty, an in-process cache is used instead.
+	RedisAddr string
+
+	// TrustedProxies are IP addresses or CIDR ranges of proxies whose
+	// X-Forwarded-For headers are trusted. Optional.
+	TrustedProxies []string
+
+	// URLScheme is the scheme of the absolute URLs of short URLs;
+	// e.g., "https".
+	URLScheme string
+
+	// VisitRetention is how long visit records are kept.
+	// Zero keeps them indefinitely.
+	VisitRetention time.Duration
+
+	// VisitRetentionMode is how visit records past retention are
+	// deleted; RetentionTTL or RetentionPrune.
+	VisitRetentionMode string
 }
 
 // New returns a service Config.
 // It will attempt to get and use the following environment variables:
+// CLICK_ID_SECRET
+// DOMAINS, as a comma separated list
 // ENV
+// GEOIP_DB
+// IP_HASH_SECRET
 // MONGO_URI
+// OIDC_AUDIENCE
+// OIDC_ISSUER
+// OIDC_JWKS
+// OIDC_OWNER_CLAIM
+// OIDC_TEAM_CLAIM
+// OIDC_TENANT_CLAIM
 // PORT
+// REDIS_ADDR
+// TRUSTED_PROXIES, as a comma separated list
+// URL_SCHEME
+// VISIT_RETENTION_DAYS, as a non-negative integer
+// VISIT_RETENTION_MODE, as "ttl" or "prune"
 // If these variables are not set, it will default to the constants
 // defined in this package.
 func New() Config {
 	return Config{
+		ClickIDSecret: os.Getenv("CLICK_ID_SECRET"),
+		Domains: func() []string {
+			if domains := os.Getenv("DOMAINS"); domains != "" {
+				return strings.Split(domains, ",")
+			}
+			return nil
+		}(),
 		Environment: func() string {
 			if env := os.Getenv("ENV"); env != "" {
 				return env
 			}
 			return defaultEnvironment
 		}(),
+		GeoIPDB:      os.Getenv("GEOIP_DB"),
+		IPHashSecret: os.Getenv("IP_HASH_SECRET"),
 		MongoURI: func() string {
 			if mongoURI := os.Getenv("MONGO_URI"); mongoURI != "" {
 				return mongoURI
 			}
 			return defaultMongoURI
 		}(),
+		OIDCAudience:    os.Getenv("OIDC_AUDIENCE"),
+		OIDCIssuer:      os.Getenv("OIDC_ISSUER"),
+		OIDCJWKS:        os.Getenv("OIDC_JWKS"),
+		OIDCOwnerClaim:  os.Getenv("OIDC_OWNER_CLAIM"),
+		OIDCTeamClaim:   os.Getenv("OIDC_TEAM_CLAIM"),
+		OIDCTenantClaim: os.Getenv("OIDC_TENANT_CLAIM"),
 		Port: func() string {
 			if port := os.Getenv("PORT"); port != "" {
 				return port
 			}
 			return defaultPort
 		}(),
+		RedisAddr: os.Getenv("REDIS_ADDR"),
+		TrustedProxies: func() []string {
+			if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+				return strings.Split(proxies, ",")
+			}
+			return nil
+		}(),
+		URLScheme: func() string {
+			if scheme := os.Getenv("URL_SCHEME"); scheme != "" {
+				return scheme
+			}
+			return defaultURLScheme
+		}(),
+		VisitRetention: func() time.Duration {
+			days := defaultVisitRetentionDays
+			if v := os.Getenv("VISIT_RETENTION_DAYS"); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 0 {
+					log.Printf(
+						"invalid VISIT_RETENTION_DAYS %q; using %d",
+						v, days,
+					)
+				} else {
+					days = n
+				}
+			}
+			return time.Duration(days) * 24 * time.Hour
+		}(),
+		VisitRetentionMode: func() string {
+			switch mode := os.Getenv("VISIT_RETENTION_MODE"); mode {
+			case "", RetentionTTL:
+				return RetentionTTL
+			case RetentionPrune:
+				return RetentionPrune
+			default:
+				log.Printf(
+					"invalid VISIT_RETENTION_MODE %q; using %s",
+					mode, RetentionTTL,
+				)
+				return RetentionTTL
+			}
+		}(),
 	}
 }
@@ -0,0 +1,157 @@
+package conversion
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// macSize is the number of bytes of the HMAC kept in a click ID.
+	macSize = 16
+
+	// idSize is the size of an ObjectID in bytes.
+	idSize = 12
+
+	// secretSize is the size of a generated secret, in bytes.
+	secretSize = 32
+
+	// tenantSeparator precedes the tenant in a click ID. It appears in
+	// neither variant names nor tenant IDs.
+	tenantSeparator = 0
+)
+
+// ErrInvalidClickID is returned for click IDs which are malformed, or
+// whose signature does not match.
+var ErrInvalidClickID = fmt.Errorf("invalid click id")
+
+// Click identifies a visit which may convert, and what it is attributed
+// to.
+type Click struct {
+	// ID identifies the click; it is also the ID of its visit
+	// record. Its timestamp is the time of the visit.
+	ID primitive.ObjectID
+
+	// ShortID is the short URL visited.
+	ShortID primitive.ObjectID
+
+	// Variant is the variant the visitor was redirected to, if any.
+	Variant string
+
+	// Tenant is the ID of the tenant of the short URL; empty for the
+	// default tenant.
+	Tenant string
+}
+
+// Signer signs and verifies click IDs.
+//
+// A click ID holds the Click itself, followed by an HMAC-SHA256 of it,
+// truncated to 16 bytes, encoded as unpadded URL-safe base64. The
+// tenant, if any, follows the variant after a tenantSeparator; click IDs
+// without one belong to the default tenant. Click IDs are
+// self-contained, so conversions can be attributed after the visit
+// record is deleted; the signature keeps them from being forged.
+// A nil Signer signs nothing, and verifies nothing.
+type Signer struct {
+	secret []byte
+}
+
+// NewSigner returns a Signer keyed with secret. If secret is empty, a
+// random secret is generated; click IDs will then be rejected by other
+// instances, and after a restart.
+func NewSigner(secret []byte) (*Signer, error) {
+	if len(secret) == 0 {
+		secret = make([]byte, secretSize)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate secret: %v", err)
+		}
+	}
+
+	return &Signer{secret: secret}, nil
+}
+
+func (s *Signer) mac(payload []byte) []byte {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write(payload)
+
+	return m.Sum(nil)[:macSize]
+}
+
+// Sign returns a click ID for c. A nil Signer returns an empty string.
+func (s *Signer) Sign(c Click) string {
+	if s == nil {
+		return ""
+	}
+
+	payload := make([]byte, 0, 2*idSize+len(c.Variant)+1+len(c.Tenant)+macSize)
+	payload = append(payload, c.ID[:]...)
+	payload = append(payload, c.ShortID[:]...)
+	payload = append(payload, c.Variant...)
+	if c.Tenant != "" {
+		payload = append(payload, tenantSeparator)
+		payload = append(payload, c.Tenant...)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(
+		append(payload, s.mac(payload)...),
+	)
+}
+
+// Verify returns the Click in a click ID, if its signature matches.
+func (s *Signer) Verify(clickID string) (c Click, err error) {
+	if s == nil {
+		return c, ErrInvalidClickID
+	}
+
+	// Strict decoding rejects unused bits in the last character, so
+	// that each Click has a single click ID.
+	b, err := base64.RawURLEncoding.Strict().DecodeString(clickID)
+	if err != nil || len(b) < 2*idSize+macSize {
+		return c, ErrInvalidClickID
+	}
+
+	payload, mac := b[:len(b)-macSize], b[len(b)-macSize:]
+	if !hmac.Equal(mac, s.mac(payload)) {
+		return c, ErrInvalidClickID
+	}
+
+	copy(c.ID[:], payload[:idSize])
+	copy(c.ShortID[:], payload[idSize:2*idSize])
+	rest := payload[2*idSize:]
+	if i := bytes.IndexByte(rest, tenantSeparator); i >= 0 {
+		c.Tenant = string(rest[i+1:])
+		rest = rest[:i]
+	}
+	c.Variant = string(rest)
+
+	return c, nil
+}
+
+// AddClickID returns the destination URL with a click ID appended to its
+// query. Existing query parameters are kept as they are. If destination
+// cannot be parsed, it is returned unchanged.
+func AddClickID(destination, clickID string) string {
+	if clickID == "" {
+		return destination
+	}
+
+	u, err := url.Parse(destination)
+	if err != nil {
+		return destination
+	}
+
+	param := ClickIDParam + "=" + url.QueryEscape(clickID)
+	if u.RawQuery == "" {
+		u.RawQuery = param
+	} else {
+		u.RawQuery += "&" + param
+	}
+
+	return u.String()
+}
@@ -0,0 +1,98 @@
+package conversion
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestSigner checks that signed click IDs verify to the signed Click,
+// and that tampered, truncated, and foreign click IDs do not.
+func TestSigner(t *testing.T) {
+	s, err := NewSigner([]byte("secret"))
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	other, err := NewSigner(nil)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+
+	for _, c := range []Click{
+		{ID: primitive.NewObjectID(), ShortID: primitive.NewObjectID()},
+		{ID: primitive.NewObjectID(), ShortID: primitive.NewObjectID(), Variant: "b"},
+		{ID: primitive.NewObjectID(), ShortID: primitive.NewObjectID(), Tenant: "acme"},
+		{ID: primitive.NewObjectID(), ShortID: primitive.NewObjectID(), Variant: "b", Tenant: "acme"},
+	} {
+		id := s.Sign(c)
+		got, err := s.Verify(id)
+		if err != nil {
+			t.Errorf("%v: failed to verify: %v", c, err)
+		} else if got != c {
+			t.Errorf("expected %v but got %v", c, got)
+		}
+
+		if _, err := other.Verify(id); err != ErrInvalidClickID {
+			t.Errorf("%v: expected foreign click id to be rejected", c)
+		}
+
+		// Change the last character of the MAC, and the first of
+		// the payload.
+		for _, i := range []int{0, len(id) - 1} {
+			b := []byte(id)
+			if b[i] == 'A' {
+				b[i] = 'B'
+			} else {
+				b[i] = 'A'
+			}
+			if _, err := s.Verify(string(b)); err != ErrInvalidClickID {
+				t.Errorf("%q: expected tampered click id to be rejected", b)
+			}
+		}
+
+		if _, err := s.Verify(id[:len(id)/2]); err != ErrInvalidClickID {
+			t.Errorf("%v: expected truncated click id to be rejected", c)
+		}
+	}
+
+	for _, id := range []string{"", "not base64!"} {
+		if _, err := s.Verify(id); err != ErrInvalidClickID {
+			t.Errorf("%q: expected click id to be rejected", id)
+		}
+	}
+
+	var nilSigner *Signer
+	if id := nilSigner.Sign(Click{}); id != "" {
+		t.Errorf("expected nil signer to sign nothing, but got %q", id)
+	}
+}
+
+func TestAddClickID(t *testing.T) {
+	var tests = []struct {
+		Destination string
+		ClickID     string
+		Expected    string
+	}{
+		{
+			Destination: "https://example.com/",
+			ClickID:     "abc",
+			Expected:    "https://example.com/?clickId=abc",
+		},
+		{
+			Destination: "https://example.com/a?b=c+d&e=f#g",
+			ClickID:     "a-b_c",
+			Expected:    "https://example.com/a?b=c+d&e=f&clickId=a-b_c#g",
+		},
+		{
+			Destination: "https://example.com/",
+			ClickID:     "",
+			Expected:    "https://example.com/",
+		},
+	}
+
+	for _, test := range tests {
+		if got := AddClickID(test.Destination, test.ClickID); got != test.Expected {
+			t.Errorf("expected %q but got %q", test.Expected, got)
+		}
+	}
+}
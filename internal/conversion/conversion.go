@@ -0,0 +1,279 @@
+// Package conversion attributes conversions, such as sign-ups, to the
+// visits of short URLs which led to them.
+//
+// When a short URL tracks conversions, its redirects append a signed
+// click ID to the destination. The destination's backend reports a
+// conversion with the click ID and an event name, and the conversion is
+// attributed to the short URL and variant in the click ID.
+package conversion
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// Collection is the MongoDB collection for Conversion documents.
+	// Conversions are kept indefinitely.
+	Collection = "conversions"
+
+	// ClickIDParam is the query parameter holding the click ID in
+	// destination URLs.
+	ClickIDParam = "clickId"
+
+	// maxEventLength is the maximum length of an event name.
+	maxEventLength = 64
+
+	// Context timeouts for DB operations.
+	aggregateTimeout = 2 * time.Second
+	indexTimeout     = 30 * time.Second
+	updateTimeout    = 1 * time.Second
+
+	// duplicateKeyCode is the MongoDB error code for duplicate keys.
+	duplicateKeyCode = 11000
+)
+
+// Conversion represents a document storing a conversion of a visit.
+type Conversion struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty"`
+	ClickID primitive.ObjectID `bson:"clickId"`
+	ShortID primitive.ObjectID `bson:"shortId"`
+	Tenant  string             `bson:"tenant,omitempty"`
+	Variant string             `bson:"variant,omitempty"`
+	Event   string             `bson:"event"`
+	Time    time.Time          `bson:"time"`
+}
+
+// ValidateEvent returns an error if the event name is invalid.
+// Event names are limited to lowercase letters, digits, "-", "_", and
+// ".".
+func ValidateEvent(event string) error {
+	if event == "" || len(event) > maxEventLength {
+		return fmt.Errorf("invalid event length")
+	}
+	for _, c := range event {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.':
+		default:
+			return fmt.Errorf("invalid event %q", event)
+		}
+	}
+
+	return nil
+}
+
+// EnsureIndexes creates the indexes conversions are recorded and counted
+// with, if they do not exist. Each click converts at most once per
+// event.
+func EnsureIndexes(ctx context.Context, db *mongo.Client, env string) error {
+	indexContext, cancel := context.WithTimeout(ctx, indexTimeout)
+	defer cancel()
+
+	if _, err := db.Database(env).Collection(Collection).Indexes().CreateMany(
+		indexContext, []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "tenant", Value: 1},
+					{Key: "clickId", Value: 1},
+					{Key: "event", Value: 1},
+				},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{
+					{Key: "tenant", Value: 1},
+					{Key: "shortId", Value: 1},
+					{Key: "time", Value: 1},
+				},
+			},
+		},
+	); err != nil {
+		return fmt.Errorf("failed to create indexes: %v", err)
+	}
+
+	return nil
+}
+
+type RecordParams struct {
+	DB          *mongo.Client
+	Environment string
+	Tenant      string
+	Click       Click
+	Event       string
+
+	// Time is when the conversion occurred. Optional; defaults to
+	// now.
+	Time time.Time
+}
+
+func (p RecordParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if p.Click.ID.IsZero() || p.Click.ShortID.IsZero() {
+		return fmt.Errorf("missing click")
+	}
+	if err := ValidateEvent(p.Event); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Record records a conversion of a click, and reports whether it is new.
+// Recording the same event for a click again has no effect, so callers
+// may safely retry.
+func Record(ctx context.Context, p RecordParams) (bool, error) {
+	if err := p.validate(); err != nil {
+		return false, fmt.Errorf("invalid params: %v", err)
+	}
+
+	if p.Time.IsZero() {
+		p.Time = time.Now()
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+	updateContext, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	res, err := coll.UpdateOne(
+		updateContext,
+		bson.M{
+			"tenant":  tenant.Match(p.Tenant),
+			"clickId": p.Click.ID,
+			"event":   p.Event,
+		},
+		bson.M{"$setOnInsert": Conversion{
+			ClickID: p.Click.ID,
+			ShortID: p.Click.ShortID,
+			Tenant:  p.Tenant,
+			Variant: p.Click.Variant,
+			Event:   p.Event,
+			Time:    p.Time,
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if isDuplicateKey(err) {
+		// A concurrent request recorded the conversion first.
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to record conversion: %v", err)
+	}
+
+	return res.UpsertedCount > 0, nil
+}
+
+// isDuplicateKey reports whether err is a duplicate key error.
+func isDuplicateKey(err error) bool {
+	switch e := err.(type) {
+	case mongo.WriteException:
+		for _, we := range e.WriteErrors {
+			if we.Code == duplicateKeyCode {
+				return true
+			}
+		}
+	case mongo.CommandError:
+		return e.Code == duplicateKeyCode
+	}
+
+	return false
+}
+
+// Counts maps events to the count of conversions by variant. Conversions
+// without a variant are counted under an empty variant.
+type Counts map[string]map[string]int
+
+type CountParams struct {
+	DB          *mongo.Client
+	Environment string
+	Tenant      string
+	ShortID     primitive.ObjectID
+
+	// From and To restrict the conversions counted to those which
+	// occurred in the range; From inclusive, and To exclusive. Either
+	// may be zero for no bound.
+	From time.Time
+	To   time.Time
+}
+
+func (p CountParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if len(p.ShortID) == 0 {
+		return fmt.Errorf("missing document id")
+	}
+
+	return nil
+}
+
+// Count counts the conversions of a short URL by event and variant.
+func Count(ctx context.Context, p CountParams) (Counts, error) {
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid params: %v", err)
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+
+	match := bson.M{"tenant": tenant.Match(p.Tenant), "shortId": p.ShortID}
+	t := bson.M{}
+	if !p.From.IsZero() {
+		t["$gte"] = p.From
+	}
+	if !p.To.IsZero() {
+		t["$lt"] = p.To
+	}
+	if len(t) > 0 {
+		match["time"] = t
+	}
+
+	aggregateContext, cancel := context.WithTimeout(ctx, aggregateTimeout)
+	defer cancel()
+
+	cursor, err := coll.Aggregate(aggregateContext, []bson.M{
+		{"$match": match},
+		{"$group": bson.M{
+			"_id":   bson.M{"event": "$event", "variant": "$variant"},
+			"count": bson.M{"$sum": 1},
+		}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate conversions: %v", err)
+	}
+
+	var res []struct {
+		ID struct {
+			Event   string `bson:"event"`
+			Variant string `bson:"variant"`
+		} `bson:"_id"`
+		Count int `bson:"count"`
+	}
+	if err := cursor.All(aggregateContext, &res); err != nil {
+		return nil, fmt.Errorf("failed to decode conversions: %v", err)
+	}
+
+	counts := Counts{}
+	for _, r := range res {
+		if counts[r.ID.Event] == nil {
+			counts[r.ID.Event] = map[string]int{}
+		}
+		counts[r.ID.Event][r.ID.Variant] += r.Count
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,43 @@
+package conversion
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateEvent(t *testing.T) {
+	var tests = []struct {
+		Event string
+		Valid bool
+	}{
+		{Event: "signup", Valid: true},
+		{Event: "checkout.complete", Valid: true},
+		{Event: "step_2-done", Valid: true},
+		{Event: "", Valid: false},
+		{Event: "SignUp", Valid: false},
+		{Event: "sign up", Valid: false},
+		{Event: strings.Repeat("a", maxEventLength+1), Valid: false},
+	}
+
+	for _, test := range tests {
+		if err := ValidateEvent(test.Event); (err == nil) != test.Valid {
+			t.Errorf("%q: expected valid %t but got error %v", test.Event, test.Valid, err)
+		}
+	}
+}
+
+func TestRecordParamsValidate(t *testing.T) {
+	t.Skip("TODO")
+}
+
+func TestRecord(t *testing.T) {
+	t.Skip("TODO")
+}
+
+func TestCountParamsValidate(t *testing.T) {
+	t.Skip("TODO")
+}
+
+func TestCount(t *testing.T) {
+	t.Skip("TODO")
+}
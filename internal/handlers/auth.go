@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/dwrz/url-shortener/internal/apikey"
+	"github.com/dwrz/url-shortener/internal/oidc"
+	"github.com/dwrz/url-shortener/internal/principal"
+	"github.com/dwrz/url-shortener/internal/shorturl"
+	"github.com/gorilla/mux"
+)
+
+// requiredScope returns the API key scope required for a request to a
+// route, by the route's path template and the request method, or an
+// empty string for public routes. Redirects, previews, conversion
+// reports, and the status check are public.
+func requiredScope(template, method string) string {
+	switch template {
+	case pathDomains, pathDomain:
+		return apikey.ScopeDomainsWrite
+	case pathCreate:
+		if method == http.MethodPost {
+			return apikey.ScopeLinksWrite
+		}
+	case pathRedirect:
+		if method == http.MethodPatch || method == http.MethodDelete {
+			return apikey.ScopeLinksWrite
+		}
+	case pathDashboard, pathDashboardLive, pathDashboardExport,
+		pathStats, pathStatsTimeSeries, pathStatsBreakdown,
+		pathStatsLive, pathStatsExport:
+		return apikey.ScopeStatsRead
+	}
+
+	return ""
+}
+
+// bearerToken returns the token in a request's "Authorization: Bearer"
+// header, or an empty string if there is none.
+func bearerToken(r *http.Request) string {
+	const scheme = "bearer "
+
+	v := r.Header.Get("Authorization")
+	if len(v) < len(scheme) || !strings.EqualFold(v[:len(scheme)], scheme) {
+		return ""
+	}
+
+	return strings.TrimSpace(v[len(scheme):])
+}
+
+// authenticate is middleware which requires an API key, or an OIDC
+// token, carrying the scope of the matched route, in an
+// "Authorization: Bearer" header. Requests without valid credentials
+// receive a 401 Unauthorized response; requests whose credentials lack
+// the scope receive a 403 Forbidden response. The principal the
+// credentials act for is added to the request context; see
+// principal.FromContext.
+func (h handler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var scope string
+		if route := mux.CurrentRoute(r); route != nil {
+			template, err := route.GetPathTemplate()
+			if err == nil {
+				scope = requiredScope(template, r.Method)
+			}
+		}
+		if scope == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := bearerToken(r)
+		if token == "" {
+			unauthorized(w)
+			return
+		}
+
+		p, err := h.principal(r, token)
+		if err == apikey.ErrInvalidKey || err == oidc.ErrInvalidToken {
+			unauthorized(w)
+			return
+		}
+		if err != nil {
+			log.Printf("failed to authenticate: %v", err)
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+
+		if !p.HasScope(scope) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(principal.NewContext(r.Context(), p)))
+	})
+}
+
+// principal returns the principal a bearer token acts for. Tokens are
+// authenticated as OIDC tokens, if configured, unless they are API
+// keys.
+func (h handler) principal(r *http.Request, token string) (*principal.Principal, error) {
+	if h.tokens != nil && !apikey.IsKey(token) {
+		return h.tokens.Authenticate(r.Context(), token)
+	}
+
+	k, err := apikey.Authenticate(r.Context(), apikey.AuthenticateParams{
+		DB:          h.db,
+		Environment: h.environment,
+		Key:         token,
+	})
+	if err != nil {
+		return nil, err
+	}
+	p := k.Principal()
+
+	return &p, nil
+}
+
+// unauthorized responds to a request without valid credentials.
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="url-shortener"`)
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
+
+// canAccess reports whether the principal of a request may manage, and
+// read the stats of, a short URL. Requests without a principal may not.
+// Callers should respond as if the short URL did not exist if not, so
+// that the short codes of others are not revealed.
+func canAccess(r *http.Request, s *shorturl.ShortURL) bool {
+	p := principal.FromContext(r.Context())
+
+	return p != nil && p.CanAccess(s.Tenant, s.Owner, s.Team)
+}
+
+// getAccessible retrieves the short URL in the request path, on the
+// domain of the request, if the principal of the request may access it.
+// Short URLs are only retrieved from the principal's tenant. Otherwise,
+// it responds with a 404 Not Found status, whether or not the short URL
+// exists, or, if it cannot be retrieved, a 500 status, and returns nil.
+func (h handler) getAccessible(w http.ResponseWriter, r *http.Request) *shorturl.ShortURL {
+	p := principal.FromContext(r.Context())
+	if p == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return nil
+	}
+
+	domain, _, err := h.domain(r)
+	if err != nil {
+		domainError(w, err)
+		return nil
+	}
+
+	s, err := shorturl.Get(r.Context(), shorturl.GetParams{
+		Cache:       h.cache,
+		DB:          h.db,
+		Environment: h.environment,
+		Tenant:      &p.Tenant,
+		Domain:      domain,
+		Short:       mux.Vars(r)["short"],
+	})
+	if err == shorturl.ErrNotFound {
+		http.Error(w, "not found", http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		log.Printf("failed to get short url: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return nil
+	}
+	if !canAccess(r, s) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return nil
+	}
+
+	return s
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/apikey"
+	"github.com/dwrz/url-shortener/internal/cache"
+	"github.com/dwrz/url-shortener/internal/oidc"
+	"github.com/dwrz/url-shortener/internal/principal"
+	"github.com/dwrz/url-shortener/internal/shorturl"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestRequiredScope(t *testing.T) {
+	var tests = []struct {
+		Template string
+		Method   string
+		Expected string
+	}{
+		{Template: pathStatus, Method: http.MethodGet, Expected: ""},
+		{Template: pathCreate, Method: http.MethodPost, Expected: apikey.ScopeLinksWrite},
+		{Template: pathDomains, Method: http.MethodGet, Expected: apikey.ScopeDomainsWrite},
+		{Template: pathDomains, Method: http.MethodPost, Expected: apikey.ScopeDomainsWrite},
+		{Template: pathDomain, Method: http.MethodDelete, Expected: apikey.ScopeDomainsWrite},
+		{Template: pathRedirect, Method: http.MethodGet, Expected: ""},
+		{Template: pathRedirect, Method: http.MethodPost, Expected: ""},
+		{Template: pathRedirect, Method: http.MethodPatch, Expected: apikey.ScopeLinksWrite},
+		{Template: pathRedirect, Method: http.MethodDelete, Expected: apikey.ScopeLinksWrite},
+		{Template: pathPreview, Method: http.MethodGet, Expected: ""},
+		{Template: pathConversions, Method: http.MethodPost, Expected: ""},
+		{Template: pathDashboard, Method: http.MethodGet, Expected: apikey.ScopeStatsRead},
+		{Template: pathStats, Method: http.MethodGet, Expected: apikey.ScopeStatsRead},
+		{Template: pathStatsExport, Method: http.MethodGet, Expected: apikey.ScopeStatsRead},
+	}
+
+	for _, test := range tests {
+		if got := requiredScope(test.Template, test.Method); got != test.Expected {
+			t.Errorf(
+				"%s %s: expected scope %q but got %q",
+				test.Method, test.Template, test.Expected, got,
+			)
+		}
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	var tests = []struct {
+		Header   string
+		Expected string
+	}{
+		{Header: "", Expected: ""},
+		{Header: "Bearer usk_abc", Expected: "usk_abc"},
+		{Header: "bearer  usk_abc ", Expected: "usk_abc"},
+		{Header: "Basic dXNlcjpwYXNz", Expected: ""},
+		{Header: "Bearer", Expected: ""},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.Header != "" {
+			r.Header.Set("Authorization", test.Header)
+		}
+		if got := bearerToken(r); got != test.Expected {
+			t.Errorf("%q: expected %q but got %q", test.Header, test.Expected, got)
+		}
+	}
+}
+
+// TestAuthenticate checks that requests to protected routes without an
+// API key are rejected, and that public routes are served.
+func TestAuthenticate(t *testing.T) {
+	// The status count is not checked, so the client need not connect.
+	client, err := mongo.NewClient(options.Client())
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	router := mux.NewRouter()
+	if err := AddRoutes(AddRoutesParams{
+		Cache:       cache.NewLocal(0),
+		DB:          client,
+		Environment: "test",
+		Router:      router,
+	}); err != nil {
+		t.Fatalf("failed to add routes: %v", err)
+	}
+
+	var tests = []struct {
+		Method   string
+		Path     string
+		Header   string
+		Expected int
+	}{
+		{Method: http.MethodGet, Path: "/?stats=true", Expected: http.StatusOK},
+		{Method: http.MethodPost, Path: "/", Expected: http.StatusUnauthorized},
+		{Method: http.MethodPatch, Path: "/abc123", Expected: http.StatusUnauthorized},
+		{Method: http.MethodDelete, Path: "/abc123", Expected: http.StatusUnauthorized},
+		{Method: http.MethodGet, Path: "/abc123/stats", Expected: http.StatusUnauthorized},
+		{Method: http.MethodGet, Path: "/stats", Expected: http.StatusUnauthorized},
+		{
+			Method:   http.MethodGet,
+			Path:     "/stats",
+			Header:   "Bearer not-a-key",
+			Expected: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(test.Method, test.Path, nil)
+		if test.Header != "" {
+			r.Header.Set("Authorization", test.Header)
+		}
+		router.ServeHTTP(w, r)
+
+		if w.Code != test.Expected {
+			t.Errorf(
+				"%s %s: expected status %d but got %d",
+				test.Method, test.Path, test.Expected, w.Code,
+			)
+		}
+		if w.Code == http.StatusUnauthorized &&
+			w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s %s: missing WWW-Authenticate header", test.Method, test.Path)
+		}
+	}
+}
+
+// TestAuthenticateOIDC checks that OIDC tokens are verified, and that
+// their scopes are required.
+func TestAuthenticateOIDC(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	jwks := fmt.Sprintf(
+		`{"keys": [{"kty": "EC", "kid": "test", "crv": "P-256", "x": %q, "y": %q}]}`,
+		base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+		base64.RawURLEncoding.EncodeToString(key.Y.Bytes()),
+	)
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(jwks)) },
+	))
+	defer server.Close()
+
+	tokens, err := oidc.New(context.Background(), oidc.Params{
+		JWKS:     server.URL,
+		Issuer:   "https://issuer.example.com",
+		Audience: "url-shortener",
+	})
+	if err != nil {
+		t.Fatalf("failed to create authenticator: %v", err)
+	}
+
+	// sign returns a token for ana with the scope, signed by signer.
+	sign := func(signer *ecdsa.PrivateKey, scope string) string {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"iss":   "https://issuer.example.com",
+			"aud":   "url-shortener",
+			"sub":   "ana",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"scope": scope,
+		})
+		signed := base64.RawURLEncoding.EncodeToString(
+			[]byte(`{"alg":"ES256","kid":"test"}`),
+		) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+		digest := sha256.Sum256([]byte(signed))
+		r, s, err := ecdsa.Sign(rand.Reader, signer, digest[:])
+		if err != nil {
+			t.Fatalf("failed to sign: %v", err)
+		}
+		sig := make([]byte, 64)
+		copy(sig[32-len(r.Bytes()):32], r.Bytes())
+		copy(sig[64-len(s.Bytes()):], s.Bytes())
+
+		return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+	}
+
+	router := mux.NewRouter()
+	if err := AddRoutes(AddRoutesParams{
+		Cache:       cache.NewLocal(0),
+		DB:          &mongo.Client{},
+		Environment: "test",
+		Router:      router,
+		Tokens:      tokens,
+	}); err != nil {
+		t.Fatalf("failed to add routes: %v", err)
+	}
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	var tests = []struct {
+		Name     string
+		Method   string
+		Path     string
+		Token    string
+		Expected int
+	}{
+		{
+			Name:     "missing scope",
+			Method:   http.MethodPatch,
+			Path:     "/abc123",
+			Token:    sign(key, "openid stats:read"),
+			Expected: http.StatusForbidden,
+		},
+		{
+			Name:     "missing scope",
+			Method:   http.MethodGet,
+			Path:     "/stats",
+			Token:    sign(key, "links:write"),
+			Expected: http.StatusForbidden,
+		},
+		{
+			Name:     "wrong key",
+			Method:   http.MethodGet,
+			Path:     "/stats",
+			Token:    sign(other, "stats:read"),
+			Expected: http.StatusUnauthorized,
+		},
+		{
+			Name:     "malformed",
+			Method:   http.MethodGet,
+			Path:     "/stats",
+			Token:    "not-a-token",
+			Expected: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(test.Method, test.Path, nil)
+		r.Header.Set("Authorization", "Bearer "+test.Token)
+		router.ServeHTTP(w, r)
+
+		if w.Code != test.Expected {
+			t.Errorf(
+				"%s: %s %s: expected status %d but got %d",
+				test.Name, test.Method, test.Path, test.Expected, w.Code,
+			)
+		}
+	}
+}
+
+func TestCanAccess(t *testing.T) {
+	s := &shorturl.ShortURL{Tenant: "acme", Owner: "ana", Team: "ads"}
+
+	var tests = []struct {
+		Principal *principal.Principal
+		Expected  bool
+	}{
+		{Principal: nil, Expected: false},
+		{Principal: &principal.Principal{ID: "ana", Tenant: "acme"}, Expected: true},
+		{Principal: &principal.Principal{ID: "bo", Tenant: "acme", Team: "ads"}, Expected: true},
+		{Principal: &principal.Principal{ID: "bo", Tenant: "acme", Team: "web"}, Expected: false},
+		{Principal: &principal.Principal{ID: "bo", Tenant: "acme"}, Expected: false},
+		{Principal: &principal.Principal{ID: "ana"}, Expected: false},
+		{Principal: &principal.Principal{ID: "ana", Tenant: "init", Team: "ads"}, Expected: false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/abc123/stats", nil)
+		if test.Principal != nil {
+			r = r.WithContext(principal.NewContext(r.Context(), test.Principal))
+		}
+		if got := canAccess(r, s); got != test.Expected {
+			t.Errorf("%v: expected %t but got %t", test.Principal, test.Expected, got)
+		}
+	}
+}
+
+// TestCreateWithoutPrincipal checks that short URLs are not created
+// without an owner.
+func TestCreateWithoutPrincipal(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(
+		http.MethodPost, "/", strings.NewReader("url=https%3A%2F%2Fexample.com%2F"),
+	)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	handler{}.Create(w, r)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d but got %d", http.StatusUnauthorized, w.Code)
+	}
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/dwrz/url-shortener/pkg/useragent"
+)
+
+// isBot reports whether a request is likely from an automated client,
+// rather than a person following a link. Besides known bot User-Agent
+// strings, HEAD requests and speculative prefetches and previews are
+// treated as bots, since no one has followed the link yet.
+func isBot(r *http.Request) bool {
+	if r.Method == http.MethodHead {
+		return true
+	}
+
+	for _, header := range []string{"Purpose", "Sec-Purpose", "X-Purpose", "X-Moz"} {
+		v := strings.ToLower(r.Header.Get(header))
+		if strings.Contains(v, "prefetch") || strings.Contains(v, "preview") {
+			return true
+		}
+	}
+
+	return useragent.IsBot(r.UserAgent())
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const browserUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:74.0) Gecko/20100101 Firefox/74.0"
+
+// TestIsBot checks the request heuristics for bots.
+func TestIsBot(t *testing.T) {
+	var tests = []struct {
+		Name     string
+		Method   string
+		Header   http.Header
+		Expected bool
+	}{
+		{Name: "browser", Method: http.MethodGet, Expected: false},
+		{Name: "head", Method: http.MethodHead, Expected: true},
+		{
+			Name:     "chrome prefetch",
+			Method:   http.MethodGet,
+			Header:   http.Header{"Sec-Purpose": {"prefetch;prerender"}},
+			Expected: true,
+		},
+		{
+			Name:     "firefox prefetch",
+			Method:   http.MethodGet,
+			Header:   http.Header{"X-Moz": {"prefetch"}},
+			Expected: true,
+		},
+		{
+			Name:     "safari preview",
+			Method:   http.MethodGet,
+			Header:   http.Header{"X-Purpose": {"preview"}},
+			Expected: true,
+		},
+		{
+			Name:     "crawler",
+			Method:   http.MethodGet,
+			Header:   http.Header{"User-Agent": {"Twitterbot/1.0"}},
+			Expected: true,
+		},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(test.Method, "/abc", nil)
+		r.Header.Set("User-Agent", browserUserAgent)
+		for k, v := range test.Header {
+			r.Header[k] = v
+		}
+
+		if got := isBot(r); got != test.Expected {
+			t.Errorf("%s: expected %t but got %t", test.Name, test.Expected, got)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// headerForwardedFor is the header proxies use to identify the clients
+// they forward requests for.
+const headerForwardedFor = "X-Forwarded-For"
+
+// ParseTrustedProxies parses a list of IP addresses and CIDR ranges,
+// identifying proxies whose X-Forwarded-For headers may be trusted.
+func ParseTrustedProxies(values []string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip %q", v)
+			}
+			bits := 8 * len(ip.To4())
+			if bits == 0 {
+				bits = 8 * net.IPv6len
+			}
+			proxies = append(proxies, &net.IPNet{
+				IP: ip, Mask: net.CIDRMask(bits, bits),
+			})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q", v)
+		}
+		proxies = append(proxies, network)
+	}
+
+	return proxies, nil
+}
+
+// clientIP returns the IP address of the client that made the request.
+// If the request came from a trusted proxy, the X-Forwarded-For header
+// is read from right to left, skipping trusted proxies, and the first
+// untrusted address is returned. Addresses appended by untrusted hops
+// may be spoofed, and are never used.
+func (h handler) clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil
+	}
+
+	if !h.trusted(ip) {
+		return ip
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values(headerForwardedFor) {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !h.trusted(ip) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// trusted reports whether the IP address belongs to a trusted proxy.
+func (h handler) trusted(ip net.IP) bool {
+	for _, network := range h.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{
+		"10.0.0.0/8", " 192.0.2.1 ", "", "2001:db8::1",
+	})
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if len(proxies) != 3 {
+		t.Errorf("expected 3 proxies but got %d", len(proxies))
+	}
+
+	for _, invalid := range []string{"10.0.0.0/33", "proxy"} {
+		if _, err := ParseTrustedProxies([]string{invalid}); err == nil {
+			t.Errorf("expected error parsing %q", invalid)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	h := handler{trustedProxies: proxies}
+
+	var tests = []struct {
+		Name       string
+		RemoteAddr string
+		Forwarded  []string
+		Expected   string
+	}{
+		{
+			Name:       "direct",
+			RemoteAddr: "192.0.2.1:1234",
+			Expected:   "192.0.2.1",
+		},
+		{
+			Name:       "untrusted forwarded",
+			RemoteAddr: "192.0.2.1:1234",
+			Forwarded:  []string{"198.51.100.1"},
+			Expected:   "192.0.2.1",
+		},
+		{
+			Name:       "trusted proxy",
+			RemoteAddr: "10.0.0.1:1234",
+			Forwarded:  []string{"198.51.100.1"},
+			Expected:   "198.51.100.1",
+		},
+		{
+			Name:       "spoofed hop",
+			RemoteAddr: "10.0.0.1:1234",
+			Forwarded:  []string{"203.0.113.1, 198.51.100.1, 10.0.0.2"},
+			Expected:   "198.51.100.1",
+		},
+		{
+			Name:       "multiple headers",
+			RemoteAddr: "10.0.0.1:1234",
+			Forwarded:  []string{"198.51.100.1", "10.0.0.2"},
+			Expected:   "198.51.100.1",
+		},
+		{
+			Name:       "invalid hop",
+			RemoteAddr: "10.0.0.1:1234",
+			Forwarded:  []string{"unknown, 10.0.0.2"},
+			Expected:   "10.0.0.2",
+		},
+		{
+			Name:       "all trusted",
+			RemoteAddr: "10.0.0.1:1234",
+			Forwarded:  []string{"10.0.0.3, 10.0.0.2"},
+			Expected:   "10.0.0.3",
+		},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.RemoteAddr
+		for _, v := range test.Forwarded {
+			r.Header.Add(headerForwardedFor, v)
+		}
+
+		if got := h.clientIP(r).String(); got != test.Expected {
+			t.Errorf(
+				"%s: expected %s but got %s",
+				test.Name, test.Expected, got,
+			)
+		}
+	}
+}
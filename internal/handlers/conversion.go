@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/dwrz/url-shortener/internal/conversion"
+)
+
+// Conversion records a conversion reported by the backend of a short
+// URL's destination. It expects an application/x-www-form-urlencoded
+// body, with the click ID appended to the destination as "clickId", and
+// the name of the event, such as "signup", as "event". Event names are
+// limited to lowercase letters, digits, "-", "_", and ".".
+// The conversion is attributed to the tenant, short URL, and variant in
+// the click ID. It responds with 201 Created for a new conversion, and
+// with 200 OK if the event was already recorded for the click, so that
+// reports may be retried.
+func (h handler) Conversion(w http.ResponseWriter, r *http.Request) {
+	if h.clickIDs == nil {
+		http.Error(w, "conversions unavailable", http.StatusNotImplemented)
+		return
+	}
+
+	click, err := h.clickIDs.Verify(r.FormValue(conversion.ClickIDParam))
+	if err != nil {
+		http.Error(w, "invalid click id", http.StatusBadRequest)
+		return
+	}
+
+	event := r.FormValue("event")
+	if err := conversion.ValidateEvent(event); err != nil {
+		http.Error(w, "invalid event", http.StatusBadRequest)
+		return
+	}
+
+	created, err := conversion.Record(r.Context(), conversion.RecordParams{
+		DB:          h.db,
+		Environment: h.environment,
+		Tenant:      click.Tenant,
+		Click:       click,
+		Event:       event,
+	})
+	if err != nil {
+		log.Printf("failed to record conversion: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	if created {
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
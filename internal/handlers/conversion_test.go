@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dwrz/url-shortener/internal/conversion"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestConversion checks that invalid reports are rejected before the
+// database is queried.
+func TestConversion(t *testing.T) {
+	signer, err := conversion.NewSigner([]byte("secret"))
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	clickID := signer.Sign(conversion.Click{
+		ID:      primitive.NewObjectID(),
+		ShortID: primitive.NewObjectID(),
+	})
+
+	var tests = []struct {
+		Signer   *conversion.Signer
+		Form     url.Values
+		Expected int
+	}{
+		{
+			Signer:   nil,
+			Form:     url.Values{"clickId": {clickID}, "event": {"signup"}},
+			Expected: http.StatusNotImplemented,
+		},
+		{
+			Signer:   signer,
+			Form:     url.Values{"event": {"signup"}},
+			Expected: http.StatusBadRequest,
+		},
+		{
+			Signer:   signer,
+			Form:     url.Values{"clickId": {clickID + "A"}, "event": {"signup"}},
+			Expected: http.StatusBadRequest,
+		},
+		{
+			Signer:   signer,
+			Form:     url.Values{"clickId": {clickID}},
+			Expected: http.StatusBadRequest,
+		},
+		{
+			Signer:   signer,
+			Form:     url.Values{"clickId": {clickID}, "event": {"Sign Up"}},
+			Expected: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(
+			http.MethodPost, "/conversions",
+			strings.NewReader(test.Form.Encode()),
+		)
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		handler{clickIDs: test.Signer}.Conversion(w, r)
+
+		if w.Code != test.Expected {
+			t.Errorf("%v: expected status %d but got %d", test.Form, test.Expected, w.Code)
+		}
+	}
+}
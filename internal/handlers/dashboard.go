@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/dwrz/url-shortener/internal/principal"
+	"github.com/dwrz/url-shortener/internal/shorturl"
+	"github.com/dwrz/url-shortener/internal/visit"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// dashboardLink is a short URL ranked by visits in a dashboard.
+type dashboardLink struct {
+	Short    string `json:"short"`
+	ShortURL string `json:"shortUrl"`
+	Title    string `json:"title,omitempty"`
+	Visits   int    `json:"visits"`
+}
+
+// Dashboard gets stats across the short URLs the principal may access:
+// their visits and the short URLs created per UTC day, and the short
+// URLs with the most visits. It responds with an application/json encoded
+// visit.Dashboard, whose top short URLs are identified by short string.
+// The following query parameters are optional: "days", the number of
+// days covered, ending today, from 1 to 365, defaulting to 30; "top",
+// the number of short URLs ranked; and "includeBots", as for Stats.
+func (h handler) Dashboard(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	days := visit.DefaultDashboardDays
+	if v := q.Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > visit.MaxDashboardDays {
+			http.Error(w, "invalid days", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	top := visit.DefaultTop
+	if v := q.Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > visit.MaxTop {
+			http.Error(w, "invalid top", http.StatusBadRequest)
+			return
+		}
+		top = n
+	}
+
+	// Cover the short URLs the principal may access: all of those of
+	// its tenant, from the rollups for the tenant, or its own.
+	viewer := principal.FromContext(r.Context())
+	if viewer == nil {
+		unauthorized(w)
+		return
+	}
+	params := visit.GetDashboardParams{
+		DB:          h.db,
+		Environment: h.environment,
+		Tenant:      viewer.Tenant,
+		URLs:        shorturl.Collection,
+		Days:        days,
+		Top:         top,
+		IncludeBots: q.Get("includeBots") == "true",
+		All:         viewer.All,
+	}
+	if !viewer.All {
+		accessible, err := shorturl.GetShorts(r.Context(), shorturl.GetShortsParams{
+			DB:          h.db,
+			Environment: h.environment,
+			Tenant:      viewer.Tenant,
+			Principal:   viewer,
+		})
+		if err != nil {
+			log.Printf("failed to get short urls for dashboard: %v", err)
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		for id := range accessible {
+			params.ShortIDs = append(params.ShortIDs, id)
+		}
+	}
+
+	d, err := visit.GetDashboard(r.Context(), params)
+	if err != nil {
+		log.Printf("failed to get dashboard: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Identify the top short URLs by their short strings.
+	var ids []primitive.ObjectID
+	for _, link := range d.Top {
+		ids = append(ids, link.ShortID)
+	}
+	shorts, err := shorturl.GetByIDs(r.Context(), shorturl.GetByIDsParams{
+		DB:          h.db,
+		Environment: h.environment,
+		Tenant:      viewer.Tenant,
+		IDs:         ids,
+	})
+	if err != nil {
+		log.Printf("failed to get top short urls: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	links := []dashboardLink{}
+	for _, link := range d.Top {
+		s, ok := shorts[link.ShortID]
+		if !ok {
+			continue
+		}
+		links = append(links, dashboardLink{
+			Short:    s.Short,
+			ShortURL: h.absoluteURL(r, s.Domain, s.Short),
+			Title:    s.Title,
+			Visits:   link.Visits,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(struct {
+		visit.Dashboard
+		Top []dashboardLink `json:"top"`
+	}{d, links}); err != nil {
+		log.Printf("failed to json encode dashboard: %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestDashboard checks that invalid queries are rejected before the
+// database is queried.
+func TestDashboard(t *testing.T) {
+	var tests = []string{
+		"days=0",
+		"days=366",
+		"days=week",
+		"top=0",
+		"top=1000",
+	}
+
+	for _, query := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/stats?"+query, nil)
+		handler{}.Dashboard(w, r)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status %d but got %d", query, http.StatusBadRequest, w.Code)
+		}
+	}
+}
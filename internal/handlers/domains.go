@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/dwrz/url-shortener/internal/principal"
+	"github.com/dwrz/url-shortener/internal/tenant"
+	"github.com/gorilla/mux"
+)
+
+// Domains lists the custom domains of the principal's tenant, as an
+// application/json encoded array.
+func (h handler) Domains(w http.ResponseWriter, r *http.Request) {
+	p := principal.FromContext(r.Context())
+	if p == nil {
+		unauthorized(w)
+		return
+	}
+
+	domains, err := tenant.ListDomains(r.Context(), tenant.ListDomainsParams{
+		DB:          h.db,
+		Environment: h.environment,
+		Tenant:      p.Tenant,
+	})
+	if err != nil {
+		log.Printf("failed to list domains: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(domains); err != nil {
+		log.Printf("failed to json encode domains: %v", err)
+	}
+}
+
+// AddDomain adds a custom domain to the principal's tenant. It expects
+// the domain in an application/x-www-form-urlencoded body, as "domain";
+// e.g., "go.example.com". The domain should already resolve to the
+// service. Domains taken by any tenant, or by the service itself,
+// receive a 409 Conflict response. It responds with the domain as JSON.
+func (h handler) AddDomain(w http.ResponseWriter, r *http.Request) {
+	p := principal.FromContext(r.Context())
+	if p == nil {
+		unauthorized(w)
+		return
+	}
+
+	name := r.FormValue("domain")
+	if err := tenant.ValidateDomain(name); err != nil {
+		http.Error(w, "invalid domain", http.StatusBadRequest)
+		return
+	}
+	if h.isOwnDomain(name) {
+		http.Error(w, "domain taken", http.StatusConflict)
+		return
+	}
+
+	// Principals of tenants which do not exist may not add domains.
+	if _, err := tenant.Get(r.Context(), tenant.GetParams{
+		DB:          h.db,
+		Environment: h.environment,
+		ID:          p.Tenant,
+	}); err == tenant.ErrNotFound {
+		http.Error(w, "unknown tenant", http.StatusForbidden)
+		return
+	} else if err != nil {
+		log.Printf("failed to get tenant: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	d, err := tenant.AddDomain(r.Context(), tenant.AddDomainParams{
+		DB:          h.db,
+		Environment: h.environment,
+		Tenant:      p.Tenant,
+		Name:        name,
+	})
+	if err == tenant.ErrExists {
+		http.Error(w, "domain taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("failed to add domain: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	h.refreshDomains()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(d); err != nil {
+		log.Printf("failed to json encode domain: %v", err)
+	}
+}
+
+// RemoveDomain removes a custom domain of the principal's tenant.
+// Short URLs created on it are no longer served, until it is added
+// again. Domains of other tenants receive a 404 Not Found response.
+func (h handler) RemoveDomain(w http.ResponseWriter, r *http.Request) {
+	p := principal.FromContext(r.Context())
+	if p == nil {
+		unauthorized(w)
+		return
+	}
+
+	err := tenant.RemoveDomain(r.Context(), tenant.RemoveDomainParams{
+		DB:          h.db,
+		Environment: h.environment,
+		Tenant:      p.Tenant,
+		Name:        mux.Vars(r)["domain"],
+	})
+	if err == tenant.ErrDomainNotFound {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("failed to remove domain: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	h.refreshDomains()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// refreshDomains causes this instance to resolve changed custom domains
+// on its next request. Other instances resolve them within a minute.
+func (h handler) refreshDomains() {
+	if h.tenants != nil {
+		h.tenants.Refresh()
+	}
+}
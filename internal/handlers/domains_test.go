@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dwrz/url-shortener/internal/principal"
+)
+
+// TestAddDomainInvalid checks that invalid domains, and the service's
+// own domains, are not added to tenants.
+func TestAddDomainInvalid(t *testing.T) {
+	h := handler{domains: []string{"ourco.link"}}
+
+	var tests = []struct {
+		Domain   string
+		Expected int
+	}{
+		{Domain: "", Expected: http.StatusBadRequest},
+		{Domain: "localhost", Expected: http.StatusBadRequest},
+		{Domain: "go.example.com:8080", Expected: http.StatusBadRequest},
+		{Domain: "192.0.2.1", Expected: http.StatusBadRequest},
+		{Domain: "ourco.link", Expected: http.StatusConflict},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		body := url.Values{"domain": {test.Domain}}.Encode()
+		r := httptest.NewRequest(http.MethodPost, "/domains", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r = r.WithContext(principal.NewContext(
+			r.Context(), &principal.Principal{ID: "ana"},
+		))
+		h.AddDomain(w, r)
+
+		if w.Code != test.Expected {
+			t.Errorf("%q: expected status %d but got %d", test.Domain, test.Expected, w.Code)
+		}
+	}
+}
+
+func TestAddDomain(t *testing.T) {
+	t.Skip("TODO")
+}
+
+func TestRemoveDomain(t *testing.T) {
+	t.Skip("TODO")
+}
@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/principal"
+	"github.com/dwrz/url-shortener/internal/shorturl"
+	"github.com/dwrz/url-shortener/internal/visit"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Export formats.
+const (
+	formatCSV    = "csv"
+	formatNDJSON = "ndjson"
+)
+
+// Export row types.
+const (
+	rowsVisits  = "visits"
+	rowsBuckets = "buckets"
+)
+
+// visitColumns maps the columns of exported visits to their values.
+// The short string of the visited short URL is passed in, since visits
+// only hold its ID.
+var visitColumns = map[string]func(v visit.Visit, short string) interface{}{
+	"time":      func(v visit.Visit, short string) interface{} { return v.Time },
+	"short":     func(v visit.Visit, short string) interface{} { return short },
+	"target":    func(v visit.Visit, short string) interface{} { return v.Target },
+	"variant":   func(v visit.Visit, short string) interface{} { return v.Variant },
+	"country":   func(v visit.Visit, short string) interface{} { return v.Country },
+	"referrer":  func(v visit.Visit, short string) interface{} { return v.Referrer },
+	"browser":   func(v visit.Visit, short string) interface{} { return v.Browser },
+	"os":        func(v visit.Visit, short string) interface{} { return v.OS },
+	"device":    func(v visit.Visit, short string) interface{} { return v.Device },
+	"language":  func(v visit.Visit, short string) interface{} { return v.Language },
+	"userAgent": func(v visit.Visit, short string) interface{} { return v.UserAgent },
+	"bot":       func(v visit.Visit, short string) interface{} { return v.Bot },
+}
+
+// defaultVisitColumns are the columns of exported visits, if none are
+// requested. The user agent is left out, since it is long.
+var defaultVisitColumns = []string{
+	"time", "short", "target", "variant", "country", "referrer",
+	"browser", "os", "device", "language", "bot",
+}
+
+// bucketColumns maps the columns of exported buckets to their values.
+var bucketColumns = map[string]func(b visit.Bucket) interface{}{
+	"start": func(b visit.Bucket) interface{} { return b.Start },
+	"count": func(b visit.Bucket) interface{} { return b.Count },
+}
+
+var defaultBucketColumns = []string{"start", "count"}
+
+// queryColumns returns the columns in the comma separated "columns"
+// query parameter, or the default columns if it is empty. Each column
+// must be a key of valid.
+func queryColumns(r *http.Request, valid map[string]bool, defaults []string) ([]string, error) {
+	v := r.URL.Query().Get("columns")
+	if v == "" {
+		return defaults, nil
+	}
+
+	var columns []string
+	seen := map[string]bool{}
+	for _, c := range strings.Split(v, ",") {
+		c = strings.TrimSpace(c)
+		if !valid[c] {
+			return nil, fmt.Errorf("invalid column %q", c)
+		}
+		if seen[c] {
+			return nil, fmt.Errorf("repeated column %q", c)
+		}
+		seen[c] = true
+		columns = append(columns, c)
+	}
+
+	return columns, nil
+}
+
+// rowWriter writes exported rows.
+type rowWriter interface {
+	// Header writes the names of the columns, if the format has a
+	// header.
+	Header(columns []string) error
+
+	// Row writes the values of a row, in the order of the columns.
+	Row(values []interface{}) error
+
+	// Flush writes any buffered rows.
+	Flush() error
+}
+
+// csvWriter writes rows as CSV, with a header.
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c csvWriter) Header(columns []string) error {
+	return c.w.Write(columns)
+}
+
+func (c csvWriter) Row(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = csvValue(v)
+	}
+
+	return c.w.Write(record)
+}
+
+func (c csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// csvValue formats a value for a CSV cell. Times are RFC 3339 in UTC.
+// Text starting with a character spreadsheets read as a formula is
+// prefixed with a quote, so that it is shown as text.
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			return "'" + v
+		}
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// ndjsonWriter writes rows as newline delimited JSON objects, with the
+// columns as keys, in order.
+type ndjsonWriter struct {
+	w       *bufio.Writer
+	columns []string
+}
+
+func (n *ndjsonWriter) Header(columns []string) error {
+	n.columns = columns
+	return nil
+}
+
+func (n *ndjsonWriter) Row(values []interface{}) error {
+	n.w.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			n.w.WriteByte(',')
+		}
+		key, err := json.Marshal(n.columns[i])
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		n.w.Write(key)
+		n.w.WriteByte(':')
+		n.w.Write(value)
+	}
+	// Errors writing out the buffer are kept, and returned by every
+	// later write.
+	_, err := n.w.WriteString("}\n")
+	return err
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return n.w.Flush()
+}
+
+// newRowWriter returns a rowWriter for the format, writing to w.
+func newRowWriter(format string, w io.Writer) rowWriter {
+	if format == formatNDJSON {
+		return &ndjsonWriter{w: bufio.NewWriter(w)}
+	}
+
+	return csvWriter{w: csv.NewWriter(w)}
+}
+
+// StatsExport streams the visits to a short URL, the short URLs with a
+// tag, or all short URLs the principal may access, as CSV or newline
+// delimited JSON, for use in spreadsheets and other tools. Without a
+// short URL in the path, the "tag" query parameter selects the short
+// URLs; without a tag, all are exported.
+// The following query parameters are optional:
+// "format" is "csv" (the default), or "ndjson";
+// "rows" is "visits" (the default), for a row per visit, or "buckets",
+// for a row per bucket of time, as for StatsTimeSeries;
+// "columns" is a comma separated list of the columns to export;
+// "from", "to", and "tz" are as for StatsTimeSeries, with the range
+// defaulting to the last 30 days; "interval" is as for
+// StatsTimeSeries, for buckets. The filters accepted by Stats apply.
+// Visits are only exported within the retention window.
+func (h handler) StatsExport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	format := q.Get("format")
+	switch format {
+	case "":
+		format = formatCSV
+	case formatCSV, formatNDJSON:
+	default:
+		http.Error(w, "invalid format", http.StatusBadRequest)
+		return
+	}
+
+	rows := q.Get("rows")
+	switch rows {
+	case "":
+		rows = rowsVisits
+	case rowsVisits, rowsBuckets:
+	default:
+		http.Error(w, "invalid rows", http.StatusBadRequest)
+		return
+	}
+
+	valid := map[string]bool{}
+	defaults := defaultVisitColumns
+	if rows == rowsBuckets {
+		for c := range bucketColumns {
+			valid[c] = true
+		}
+		defaults = defaultBucketColumns
+	} else {
+		for c := range visitColumns {
+			valid[c] = true
+		}
+	}
+	columns, err := queryColumns(r, valid, defaults)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	interval := visit.Day
+	if v := q.Get("interval"); v != "" {
+		if interval, err = visit.ParseInterval(v); err != nil {
+			http.Error(w, "invalid interval", http.StatusBadRequest)
+			return
+		}
+	}
+
+	loc, err := queryLocation(r)
+	if err != nil {
+		http.Error(w, "invalid tz", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	rg, err := queryRange(r, now, loc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if rg == nil {
+		rg = &visit.Range{From: visit.Day.DefaultSpan(now), To: now}
+	}
+
+	// Reject ranges with too many buckets before querying.
+	if rows == rowsBuckets {
+		if _, err := visit.Buckets(*rg, interval, loc, nil); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	tag := q.Get("tag")
+	if tag != "" {
+		if err := shorturl.ValidateTag(tag); err != nil {
+			http.Error(w, "invalid tag", http.StatusBadRequest)
+			return
+		}
+	}
+
+	params := visit.ExportParams{
+		DB:          h.db,
+		Environment: h.environment,
+		Range:       *rg,
+		Filter:      visit.FilterFromQuery(q),
+	}
+	viewer := principal.FromContext(r.Context())
+	if viewer == nil {
+		unauthorized(w)
+		return
+	}
+	params.Tenant = viewer.Tenant
+
+	// Select the short URLs to export, of those the principal may
+	// access, and name the export after them.
+	var (
+		name   string
+		shorts map[primitive.ObjectID]string
+	)
+	if short := mux.Vars(r)["short"]; short != "" {
+		s := h.getAccessible(w, r)
+		if s == nil {
+			return
+		}
+		name = s.Short
+		shorts = map[primitive.ObjectID]string{s.ID: s.Short}
+	} else {
+		name = "all"
+		if tag != "" {
+			name = tag
+		}
+		shorts, err = shorturl.GetShorts(r.Context(), shorturl.GetShortsParams{
+			DB:          h.db,
+			Environment: h.environment,
+			Tenant:      viewer.Tenant,
+			Tag:         tag,
+			Principal:   viewer,
+		})
+		if err != nil {
+			log.Printf("failed to get short urls for export: %v", err)
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	for id := range shorts {
+		params.ShortIDs = append(params.ShortIDs, id)
+	}
+
+	// Count buckets before responding, so that errors are reported.
+	var buckets []visit.Bucket
+	if rows == rowsBuckets {
+		if buckets, err = visit.ExportBuckets(
+			r.Context(), params, interval, loc,
+		); err != nil {
+			log.Printf("failed to export buckets: %v", err)
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == formatNDJSON {
+		contentType = "application/x-ndjson"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(
+		"attachment; filename=%q", name+"-"+rows+"."+format,
+	))
+
+	rw := newRowWriter(format, w)
+	if err := rw.Header(columns); err != nil {
+		log.Printf("failed to write export: %v", err)
+		return
+	}
+
+	values := make([]interface{}, len(columns))
+	if rows == rowsBuckets {
+		for _, b := range buckets {
+			for i, c := range columns {
+				values[i] = bucketColumns[c](b)
+			}
+			if err := rw.Row(values); err != nil {
+				log.Printf("failed to write export: %v", err)
+				return
+			}
+		}
+	} else {
+		// Visits are streamed; an error ends the response early.
+		if err := visit.ExportVisits(r.Context(), params, func(v visit.Visit) error {
+			for i, c := range columns {
+				values[i] = visitColumns[c](v, shorts[v.ShortID])
+			}
+			return rw.Row(values)
+		}); err != nil {
+			log.Printf("failed to export visits: %v", err)
+			return
+		}
+	}
+
+	if err := rw.Flush(); err != nil {
+		log.Printf("failed to write export: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestStatsExport checks that invalid queries are rejected before the
+// database is queried.
+func TestStatsExport(t *testing.T) {
+	var tests = []string{
+		"format=xlsx",
+		"rows=links",
+		"columns=time,ipHash",
+		"columns=time,time",
+		"rows=buckets&columns=country",
+		"rows=buckets&interval=minute",
+		"rows=buckets&interval=hour&from=2000-01-01",
+		"tz=Nowhere/Special",
+		"from=2020-03-02&to=2020-03-01",
+		"tag=Not%20A%20Tag",
+	}
+
+	for _, query := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/stats/export?"+query, nil)
+		handler{}.StatsExport(w, r)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status %d but got %d", query, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestQueryColumns(t *testing.T) {
+	valid := map[string]bool{"start": true, "count": true}
+	defaults := []string{"start", "count"}
+
+	r := httptest.NewRequest(http.MethodGet, "/?columns=count,%20start", nil)
+	columns, err := queryColumns(r, valid, defaults)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"count", "start"}; !reflect.DeepEqual(columns, expected) {
+		t.Errorf("expected %v but got %v", expected, columns)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	if columns, _ := queryColumns(r, valid, defaults); !reflect.DeepEqual(columns, defaults) {
+		t.Errorf("expected %v but got %v", defaults, columns)
+	}
+}
+
+// TestRowWriters checks the output of each format.
+func TestRowWriters(t *testing.T) {
+	columns := []string{"time", "referrer", "count", "bot"}
+	values := []interface{}{
+		time.Date(2020, 3, 29, 1, 41, 16, 0, time.UTC),
+		"=cmd()",
+		3,
+		true,
+	}
+
+	var tests = []struct {
+		Format   string
+		Expected string
+	}{
+		{
+			Format:   formatCSV,
+			Expected: "time,referrer,count,bot\n2020-03-29T01:41:16Z,'=cmd(),3,true\n",
+		},
+		{
+			Format:   formatNDJSON,
+			Expected: `{"time":"2020-03-29T01:41:16Z","referrer":"=cmd()","count":3,"bot":true}` + "\n",
+		},
+	}
+
+	for _, test := range tests {
+		var b bytes.Buffer
+		rw := newRowWriter(test.Format, &b)
+		if err := rw.Header(columns); err != nil {
+			t.Fatalf("%s: failed to write header: %v", test.Format, err)
+		}
+		if err := rw.Row(values); err != nil {
+			t.Fatalf("%s: failed to write row: %v", test.Format, err)
+		}
+		if err := rw.Flush(); err != nil {
+			t.Fatalf("%s: failed to flush: %v", test.Format, err)
+		}
+
+		if got := b.String(); got != test.Expected {
+			t.Errorf("%s: expected %q but got %q", test.Format, test.Expected, got)
+		}
+	}
+}
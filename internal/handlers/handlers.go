@@ -2,34 +2,125 @@ package handlers
 
 import (
 	"encoding/json"
+	"github.com/dwrz/url-shortener/internal/cache"
+	"github.com/dwrz/url-shortener/internal/conversion"
+	"github.com/dwrz/url-shortener/internal/live"
+	"github.com/dwrz/url-shortener/internal/oidc"
+	"github.com/dwrz/url-shortener/internal/principal"
 	"github.com/dwrz/url-shortener/internal/shorturl"
+	"github.com/dwrz/url-shortener/internal/tenant"
 	"github.com/dwrz/url-shortener/internal/validurl"
 	"github.com/dwrz/url-shortener/internal/visit"
-	"github.com/gorilla/mux"
+	"github.com/dwrz/url-shortener/pkg/geoip"
+	"github.com/dwrz/url-shortener/pkg/iphash"
+	"github.com/dwrz/url-shortener/pkg/language"
+	"github.com/dwrz/url-shortener/pkg/useragent"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// maxTitleLength is the maximum length of a short URL title.
+const maxTitleLength = 200
+
 // handler is used to store values needed by methods implementing the
 // net/http Handler interface for this service.
 type handler struct {
+	// cache is used to avoid DB queries when retrieving short URLs.
+	cache cache.Cache
+
+	// clickIDs signs the click IDs of short URLs which track
+	// conversions. If nil, click IDs are not added to redirects.
+	clickIDs *conversion.Signer
+
 	// db is the client handlers should inject for MongoDB queries.
 	db *mongo.Client
 
+	// domains are the service's own domains. The first is used in the
+	// absolute URLs of short URLs without a custom domain.
+	// If empty, every host which is not a custom domain is the
+	// service's own.
+	domains []string
+
 	// environment is the service environment handlers should operate
 	// in; e.g., "development", "staging", or "production".
 	// This value determines which database to use for MongoDB.
 	// It should originate from the service configuration.
 	environment string
+
+	// geoip resolves client IP addresses to countries.
+	// If nil, countries are not resolved.
+	geoip *geoip.DB
+
+	// ipHasher pseudonymizes client IP addresses in visit records.
+	// If nil, visit records omit the IP hash, and unique visitors are
+	// not counted.
+	ipHasher *iphash.Hasher
+
+	// live broadcasts recorded visits to live stats streams.
+	// If nil, visits are not broadcast.
+	live *live.Hub
+
+	// tenants resolves the custom domains of tenants.
+	// If nil, all requests are on the service's own domain.
+	tenants *tenant.Resolver
+
+	// tokens authenticates OIDC bearer tokens.
+	// If nil, only API keys are accepted.
+	tokens *oidc.Authenticator
+
+	// trustedProxies are the networks whose X-Forwarded-For headers
+	// are trusted when determining the client IP address.
+	trustedProxies []*net.IPNet
+
+	// urlScheme is the scheme of the absolute URLs of short URLs.
+	// If empty, "https" is used.
+	urlScheme string
 }
 
 // Create handlers requests to create a new short URL.
 // It expects a long URL in an application/x-www-form-urlencoded body,
 // with the field for the long URL as "url".
-// It returns the short code for the URL in a response body.
+// The following optional fields limit the lifetime of the short URL:
+// "expiresAt", an RFC 3339 timestamp; "maxVisits", a positive integer;
+// and "fallbackUrl", where visitors are sent once either limit is
+// reached. The optional "activeFrom" and "activeUntil" RFC 3339
+// timestamps limit when the short URL redirects; "pendingUrl" is where
+// visitors are sent before then. An optional "targets" field holds a
+// JSON array of shorturl.Target, redirecting visitors by device,
+// country, or language. An optional "variants" field holds a JSON
+// array of shorturl.Variant, splitting other visitors between several
+// URLs; "sticky" set to "true" keeps returning visitors on the same
+// variant. An optional "password" field, of up to 72 bytes, protects the
+// short URL.
+// An optional "title" describes the short URL in previews; setting
+// "interstitial" to "true" shows visitors a preview page before
+// redirecting them, for "interstitialDelay" seconds. An optional
+// "tags" field holds a comma separated list of tags, to group short
+// URLs in exports. Setting "trackConversions" to "true" appends a
+// signed click ID to each redirect; see Conversion.
+// The short URL is owned by the principal of the request, its tenant,
+// and its team, and is created on the domain of the request: a custom
+// domain of the tenant, or the service's own domain. Requests on the
+// custom domain of another tenant, and requests from tenants which have
+// reached their quota of short URLs, receive a 403 Forbidden response;
+// requests on unknown hosts receive a 421 Misdirected Request response.
+// It returns the short code for the URL in a response body, and its
+// absolute URL, on its domain, in the Location header.
 func (h handler) Create(w http.ResponseWriter, r *http.Request) {
+	// The short URL is owned by the principal creating it.
+	p := principal.FromContext(r.Context())
+	if p == nil {
+		unauthorized(w)
+		return
+	}
+
 	longURL := r.FormValue("url")
 
 	// Validate the URL.
@@ -38,92 +129,538 @@ func (h handler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Validate the optional expiry settings.
+	expiresAt, err := formTime(r, "expiresAt")
+	if err != nil || (expiresAt != nil && !expiresAt.After(time.Now())) {
+		http.Error(w, "invalid expiresAt", http.StatusBadRequest)
+		return
+	}
+
+	var maxVisits int64
+	if v := r.FormValue("maxVisits"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid maxVisits", http.StatusBadRequest)
+			return
+		}
+		maxVisits = n
+	}
+
+	fallbackURL := r.FormValue("fallbackUrl")
+	if fallbackURL != "" {
+		if err := validurl.Validate(fallbackURL); err != nil {
+			http.Error(w, "invalid fallbackUrl", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate the optional activation window.
+	activeFrom, err := formTime(r, "activeFrom")
+	if err != nil {
+		http.Error(w, "invalid activeFrom", http.StatusBadRequest)
+		return
+	}
+
+	activeUntil, err := formTime(r, "activeUntil")
+	if err != nil || (activeUntil != nil && !activeUntil.After(time.Now())) ||
+		(activeUntil != nil && activeFrom != nil &&
+			!activeUntil.After(*activeFrom)) {
+		http.Error(w, "invalid activeUntil", http.StatusBadRequest)
+		return
+	}
+
+	pendingURL := r.FormValue("pendingUrl")
+	if pendingURL != "" {
+		if err := validurl.Validate(pendingURL); err != nil {
+			http.Error(w, "invalid pendingUrl", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate the optional preview settings.
+	title := r.FormValue("title")
+	if len(title) > maxTitleLength {
+		http.Error(w, "invalid title", http.StatusBadRequest)
+		return
+	}
+
+	var interstitialDelay int
+	if v := r.FormValue("interstitialDelay"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > shorturl.MaxInterstitialDelay {
+			http.Error(
+				w, "invalid interstitialDelay",
+				http.StatusBadRequest,
+			)
+			return
+		}
+		interstitialDelay = n
+	}
+
+	// Validate the optional targets.
+	var targets []shorturl.Target
+	if v := r.FormValue("targets"); v != "" {
+		if err := json.Unmarshal([]byte(v), &targets); err != nil {
+			http.Error(w, "invalid targets", http.StatusBadRequest)
+			return
+		}
+		if err := shorturl.ValidateTargets(targets); err != nil {
+			http.Error(w, "invalid targets", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate the optional tags.
+	tags := shorturl.ParseTags(r.FormValue("tags"))
+	if err := shorturl.ValidateTags(tags); err != nil {
+		http.Error(w, "invalid tags", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the optional variants.
+	var variants []shorturl.Variant
+	if v := r.FormValue("variants"); v != "" {
+		if err := json.Unmarshal([]byte(v), &variants); err != nil {
+			http.Error(w, "invalid variants", http.StatusBadRequest)
+			return
+		}
+		if err := shorturl.ValidateVariants(variants); err != nil {
+			http.Error(w, "invalid variants", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate the optional password.
+	password := r.FormValue("password")
+	if err := shorturl.ValidatePassword(password); err != nil {
+		http.Error(w, "invalid password", http.StatusBadRequest)
+		return
+	}
+
+	// Create the short URL on the domain of the request, if it is the
+	// custom domain of the principal's tenant, and within its quota.
+	domain, owner, err := h.domain(r)
+	if err != nil {
+		domainError(w, err)
+		return
+	}
+	if domain != "" && owner != p.Tenant {
+		http.Error(w, "invalid domain", http.StatusForbidden)
+		return
+	}
+	maxLinks, ok := h.linkQuota(w, r, p.Tenant)
+	if !ok {
+		return
+	}
+
 	// Generate the short URL and create a DB document.
 	short, err := shorturl.Create(r.Context(), shorturl.CreateParams{
 		DB:          h.db,
 		Environment: h.environment,
+		Tenant:      p.Tenant,
+		Domain:      domain,
+		MaxLinks:    maxLinks,
 		LongURL:     longURL,
+		Owner:       p.ID,
+		Team:        p.Team,
+		Title:       title,
+		Tags:        tags,
+		ExpiresAt:   expiresAt,
+		MaxVisits:   maxVisits,
+		FallbackURL: fallbackURL,
+		ActiveFrom:  activeFrom,
+		ActiveUntil: activeUntil,
+		PendingURL:  pendingURL,
+		Targets:     targets,
+		Variants:    variants,
+		Sticky:      r.FormValue("sticky") == "true",
+		Password:    password,
+
+		Interstitial:      r.FormValue("interstitial") == "true",
+		InterstitialDelay: interstitialDelay,
+		TrackConversions:  r.FormValue("trackConversions") == "true",
 	})
+	if err == tenant.ErrQuotaExceeded {
+		http.Error(w, "link quota exceeded", http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		log.Printf("failed to create short url: %v", err)
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
 
-	// Respond with the short URL id.
+	// Count the short URL in the dashboard. It is already created, so
+	// failures are only logged.
+	if err := visit.AddCreated(r.Context(), visit.AddCreatedParams{
+		DB:          h.db,
+		Environment: h.environment,
+		Tenant:      p.Tenant,
+		Time:        time.Now(),
+	}); err != nil {
+		log.Printf("failed to count created short url: %v", err)
+	}
+
+	// Respond with the short URL id, and its absolute URL.
+	w.Header().Set("Location", h.absoluteURL(r, domain, short))
 	w.WriteHeader(http.StatusCreated)
 	w.Write([]byte(short))
 }
 
-// Redirect gets the requested short URL id, and if it exists, redirects
-// the client to the associated long URL. It also stores a record of the
-// visit to this short URL.
+// Redirect gets the requested short URL id, on the custom domain of the
+// request's host, or the service's own domain, and if it exists,
+// redirects the client to the associated long URL. Requests on unknown
+// hosts receive a 421 Misdirected Request response. It also stores a
+// record of the visit to this short URL.
+// If the short URL has expired, the client is redirected to its
+// fallback URL, or receives a 410 Gone response. If its activation
+// window has yet to open, the client is redirected to its pending URL,
+// or receives a 404 Not Found response.
+// Requests with a "preview" query parameter are served a preview of the
+// short URL instead; see Preview.
+// If the short URL is password protected, the visit is only recorded,
+// and the client only redirected, once the password is verified.
 func (h handler) Redirect(w http.ResponseWriter, r *http.Request) {
-	pathParams := mux.Vars(r)
+	if _, ok := r.URL.Query()["preview"]; ok {
+		h.Preview(w, r)
+		return
+	}
 
-	// Retrieve the short URL.
-	s, err := shorturl.Get(r.Context(), shorturl.GetParams{
-		DB:          h.db,
-		Environment: h.environment,
-		Short:       pathParams["short"],
-	})
-	if err != nil {
-		http.Error(w, "not found", http.StatusNotFound)
+	// Retrieve the short URL, on the domain of the request.
+	s := h.getPublic(w, r)
+	if s == nil {
+		return
+	}
+
+	// Check whether the short URL has expired, or is yet to open.
+	now := time.Now()
+	if s.IsExpired(now) {
+		expired(w, r, s)
+		return
+	}
+	if s.IsPending(now) {
+		pending(w, r, s)
 		return
 	}
 
+	// Check the password for protected short URLs.
+	if !h.unlock(w, r, s) {
+		return
+	}
+
+	// Enforce the visit limit with a cached counter.
+	// If the counter is unavailable, allow the visit; the expiry
+	// sweep will catch up with the limit. Bots are redirected, but do
+	// not count towards the limit.
+	bot := isBot(r)
+	if s.MaxVisits > 0 && !bot {
+		n, err := visit.Increment(r.Context(), visit.IncrementParams{
+			Cache:       h.cache,
+			DB:          h.db,
+			Environment: h.environment,
+			Tenant:      s.Tenant,
+			ShortID:     s.ID,
+		})
+		if err != nil {
+			log.Printf("failed to increment visit counter: %v", err)
+		} else if n > s.MaxVisits {
+			expired(w, r, s)
+			return
+		}
+	}
+
+	// Match the visitor against the short URL's targets.
+	ua := useragent.Parse(r.UserAgent())
+	ip := h.clientIP(r)
+	country := h.geoip.Country(ip)
+	lang := language.Preferred(r.Header.Get("Accept-Language"))
+	destination, target := s.Destination(shorturl.Visitor{
+		OS:       ua.OS,
+		Device:   ua.Device,
+		Country:  country,
+		Language: lang,
+	})
+
+	// Split visitors not matching a target between variants.
+	var variant string
+	if target == "" && len(s.Variants) > 0 {
+		v := assignVariant(w, r, s)
+		destination, variant = v.URL, v.Name
+	}
+
+	// Add a click ID to the destination, so that conversions can be
+	// attributed to this visit. Bots are not expected to convert.
+	var clickID primitive.ObjectID
+	if s.TrackConversions && h.clickIDs != nil && !bot {
+		clickID = primitive.NewObjectID()
+		destination = conversion.AddClickID(destination, h.clickIDs.Sign(
+			conversion.Click{
+				ID:      clickID,
+				ShortID: s.ID,
+				Variant: variant,
+				Tenant:  s.Tenant,
+			},
+		))
+	}
+
 	// Create a visit record.
 	if err := visit.Create(r.Context(), visit.CreateParams{
 		DB:          h.db,
 		Environment: h.environment,
+		Tenant:      s.Tenant,
 		ShortID:     s.ID,
+		ID:          clickID,
+		Target:      target,
+		Country:     country,
+		Variant:     variant,
+		Referrer:    referrerHost(r),
+		UserAgent:   r.UserAgent(),
+		Browser:     ua.Browser,
+		OS:          ua.OS,
+		Device:      ua.Device,
+		Language:    lang,
+		IPHash:      h.ipHasher.Hash(ip, now),
+		Visitor:     h.ipHasher.Visitor(ip),
+		Bot:         bot,
 	}); err != nil {
 		log.Printf("failed to create visit record: %v", err)
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
+	h.live.Publish(live.Event{
+		Short:    s.Short,
+		Tenant:   s.Tenant,
+		Owner:    s.Owner,
+		Team:     s.Team,
+		Domain:   s.Domain,
+		Time:     now,
+		Target:   target,
+		Variant:  variant,
+		Country:  country,
+		Referrer: referrerHost(r),
+		Browser:  ua.Browser,
+		OS:       ua.OS,
+		Device:   ua.Device,
+		Language: lang,
+		Bot:      bot,
+	})
+
+	// Redirect to the destination.
+	// Targeted responses vary with the client.
+	if len(s.Targets) > 0 {
+		w.Header().Add("Vary", "User-Agent, Accept-Language")
+	}
+	if s.Sticky {
+		w.Header().Add("Vary", "Cookie")
+	}
+	if s.Interstitial {
+		interstitial(w, s, destination)
+		return
+	}
+	http.Redirect(w, r, destination, redirectStatus(r, s))
+}
+
+// referrerHost returns the lower case host name of the request's
+// Referer header, or an empty string if there is none. Only the host is
+// kept, since paths and queries may identify the visitor.
+func referrerHost(r *http.Request) string {
+	ref := r.Referer()
+	if ref == "" {
+		return ""
+	}
+
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(u.Hostname())
+}
+
+// redirectStatus returns the HTTP status used to redirect to a short
+// URL's long URL.
+// Clients cache permanent redirects, and would skip this service on
+// subsequent visits. Short URLs which may stop redirecting, which
+// require a password, or whose destination depends on the visitor or
+// the visit, use a temporary redirect instead.
+func redirectStatus(r *http.Request, s *shorturl.ShortURL) int {
+	switch {
+	case r.Method == http.MethodPost:
+		// Redirect a submitted password form with a GET.
+		return http.StatusSeeOther
+	case s.IsProtected(), s.ExpiresAt != nil, s.ActiveUntil != nil,
+		s.MaxVisits > 0, len(s.Targets) > 0, len(s.Variants) > 0,
+		s.TrackConversions:
+		return http.StatusFound
+	default:
+		return http.StatusMovedPermanently
+	}
+}
+
+// expired responds to a request for an expired short URL.
+// The client is redirected to the fallback URL if one is set.
+func expired(w http.ResponseWriter, r *http.Request, s *shorturl.ShortURL) {
+	if s.FallbackURL != "" {
+		http.Redirect(w, r, s.FallbackURL, http.StatusFound)
+		return
+	}
+
+	http.Error(w, "gone", http.StatusGone)
+}
+
+// pending responds to a request for a short URL whose activation window
+// has yet to open. The client is redirected to the pending URL if one
+// is set. Neither response may be cached, since the short URL will
+// redirect elsewhere once the window opens.
+func pending(w http.ResponseWriter, r *http.Request, s *shorturl.ShortURL) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	if s.PendingURL != "" {
+		http.Redirect(w, r, s.PendingURL, http.StatusFound)
+		return
+	}
+
+	http.Error(w, "not yet available", http.StatusNotFound)
+}
+
+// formTime returns the RFC 3339 timestamp in the named form field, or
+// nil if the field is empty.
+func formTime(r *http.Request, name string) (*time.Time, error) {
+	v := r.FormValue(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, err
+	}
 
-	// Redirect to the associated long URL.
-	http.Redirect(w, r, s.URL, http.StatusMovedPermanently)
+	return &t, nil
 }
 
 // Stats gets the visit count for a short URL.
 // It responds with a application/json body which specifies the number
-// of visits in the past 24 hours, week, and year.
+// of visits in the past 24 hours, week, and year, and all time, the
+// absolute URL of the short URL, on its domain, and its state:
+// "pending", "active", or "expired".
+// If the "from" and optional "to" query parameters are set, the body
+// instead specifies the number of visits within that range.
+// The query parameters "browser", "country", "device", "language",
+// "os", "referrer", "target", and "variant" restrict the visits
+// counted to those matching each value. Visits by bots are excluded,
+// unless the "includeBots" query parameter is "true".
+// Unless visits are filtered, the body also specifies the conversions
+// of the visits by event, with their rates, overall and by variant.
 func (h handler) Stats(w http.ResponseWriter, r *http.Request) {
-	pathParams := mux.Vars(r)
-
-	// Retrieve the short URL.
-	s, err := shorturl.Get(r.Context(), shorturl.GetParams{
-		DB:          h.db,
-		Environment: h.environment,
-		Short:       pathParams["short"],
-	})
+	now := time.Now()
+	rg, err := queryRange(r, now, time.UTC)
 	if err != nil {
-		http.Error(w, "not found", http.StatusNotFound)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Get the visited stats for this short URL.
-	stats, err := visit.GetStats(r.Context(), visit.GetStatsParams{
-		DB:          h.db,
-		Environment: h.environment,
-		ShortID:     s.ID,
-	})
-	if err != nil {
-		log.Printf("failed to get stats: %v", err)
-		http.Error(w, "server error", http.StatusInternalServerError)
+	// Retrieve the short URL, if the principal may access it.
+	s := h.getAccessible(w, r)
+	if s == nil {
 		return
 	}
 
+	// Get the visited stats for this short URL, with its absolute URL
+	// and state.
+	var res interface{}
+	filter := visit.FilterFromQuery(r.URL.Query())
+	shortURL := h.absoluteURL(r, s.Domain, s.Short)
+	state := s.State(now)
+
+	if rg != nil {
+		stats, err := visit.GetRangeStats(r.Context(), visit.GetRangeStatsParams{
+			DB:          h.db,
+			Environment: h.environment,
+			Tenant:      s.Tenant,
+			ShortID:     s.ID,
+			Range:       *rg,
+			Filter:      filter,
+		})
+		if err != nil {
+			log.Printf("failed to get range stats: %v", err)
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+
+		// Count conversions within the range the visits were counted
+		// in, which may have been extended to whole hours.
+		counts, err := h.countConversions(r, s, filter, &stats.Range)
+		if err != nil {
+			log.Printf("failed to count conversions: %v", err)
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		stats.SetConversions(counts)
+		res = struct {
+			visit.RangeStats
+			ShortURL string `json:"shortUrl"`
+			State    string `json:"state"`
+		}{stats, shortURL, state}
+	} else {
+		stats, err := visit.GetStats(r.Context(), visit.GetStatsParams{
+			DB:          h.db,
+			Environment: h.environment,
+			Tenant:      s.Tenant,
+			ShortID:     s.ID,
+			Filter:      filter,
+		})
+		if err != nil {
+			log.Printf("failed to get stats: %v", err)
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+
+		counts, err := h.countConversions(r, s, filter, nil)
+		if err != nil {
+			log.Printf("failed to count conversions: %v", err)
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		stats.SetConversions(counts)
+		res = struct {
+			visit.Stats
+			ShortURL string `json:"shortUrl"`
+			State    string `json:"state"`
+		}{stats, shortURL, state}
+	}
+
 	// Respond with JSON encoded stats.
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(stats); err != nil {
+	if err := json.NewEncoder(w).Encode(res); err != nil {
 		log.Printf("failed to json encode stats: %v", err)
 	}
 
 }
 
+// countConversions counts the conversions of a short URL, within a
+// range, if any. Conversions are only attributed to short URLs and
+// variants, so none are counted if visits are filtered.
+func (h handler) countConversions(
+	r *http.Request, s *shorturl.ShortURL, filter visit.Filter, rg *visit.Range,
+) (conversion.Counts, error) {
+	if filter.HasDimensions() {
+		return nil, nil
+	}
+
+	p := conversion.CountParams{
+		DB:          h.db,
+		Environment: h.environment,
+		Tenant:      s.Tenant,
+		ShortID:     s.ID,
+	}
+	if rg != nil {
+		p.From, p.To = rg.From, rg.To
+	}
+
+	return conversion.Count(r.Context(), p)
+}
+
 // status is used as a health check for this service.
 // It should respond with a 200 HTTP Status OK and an empty body.
 func (h handler) Status(w http.ResponseWriter, r *http.Request) {
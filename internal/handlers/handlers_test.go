@@ -4,6 +4,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func TestCreate(t *testing.T) {
@@ -19,14 +22,21 @@ func TestStats(t *testing.T) {
 }
 
 func TestStatus(t *testing.T) {
-	req, err := http.NewRequest(http.MethodGet, "/", nil)
+	req, err := http.NewRequest(http.MethodGet, "/?stats=true", nil)
 	if err != nil {
 		t.Fatalf("failed to create request: %v", err)
 	}
 
 	recorder := httptest.NewRecorder()
 
-	handler := http.HandlerFunc(status)
+	// The count is not checked, so the client need not connect.
+	client, err := mongo.NewClient(options.Client())
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	h := handler{db: client, environment: "test"}
+
+	handler := http.HandlerFunc(h.Status)
 	handler.ServeHTTP(recorder, req)
 
 	if status := recorder.Code; status != http.StatusOK {
@@ -36,3 +46,29 @@ func TestStatus(t *testing.T) {
 		)
 	}
 }
+
+// TestReferrerHost checks that only the referrer's host is kept.
+func TestReferrerHost(t *testing.T) {
+	var tests = []struct {
+		Referer  string
+		Expected string
+	}{
+		{Referer: "", Expected: ""},
+		{Referer: "https://News.Example.com:8443/a?b=c", Expected: "news.example.com"},
+		{Referer: "android-app://com.example", Expected: "com.example"},
+		{Referer: "::not a url", Expected: ""},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.Referer != "" {
+			r.Header.Set("Referer", test.Referer)
+		}
+		if got := referrerHost(r); got != test.Expected {
+			t.Errorf(
+				"%q: expected %q but got %q",
+				test.Referer, test.Expected, got,
+			)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/principal"
+	"github.com/dwrz/url-shortener/internal/shorturl"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// liveCountInterval is the interval visits are counted over, when
+	// streaming counts.
+	liveCountInterval = time.Second
+
+	// liveHeartbeatInterval is how often a stream sends a comment, so
+	// that proxies and clients do not time out idle streams.
+	liveHeartbeatInterval = 15 * time.Second
+
+	// liveRetry is how long clients should wait before reconnecting,
+	// in milliseconds.
+	liveRetry = 5000
+)
+
+// liveCount is the count of visits in the interval of a stream ending
+// at Time.
+type liveCount struct {
+	Time  time.Time `json:"time"`
+	Count int       `json:"count"`
+}
+
+// liveDropped reports events dropped because the client fell behind.
+type liveDropped struct {
+	Dropped uint64 `json:"dropped"`
+}
+
+// StatsLive streams visits to a short URL as Server-Sent Events, as they
+// are recorded. Without a short URL in the path, it streams visits to
+// all short URLs the principal may access. Each visit is sent as a
+// "visit" event, with a JSON encoded live.Event. If the "mode" query
+// parameter is "counts", the count of visits each second is sent as a
+// "count" event instead.
+// Visits by bots are left out, unless "includeBots" is "true".
+// If the client falls behind, visits are dropped, and their number is
+// sent as a "dropped" event. Streams send a comment every 15 seconds,
+// so that idle connections are kept open. Streams end when the client
+// disconnects, or when the server shuts down.
+func (h handler) StatsLive(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	counts := false
+	switch q.Get("mode") {
+	case "", "visits":
+	case "counts":
+		counts = true
+	default:
+		http.Error(w, "invalid mode", http.StatusBadRequest)
+		return
+	}
+	includeBots := q.Get("includeBots") == "true"
+
+	flusher, ok := w.(http.Flusher)
+	if !ok || h.live == nil {
+		http.Error(w, "streaming unsupported", http.StatusNotImplemented)
+		return
+	}
+
+	// Retrieve the short URL, unless streaming all visits, if the
+	// principal may access it.
+	var s *shorturl.ShortURL
+	short := mux.Vars(r)["short"]
+	if short != "" {
+		if s = h.getAccessible(w, r); s == nil {
+			return
+		}
+	}
+	viewer := principal.FromContext(r.Context())
+
+	sub, err := h.live.Subscribe(short)
+	if err != nil {
+		log.Printf("failed to subscribe to live visits: %v", err)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Disable response buffering by nginx.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", liveRetry)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(liveHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	// The count ticker is only read when streaming counts.
+	var tick <-chan time.Time
+	if counts {
+		ticker := time.NewTicker(liveCountInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var count int
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+
+		case e, ok := <-sub.Events():
+			if !ok {
+				// The server is shutting down.
+				return
+			}
+			if e.Bot && !includeBots {
+				continue
+			}
+			if viewer == nil || !viewer.CanAccess(e.Tenant, e.Owner, e.Team) {
+				continue
+			}
+			if s != nil && e.Domain != s.Domain {
+				continue
+			}
+			if counts {
+				count++
+				continue
+			}
+			err = writeEvent(w, "visit", e)
+
+		case t := <-tick:
+			err = writeEvent(w, "count", liveCount{
+				Time:  t.UTC(),
+				Count: count,
+			})
+			count = 0
+
+		case <-heartbeat.C:
+			_, err = io.WriteString(w, ": heartbeat\n\n")
+		}
+
+		if n := sub.Dropped(); n > 0 && err == nil {
+			err = writeEvent(w, "dropped", liveDropped{Dropped: n})
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes a Server-Sent Event with JSON encoded data.
+func writeEvent(w io.Writer, event string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to json encode event: %v", err)
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
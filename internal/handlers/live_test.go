@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/live"
+	"github.com/dwrz/url-shortener/internal/principal"
+)
+
+// TestStatsLive checks that visits are streamed until the hub closes,
+// without bots, or visits to the short URLs of others.
+func TestStatsLive(t *testing.T) {
+	hub := live.NewHub(0)
+	h := handler{live: hub}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/stats/live", nil)
+	r = r.WithContext(principal.NewContext(
+		r.Context(), &principal.Principal{ID: "ana"},
+	))
+	done := make(chan struct{})
+	go func() {
+		h.StatsLive(w, r)
+		close(done)
+	}()
+
+	// Wait for the stream to subscribe.
+	for deadline := time.Now().Add(time.Second); hub.Len() == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("stream did not subscribe")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	hub.Publish(live.Event{Short: "abc123", Bot: true})
+	hub.Publish(live.Event{Short: "bcd234", Owner: "bo"})
+	hub.Publish(live.Event{Short: "cde345", Tenant: "acme", Owner: "ana"})
+	hub.Publish(live.Event{Short: "xyz789", Country: "DE", Owner: "ana"})
+	hub.Close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stream did not end when the hub closed")
+	}
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected text/event-stream but got %q", ct)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "abc123") {
+		t.Errorf("expected bot visit to be left out but got %q", body)
+	}
+	if strings.Contains(body, "bcd234") {
+		t.Errorf("expected visit to another's short url to be left out but got %q", body)
+	}
+	if strings.Contains(body, "cde345") {
+		t.Errorf("expected visit to another tenant's short url to be left out but got %q", body)
+	}
+	expected := "event: visit\ndata: {\"short\":\"xyz789\",\"time\":\"0001-01-01T00:00:00Z\",\"country\":\"DE\"}\n\n"
+	if !strings.Contains(body, expected) {
+		t.Errorf("expected %q in %q", expected, body)
+	}
+}
+
+func TestStatsLiveInvalidMode(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/stats/live?mode=all", nil)
+	handler{live: live.NewHub(0)}.StatsLive(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d but got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/shorturl"
+)
+
+const (
+	// headerPassword is the request header which may be used to
+	// provide the password for a protected short URL.
+	headerPassword = "X-Link-Password"
+
+	// maxUnlockAttempts is the number of failed password attempts
+	// allowed per client and short URL, within unlockWindow.
+	maxUnlockAttempts = 5
+
+	// unlockWindow is the period over which failed password attempts
+	// are counted.
+	unlockWindow = 15 * time.Minute
+)
+
+// promptPage is served to clients visiting a protected short URL
+// without a password. The form posts back to the short URL.
+var promptPage = template.Must(template.New("prompt").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Password required</title>
+</head>
+<body>
+<form method="post">
+<p>{{if .Failed}}Incorrect password.{{else}}This link is password protected.{{end}}</p>
+<input type="password" name="password" autofocus required>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+// unlock checks the password provided for a protected short URL,
+// either in the X-Link-Password header, or in a "password" form field.
+// It reports whether the request may proceed. Otherwise, it responds
+// with a password prompt, or a 429 Too Many Requests if the client has
+// exceeded the number of failed attempts.
+func (h handler) unlock(w http.ResponseWriter, r *http.Request, s *shorturl.ShortURL) bool {
+	if !s.IsProtected() {
+		return true
+	}
+
+	password := r.Header.Get(headerPassword)
+	if password == "" && r.Method == http.MethodPost {
+		password = r.PostFormValue("password")
+	}
+	if password == "" {
+		prompt(w, http.StatusOK, false)
+		return false
+	}
+
+	// Failed attempts are counted per client, per short URL.
+	// Count the attempt before verifying the password, so that
+	// concurrent attempts cannot exceed the limit, and so that a
+	// correct guess is also rejected once the limit is reached.
+	// Successful attempts are not counted.
+	key := fmt.Sprintf(
+		"%s:unlock:%s:%s", h.environment, s.ID.Hex(), h.clientIP(r),
+	)
+	attempts, err := h.cache.IncrBy(r.Context(), key, 1, unlockWindow)
+	if err != nil {
+		log.Printf("failed to count unlock attempt: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return false
+	}
+	if attempts > maxUnlockAttempts {
+		http.Error(w, "too many attempts", http.StatusTooManyRequests)
+		return false
+	}
+
+	if s.CheckPassword(password) {
+		if _, err := h.cache.IncrBy(r.Context(), key, -1, unlockWindow); err != nil {
+			log.Printf("failed to uncount unlock attempt: %v", err)
+		}
+		return true
+	}
+
+	prompt(w, http.StatusForbidden, true)
+
+	return false
+}
+
+// prompt responds with the password prompt page.
+func prompt(w http.ResponseWriter, status int, failed bool) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	if err := promptPage.Execute(w, struct{ Failed bool }{
+		Failed: failed,
+	}); err != nil {
+		log.Printf("failed to render password prompt: %v", err)
+	}
+}
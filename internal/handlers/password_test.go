@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dwrz/url-shortener/internal/cache"
+	"github.com/dwrz/url-shortener/internal/shorturl"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUnlock(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+
+	h := handler{cache: cache.NewLocal(0), environment: "test"}
+	s := &shorturl.ShortURL{
+		ID:           primitive.NewObjectID(),
+		PasswordHash: string(hash),
+	}
+
+	unlock := func(r *http.Request) (bool, int) {
+		recorder := httptest.NewRecorder()
+		ok := h.unlock(recorder, r, s)
+		return ok, recorder.Code
+	}
+
+	// Without a password, the prompt is served.
+	r := httptest.NewRequest(http.MethodGet, "/short", nil)
+	if ok, code := unlock(r); ok || code != http.StatusOK {
+		t.Errorf("expected prompt, but got %v and %d", ok, code)
+	}
+
+	// The correct password in a header unlocks.
+	r = httptest.NewRequest(http.MethodGet, "/short", nil)
+	r.Header.Set(headerPassword, "secret")
+	if ok, _ := unlock(r); !ok {
+		t.Error("expected correct header password to unlock")
+	}
+
+	// The correct password in a form unlocks.
+	r = httptest.NewRequest(
+		http.MethodPost, "/short",
+		strings.NewReader(url.Values{"password": {"secret"}}.Encode()),
+	)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if ok, _ := unlock(r); !ok {
+		t.Error("expected correct form password to unlock")
+	}
+
+	// Incorrect passwords are rejected, until the client is limited.
+	for i := 0; i < maxUnlockAttempts; i++ {
+		r = httptest.NewRequest(http.MethodGet, "/short", nil)
+		r.Header.Set(headerPassword, "wrong")
+		if ok, code := unlock(r); ok || code != http.StatusForbidden {
+			t.Errorf("expected rejection, but got %v and %d", ok, code)
+		}
+	}
+
+	// Once limited, even the correct password is rejected.
+	r = httptest.NewRequest(http.MethodGet, "/short", nil)
+	r.Header.Set(headerPassword, "secret")
+	if ok, code := unlock(r); ok || code != http.StatusTooManyRequests {
+		t.Errorf("expected rate limit, but got %v and %d", ok, code)
+	}
+
+	// Other clients are not limited.
+	r = httptest.NewRequest(http.MethodGet, "/short", nil)
+	r.RemoteAddr = "192.0.2.2:1234"
+	r.Header.Set(headerPassword, "secret")
+	if ok, _ := unlock(r); !ok {
+		t.Error("expected other client to unlock")
+	}
+}
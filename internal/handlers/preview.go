@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/shorturl"
+)
+
+// previewPage shows where a short URL leads, without redirecting.
+// If Delay is set, it is used as an interstitial page, and the client
+// is sent on to the destination after Delay seconds.
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+{{- if and .Delay .URL}}
+<meta http-equiv="refresh" content="{{.Delay}};url={{.URL}}">
+{{- end}}
+<title>{{if .Title}}{{.Title}}{{else}}Link preview{{end}}</title>
+</head>
+<body>
+{{- if .Title}}
+<h1>{{.Title}}</h1>
+{{- end}}
+{{- if .URL}}
+<p>This link leads to:</p>
+<p><a href="{{.URL}}" rel="noopener noreferrer nofollow">{{.URL}}</a></p>
+{{- else if .Protected}}
+<p>This link is password protected.</p>
+{{- else}}
+<p>This link is {{.State}}.</p>
+{{- end}}
+<p>Created {{.Created.Format "2 January 2006"}}.</p>
+{{- if and .Delay .URL}}
+<p>You will be redirected in {{.Delay}} seconds.</p>
+{{- end}}
+</body>
+</html>
+`))
+
+// preview describes a short URL for display, without redirecting.
+type preview struct {
+	Short     string    `json:"short"`
+	ShortURL  string    `json:"shortUrl"`
+	Title     string    `json:"title,omitempty"`
+	Created   time.Time `json:"created"`
+	State     string    `json:"state"`
+	Protected bool      `json:"protected"`
+
+	// URL is the destination. It is omitted if the short URL is not
+	// active, or is password protected, so that a preview does not
+	// reveal what the short URL's owner has not published.
+	URL string `json:"url,omitempty"`
+
+	// Delay is the number of seconds an interstitial page waits
+	// before redirecting. It is not used for previews.
+	Delay int `json:"-"`
+}
+
+func newPreview(s *shorturl.ShortURL, now time.Time) preview {
+	p := preview{
+		Short:     s.Short,
+		Title:     s.Title,
+		Created:   s.Created,
+		State:     s.State(now),
+		Protected: s.IsProtected(),
+	}
+	if p.State == shorturl.StateActive && !p.Protected {
+		p.URL = s.URL
+	}
+
+	return p
+}
+
+// Preview shows where a short URL leads, without redirecting or
+// recording a visit. It is served at /{short}+, and for redirects with
+// a "preview" query parameter.
+// It responds with JSON if the client accepts application/json, and
+// with an HTML page otherwise.
+func (h handler) Preview(w http.ResponseWriter, r *http.Request) {
+	// Retrieve the short URL, on the domain of the request.
+	s := h.getPublic(w, r)
+	if s == nil {
+		return
+	}
+
+	p := newPreview(s, time.Now())
+	p.ShortURL = h.absoluteURL(r, s.Domain, s.Short)
+
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(p); err != nil {
+			log.Printf("failed to json encode preview: %v", err)
+		}
+		return
+	}
+
+	renderPreview(w, p)
+}
+
+// interstitial responds with a page showing the destination, which
+// redirects the client after the short URL's interstitial delay.
+func interstitial(w http.ResponseWriter, s *shorturl.ShortURL, destination string) {
+	p := newPreview(s, time.Now())
+	p.URL = destination
+	p.Delay = s.InterstitialDelay
+	if p.Delay <= 0 {
+		p.Delay = shorturl.DefaultInterstitialDelay
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	renderPreview(w, p)
+}
+
+func renderPreview(w http.ResponseWriter, p preview) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := previewPage.Execute(w, p); err != nil {
+		log.Printf("failed to render preview: %v", err)
+	}
+}
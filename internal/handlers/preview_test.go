@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/shorturl"
+)
+
+func TestNewPreview(t *testing.T) {
+	now := time.Now()
+	future := now.Add(time.Hour)
+
+	var tests = []struct {
+		Name        string
+		Input       shorturl.ShortURL
+		ExpectedURL string
+	}{
+		{
+			Name:        "active",
+			Input:       shorturl.ShortURL{URL: "https://example.com/"},
+			ExpectedURL: "https://example.com/",
+		},
+		{
+			Name: "protected",
+			Input: shorturl.ShortURL{
+				URL: "https://example.com/", PasswordHash: "hash",
+			},
+		},
+		{
+			Name: "pending",
+			Input: shorturl.ShortURL{
+				URL: "https://example.com/", ActiveFrom: &future,
+			},
+		},
+		{
+			Name: "expired",
+			Input: shorturl.ShortURL{
+				URL: "https://example.com/", Expired: true,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		if got := newPreview(&test.Input, now); got.URL != test.ExpectedURL {
+			t.Errorf(
+				"%s: expected url %q but got %q",
+				test.Name, test.ExpectedURL, got.URL,
+			)
+		}
+	}
+}
+
+func TestInterstitial(t *testing.T) {
+	s := &shorturl.ShortURL{
+		Short:             "abc123",
+		Title:             "<Launch>",
+		URL:               "https://example.com/",
+		Interstitial:      true,
+		InterstitialDelay: 3,
+	}
+
+	recorder := httptest.NewRecorder()
+	interstitial(recorder, s, "https://example.com/?a=1&b=2")
+	body := recorder.Body.String()
+
+	for _, expected := range []string{
+		`content="3;url=https://example.com/?a=1&amp;b=2"`,
+		"&lt;Launch&gt;",
+		"redirected in 3 seconds",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected body to contain %q:\n%s", expected, body)
+		}
+	}
+}
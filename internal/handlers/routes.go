@@ -2,38 +2,134 @@ package handlers
 
 import (
 	"fmt"
+	"github.com/dwrz/url-shortener/internal/cache"
+	"github.com/dwrz/url-shortener/internal/conversion"
+	"github.com/dwrz/url-shortener/internal/live"
+	"github.com/dwrz/url-shortener/internal/oidc"
+	"github.com/dwrz/url-shortener/internal/tenant"
+	"github.com/dwrz/url-shortener/pkg/geoip"
+	"github.com/dwrz/url-shortener/pkg/iphash"
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/mongo"
+	"net"
 	"net/http"
 )
 
 const (
+	// pathConversions is the endpoint used to report conversions.
+	pathConversions = "/conversions"
+
 	// pathCreate is the endpoint used to create a new short URL.
 	pathCreate = "/"
 
-	// pathRedirect is the endpoint used to redirect a short URL.
+	// pathDomains is the endpoint used to list and add the custom
+	// domains of a tenant.
+	pathDomains = "/domains"
+
+	// pathDomain is the endpoint used to remove a custom domain.
+	pathDomain = "/domains/{domain}"
+
+	// pathDashboard is the endpoint used to get stats across all
+	// short URLs.
+	pathDashboard = "/stats"
+
+	// pathDashboardLive is the endpoint used to stream visits to all
+	// short URLs.
+	pathDashboardLive = "/stats/live"
+
+	// pathDashboardExport is the endpoint used to export visits to
+	// several short URLs.
+	pathDashboardExport = "/stats/export"
+
+	// pathPreview is the endpoint used to preview a short URL.
+	pathPreview = "/{short}+"
+
+	// pathRedirect is the endpoint used to redirect a short URL, and
+	// to update or delete it.
 	pathRedirect = "/{short}"
 
 	// pathStats is the endpoint used to get stats for a short URL.
 	pathStats = "/{short}/stats"
 
+	// pathStatsTimeSeries is the endpoint used to get visit counts
+	// over time for a short URL.
+	pathStatsTimeSeries = "/{short}/stats/timeseries"
+
+	// pathStatsBreakdown is the endpoint used to rank the values of a
+	// dimension of visits to a short URL.
+	pathStatsBreakdown = "/{short}/stats/breakdown"
+
+	// pathStatsLive is the endpoint used to stream visits to a short
+	// URL.
+	pathStatsLive = "/{short}/stats/live"
+
+	// pathStatsExport is the endpoint used to export visits to a short
+	// URL.
+	pathStatsExport = "/{short}/stats/export"
+
 	// pathStatus is the healthcheck endpoint for the service.
 	pathStatus = "/"
 )
 
 type AddRoutesParams struct {
+	// Cache handlers should use to avoid DB queries.
+	Cache cache.Cache
+
+	// ClickIDs signs and verifies the click IDs of short URLs which
+	// track conversions. Optional; if nil, click IDs are not added to
+	// redirects, and conversions cannot be reported.
+	ClickIDs *conversion.Signer
+
 	// DB client handlers should inject for MongoDB queries.
 	DB *mongo.Client
 
+	// Domains are the service's own domains, which short URLs without
+	// a custom domain are served from; e.g., "ourco.link". The first
+	// is used in their absolute URLs. Optional; if empty, every host
+	// which is not a custom domain is the service's own.
+	Domains []string
+
 	// Environment the handlers should function in.
 	// This value should be taken from the service configuration.
 	Environment string
 
+	// GeoIP resolves client IP addresses to countries. Optional.
+	GeoIP *geoip.DB
+
+	// IPHasher pseudonymizes visitor IP addresses in visit records.
+	// Optional; if nil, visit records omit the IP hash, and unique
+	// visitors are not counted.
+	IPHasher *iphash.Hasher
+
+	// Live broadcasts recorded visits to live stats streams, which
+	// end when it is closed. Optional; if nil, visits are not
+	// broadcast, and live stats are unavailable.
+	Live *live.Hub
+
 	// Router which routes should be added to.
 	Router *mux.Router
+
+	// Tenants resolves the custom domains of tenants. Optional; if nil,
+	// all requests are on the service's own domain.
+	Tenants *tenant.Resolver
+
+	// Tokens authenticates OIDC bearer tokens. Optional; if nil, only
+	// API keys are accepted.
+	Tokens *oidc.Authenticator
+
+	// TrustedProxies are the networks whose X-Forwarded-For headers
+	// are trusted. Optional; see ParseTrustedProxies.
+	TrustedProxies []*net.IPNet
+
+	// URLScheme is the scheme of the absolute URLs of short URLs.
+	// Optional; defaults to "https".
+	URLScheme string
 }
 
 func (p *AddRoutesParams) validate() error {
+	if p.Cache == nil {
+		return fmt.Errorf("missing cache")
+	}
 	if p.DB == nil {
 		return fmt.Errorf("missing db client")
 	}
@@ -47,35 +143,142 @@ func (p *AddRoutesParams) validate() error {
 	return nil
 }
 
-// AddRoutes attaches handlers to the Router, and sets the DB and
-// Environment configuration on handlers.
+// AddRoutes attaches handlers to the Router, and sets the remaining
+// parameters as configuration on handlers.
 func AddRoutes(p AddRoutesParams) error {
 	if err := p.validate(); err != nil {
 		return fmt.Errorf("invalid params: %v", err)
 	}
 
+	h := handler{
+		cache:          p.Cache,
+		clickIDs:       p.ClickIDs,
+		db:             p.DB,
+		domains:        p.Domains,
+		environment:    p.Environment,
+		geoip:          p.GeoIP,
+		ipHasher:       p.IPHasher,
+		live:           p.Live,
+		tenants:        p.Tenants,
+		tokens:         p.Tokens,
+		trustedProxies: p.TrustedProxies,
+		urlScheme:      p.URLScheme,
+	}
+
+	// Require API keys, or OIDC tokens, for management and stats
+	// endpoints.
+	// Middleware runs once a route is matched, so it can check the
+	// scope required by the route.
+	p.Router.Use(h.authenticate)
+
 	// Add the status handler.
 	p.Router.HandleFunc(
 		pathStatus,
-		handler{db: p.DB, environment: p.Environment}.Status,
+		h.Status,
 	).Methods(http.MethodGet)
 
 	// Add the create handler.
 	p.Router.HandleFunc(
 		pathCreate,
-		handler{db: p.DB, environment: p.Environment}.Create,
+		h.Create,
 	).Methods(http.MethodPost)
 
+	// Add the conversion handler.
+	// It must precede the redirect handler, whose path also matches.
+	p.Router.HandleFunc(
+		pathConversions,
+		h.Conversion,
+	).Methods(http.MethodPost)
+
+	// Add the domain handlers.
+	// They must precede the redirect handlers, whose paths also match.
+	p.Router.HandleFunc(
+		pathDomains,
+		h.Domains,
+	).Methods(http.MethodGet)
+	p.Router.HandleFunc(
+		pathDomains,
+		h.AddDomain,
+	).Methods(http.MethodPost)
+	p.Router.HandleFunc(
+		pathDomain,
+		h.RemoveDomain,
+	).Methods(http.MethodDelete)
+
+	// Add the dashboard handler.
+	// It must precede the redirect handler, whose path also matches.
+	p.Router.HandleFunc(
+		pathDashboard,
+		h.Dashboard,
+	).Methods(http.MethodGet)
+
+	// Add the live dashboard handler.
+	p.Router.HandleFunc(
+		pathDashboardLive,
+		h.StatsLive,
+	).Methods(http.MethodGet)
+
+	// Add the export handler for several short URLs.
+	p.Router.HandleFunc(
+		pathDashboardExport,
+		h.StatsExport,
+	).Methods(http.MethodGet)
+
+	// Add the preview handler.
+	// It must precede the redirect handler, whose path also matches.
+	p.Router.HandleFunc(
+		pathPreview,
+		h.Preview,
+	).Methods(http.MethodGet)
+
 	// Add the redirect handler.
+	// POST is used to submit passwords for protected short URLs.
+	// HEAD requests are redirected, and recorded as bot visits.
 	p.Router.HandleFunc(
 		pathRedirect,
-		handler{db: p.DB, environment: p.Environment}.Redirect,
-	).Methods(http.MethodGet)
+		h.Redirect,
+	).Methods(http.MethodGet, http.MethodHead, http.MethodPost)
+
+	// Add the update handler.
+	p.Router.HandleFunc(
+		pathRedirect,
+		h.Update,
+	).Methods(http.MethodPatch)
+
+	// Add the delete handler.
+	p.Router.HandleFunc(
+		pathRedirect,
+		h.Delete,
+	).Methods(http.MethodDelete)
 
 	// Add the stats handler.
 	p.Router.HandleFunc(
 		pathStats,
-		handler{db: p.DB, environment: p.Environment}.Stats,
+		h.Stats,
+	).Methods(http.MethodGet)
+
+	// Add the time series stats handler.
+	p.Router.HandleFunc(
+		pathStatsTimeSeries,
+		h.StatsTimeSeries,
+	).Methods(http.MethodGet)
+
+	// Add the breakdown stats handler.
+	p.Router.HandleFunc(
+		pathStatsBreakdown,
+		h.StatsBreakdown,
+	).Methods(http.MethodGet)
+
+	// Add the live stats handler.
+	p.Router.HandleFunc(
+		pathStatsLive,
+		h.StatsLive,
+	).Methods(http.MethodGet)
+
+	// Add the export handler.
+	p.Router.HandleFunc(
+		pathStatsExport,
+		h.StatsExport,
 	).Methods(http.MethodGet)
 
 	return nil
@@ -1,11 +1,78 @@
 package handlers
 
-import "testing"
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dwrz/url-shortener/internal/cache"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/mongo"
+)
 
 func TestAddRoutesParamsValidate(t *testing.T) {
 	t.Skip("TODO")
 }
 
+// TestAddRoutes checks that requests are routed to the expected
+// endpoints, by comparing route path templates.
 func TestAddRoutes(t *testing.T) {
-	t.Skip("TODO")
+	router := mux.NewRouter()
+	if err := AddRoutes(AddRoutesParams{
+		Cache:       cache.NewLocal(0),
+		DB:          &mongo.Client{},
+		Environment: "test",
+		Router:      router,
+	}); err != nil {
+		t.Fatalf("failed to add routes: %v", err)
+	}
+
+	var tests = []struct {
+		Method   string
+		Path     string
+		Expected string
+	}{
+		{Method: http.MethodGet, Path: "/", Expected: pathStatus},
+		{Method: http.MethodPost, Path: "/", Expected: pathCreate},
+		{Method: http.MethodPost, Path: "/conversions", Expected: pathConversions},
+		{Method: http.MethodGet, Path: "/stats", Expected: pathDashboard},
+		{Method: http.MethodGet, Path: "/stats/live", Expected: pathDashboardLive},
+		{Method: http.MethodGet, Path: "/stats/export", Expected: pathDashboardExport},
+		{Method: http.MethodGet, Path: "/abc123", Expected: pathRedirect},
+		{Method: http.MethodPost, Path: "/abc123", Expected: pathRedirect},
+		{Method: http.MethodHead, Path: "/abc123", Expected: pathRedirect},
+		{Method: http.MethodPatch, Path: "/abc123", Expected: pathRedirect},
+		{Method: http.MethodDelete, Path: "/abc123", Expected: pathRedirect},
+		{Method: http.MethodGet, Path: "/abc123+", Expected: pathPreview},
+		{Method: http.MethodGet, Path: "/abc123/stats", Expected: pathStats},
+		{Method: http.MethodGet, Path: "/abc123/stats/timeseries", Expected: pathStatsTimeSeries},
+		{Method: http.MethodGet, Path: "/abc123/stats/breakdown", Expected: pathStatsBreakdown},
+		{Method: http.MethodGet, Path: "/abc123/stats/live", Expected: pathStatsLive},
+		{Method: http.MethodGet, Path: "/abc123/stats/export", Expected: pathStatsExport},
+	}
+
+	for _, test := range tests {
+		var match mux.RouteMatch
+		r := httptest.NewRequest(test.Method, test.Path, nil)
+		if !router.Match(r, &match) || match.Route == nil {
+			t.Errorf("%s %s: no route", test.Method, test.Path)
+			continue
+		}
+
+		template, err := match.Route.GetPathTemplate()
+		if err != nil {
+			t.Errorf("%s %s: %v", test.Method, test.Path, err)
+			continue
+		}
+		if template != test.Expected {
+			t.Errorf(
+				"%s %s: expected route %s but got %s",
+				test.Method, test.Path, test.Expected, template,
+			)
+		}
+		if short := match.Vars["short"]; test.Expected == pathPreview &&
+			short != "abc123" {
+			t.Errorf("expected short abc123 but got %q", short)
+		}
+	}
 }
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/visit"
+)
+
+// dateLayout is the layout of dates accepted in place of RFC 3339
+// timestamps in stats queries.
+const dateLayout = "2006-01-02"
+
+// queryRange returns the visit.Range in the "from" and "to" query
+// parameters, or nil if neither is set. Each is an RFC 3339 timestamp,
+// or a date in loc, which stands for its start. If "to" is empty, the
+// range ends at now.
+func queryRange(r *http.Request, now time.Time, loc *time.Location) (*visit.Range, error) {
+	q := r.URL.Query()
+	if q.Get("from") == "" && q.Get("to") == "" {
+		return nil, nil
+	}
+
+	from, err := queryTime(q.Get("from"), loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from: %v", err)
+	}
+	if from.IsZero() {
+		return nil, fmt.Errorf("missing from")
+	}
+
+	to := now
+	if v := q.Get("to"); v != "" {
+		if to, err = queryTime(v, loc); err != nil {
+			return nil, fmt.Errorf("invalid to: %v", err)
+		}
+	}
+	if !to.After(from) {
+		return nil, fmt.Errorf("to must be after from")
+	}
+
+	return &visit.Range{From: from, To: to}, nil
+}
+
+// queryLocation returns the time zone named by the "tz" query
+// parameter, or UTC if it is empty.
+func queryLocation(r *http.Request) (*time.Location, error) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		return time.UTC, nil
+	}
+
+	return time.LoadLocation(tz)
+}
+
+// queryTime parses an RFC 3339 timestamp, or a date in loc.
+// An empty string returns the zero time.
+func queryTime(v string, loc *time.Location) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+
+	return time.ParseInLocation(dateLayout, v, loc)
+}
+
+// StatsTimeSeries gets the visit counts for a short URL in buckets of
+// time, for charts. It responds with an application/json encoded
+// visit.TimeSeries. Buckets with no visits have a count of zero.
+// The following query parameters are optional:
+// "interval" is one of "hour", "day" (the default), "week", or "month";
+// "tz" is an IANA time zone name, for bucket boundaries and dates,
+// defaulting to UTC; "from" and "to" are as for Stats, defaulting to a
+// span suited to the interval. The filters accepted by Stats apply.
+func (h handler) StatsTimeSeries(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	interval := visit.Day
+	if v := q.Get("interval"); v != "" {
+		var err error
+		if interval, err = visit.ParseInterval(v); err != nil {
+			http.Error(w, "invalid interval", http.StatusBadRequest)
+			return
+		}
+	}
+
+	loc, err := queryLocation(r)
+	if err != nil {
+		http.Error(w, "invalid tz", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	rg, err := queryRange(r, now, loc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if rg == nil {
+		rg = &visit.Range{From: interval.DefaultSpan(now), To: now}
+	}
+
+	// Reject ranges with too many buckets before querying.
+	if _, err := visit.Buckets(*rg, interval, loc, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Retrieve the short URL, if the principal may access it.
+	s := h.getAccessible(w, r)
+	if s == nil {
+		return
+	}
+
+	ts, err := visit.GetTimeSeries(r.Context(), visit.GetTimeSeriesParams{
+		DB:          h.db,
+		Environment: h.environment,
+		Tenant:      s.Tenant,
+		ShortID:     s.ID,
+		Range:       *rg,
+		Interval:    interval,
+		Location:    loc,
+		Filter:      visit.FilterFromQuery(q),
+	})
+	if err != nil {
+		log.Printf("failed to get time series: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ts); err != nil {
+		log.Printf("failed to json encode time series: %v", err)
+	}
+}
+
+// StatsBreakdown ranks the values of a dimension of visits to a short
+// URL by their count. It responds with an application/json encoded
+// visit.Breakdown. The "by" query parameter is the dimension; one of
+// "browser", "country", "device", "language", "os", or "referrer".
+// The optional "top" query parameter is the number of values ranked,
+// with the remaining visits counted as "other". The range, "tz", and
+// filters accepted by StatsTimeSeries apply; without a range, all
+// visits are counted.
+func (h handler) StatsBreakdown(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	by := q.Get("by")
+	if !visit.IsDimension(by) {
+		http.Error(w, "invalid by", http.StatusBadRequest)
+		return
+	}
+
+	top := visit.DefaultTop
+	if v := q.Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > visit.MaxTop {
+			http.Error(w, "invalid top", http.StatusBadRequest)
+			return
+		}
+		top = n
+	}
+
+	loc, err := queryLocation(r)
+	if err != nil {
+		http.Error(w, "invalid tz", http.StatusBadRequest)
+		return
+	}
+
+	rg, err := queryRange(r, time.Now(), loc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Retrieve the short URL, if the principal may access it.
+	s := h.getAccessible(w, r)
+	if s == nil {
+		return
+	}
+
+	b, err := visit.GetBreakdown(r.Context(), visit.GetBreakdownParams{
+		DB:          h.db,
+		Environment: h.environment,
+		Tenant:      s.Tenant,
+		ShortID:     s.ID,
+		By:          by,
+		Top:         top,
+		Range:       rg,
+		Filter:      visit.FilterFromQuery(q),
+	})
+	if err != nil {
+		log.Printf("failed to get breakdown: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(b); err != nil {
+		log.Printf("failed to json encode breakdown: %v", err)
+	}
+}
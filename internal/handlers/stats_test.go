@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestQueryRange checks parsing of the "from" and "to" query
+// parameters.
+func TestQueryRange(t *testing.T) {
+	now := time.Date(2020, 3, 29, 12, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		Query    string
+		Nil      bool
+		Err      bool
+		From, To time.Time
+	}{
+		{Query: "", Nil: true},
+		{
+			Query: "from=2020-03-01",
+			From:  time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC),
+			To:    now,
+		},
+		{
+			Query: "from=2020-03-01T10:00:00%2B02:00&to=2020-03-02",
+			From:  time.Date(2020, 3, 1, 8, 0, 0, 0, time.UTC),
+			To:    time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{Query: "to=2020-03-02", Err: true},
+		{Query: "from=yesterday", Err: true},
+		{Query: "from=2020-03-02&to=2020-03-01", Err: true},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/abc/stats?"+test.Query, nil)
+		rg, err := queryRange(r, now, time.UTC)
+
+		switch {
+		case test.Err:
+			if err == nil {
+				t.Errorf("%q: expected error", test.Query)
+			}
+		case err != nil:
+			t.Errorf("%q: unexpected error: %v", test.Query, err)
+		case test.Nil:
+			if rg != nil {
+				t.Errorf("%q: expected no range but got %+v", test.Query, rg)
+			}
+		case rg == nil:
+			t.Errorf("%q: expected a range", test.Query)
+		case !rg.From.Equal(test.From) || !rg.To.Equal(test.To):
+			t.Errorf(
+				"%q: expected %v to %v but got %v to %v",
+				test.Query, test.From, test.To, rg.From, rg.To,
+			)
+		}
+	}
+}
+
+// TestQueryRangeLocation checks that dates are parsed in the requested
+// time zone.
+func TestQueryRangeLocation(t *testing.T) {
+	loc := time.FixedZone("UTC-5", -5*60*60)
+	r := httptest.NewRequest(http.MethodGet, "/abc/stats?from=2020-03-01&to=2020-03-02", nil)
+
+	rg, err := queryRange(r, time.Now(), loc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := time.Date(2020, 3, 1, 5, 0, 0, 0, time.UTC)
+	if !rg.From.Equal(expected) {
+		t.Errorf("expected %v but got %v", expected, rg.From)
+	}
+}
+
+// TestStatsTimeSeries checks that invalid queries are rejected before
+// the short URL is retrieved.
+func TestStatsTimeSeries(t *testing.T) {
+	var tests = []string{
+		"interval=minute",
+		"tz=Nowhere/Special",
+		"from=2020-03-02&to=2020-03-01",
+		"interval=hour&from=2000-01-01&to=2020-01-01",
+	}
+
+	for _, query := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(
+			http.MethodGet, "/abc/stats/timeseries?"+query, nil,
+		)
+		handler{}.StatsTimeSeries(w, r)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status %d but got %d", query, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+// TestStatsBreakdown checks that invalid queries are rejected before
+// the short URL is retrieved.
+func TestStatsBreakdown(t *testing.T) {
+	var tests = []string{
+		"",
+		"by=ipHash",
+		"by=country&top=0",
+		"by=country&top=1000",
+		"by=country&top=ten",
+		"by=country&tz=Nowhere/Special",
+		"by=country&from=2020-03-02&to=2020-03-01",
+	}
+
+	for _, query := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(
+			http.MethodGet, "/abc/stats/breakdown?"+query, nil,
+		)
+		handler{}.StatsBreakdown(w, r)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status %d but got %d", query, http.StatusBadRequest, w.Code)
+		}
+	}
+}
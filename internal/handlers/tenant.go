@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/dwrz/url-shortener/internal/shorturl"
+	"github.com/dwrz/url-shortener/internal/tenant"
+	"github.com/gorilla/mux"
+)
+
+// errUnknownHost is returned for requests on a host which is neither one
+// of the service's own domains, nor a custom domain.
+var errUnknownHost = fmt.Errorf("unknown host")
+
+// domain returns the custom domain a request was made on, and the ID of
+// the tenant it belongs to. For requests on the service's own domains,
+// both are empty. It returns errUnknownHost for other hosts.
+func (h handler) domain(r *http.Request) (domain, owner string, err error) {
+	host := tenant.NormalizeDomain(r.Host)
+	if h.isOwnDomain(host) {
+		return "", "", nil
+	}
+
+	if h.tenants != nil {
+		owner, ok, err := h.tenants.Resolve(r.Context(), host)
+		if err != nil {
+			return "", "", err
+		}
+		if ok {
+			return host, owner, nil
+		}
+	}
+	if len(h.domains) == 0 {
+		return "", "", nil
+	}
+
+	return "", "", errUnknownHost
+}
+
+// isOwnDomain reports whether a domain is one of the service's own
+// domains. Without any configured, it reports false, so that custom
+// domains are still resolved.
+func (h handler) isOwnDomain(domain string) bool {
+	for _, d := range h.domains {
+		if tenant.NormalizeDomain(d) == domain {
+			return true
+		}
+	}
+
+	return false
+}
+
+// domainError responds to a request whose domain could not be resolved:
+// with a 421 Misdirected Request status for unknown hosts, and with a
+// 500 Internal Server Error status otherwise.
+func domainError(w http.ResponseWriter, err error) {
+	if err == errUnknownHost {
+		http.Error(w, "unknown host", http.StatusMisdirectedRequest)
+		return
+	}
+
+	log.Printf("failed to resolve domain: %v", err)
+	http.Error(w, "server error", http.StatusInternalServerError)
+}
+
+// absoluteURL returns the absolute URL of a short URL: on its custom
+// domain, if it has one, and otherwise on the first of the service's own
+// domains, or the host of the request if none are configured.
+func (h handler) absoluteURL(r *http.Request, domain, short string) string {
+	host := domain
+	if host == "" && len(h.domains) > 0 {
+		host = h.domains[0]
+	}
+	if host == "" {
+		host = r.Host
+	}
+	scheme := h.urlScheme
+	if scheme == "" {
+		scheme = "https"
+	}
+
+	u := url.URL{Scheme: scheme, Host: host, Path: "/" + short}
+
+	return u.String()
+}
+
+// getPublic retrieves the short URL in the request path, on the domain
+// of the request. Short URLs on a custom domain are only retrieved from
+// the tenant it belongs to. If there is no such short URL, it responds
+// with a 404 Not Found status, and returns nil; see domainError for
+// requests on unknown hosts.
+func (h handler) getPublic(w http.ResponseWriter, r *http.Request) *shorturl.ShortURL {
+	domain, owner, err := h.domain(r)
+	if err != nil {
+		domainError(w, err)
+		return nil
+	}
+
+	params := shorturl.GetParams{
+		Cache:       h.cache,
+		DB:          h.db,
+		Environment: h.environment,
+		Domain:      domain,
+		Short:       mux.Vars(r)["short"],
+	}
+	// The service's own domain is shared by all tenants.
+	if domain != "" {
+		params.Tenant = &owner
+	}
+
+	s, err := shorturl.Get(r.Context(), params)
+	if err == shorturl.ErrNotFound {
+		http.Error(w, "not found", http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		log.Printf("failed to get short url: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return nil
+	}
+
+	return s
+}
+
+// linkQuota returns a tenant's quota of short URLs; zero for no limit.
+// If the tenant does not exist, it responds with a 403 Forbidden status,
+// or if it cannot be retrieved, a 500 Internal Server Error status, and
+// returns false.
+func (h handler) linkQuota(w http.ResponseWriter, r *http.Request, id string) (int64, bool) {
+	t, err := tenant.Get(r.Context(), tenant.GetParams{
+		DB:          h.db,
+		Environment: h.environment,
+		ID:          id,
+	})
+	if err == tenant.ErrNotFound {
+		http.Error(w, "unknown tenant", http.StatusForbidden)
+		return 0, false
+	}
+	if err != nil {
+		log.Printf("failed to get tenant: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return 0, false
+	}
+
+	return t.Quotas.Links, true
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dwrz/url-shortener/internal/principal"
+)
+
+func TestDomain(t *testing.T) {
+	var tests = []struct {
+		Domains []string
+		Host    string
+		Err     error
+	}{
+		{Domains: nil, Host: "localhost:8080", Err: nil},
+		{Domains: []string{"ourco.link"}, Host: "ourco.link", Err: nil},
+		{Domains: []string{"ourco.link"}, Host: "OURCO.link:443", Err: nil},
+		{Domains: []string{"ourco.link", "localhost:8080"}, Host: "localhost", Err: nil},
+		{Domains: []string{"ourco.link"}, Host: "example.com", Err: errUnknownHost},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+		r.Host = test.Host
+		domain, owner, err := handler{domains: test.Domains}.domain(r)
+		if err != test.Err || domain != "" || owner != "" {
+			t.Errorf(
+				"%v %q: expected own domain and %v but got %q, %q, %v",
+				test.Domains, test.Host, test.Err, domain, owner, err,
+			)
+		}
+	}
+}
+
+func TestAbsoluteURL(t *testing.T) {
+	var tests = []struct {
+		Handler  handler
+		Domain   string
+		Expected string
+	}{
+		{
+			Handler:  handler{},
+			Expected: "https://localhost:8080/abc123",
+		},
+		{
+			Handler:  handler{urlScheme: "http"},
+			Expected: "http://localhost:8080/abc123",
+		},
+		{
+			Handler:  handler{domains: []string{"ourco.link", "ourco.io"}},
+			Expected: "https://ourco.link/abc123",
+		},
+		{
+			Handler:  handler{domains: []string{"ourco.link"}},
+			Domain:   "go.ourcompany.com",
+			Expected: "https://go.ourcompany.com/abc123",
+		},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Host = "localhost:8080"
+		got := test.Handler.absoluteURL(r, test.Domain, "abc123")
+		if got != test.Expected {
+			t.Errorf("%q: expected %q but got %q", test.Domain, test.Expected, got)
+		}
+	}
+}
+
+// TestUnknownHost checks that redirects and short URLs are not served,
+// or created, on hosts which are not the service's.
+func TestUnknownHost(t *testing.T) {
+	h := handler{domains: []string{"ourco.link"}}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+	r.Host = "example.com"
+	h.Redirect(w, r)
+	if w.Code != http.StatusMisdirectedRequest {
+		t.Errorf(
+			"redirect: expected status %d but got %d",
+			http.StatusMisdirectedRequest, w.Code,
+		)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(
+		http.MethodPost, "/", strings.NewReader("url=https%3A%2F%2Fexample.com%2F"),
+	)
+	r.Host = "example.com"
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r = r.WithContext(principal.NewContext(
+		r.Context(), &principal.Principal{ID: "ana"},
+	))
+	h.Create(w, r)
+	if w.Code != http.StatusMisdirectedRequest {
+		t.Errorf(
+			"create: expected status %d but got %d",
+			http.StatusMisdirectedRequest, w.Code,
+		)
+	}
+}
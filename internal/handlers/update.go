@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/shorturl"
+	"github.com/dwrz/url-shortener/internal/validurl"
+	"github.com/gorilla/mux"
+)
+
+// Update handles requests to change a short URL.
+// It expects an application/x-www-form-urlencoded body with any of the
+// following fields; fields left out are unchanged: "url", the long URL;
+// "title", which is removed if empty; "tags", a comma separated list of
+// tags, which are removed if empty; and "expiresAt", an RFC 3339
+// timestamp, which removes the expiry time if empty.
+// It responds with a 204 No Content status once the short URL is
+// changed, or a 404 Not Found status if it does not exist, or the
+// principal is neither its owner nor a member of its team.
+func (h handler) Update(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	params := shorturl.UpdateParams{
+		Cache:       h.cache,
+		DB:          h.db,
+		Environment: h.environment,
+		Short:       mux.Vars(r)["short"],
+	}
+
+	if _, ok := r.PostForm["url"]; ok {
+		longURL := r.PostForm.Get("url")
+		if err := validurl.Validate(longURL); err != nil {
+			http.Error(w, "invalid url", http.StatusBadRequest)
+			return
+		}
+		params.LongURL = &longURL
+	}
+
+	if _, ok := r.PostForm["title"]; ok {
+		title := r.PostForm.Get("title")
+		if len(title) > maxTitleLength {
+			http.Error(w, "invalid title", http.StatusBadRequest)
+			return
+		}
+		params.Title = &title
+	}
+
+	if _, ok := r.PostForm["tags"]; ok {
+		tags := shorturl.ParseTags(r.PostForm.Get("tags"))
+		if err := shorturl.ValidateTags(tags); err != nil {
+			http.Error(w, "invalid tags", http.StatusBadRequest)
+			return
+		}
+		params.Tags = &tags
+	}
+
+	if _, ok := r.PostForm["expiresAt"]; ok {
+		expiresAt, err := formTime(r, "expiresAt")
+		if err != nil || (expiresAt != nil && !expiresAt.After(time.Now())) {
+			http.Error(w, "invalid expiresAt", http.StatusBadRequest)
+			return
+		}
+		params.ExpiresAt = expiresAt
+		params.RemoveExpiry = expiresAt == nil
+	}
+
+	// Only the owner and the owner's team may change the short URL.
+	s := h.getAccessible(w, r)
+	if s == nil {
+		return
+	}
+	params.Tenant, params.Domain = s.Tenant, s.Domain
+
+	err := shorturl.Update(r.Context(), params)
+	if err == shorturl.ErrNotFound {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("failed to update short url: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Delete handles requests to delete a short URL. Its short code no
+// longer redirects, and its stats are no longer available.
+// It responds with a 204 No Content status once the short URL is
+// deleted, or a 404 Not Found status as for Update.
+func (h handler) Delete(w http.ResponseWriter, r *http.Request) {
+	// Only the owner and the owner's team may delete the short URL.
+	s := h.getAccessible(w, r)
+	if s == nil {
+		return
+	}
+
+	err := shorturl.Delete(r.Context(), shorturl.DeleteParams{
+		Cache:       h.cache,
+		DB:          h.db,
+		Environment: h.environment,
+		Tenant:      s.Tenant,
+		Domain:      s.Domain,
+		Short:       s.Short,
+	})
+	if err == shorturl.ErrNotFound {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("failed to delete short url: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestUpdate checks that invalid changes are rejected before the
+// database is queried.
+func TestUpdate(t *testing.T) {
+	var tests = []url.Values{
+		{"url": {""}},
+		{"url": {"ftp://example.com"}},
+		{"title": {strings.Repeat("a", maxTitleLength+1)}},
+		{"tags": {"Not A Tag"}},
+		{"expiresAt": {"tomorrow"}},
+		{"expiresAt": {"2000-01-01T00:00:00Z"}},
+	}
+
+	for _, form := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(
+			http.MethodPatch, "/abc123", strings.NewReader(form.Encode()),
+		)
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		handler{}.Update(w, r)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected status %d but got %d", form, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	t.Skip("TODO")
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/shorturl"
+)
+
+const (
+	// variantCookiePrefix prefixes the name of the cookie which
+	// assigns a visitor to a variant of a short URL. The short URL
+	// string is appended.
+	variantCookiePrefix = "v_"
+
+	// variantCookieMaxAge is how long a visitor is assigned to a
+	// variant.
+	variantCookieMaxAge = 30 * 24 * time.Hour
+)
+
+// assignVariant returns the variant of the short URL a visitor is
+// redirected to. Visitors are assigned a variant at random, by weight.
+// If the short URL's variants are sticky, the assignment is stored in a
+// cookie, and a visitor presenting a cookie for a variant that still
+// exists keeps it. The short URL must have variants.
+func assignVariant(
+	w http.ResponseWriter, r *http.Request, s *shorturl.ShortURL,
+) shorturl.Variant {
+	if !s.Sticky {
+		return s.PickVariant(rand.Intn(100))
+	}
+
+	name := variantCookiePrefix + s.Short
+
+	if c, err := r.Cookie(name); err == nil {
+		if v, ok := s.Variant(c.Value); ok {
+			return v
+		}
+	}
+
+	v := s.PickVariant(rand.Intn(100))
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    v.Name,
+		Path:     "/" + s.Short,
+		MaxAge:   int(variantCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return v
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dwrz/url-shortener/internal/shorturl"
+)
+
+func TestAssignVariant(t *testing.T) {
+	s := &shorturl.ShortURL{
+		Short:  "abc123",
+		Sticky: true,
+		Variants: []shorturl.Variant{
+			{Name: "a", URL: "https://example.com/a", Weight: 50},
+			{Name: "b", URL: "https://example.com/b", Weight: 50},
+		},
+	}
+
+	// A new visitor is assigned a variant, and a cookie.
+	recorder := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+	v := assignVariant(recorder, r, s)
+
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected 1 cookie but got %d", len(cookies))
+	}
+	if cookies[0].Name != "v_abc123" || cookies[0].Value != v.Name {
+		t.Errorf("unexpected cookie: %+v", cookies[0])
+	}
+
+	// A returning visitor keeps the variant, without a new cookie.
+	for i := 0; i < 10; i++ {
+		recorder = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/abc123", nil)
+		r.AddCookie(cookies[0])
+
+		if got := assignVariant(recorder, r, s); got != v {
+			t.Fatalf("expected sticky variant %s but got %s", v.Name, got.Name)
+		}
+		if n := len(recorder.Result().Cookies()); n != 0 {
+			t.Errorf("expected no new cookie but got %d", n)
+		}
+	}
+
+	// An unknown variant is reassigned.
+	recorder = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/abc123", nil)
+	r.AddCookie(&http.Cookie{Name: "v_abc123", Value: "removed"})
+	if got := assignVariant(recorder, r, s); got.Name != "a" && got.Name != "b" {
+		t.Errorf("unexpected variant %q", got.Name)
+	}
+	if n := len(recorder.Result().Cookies()); n != 1 {
+		t.Errorf("expected a new cookie but got %d", n)
+	}
+}
+
+func TestAssignVariantNotSticky(t *testing.T) {
+	s := &shorturl.ShortURL{
+		Short: "abc123",
+		Variants: []shorturl.Variant{
+			{Name: "a", URL: "https://example.com/a", Weight: 50},
+			{Name: "b", URL: "https://example.com/b", Weight: 50},
+		},
+	}
+
+	recorder := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+	assignVariant(recorder, r, s)
+
+	if n := len(recorder.Result().Cookies()); n != 0 {
+		t.Errorf("expected no cookie but got %d", n)
+	}
+}
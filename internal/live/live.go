@@ -0,0 +1,191 @@
+// Package live broadcasts visits to short URLs as they are recorded, to
+// in-process subscribers; e.g., clients watching a launch in real time.
+//
+// Publishing never blocks the visit being recorded. Each subscription
+// buffers a limited number of events; if a subscriber falls behind,
+// further events are dropped and counted, rather than queued.
+package live
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// bufferSize is the number of events a subscription holds for a
+	// subscriber which has fallen behind.
+	bufferSize = 64
+
+	// defaultMaxSubscribers is the number of concurrent subscriptions
+	// a Hub allows, if not otherwise specified.
+	defaultMaxSubscribers = 1000
+)
+
+var (
+	// ErrClosed is returned when subscribing to a closed Hub.
+	ErrClosed = fmt.Errorf("hub closed")
+
+	// ErrTooManySubscribers is returned when a Hub has reached its
+	// maximum number of subscriptions.
+	ErrTooManySubscribers = fmt.Errorf("too many subscribers")
+)
+
+// Event describes a recorded visit. It holds the same classification
+// as the visit record, but nothing identifying the visitor.
+type Event struct {
+	Short    string    `json:"short"`
+	Time     time.Time `json:"time"`
+	Target   string    `json:"target,omitempty"`
+	Variant  string    `json:"variant,omitempty"`
+	Country  string    `json:"country,omitempty"`
+	Referrer string    `json:"referrer,omitempty"`
+	Browser  string    `json:"browser,omitempty"`
+	OS       string    `json:"os,omitempty"`
+	Device   string    `json:"device,omitempty"`
+	Language string    `json:"language,omitempty"`
+	Bot      bool      `json:"bot,omitempty"`
+
+	// Tenant, Owner, and Team are those of the short URL, so that
+	// streams of all visits can be restricted to the short URLs a
+	// subscriber may access, and Domain its custom domain, if any, so
+	// that streams of a short URL can be restricted to its domain.
+	// They are not sent to subscribers.
+	Tenant string `json:"-"`
+	Owner  string `json:"-"`
+	Team   string `json:"-"`
+	Domain string `json:"-"`
+}
+
+// Hub broadcasts events to subscriptions.
+// A nil Hub discards events.
+type Hub struct {
+	mu             sync.RWMutex
+	closed         bool
+	subs           map[*Subscription]struct{}
+	maxSubscribers int
+}
+
+// NewHub returns a Hub allowing at most maxSubscribers concurrent
+// subscriptions. A maxSubscribers of zero or less uses
+// defaultMaxSubscribers.
+func NewHub(maxSubscribers int) *Hub {
+	if maxSubscribers <= 0 {
+		maxSubscribers = defaultMaxSubscribers
+	}
+
+	return &Hub{
+		subs:           map[*Subscription]struct{}{},
+		maxSubscribers: maxSubscribers,
+	}
+}
+
+// Subscribe returns a subscription to the events for a short URL, or to
+// all events if short is empty. The subscription must be closed once
+// it is no longer read.
+func (h *Hub) Subscribe(short string) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, ErrClosed
+	}
+	if len(h.subs) >= h.maxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+
+	s := &Subscription{
+		hub:    h,
+		short:  short,
+		events: make(chan Event, bufferSize),
+	}
+	h.subs[s] = struct{}{}
+
+	return s, nil
+}
+
+// Publish sends an event to the matching subscriptions, without
+// blocking. Subscriptions whose buffers are full drop the event.
+func (h *Hub) Publish(e Event) {
+	if h == nil {
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for s := range h.subs {
+		if s.short != "" && s.short != e.Short {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+// Close closes all subscriptions, and rejects new ones. Subscribers see
+// their event channels closed.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+	h.closed = true
+
+	for s := range h.subs {
+		close(s.events)
+		delete(h.subs, s)
+	}
+}
+
+// Len returns the number of open subscriptions.
+func (h *Hub) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.subs)
+}
+
+// Subscription receives the events published to a Hub for a short URL.
+type Subscription struct {
+	// dropped is first, so that it is 64-bit aligned for atomic
+	// operations on 32-bit platforms.
+	dropped uint64
+
+	hub    *Hub
+	short  string
+	events chan Event
+}
+
+// Events returns the channel events are received on. It is closed when
+// the subscription or the Hub is closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped returns the number of events dropped since the last call,
+// because the subscription's buffer was full.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.SwapUint64(&s.dropped, 0)
+}
+
+// Close removes the subscription from its Hub, and closes its event
+// channel. It is safe to call more than once, and after the Hub is
+// closed.
+func (s *Subscription) Close() {
+	h := s.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[s]; !ok {
+		return
+	}
+	delete(h.subs, s)
+	close(s.events)
+}
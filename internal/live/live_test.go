@@ -0,0 +1,106 @@
+package live
+
+import (
+	"testing"
+)
+
+// TestPublish checks that events reach matching subscriptions only.
+func TestPublish(t *testing.T) {
+	h := NewHub(0)
+
+	one, err := h.Subscribe("one")
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer one.Close()
+	all, err := h.Subscribe("")
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer all.Close()
+
+	h.Publish(Event{Short: "one"})
+	h.Publish(Event{Short: "two"})
+
+	if n := len(one.Events()); n != 1 {
+		t.Errorf("expected 1 event for one but got %d", n)
+	}
+	if n := len(all.Events()); n != 2 {
+		t.Errorf("expected 2 events for all but got %d", n)
+	}
+	if e := <-one.Events(); e.Short != "one" {
+		t.Errorf("expected an event for one but got %q", e.Short)
+	}
+}
+
+// TestPublishDropped checks that a full subscription drops and counts
+// events, rather than blocking.
+func TestPublishDropped(t *testing.T) {
+	h := NewHub(0)
+	s, err := h.Subscribe("")
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer s.Close()
+
+	for i := 0; i < bufferSize+3; i++ {
+		h.Publish(Event{})
+	}
+
+	if n := s.Dropped(); n != 3 {
+		t.Errorf("expected 3 dropped but got %d", n)
+	}
+	if n := s.Dropped(); n != 0 {
+		t.Errorf("expected dropped to reset but got %d", n)
+	}
+}
+
+// TestSubscribeLimit checks the subscription limit, and that closed
+// subscriptions free their place.
+func TestSubscribeLimit(t *testing.T) {
+	h := NewHub(1)
+	s, err := h.Subscribe("")
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	if _, err := h.Subscribe(""); err != ErrTooManySubscribers {
+		t.Errorf("expected %v but got %v", ErrTooManySubscribers, err)
+	}
+
+	s.Close()
+	s.Close()
+	if _, ok := <-s.Events(); ok {
+		t.Error("expected closed events")
+	}
+	if _, err := h.Subscribe(""); err != nil {
+		t.Errorf("failed to subscribe after close: %v", err)
+	}
+}
+
+// TestClose checks that closing a hub closes its subscriptions, and
+// rejects new ones.
+func TestClose(t *testing.T) {
+	h := NewHub(0)
+	s, err := h.Subscribe("")
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	h.Close()
+	h.Close()
+	if _, ok := <-s.Events(); ok {
+		t.Error("expected closed events")
+	}
+	s.Close()
+	h.Publish(Event{})
+
+	if _, err := h.Subscribe(""); err != ErrClosed {
+		t.Errorf("expected %v but got %v", ErrClosed, err)
+	}
+	if n := h.Len(); n != 0 {
+		t.Errorf("expected 0 subscriptions but got %d", n)
+	}
+
+	var nilHub *Hub
+	nilHub.Publish(Event{})
+}
@@ -0,0 +1,296 @@
+// Package oidc authenticates callers with JSON Web Tokens issued by an
+// OpenID Connect provider, such as the access tokens of internal tools.
+//
+// Token signatures are verified against a JSON Web Key Set, loaded from
+// a file or a URL. Keys are reloaded periodically, and when a token is
+// signed with an unknown key, so that providers may rotate keys.
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/principal"
+	"github.com/dwrz/url-shortener/pkg/jwt"
+)
+
+const (
+	// DefaultOwnerClaim is the claim identifying the owner of the
+	// short URLs a caller creates.
+	DefaultOwnerClaim = "sub"
+
+	// leeway allows for clock skew between the service and the
+	// provider when checking token validity times.
+	leeway = time.Minute
+
+	// maxKeySetSize is the maximum size of a key set, in bytes.
+	maxKeySetSize = 1 << 20
+
+	// fetchTimeout is the timeout for fetching a key set by URL.
+	fetchTimeout = 5 * time.Second
+
+	// refreshInterval is how often the key set is reloaded.
+	refreshInterval = 1 * time.Hour
+
+	// minRefreshInterval limits how often tokens signed with unknown
+	// keys may cause the key set to be reloaded.
+	minRefreshInterval = 1 * time.Minute
+)
+
+// ErrInvalidToken is returned for tokens which are malformed, not
+// signed by a key in the key set, not valid at the time of use, from
+// another issuer or for another audience, or without an owner.
+var ErrInvalidToken = fmt.Errorf("invalid token")
+
+type Params struct {
+	// JWKS is the path, or http(s) URL, of the key set.
+	JWKS string
+
+	// Issuer is the expected "iss" claim of tokens.
+	Issuer string
+
+	// Audience is the expected "aud" claim of tokens.
+	Audience string
+
+	// OwnerClaim is the claim identifying the principal of a token.
+	// Optional; defaults to DefaultOwnerClaim.
+	OwnerClaim string
+
+	// TeamClaim is the claim naming the team of the principal of a
+	// token. Optional; without it, principals have no team.
+	TeamClaim string
+
+	// TenantClaim is the claim naming the tenant of the principal of
+	// a token. Optional; without it, or without the claim, principals
+	// belong to the default tenant.
+	TenantClaim string
+
+	// Client is used to fetch key sets by URL. Optional; defaults to
+	// http.DefaultClient.
+	Client *http.Client
+}
+
+func (p Params) validate() error {
+	if p.JWKS == "" {
+		return fmt.Errorf("missing jwks")
+	}
+	if p.Issuer == "" {
+		return fmt.Errorf("missing issuer")
+	}
+	if p.Audience == "" {
+		return fmt.Errorf("missing audience")
+	}
+
+	return nil
+}
+
+// Authenticator authenticates tokens. It is safe for concurrent use.
+type Authenticator struct {
+	params Params
+
+	// minRefresh limits reloads on unknown keys; see
+	// minRefreshInterval.
+	minRefresh time.Duration
+
+	mu     sync.Mutex
+	keys   *jwt.KeySet
+	loaded time.Time
+
+	// loading is closed when the reload in progress, if any, ends.
+	// Key sets are reloaded without holding mu.
+	loading chan struct{}
+}
+
+// New returns an Authenticator, with the key set loaded.
+func New(ctx context.Context, p Params) (*Authenticator, error) {
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid params: %v", err)
+	}
+	if p.OwnerClaim == "" {
+		p.OwnerClaim = DefaultOwnerClaim
+	}
+	if p.Client == nil {
+		p.Client = http.DefaultClient
+	}
+
+	a := &Authenticator{params: p, minRefresh: minRefreshInterval}
+
+	keys, err := a.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	a.keys, a.loaded = keys, time.Now()
+
+	return a, nil
+}
+
+// Len returns the number of keys in the loaded key set.
+func (a *Authenticator) Len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.keys.Len()
+}
+
+// Authenticate verifies a token, and returns the principal it was issued
+// to. The principal is identified by the owner claim, belongs to the
+// tenant and team in the tenant and team claims, if configured, and
+// carries the scopes in the
+// "scope" claim, as a space separated list, or the "scp" claim, as an
+// array. It returns ErrInvalidToken if the token is not valid.
+func (a *Authenticator) Authenticate(ctx context.Context, token string) (*principal.Principal, error) {
+	t, err := jwt.Parse(token)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	err = t.Verify(a.keySet(ctx, false))
+	if err == jwt.ErrUnknownKey {
+		err = t.Verify(a.keySet(ctx, true))
+	}
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if err := t.Validate(jwt.Expected{
+		Issuer:   a.params.Issuer,
+		Audience: a.params.Audience,
+		Leeway:   leeway,
+	}); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return a.principal(t.Claims)
+}
+
+// principal maps the claims of a verified token to a principal.
+func (a *Authenticator) principal(c jwt.Claims) (*principal.Principal, error) {
+	id, _ := c.String(a.params.OwnerClaim)
+	if id == "" {
+		return nil, ErrInvalidToken
+	}
+
+	p := &principal.Principal{ID: id}
+	if a.params.TenantClaim != "" {
+		p.Tenant, _ = c.String(a.params.TenantClaim)
+	}
+	if a.params.TeamClaim != "" {
+		p.Team, _ = c.String(a.params.TeamClaim)
+	}
+	if scope, ok := c.String("scope"); ok {
+		p.Scopes = strings.Fields(scope)
+	} else {
+		p.Scopes = c.Strings("scp")
+	}
+
+	return p, nil
+}
+
+// keySet returns the key set, reloading it if it is due, or if unknown
+// is set, because a token was signed with an unknown key. Failed reloads
+// are logged, and the loaded key set is kept.
+//
+// One caller reloads the key set at a time. Meanwhile, other callers use
+// the loaded key set, unless unknown is set; those wait for the reload,
+// or for ctx to end.
+func (a *Authenticator) keySet(ctx context.Context, unknown bool) *jwt.KeySet {
+	a.mu.Lock()
+	age := time.Since(a.loaded)
+	if age < refreshInterval && (!unknown || age < a.minRefresh) {
+		defer a.mu.Unlock()
+		return a.keys
+	}
+
+	if loading := a.loading; loading != nil {
+		if !unknown {
+			defer a.mu.Unlock()
+			return a.keys
+		}
+		a.mu.Unlock()
+
+		select {
+		case <-loading:
+		case <-ctx.Done():
+		}
+
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		return a.keys
+	}
+
+	loading := make(chan struct{})
+	a.loading = loading
+	a.mu.Unlock()
+
+	// The reload is shared with other callers, so it is not canceled
+	// with the caller's context.
+	keys, err := a.load(context.Background())
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	defer close(loading)
+	a.loading = nil
+
+	if err != nil {
+		log.Printf("failed to reload jwks: %v", err)
+		// Do not retry on every request.
+		a.loaded = time.Now()
+		return a.keys
+	}
+	a.keys, a.loaded = keys, time.Now()
+
+	return a.keys
+}
+
+// load reads and parses the key set.
+func (a *Authenticator) load(ctx context.Context) (*jwt.KeySet, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if strings.HasPrefix(a.params.JWKS, "http://") ||
+		strings.HasPrefix(a.params.JWKS, "https://") {
+		data, err = a.fetch(ctx)
+	} else {
+		data, err = ioutil.ReadFile(a.params.JWKS)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jwks: %v", err)
+	}
+
+	keys, err := jwt.ParseKeySet(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse jwks: %v", err)
+	}
+
+	return keys, nil
+}
+
+// fetch gets the key set by URL.
+func (a *Authenticator) fetch(ctx context.Context) ([]byte, error) {
+	fetchContext, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, a.params.JWKS, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := a.params.Client.Do(req.WithContext(fetchContext))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+
+	return ioutil.ReadAll(io.LimitReader(res.Body, maxKeySetSize))
+}
@@ -0,0 +1,309 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	issuer   = "https://issuer.example.com"
+	audience = "url-shortener"
+)
+
+// provider is a local stand-in for an OpenID Connect provider, serving a
+// key set, and signing tokens.
+type provider struct {
+	mu   sync.Mutex
+	kid  string
+	key  *rsa.PrivateKey
+	hits int
+}
+
+func newProvider(t *testing.T) *provider {
+	p := &provider{}
+	p.rotate(t)
+
+	return p
+}
+
+// rotate replaces the provider's key.
+func (p *provider) rotate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.key = key
+	p.kid = fmt.Sprintf("key-%d", time.Now().UnixNano())
+}
+
+func (p *provider) jwks() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return []byte(fmt.Sprintf(
+		`{"keys": [{"kty": "RSA", "kid": %q, "use": "sig", "alg": "RS256", "n": %q, "e": %q}]}`,
+		p.kid,
+		base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+	))
+}
+
+// fetches returns the number of times the key set was fetched.
+func (p *provider) fetches() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.hits
+}
+
+func (p *provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	p.hits++
+	p.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(p.jwks())
+}
+
+// sign returns a token with the claims, signed with the provider's key.
+func (p *provider) sign(t *testing.T, claims map[string]interface{}) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": p.kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+
+	h := crypto.SHA256.New()
+	h.Write([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, h.Sum(nil))
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func claims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":   issuer,
+		"aud":   audience,
+		"sub":   "ana",
+		"team":  "ads",
+		"org":   "acme",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "openid links:write stats:read",
+	}
+}
+
+func TestParamsValidate(t *testing.T) {
+	var tests = []struct {
+		name   string
+		params Params
+	}{
+		{"missing jwks", Params{Issuer: issuer, Audience: audience}},
+		{"missing issuer", Params{JWKS: "jwks.json", Audience: audience}},
+		{"missing audience", Params{JWKS: "jwks.json", Issuer: issuer}},
+	}
+	for _, test := range tests {
+		if err := test.params.validate(); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	p := newProvider(t)
+	server := httptest.NewServer(p)
+	defer server.Close()
+
+	a, err := New(context.Background(), Params{
+		JWKS:        server.URL,
+		Issuer:      issuer,
+		Audience:    audience,
+		TeamClaim:   "team",
+		TenantClaim: "org",
+	})
+	if err != nil {
+		t.Fatalf("failed to create authenticator: %v", err)
+	}
+
+	principal, err := a.Authenticate(context.Background(), p.sign(t, claims()))
+	if err != nil {
+		t.Fatalf("failed to authenticate: %v", err)
+	}
+	if principal.ID != "ana" || principal.Tenant != "acme" || principal.Team != "ads" {
+		t.Errorf("expected principal ana of tenant acme, team ads but got %v", principal)
+	}
+	if !principal.HasScope("links:write") || !principal.HasScope("stats:read") {
+		t.Errorf("expected links:write and stats:read scopes but got %v", principal.Scopes)
+	}
+
+	// Scopes may be an array, in the "scp" claim.
+	c := claims()
+	delete(c, "scope")
+	c["scp"] = []string{"stats:read"}
+	principal, err = a.Authenticate(context.Background(), p.sign(t, c))
+	if err != nil {
+		t.Fatalf("failed to authenticate: %v", err)
+	}
+	if principal.HasScope("links:write") || !principal.HasScope("stats:read") {
+		t.Errorf("expected only the stats:read scope but got %v", principal.Scopes)
+	}
+
+	var invalid = []struct {
+		name   string
+		modify func(map[string]interface{})
+	}{
+		{"wrong issuer", func(c map[string]interface{}) { c["iss"] = "https://other.example.com" }},
+		{"wrong audience", func(c map[string]interface{}) { c["aud"] = "other" }},
+		{"expired", func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{"missing owner", func(c map[string]interface{}) { delete(c, "sub") }},
+	}
+	for _, test := range invalid {
+		c := claims()
+		test.modify(c)
+		if _, err := a.Authenticate(context.Background(), p.sign(t, c)); err != ErrInvalidToken {
+			t.Errorf("%s: expected %v but got %v", test.name, ErrInvalidToken, err)
+		}
+	}
+	if _, err := a.Authenticate(context.Background(), "usk_not-a-token"); err != ErrInvalidToken {
+		t.Errorf("expected %v for a malformed token but got %v", ErrInvalidToken, err)
+	}
+}
+
+// TestAuthenticateRotation checks that the key set is reloaded when a
+// token is signed with an unknown key, at most once per interval.
+func TestAuthenticateRotation(t *testing.T) {
+	p := newProvider(t)
+	server := httptest.NewServer(p)
+	defer server.Close()
+
+	a, err := New(context.Background(), Params{
+		JWKS:     server.URL,
+		Issuer:   issuer,
+		Audience: audience,
+	})
+	if err != nil {
+		t.Fatalf("failed to create authenticator: %v", err)
+	}
+
+	// Within the minimum refresh interval, unknown keys are rejected
+	// without reloading.
+	p.rotate(t)
+	if _, err := a.Authenticate(context.Background(), p.sign(t, claims())); err != ErrInvalidToken {
+		t.Errorf("expected %v but got %v", ErrInvalidToken, err)
+	}
+	if p.fetches() != 1 {
+		t.Errorf("expected 1 key set fetch but got %d", p.fetches())
+	}
+
+	a.minRefresh = 0
+	if _, err := a.Authenticate(context.Background(), p.sign(t, claims())); err != nil {
+		t.Errorf("expected the rotated key to be accepted but got %v", err)
+	}
+	if p.fetches() != 2 {
+		t.Errorf("expected 2 key set fetches but got %d", p.fetches())
+	}
+}
+
+// TestAuthenticateRotationConcurrent checks that concurrent callers
+// share key set reloads, which are not canceled with a caller's context.
+func TestAuthenticateRotationConcurrent(t *testing.T) {
+	p := newProvider(t)
+	server := httptest.NewServer(p)
+	defer server.Close()
+
+	a, err := New(context.Background(), Params{
+		JWKS:     server.URL,
+		Issuer:   issuer,
+		Audience: audience,
+	})
+	if err != nil {
+		t.Fatalf("failed to create authenticator: %v", err)
+	}
+	a.minRefresh = 0
+
+	p.rotate(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := a.Authenticate(ctx, p.sign(t, claims())); err != nil {
+		t.Errorf("expected the rotated key to be accepted but got %v", err)
+	}
+
+	p.rotate(t)
+	token := p.sign(t, claims())
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := a.Authenticate(context.Background(), token)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("expected the rotated key to be accepted but got %v", err)
+		}
+	}
+}
+
+func TestNewFromFile(t *testing.T) {
+	p := newProvider(t)
+
+	dir, err := ioutil.TempDir("", "oidc")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "jwks.json")
+	if err := ioutil.WriteFile(path, p.jwks(), 0600); err != nil {
+		t.Fatalf("failed to write jwks: %v", err)
+	}
+
+	a, err := New(context.Background(), Params{
+		JWKS:     path,
+		Issuer:   issuer,
+		Audience: audience,
+	})
+	if err != nil {
+		t.Fatalf("failed to create authenticator: %v", err)
+	}
+	if a.Len() != 1 {
+		t.Errorf("expected 1 key but got %d", a.Len())
+	}
+	if _, err := a.Authenticate(context.Background(), p.sign(t, claims())); err != nil {
+		t.Errorf("failed to authenticate: %v", err)
+	}
+
+	if _, err := New(context.Background(), Params{
+		JWKS:     filepath.Join(dir, "missing.json"),
+		Issuer:   issuer,
+		Audience: audience,
+	}); err == nil {
+		t.Error("expected an error for a missing jwks file")
+	}
+}
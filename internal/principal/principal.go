@@ -0,0 +1,75 @@
+// Package principal describes the authenticated callers of the service,
+// and what they may access.
+package principal
+
+import "context"
+
+// Principal is an authenticated caller; e.g., a user, or a service
+// holding an API key.
+type Principal struct {
+	// ID identifies the principal. Short URLs are owned by the
+	// principal which created them.
+	ID string
+
+	// Tenant is the ID of the tenant the principal belongs to; empty
+	// for the default tenant. Principals only see the resources of
+	// their tenant.
+	Tenant string
+
+	// Team is the team the principal belongs to, if any. Members of
+	// a team share access to the short URLs of its members.
+	Team string
+
+	// Scopes are what the principal may do; e.g., "links:write".
+	Scopes []string
+
+	// All is set for principals which may access every resource of
+	// their tenant, whatever its owner.
+	All bool
+}
+
+// HasScope reports whether the principal carries a scope.
+func (p Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CanAccess reports whether the principal may manage, and read the stats
+// of, a resource of a tenant, with an owner and team: if it belongs to
+// the tenant, and is the owner, or a member of the team, or may access
+// all of the tenant's resources. Resources without an owner predate
+// ownership, and may be accessed by any principal of the tenant.
+func (p Principal) CanAccess(tenant, owner, team string) bool {
+	switch {
+	case tenant != p.Tenant:
+		return false
+	case p.All:
+		return true
+	case owner == "":
+		return true
+	case owner == p.ID:
+		return true
+	default:
+		return team != "" && team == p.Team
+	}
+}
+
+// contextKey is the type of context keys for this package.
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the principal.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal carried by ctx, or nil.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+
+	return p
+}
@@ -0,0 +1,62 @@
+package principal
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHasScope(t *testing.T) {
+	p := Principal{Scopes: []string{"stats:read"}}
+	if !p.HasScope("stats:read") {
+		t.Errorf("expected principal to have scope stats:read")
+	}
+	if p.HasScope("links:write") {
+		t.Errorf("expected principal not to have scope links:write")
+	}
+}
+
+func TestCanAccess(t *testing.T) {
+	var tests = []struct {
+		Principal Principal
+		Tenant    string
+		Owner     string
+		Team      string
+		Expected  bool
+	}{
+		{Principal: Principal{ID: "ana"}, Owner: "ana", Expected: true},
+		{Principal: Principal{ID: "ana"}, Owner: "bo", Expected: false},
+		{Principal: Principal{ID: "ana", Team: "ads"}, Owner: "bo", Team: "ads", Expected: true},
+		{Principal: Principal{ID: "ana", Team: "ads"}, Owner: "bo", Team: "web", Expected: false},
+		{Principal: Principal{ID: "ana", Team: "ads"}, Owner: "bo", Expected: false},
+		{Principal: Principal{ID: "ana"}, Owner: "bo", Team: "", Expected: false},
+		{Principal: Principal{ID: "ana"}, Owner: "", Expected: true},
+		{Principal: Principal{ID: "ana"}, Tenant: "acme", Owner: "", Expected: false},
+		{Principal: Principal{ID: "ana"}, Tenant: "acme", Owner: "ana", Expected: false},
+		{Principal: Principal{ID: "ana", Tenant: "acme"}, Tenant: "acme", Owner: "ana", Expected: true},
+		{Principal: Principal{ID: "ana", Tenant: "acme"}, Owner: "ana", Expected: false},
+		{Principal: Principal{ID: "ana", All: true}, Owner: "bo", Team: "web", Expected: true},
+		{Principal: Principal{ID: "ana", All: true}, Tenant: "acme", Owner: "bo", Expected: false},
+	}
+
+	for _, test := range tests {
+		if got := test.Principal.CanAccess(test.Tenant, test.Owner, test.Team); got != test.Expected {
+			t.Errorf(
+				"%v accessing %q/%q/%q: expected %t but got %t",
+				test.Principal, test.Tenant, test.Owner, test.Team,
+				test.Expected, got,
+			)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if p := FromContext(ctx); p != nil {
+		t.Errorf("expected no principal but got %v", p)
+	}
+
+	p := &Principal{ID: "ana"}
+	if got := FromContext(NewContext(ctx, p)); got != p {
+		t.Errorf("expected principal %v but got %v", p, got)
+	}
+}
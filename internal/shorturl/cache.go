@@ -0,0 +1,81 @@
+package shorturl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dwrz/url-shortener/internal/cache"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// cacheKey returns the cache key for a short URL on a domain.
+// Keys are namespaced by environment, since environments may share a
+// cache server, and by custom domain, since short URL strings are only
+// unique on a domain.
+func cacheKey(environment, domain, short string) string {
+	if domain == "" {
+		return fmt.Sprintf("%s:%s:%s", environment, Collection, short)
+	}
+
+	return fmt.Sprintf("%s:%s:%s:%s", environment, Collection, domain, short)
+}
+
+// generationKey returns the cache key counting the invalidations of a
+// cached short URL. Short URL strings hold no ":", so it cannot be the
+// key of a short URL on a custom domain.
+func generationKey(key string) string {
+	return key + ":generation"
+}
+
+// generation returns the number of invalidations of a cached short URL.
+// It is read with IncrBy, so that it is read from the cache server,
+// never from a copy held by the instance.
+func generation(ctx context.Context, c cache.Cache, key string) (int64, error) {
+	return c.IncrBy(ctx, generationKey(key), 0, generationTTL)
+}
+
+// store caches a short URL read from the database, when the short URL's
+// generation was gen. If the short URL has been invalidated since, the
+// short URL read may be stale, and is removed from the cache again.
+// Invalidate raises the generation before removing the short URL, so
+// either the generation differs here, or the short URL is removed after
+// it is stored.
+func store(ctx context.Context, c cache.Cache, key string, gen int64, short *ShortURL) error {
+	b, err := bson.Marshal(short)
+	if err != nil {
+		return fmt.Errorf("failed to encode: %v", err)
+	}
+	if err := c.Set(ctx, key, b, cacheTTL); err != nil {
+		return fmt.Errorf("failed to set: %v", err)
+	}
+
+	current, err := generation(ctx, c, key)
+	if err == nil && current == gen {
+		return nil
+	}
+	if err := c.Invalidate(ctx, key); err != nil {
+		return fmt.Errorf("failed to remove stale short url: %v", err)
+	}
+
+	return nil
+}
+
+// Invalidate removes a short URL on a domain from the cache, on every
+// service instance. It should be called whenever a ShortURL document is
+// modified or removed, after it is.
+func Invalidate(ctx context.Context, c cache.Cache, environment, domain, short string) error {
+	if c == nil {
+		return nil
+	}
+
+	key := cacheKey(environment, domain, short)
+	_, genErr := c.IncrBy(ctx, generationKey(key), 1, generationTTL)
+	if err := c.Invalidate(ctx, key); err != nil {
+		return err
+	}
+	if genErr != nil {
+		return fmt.Errorf("failed to count invalidation: %v", genErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package shorturl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dwrz/url-shortener/internal/cache"
+)
+
+func TestCacheKey(t *testing.T) {
+	a := cacheKey("development", "", "abc123")
+	b := cacheKey("production", "", "abc123")
+	c := cacheKey("development", "go.example.com", "abc123")
+
+	if a == b {
+		t.Errorf("expected keys to differ by environment, got %q", a)
+	}
+	if a == c {
+		t.Errorf("expected keys to differ by domain, got %q", a)
+	}
+	if a != "development:urls:abc123" {
+		t.Errorf("unexpected key %q", a)
+	}
+	if c != "development:urls:go.example.com:abc123" {
+		t.Errorf("unexpected key %q", c)
+	}
+}
+
+// TestStore checks that a short URL read before an invalidation, and
+// stored after it, is not left in the cache.
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewLocal(0)
+	key := cacheKey("development", "", "abc123")
+	short := &ShortURL{Short: "abc123", URL: "https://example.com"}
+
+	gen, err := generation(ctx, c, key)
+	if err != nil {
+		t.Fatalf("failed to get generation: %v", err)
+	}
+	if err := store(ctx, c, key, gen, short); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+	if _, err := c.Get(ctx, key); err != nil {
+		t.Errorf("expected short url to be cached, but got %v", err)
+	}
+
+	// Read the generation, as if before reading the database, then
+	// invalidate the short URL before it is stored.
+	gen, err = generation(ctx, c, key)
+	if err != nil {
+		t.Fatalf("failed to get generation: %v", err)
+	}
+	if err := Invalidate(ctx, c, "development", "", "abc123"); err != nil {
+		t.Fatalf("failed to invalidate: %v", err)
+	}
+	if err := store(ctx, c, key, gen, short); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+	if _, err := c.Get(ctx, key); err != cache.ErrMiss {
+		t.Errorf("expected stale short url to be removed, but got %v", err)
+	}
+}
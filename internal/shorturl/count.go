@@ -0,0 +1,48 @@
+package shorturl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dwrz/url-shortener/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type CountParams struct {
+	DB          *mongo.Client
+	Environment string
+	Tenant      string
+}
+
+func (p CountParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+
+	return nil
+}
+
+// Count returns the number of short URLs of a tenant; e.g., to enforce
+// its quota.
+func Count(ctx context.Context, p CountParams) (int64, error) {
+	if err := p.validate(); err != nil {
+		return 0, fmt.Errorf("invalid params: %v", err)
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+	countContext, cancel := context.WithTimeout(ctx, countTimeout)
+	defer cancel()
+
+	n, err := coll.CountDocuments(
+		countContext, bson.M{"tenant": tenant.Match(p.Tenant)},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count: %v", err)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,11 @@
+package shorturl
+
+import "testing"
+
+func TestCountParamsValidate(t *testing.T) {
+	t.Skip("TODO")
+}
+
+func TestCount(t *testing.T) {
+	t.Skip("TODO")
+}
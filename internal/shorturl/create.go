@@ -6,15 +6,66 @@ import (
 	"log"
 	"time"
 
+	"github.com/dwrz/url-shortener/internal/tenant"
 	"github.com/dwrz/url-shortener/pkg/randstr"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type CreateParams struct {
 	DB          *mongo.Client
 	Environment string
 	LongURL     string
+	Title       string
+
+	// Tenant is the ID of the tenant the short URL belongs to, and
+	// Domain the custom domain it is served on, if any.
+	Tenant string
+	Domain string
+
+	// MaxLinks is the maximum number of short URLs of the tenant,
+	// from its quotas. Zero means no limit.
+	MaxLinks int64
+
+	// Owner is the ID of the principal creating the short URL, and
+	// Team its team, if any.
+	Owner string
+	Team  string
+
+	// Tags group short URLs.
+	// They should be checked with ValidateTags.
+	Tags []string
+
+	// Interstitial settings; see ShortURL.
+	Interstitial      bool
+	InterstitialDelay int
+
+	// Optional expiry settings; see ShortURL.
+	ExpiresAt   *time.Time
+	MaxVisits   int64
+	FallbackURL string
+
+	// Optional activation window; see ShortURL.
+	ActiveFrom  *time.Time
+	ActiveUntil *time.Time
+	PendingURL  string
+
+	// Targets redirect matching visitors to alternate URLs.
+	// They should be checked with ValidateTargets.
+	Targets []Target
+
+	// Variants split traffic between several URLs.
+	// They should be checked with ValidateVariants.
+	Variants []Variant
+	Sticky   bool
+
+	// TrackConversions appends click IDs to redirects; see ShortURL.
+	TrackConversions bool
+
+	// Password is required to follow the short URL, if set.
+	// It is stored as a bcrypt hash.
+	Password string
 }
 
 func (p CreateParams) validate() error {
@@ -27,12 +78,40 @@ func (p CreateParams) validate() error {
 	if p.LongURL == "" {
 		return fmt.Errorf("missing long url")
 	}
+	if p.Owner == "" {
+		return fmt.Errorf("missing owner")
+	}
+	if p.MaxLinks < 0 {
+		return fmt.Errorf("invalid max links")
+	}
+	if p.MaxVisits < 0 {
+		return fmt.Errorf("invalid max visits")
+	}
+	if p.InterstitialDelay < 0 || p.InterstitialDelay > MaxInterstitialDelay {
+		return fmt.Errorf("invalid interstitial delay")
+	}
+	if err := ValidateTargets(p.Targets); err != nil {
+		return fmt.Errorf("invalid targets: %v", err)
+	}
+	if err := ValidateVariants(p.Variants); err != nil {
+		return fmt.Errorf("invalid variants: %v", err)
+	}
+	if err := ValidateTags(p.Tags); err != nil {
+		return fmt.Errorf("invalid tags: %v", err)
+	}
+	if err := ValidatePassword(p.Password); err != nil {
+		return fmt.Errorf("invalid password: %v", err)
+	}
+	if p.ActiveFrom != nil && p.ActiveUntil != nil &&
+		!p.ActiveUntil.After(*p.ActiveFrom) {
+		return fmt.Errorf("invalid activation window")
+	}
 
 	return nil
 }
 
-// Create generates a short URL string for the input long URL, and
-// inserts a new ShortURL document into MongoDB.
+// Create generates a short URL string for the input long URL, unique on
+// the domain, and inserts a new ShortURL document into MongoDB.
 // Create attempts to create a short URL string of defaultLength.
 // If there is a collision, a new string is generated with an
 // incremented length -- which should reduce the likelihood of another
@@ -45,6 +124,8 @@ func (p CreateParams) validate() error {
 // Increasing the defaultLength of the short URL decreases this
 // possibility, as would using a read concern of linearizable.
 // The latter would come at the cost of increased latency.
+// The short URL is counted against the tenant's quota; Create returns
+// tenant.ErrQuotaExceeded if the tenant has MaxLinks short URLs.
 func Create(ctx context.Context, p CreateParams) (short string, err error) {
 	if err := p.validate(); err != nil {
 		return "", fmt.Errorf("invalid params: %v", err)
@@ -52,11 +133,41 @@ func Create(ctx context.Context, p CreateParams) (short string, err error) {
 
 	coll := p.DB.Database(p.Environment).Collection(Collection)
 
+	if err := tenant.Reserve(ctx, tenant.ReserveParams{
+		DB:          p.DB,
+		Environment: p.Environment,
+		ID:          p.Tenant,
+		Resource:    tenant.ResourceLinks,
+		Limit:       p.MaxLinks,
+		Count: func(ctx context.Context) (int64, error) {
+			return Count(ctx, CountParams{
+				DB:          p.DB,
+				Environment: p.Environment,
+				Tenant:      p.Tenant,
+			})
+		},
+	}); err != nil {
+		return "", err
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if err := tenant.Release(ctx, tenant.ReleaseParams{
+			DB:          p.DB,
+			Environment: p.Environment,
+			ID:          p.Tenant,
+			Resource:    tenant.ResourceLinks,
+		}); err != nil {
+			log.Printf("failed to release short url quota: %v", err)
+		}
+	}()
+
 	// Generate a short URL and check for collisions.
 	for length := defaultLength; length <= maxLength; length++ {
 		short = randstr.New(length)
 
-		filter := bson.M{"short": short}
+		filter := bson.M{"domain": domainMatch(p.Domain), "short": short}
 		findContext, cancel := context.WithTimeout(ctx, findTimeout)
 		defer cancel()
 
@@ -72,14 +183,45 @@ func Create(ctx context.Context, p CreateParams) (short string, err error) {
 		}
 	}
 
+	// Hash the password, if any.
+	var passwordHash string
+	if p.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword(
+			[]byte(p.Password), bcrypt.DefaultCost,
+		)
+		if err != nil {
+			return "", fmt.Errorf("failed to hash password: %v", err)
+		}
+		passwordHash = string(hash)
+	}
+
 	// Insert a new ShortURL document.
 	insertContext, cancel := context.WithTimeout(ctx, insertTimeout)
 	defer cancel()
 
 	if _, err := coll.InsertOne(insertContext, ShortURL{
-		Created: time.Now(),
-		Short:   short,
-		URL:     p.LongURL,
+		Created:           time.Now(),
+		Tenant:            p.Tenant,
+		Domain:            p.Domain,
+		Short:             short,
+		URL:               p.LongURL,
+		Owner:             p.Owner,
+		Team:              p.Team,
+		Title:             p.Title,
+		Tags:              p.Tags,
+		Interstitial:      p.Interstitial,
+		InterstitialDelay: p.InterstitialDelay,
+		ExpiresAt:         p.ExpiresAt,
+		MaxVisits:         p.MaxVisits,
+		FallbackURL:       p.FallbackURL,
+		ActiveFrom:        p.ActiveFrom,
+		ActiveUntil:       p.ActiveUntil,
+		PendingURL:        p.PendingURL,
+		Targets:           p.Targets,
+		Variants:          p.Variants,
+		Sticky:            p.Sticky,
+		TrackConversions:  p.TrackConversions,
+		PasswordHash:      passwordHash,
 	}); err != nil {
 		return "", fmt.Errorf("failed to insert: %v", err)
 	}
@@ -0,0 +1,79 @@
+package shorturl
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/dwrz/url-shortener/internal/cache"
+	"github.com/dwrz/url-shortener/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type DeleteParams struct {
+	// Cache is invalidated once the short URL is deleted.
+	Cache       cache.Cache
+	DB          *mongo.Client
+	Environment string
+
+	// Tenant and Domain are those of the short URL; see ShortURL.
+	Tenant string
+	Domain string
+	Short  string
+}
+
+func (p DeleteParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if p.Short == "" {
+		return fmt.Errorf("missing short")
+	}
+
+	return nil
+}
+
+// Delete deletes a short URL of a tenant, invalidates it in the cache,
+// and releases it from the tenant's quota. It returns ErrNotFound if the
+// short URL does not exist.
+// Records of its visits are kept until they pass retention, and its
+// rollups are kept; neither are reachable once it is deleted.
+func Delete(ctx context.Context, p DeleteParams) error {
+	if err := p.validate(); err != nil {
+		return fmt.Errorf("invalid params: %v", err)
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+	deleteContext, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	res, err := coll.DeleteOne(deleteContext, bson.M{
+		"tenant": tenant.Match(p.Tenant),
+		"domain": domainMatch(p.Domain),
+		"short":  p.Short,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete: %v", err)
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	if err := Invalidate(ctx, p.Cache, p.Environment, p.Domain, p.Short); err != nil {
+		log.Printf("failed to invalidate %s: %v", p.Short, err)
+	}
+	if err := tenant.Release(ctx, tenant.ReleaseParams{
+		DB:          p.DB,
+		Environment: p.Environment,
+		ID:          p.Tenant,
+		Resource:    tenant.ResourceLinks,
+	}); err != nil {
+		log.Printf("failed to release short url quota: %v", err)
+	}
+
+	return nil
+}
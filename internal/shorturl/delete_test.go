@@ -0,0 +1,11 @@
+package shorturl
+
+import "testing"
+
+func TestDeleteParamsValidate(t *testing.T) {
+	t.Skip("TODO")
+}
+
+func TestDelete(t *testing.T) {
+	t.Skip("TODO")
+}
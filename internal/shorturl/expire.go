@@ -0,0 +1,127 @@
+package shorturl
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/cache"
+	"github.com/dwrz/url-shortener/internal/visit"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ExpireParams struct {
+	Cache       cache.Cache
+	DB          *mongo.Client
+	Environment string
+}
+
+func (p ExpireParams) validate() error {
+	if p.Cache == nil {
+		return fmt.Errorf("missing cache")
+	}
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+
+	return nil
+}
+
+// Expire marks short URLs which have passed their expiry time or the
+// end of their activation window, or reached their visit limit, as
+// expired. Expired short URLs are
+// invalidated in the cache. It returns the number of short URLs marked.
+// Expire is intended to be called periodically. Redirects enforce
+// expiry on their own; marking expired short URLs allows them to skip
+// visit counting, and makes the state visible in the database.
+// Short URLs which cannot be checked or marked are logged and skipped,
+// so that one does not hold back the others; the returned error then
+// counts them.
+func Expire(ctx context.Context, p ExpireParams) (n int, err error) {
+	if err := p.validate(); err != nil {
+		return 0, fmt.Errorf("invalid params: %v", err)
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+
+	findContext, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	// Find unexpired short URLs with an expiry time, the end of an
+	// activation window, or a visit limit.
+	now := time.Now()
+	cursor, err := coll.Find(findContext, bson.M{
+		"expired": bson.M{"$ne": true},
+		"$or": []bson.M{
+			{"expiresAt": bson.M{"$lte": now}},
+			{"activeUntil": bson.M{"$lte": now}},
+			{"maxVisits": bson.M{"$gt": 0}},
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find: %v", err)
+	}
+
+	var candidates []ShortURL
+	if err := cursor.All(findContext, &candidates); err != nil {
+		return 0, fmt.Errorf("failed to decode: %v", err)
+	}
+
+	var failed int
+	for _, s := range candidates {
+		if !s.IsExpired(now) {
+			visits, err := visit.Count(ctx, visit.CountParams{
+				DB:          p.DB,
+				Environment: p.Environment,
+				Tenant:      s.Tenant,
+				ShortID:     s.ID,
+			})
+			if err != nil {
+				log.Printf("failed to count visits of %s: %v", s.Short, err)
+				failed++
+				continue
+			}
+			if visits < s.MaxVisits {
+				continue
+			}
+		}
+
+		// Skip short URLs marked expired since they were found; e.g., by
+		// another instance.
+		updateContext, cancel := context.WithTimeout(ctx, updateTimeout)
+		res, err := coll.UpdateOne(
+			updateContext,
+			bson.M{"_id": s.ID, "expired": bson.M{"$ne": true}},
+			bson.M{"$set": bson.M{"expired": true}},
+		)
+		cancel()
+		if err != nil {
+			log.Printf("failed to mark %s expired: %v", s.Short, err)
+			failed++
+			continue
+		}
+		if res.ModifiedCount == 0 {
+			continue
+		}
+		n++
+
+		if err := Invalidate(
+			ctx, p.Cache, p.Environment, s.Domain, s.Short,
+		); err != nil {
+			log.Printf("failed to invalidate %s: %v", s.Short, err)
+		}
+	}
+
+	if failed > 0 {
+		return n, fmt.Errorf(
+			"failed to expire %d of %d short urls", failed, len(candidates),
+		)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,11 @@
+package shorturl
+
+import "testing"
+
+func TestExpireParamsValidate(t *testing.T) {
+	t.Skip("TODO")
+}
+
+func TestExpire(t *testing.T) {
+	t.Skip("TODO")
+}
@@ -3,14 +3,32 @@ package shorturl
 import (
 	"context"
 	"fmt"
+	"log"
+
+	"github.com/dwrz/url-shortener/internal/cache"
+	"github.com/dwrz/url-shortener/internal/principal"
+	"github.com/dwrz/url-shortener/internal/tenant"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type GetParams struct {
+	// Cache is checked before the DB, if set.
+	Cache       cache.Cache
 	DB          *mongo.Client
 	Environment string
-	Short       string
+
+	// Tenant restricts the short URL to a tenant's. Optional; if nil,
+	// the short URL of any tenant is retrieved. Only public requests,
+	// such as redirects, which are scoped by domain, should omit it.
+	Tenant *string
+
+	// Domain is the custom domain of the short URL; empty for the
+	// service's own domain.
+	Domain string
+	Short  string
 }
 
 func (p GetParams) validate() error {
@@ -27,22 +45,201 @@ func (p GetParams) validate() error {
 	return nil
 }
 
-// Get retrieves a short URL document from the database.
+// Get retrieves a short URL document, by its domain and short URL
+// string. It returns ErrNotFound if the short URL does not exist, or
+// belongs to another tenant.
+// If a cache is provided, it is checked first; documents retrieved from
+// the database are then stored in the cache, unless the short URL was
+// invalidated while they were read. Cache errors are logged, but
+// otherwise ignored -- the database remains the source of truth.
 func Get(ctx context.Context, p GetParams) (short *ShortURL, err error) {
 
 	if err := p.validate(); err != nil {
 		return nil, fmt.Errorf("invalid params: %v", err)
 	}
 
+	key := cacheKey(p.Environment, p.Domain, p.Short)
+	cacheable := p.Cache != nil
+	var gen int64
+	if p.Cache != nil {
+		b, err := p.Cache.Get(ctx, key)
+		if err == nil {
+			if err := bson.Unmarshal(b, &short); err == nil {
+				if p.Tenant != nil && short.Tenant != *p.Tenant {
+					return nil, ErrNotFound
+				}
+				return short, nil
+			}
+			log.Printf("failed to decode cached short url: %v", err)
+		} else if err != cache.ErrMiss {
+			log.Printf("failed to get cached short url: %v", err)
+		}
+
+		// Read the generation before the database, so that the short
+		// URL is only cached if it was not invalidated meanwhile.
+		if gen, err = generation(ctx, p.Cache, key); err != nil {
+			log.Printf("failed to get cached short url generation: %v", err)
+			cacheable = false
+		}
+	}
+
 	coll := p.DB.Database(p.Environment).Collection(Collection)
 
 	findContext, cancel := context.WithTimeout(ctx, findTimeout)
 	defer cancel()
 
-	filter := bson.M{"short": p.Short}
-	if err := coll.FindOne(findContext, filter).Decode(&short); err != nil {
+	filter := bson.M{"domain": domainMatch(p.Domain), "short": p.Short}
+	if p.Tenant != nil {
+		filter["tenant"] = tenant.Match(*p.Tenant)
+	}
+	err = coll.FindOne(findContext, filter).Decode(&short)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
 		return nil, fmt.Errorf("failed to find: %v", err)
 	}
 
+	if cacheable {
+		if err := store(ctx, p.Cache, key, gen, short); err != nil {
+			log.Printf("failed to cache short url: %v", err)
+		}
+	}
+
 	return short, nil
 }
+
+type GetByIDsParams struct {
+	DB          *mongo.Client
+	Environment string
+	Tenant      string
+	IDs         []primitive.ObjectID
+}
+
+func (p GetByIDsParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+
+	return nil
+}
+
+// GetByIDs retrieves the short URL documents of a tenant with the given
+// IDs, keyed by ID. IDs without a document of the tenant are left out.
+func GetByIDs(ctx context.Context, p GetByIDsParams) (map[primitive.ObjectID]ShortURL, error) {
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid params: %v", err)
+	}
+
+	shorts := map[primitive.ObjectID]ShortURL{}
+	if len(p.IDs) == 0 {
+		return shorts, nil
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+
+	findContext, cancel := context.WithTimeout(ctx, findTimeout)
+	defer cancel()
+
+	cursor, err := coll.Find(findContext, bson.M{
+		"_id":    bson.M{"$in": p.IDs},
+		"tenant": tenant.Match(p.Tenant),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find: %v", err)
+	}
+
+	var docs []ShortURL
+	if err := cursor.All(findContext, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode: %v", err)
+	}
+	for _, s := range docs {
+		shorts[s.ID] = s
+	}
+
+	return shorts, nil
+}
+
+type GetShortsParams struct {
+	DB          *mongo.Client
+	Environment string
+	Tenant      string
+
+	// Tag restricts the short URLs to those with the tag. Optional;
+	// if empty, all short URLs are returned.
+	Tag string
+
+	// Principal restricts the short URLs to those it may access.
+	// Optional; if nil, short URLs are not restricted by owner.
+	Principal *principal.Principal
+}
+
+func (p GetShortsParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+
+	return nil
+}
+
+// GetShorts returns the short strings of a tenant's short URLs with a
+// tag, or of all its short URLs, keyed by ID, optionally restricted to
+// those a principal may access. Only the short strings are read, so that
+// the IDs of many short URLs can be held in memory.
+func GetShorts(ctx context.Context, p GetShortsParams) (map[primitive.ObjectID]string, error) {
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid params: %v", err)
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+
+	filter := bson.M{"tenant": tenant.Match(p.Tenant)}
+	if p.Tag != "" {
+		filter["tags"] = p.Tag
+	}
+	if p.Principal != nil && !p.Principal.All {
+		filter["$or"] = accessFilter(*p.Principal)
+	}
+
+	cursor, err := coll.Find(
+		ctx, filter, options.Find().SetProjection(bson.M{"short": 1}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	shorts := map[primitive.ObjectID]string{}
+	for cursor.Next(ctx) {
+		var s ShortURL
+		if err := cursor.Decode(&s); err != nil {
+			return nil, fmt.Errorf("failed to decode: %v", err)
+		}
+		shorts[s.ID] = s.Short
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read: %v", err)
+	}
+
+	return shorts, nil
+}
+
+// accessFilter returns the conditions of a $or query operator matching
+// the short URLs a principal may access; see Principal.CanAccess.
+func accessFilter(p principal.Principal) bson.A {
+	or := bson.A{
+		bson.M{"owner": bson.M{"$exists": false}},
+		bson.M{"owner": p.ID},
+	}
+	if p.Team != "" {
+		or = append(or, bson.M{"team": p.Team})
+	}
+
+	return or
+}
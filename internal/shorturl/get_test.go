@@ -1,6 +1,12 @@
 package shorturl
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dwrz/url-shortener/internal/principal"
+	"go.mongodb.org/mongo-driver/bson"
+)
 
 func TestGetParamsValidate(t *testing.T) {
 	t.Skip("TODO")
@@ -9,3 +15,31 @@ func TestGetParamsValidate(t *testing.T) {
 func TestGet(t *testing.T) {
 	t.Skip("TODO")
 }
+
+// TestAccessFilter checks that principals match their own short URLs,
+// their team's, and those without an owner.
+func TestAccessFilter(t *testing.T) {
+	unowned := bson.M{"owner": bson.M{"$exists": false}}
+
+	var tests = []struct {
+		Principal principal.Principal
+		Expected  bson.A
+	}{
+		{
+			Principal: principal.Principal{ID: "ana"},
+			Expected:  bson.A{unowned, bson.M{"owner": "ana"}},
+		},
+		{
+			Principal: principal.Principal{ID: "ana", Team: "ads"},
+			Expected: bson.A{
+				unowned, bson.M{"owner": "ana"}, bson.M{"team": "ads"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		if got := accessFilter(test.Principal); !reflect.DeepEqual(got, test.Expected) {
+			t.Errorf("%v: expected %v but got %v", test.Principal, test.Expected, got)
+		}
+	}
+}
@@ -1,15 +1,32 @@
 package shorturl
 
 import (
+	"context"
+	"fmt"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
 )
 
 const (
+	// cacheTTL is how long a ShortURL is cached.
+	cacheTTL = 1 * time.Hour
+
+	// generationTTL is how long the invalidations of a cached ShortURL
+	// are counted. It outlasts cacheTTL, so that counts are kept while
+	// the ShortURL may be cached.
+	generationTTL = 2 * cacheTTL
+
 	// Context timeouts for DB operations.
+	countTimeout  = 1 * time.Second
 	findTimeout   = 1 * time.Second
+	indexTimeout  = 30 * time.Second
 	insertTimeout = 1 * time.Second
+	updateTimeout = 5 * time.Second
 
 	// Collection is the MongoDB collection for ShortURL documents.
 	Collection = "urls"
@@ -18,6 +35,18 @@ const (
 	// New short URLs will be generated with this length.
 	defaultLength = 6
 
+	// DefaultInterstitialDelay is the number of seconds an
+	// interstitial page is shown for, if not otherwise specified.
+	DefaultInterstitialDelay = 5
+
+	// MaxInterstitialDelay is the maximum number of seconds an
+	// interstitial page may be shown for.
+	MaxInterstitialDelay = 60
+
+	// MaxPasswordLength is the maximum length of a password, in
+	// bytes; bcrypt only hashes this many.
+	MaxPasswordLength = 72
+
 	// maxLength is the maximum length of short URL strings.
 	// If a unique short URL id cannot be generated with a string of
 	// this length, an error is returned.
@@ -30,10 +59,191 @@ type ShortURL struct {
 	ID      primitive.ObjectID `bson:"_id,omitempty"`
 	Created time.Time          `bson:"created"`
 
+	// Tenant is the ID of the tenant the short URL belongs to; empty
+	// for the default tenant. See package tenant.
+	Tenant string `bson:"tenant,omitempty"`
+
+	// Domain is the custom domain the short URL is served on; empty
+	// for the service's own domain.
+	Domain string `bson:"domain,omitempty"`
+
 	// Short is the short URL string used to retrieve the long URL.
+	// It is unique on the short URL's domain.
 	Short string `bson:"short"`
 
 	// URL is the original long URL for which a short URL was
 	// created.
 	URL string `bson:"url"`
+
+	// Owner is the ID of the principal which created the short URL,
+	// and Team its team, if any. Only the owner and members of the
+	// team may manage the short URL, or read its stats. Short URLs
+	// created before ownership have no owner.
+	Owner string `bson:"owner,omitempty"`
+	Team  string `bson:"team,omitempty"`
+
+	// Title describes the short URL in previews. It is optional.
+	Title string `bson:"title,omitempty"`
+
+	// Tags group short URLs; e.g., for exports. They are optional.
+	Tags []string `bson:"tags,omitempty"`
+
+	// Interstitial shows visitors a page with the destination before
+	// redirecting them, for InterstitialDelay seconds.
+	Interstitial      bool `bson:"interstitial,omitempty"`
+	InterstitialDelay int  `bson:"interstitialDelay,omitempty"`
+
+	// ExpiresAt is the time after which the short URL no longer
+	// redirects to URL. It is optional.
+	ExpiresAt *time.Time `bson:"expiresAt,omitempty"`
+
+	// MaxVisits is the number of visits after which the short URL no
+	// longer redirects to URL. Zero means no limit.
+	MaxVisits int64 `bson:"maxVisits,omitempty"`
+
+	// FallbackURL is where visitors are sent once the short URL has
+	// expired. If empty, they receive a 410 Gone response.
+	FallbackURL string `bson:"fallbackUrl,omitempty"`
+
+	// ActiveFrom is the time before which the short URL does not
+	// redirect to URL. It is optional.
+	ActiveFrom *time.Time `bson:"activeFrom,omitempty"`
+
+	// ActiveUntil is the time after which the short URL no longer
+	// redirects to URL. It is optional, and behaves like ExpiresAt.
+	ActiveUntil *time.Time `bson:"activeUntil,omitempty"`
+
+	// PendingURL is where visitors are sent before ActiveFrom.
+	// If empty, they receive a "not yet available" response.
+	PendingURL string `bson:"pendingUrl,omitempty"`
+
+	// Targets redirect matching visitors to alternate URLs.
+	// Visitors not matching any target are redirected to URL.
+	Targets []Target `bson:"targets,omitempty"`
+
+	// Variants split visitors not matching any target between
+	// several URLs, by weight. If set, URL is not used for redirects.
+	Variants []Variant `bson:"variants,omitempty"`
+
+	// Sticky assigns returning visitors to the same variant, with a
+	// cookie.
+	Sticky bool `bson:"sticky,omitempty"`
+
+	// TrackConversions appends a signed click ID to the destination
+	// of each redirect, so that conversions can be attributed to the
+	// visit.
+	TrackConversions bool `bson:"trackConversions,omitempty"`
+
+	// PasswordHash is a bcrypt hash of the password required to
+	// follow the short URL. If empty, no password is required.
+	PasswordHash string `bson:"passwordHash,omitempty"`
+
+	// Expired is set once the short URL has reached its expiry time
+	// or visit limit.
+	Expired bool `bson:"expired,omitempty"`
+}
+
+// IsProtected reports whether a password is required to follow the
+// short URL.
+func (s ShortURL) IsProtected() bool {
+	return s.PasswordHash != ""
+}
+
+// CheckPassword reports whether the password matches the short URL's
+// password hash. The comparison is constant time.
+func (s ShortURL) CheckPassword(password string) bool {
+	if !s.IsProtected() {
+		return true
+	}
+
+	return bcrypt.CompareHashAndPassword(
+		[]byte(s.PasswordHash), []byte(password),
+	) == nil
+}
+
+// ValidatePassword returns an error if a password cannot protect a short
+// URL. An empty password protects nothing, and is valid.
+func ValidatePassword(password string) error {
+	if len(password) > MaxPasswordLength {
+		return fmt.Errorf("password longer than %d bytes", MaxPasswordLength)
+	}
+
+	return nil
+}
+
+// IsExpired reports whether the short URL has been marked as expired,
+// or has passed its expiry time or the end of its activation window.
+// Visit limits are not checked here, since they require a count of
+// visits.
+func (s ShortURL) IsExpired(now time.Time) bool {
+	if s.Expired {
+		return true
+	}
+	if s.ExpiresAt != nil && !now.Before(*s.ExpiresAt) {
+		return true
+	}
+
+	return s.ActiveUntil != nil && !now.Before(*s.ActiveUntil)
+}
+
+// IsPending reports whether the short URL's activation window has yet
+// to open.
+func (s ShortURL) IsPending(now time.Time) bool {
+	return s.ActiveFrom != nil && now.Before(*s.ActiveFrom)
+}
+
+// States of a short URL, as returned by State.
+const (
+	StateActive  = "active"
+	StateExpired = "expired"
+	StatePending = "pending"
+)
+
+// State returns whether the short URL is pending activation, active,
+// or expired.
+func (s ShortURL) State(now time.Time) string {
+	switch {
+	case s.IsExpired(now):
+		return StateExpired
+	case s.IsPending(now):
+		return StatePending
+	default:
+		return StateActive
+	}
+}
+
+// EnsureIndexes creates the indexes short URLs are retrieved and
+// counted with, if they do not exist. Short URL strings are unique on
+// each domain.
+func EnsureIndexes(ctx context.Context, db *mongo.Client, env string) error {
+	indexContext, cancel := context.WithTimeout(ctx, indexTimeout)
+	defer cancel()
+
+	if _, err := db.Database(env).Collection(Collection).Indexes().CreateMany(
+		indexContext, []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "domain", Value: 1},
+					{Key: "short", Value: 1},
+				},
+				Options: options.Index().SetUnique(true),
+			},
+			{Keys: bson.D{{Key: "tenant", Value: 1}}},
+		},
+	); err != nil {
+		return fmt.Errorf("failed to create indexes: %v", err)
+	}
+
+	return nil
+}
+
+// domainMatch returns the value of a query filter on the domain field
+// of short URLs, matching those on a domain. Short URLs on the
+// service's own domain have no domain field.
+func domainMatch(domain string) interface{} {
+	if domain == "" {
+		return nil
+	}
+
+	return domain
 }
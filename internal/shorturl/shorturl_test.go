@@ -0,0 +1,122 @@
+package shorturl
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestIsExpired(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+
+	var tests = []struct {
+		Name     string
+		Input    ShortURL
+		Expected bool
+	}{
+		{Name: "no expiry", Input: ShortURL{}, Expected: false},
+		{Name: "marked", Input: ShortURL{Expired: true}, Expected: true},
+		{Name: "past", Input: ShortURL{ExpiresAt: &past}, Expected: true},
+		{Name: "now", Input: ShortURL{ExpiresAt: &now}, Expected: true},
+		{Name: "future", Input: ShortURL{ExpiresAt: &future}, Expected: false},
+		{Name: "ended", Input: ShortURL{ActiveUntil: &past}, Expected: true},
+		{Name: "open", Input: ShortURL{ActiveUntil: &future}, Expected: false},
+	}
+
+	for _, test := range tests {
+		if got := test.Input.IsExpired(now); got != test.Expected {
+			t.Errorf(
+				"%s: expected %v but got %v",
+				test.Name, test.Expected, got,
+			)
+		}
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+
+	if !(ShortURL{}).CheckPassword("") {
+		t.Error("expected unprotected short url to accept any password")
+	}
+
+	s := ShortURL{PasswordHash: string(hash)}
+	if !s.CheckPassword("secret") {
+		t.Error("expected correct password to match")
+	}
+	if s.CheckPassword("wrong") {
+		t.Error("expected incorrect password not to match")
+	}
+	if s.CheckPassword("") {
+		t.Error("expected empty password not to match")
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	var tests = []struct {
+		Password string
+		Valid    bool
+	}{
+		{Password: "", Valid: true},
+		{Password: "secret", Valid: true},
+		{Password: strings.Repeat("a", MaxPasswordLength), Valid: true},
+		{Password: strings.Repeat("a", MaxPasswordLength+1), Valid: false},
+		{Password: strings.Repeat("é", MaxPasswordLength/2+1), Valid: false},
+	}
+
+	for _, test := range tests {
+		if err := ValidatePassword(test.Password); (err == nil) != test.Valid {
+			t.Errorf("%q: expected valid %t but got %v", test.Password, test.Valid, err)
+		}
+	}
+}
+
+func TestState(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+
+	var tests = []struct {
+		Name     string
+		Input    ShortURL
+		Expected string
+	}{
+		{Name: "default", Input: ShortURL{}, Expected: StateActive},
+		{
+			Name:     "pending",
+			Input:    ShortURL{ActiveFrom: &future},
+			Expected: StatePending,
+		},
+		{
+			Name:     "opened",
+			Input:    ShortURL{ActiveFrom: &past, ActiveUntil: &future},
+			Expected: StateActive,
+		},
+		{
+			Name:     "closed",
+			Input:    ShortURL{ActiveFrom: &past, ActiveUntil: &past},
+			Expected: StateExpired,
+		},
+		{
+			Name:     "expired",
+			Input:    ShortURL{Expired: true},
+			Expected: StateExpired,
+		},
+	}
+
+	for _, test := range tests {
+		if got := test.Input.State(now); got != test.Expected {
+			t.Errorf(
+				"%s: expected %q but got %q",
+				test.Name, test.Expected, got,
+			)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package shorturl
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// maxTags is the maximum number of tags on a short URL.
+	maxTags = 10
+
+	// maxTagLength is the maximum length of a tag.
+	maxTagLength = 32
+)
+
+// ParseTags splits a comma separated list of tags. Tags are trimmed and
+// lowercased; empty and repeated tags are dropped.
+func ParseTags(s string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+// ValidateTags returns an error if the tags are invalid.
+// Tags are limited to lowercase letters, digits, "-", and "_".
+func ValidateTags(tags []string) error {
+	if len(tags) > maxTags {
+		return fmt.Errorf("more than %d tags", maxTags)
+	}
+	for _, tag := range tags {
+		if err := ValidateTag(tag); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateTag returns an error if the tag is invalid; see ValidateTags.
+func ValidateTag(tag string) error {
+	if tag == "" || len(tag) > maxTagLength {
+		return fmt.Errorf("invalid tag length")
+	}
+	for _, c := range tag {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return fmt.Errorf("invalid tag %q", tag)
+		}
+	}
+
+	return nil
+}
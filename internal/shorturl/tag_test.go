@@ -0,0 +1,49 @@
+package shorturl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	var tests = []struct {
+		Input    string
+		Expected []string
+	}{
+		{Input: "", Expected: nil},
+		{Input: "launch", Expected: []string{"launch"}},
+		{Input: " Launch, spring-2020 ,,launch", Expected: []string{"launch", "spring-2020"}},
+	}
+
+	for _, test := range tests {
+		if got := ParseTags(test.Input); !reflect.DeepEqual(got, test.Expected) {
+			t.Errorf("%q: expected %v but got %v", test.Input, test.Expected, got)
+		}
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	var tests = []struct {
+		Tags  []string
+		Valid bool
+	}{
+		{Tags: nil, Valid: true},
+		{Tags: []string{"launch", "spring_2020", "q1-ads"}, Valid: true},
+		{Tags: []string{""}, Valid: false},
+		{Tags: []string{"Launch"}, Valid: false},
+		{Tags: []string{"two words"}, Valid: false},
+		{Tags: []string{strings.Repeat("a", maxTagLength+1)}, Valid: false},
+		{Tags: strings.Split("a,b,c,d,e,f,g,h,i,j,k", ","), Valid: false},
+	}
+
+	for _, test := range tests {
+		err := ValidateTags(test.Tags)
+		if test.Valid && err != nil {
+			t.Errorf("%v: unexpected error: %v", test.Tags, err)
+		}
+		if !test.Valid && err == nil {
+			t.Errorf("%v: expected an error", test.Tags)
+		}
+	}
+}
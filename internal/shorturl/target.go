@@ -0,0 +1,165 @@
+package shorturl
+
+import (
+	"fmt"
+
+	"github.com/dwrz/url-shortener/internal/validurl"
+	"github.com/dwrz/url-shortener/pkg/language"
+	"github.com/dwrz/url-shortener/pkg/useragent"
+)
+
+// maxTargets is the maximum number of targets on a short URL.
+const maxTargets = 32
+
+// Target redirects visitors matching all of its conditions to an
+// alternate URL. Empty conditions match any visitor.
+type Target struct {
+	// Name identifies the target in visit records.
+	Name string `bson:"name" json:"name"`
+
+	// OS is an operating system, as classified by useragent.Parse.
+	OS string `bson:"os,omitempty" json:"os,omitempty"`
+
+	// Device is a device class, as classified by useragent.Parse.
+	Device string `bson:"device,omitempty" json:"device,omitempty"`
+
+	// Countries are ISO 3166-1 alpha-2 country codes, resolved from
+	// the visitor's IP address. Any one must match.
+	Countries []string `bson:"countries,omitempty" json:"countries,omitempty"`
+
+	// Languages are language ranges, matched against the visitor's
+	// preferred language; e.g., "pt" matches "pt-BR". Any one must
+	// match.
+	Languages []string `bson:"languages,omitempty" json:"languages,omitempty"`
+
+	// URL is where matching visitors are redirected.
+	URL string `bson:"url" json:"url"`
+}
+
+// Visitor describes the client following a short URL, for matching
+// against targets.
+type Visitor struct {
+	OS     string
+	Device string
+
+	// Country is an upper case ISO 3166-1 alpha-2 country code.
+	Country string
+
+	// Language is the visitor's preferred language tag.
+	Language string
+}
+
+// matches reports whether the visitor satisfies every condition of the
+// target.
+func (t Target) matches(v Visitor) bool {
+	if t.OS != "" && t.OS != v.OS {
+		return false
+	}
+	if t.Device != "" && t.Device != v.Device {
+		return false
+	}
+	if len(t.Countries) > 0 && !t.matchesCountry(v.Country) {
+		return false
+	}
+	if len(t.Languages) > 0 && !t.matchesLanguage(v.Language) {
+		return false
+	}
+
+	return true
+}
+
+func (t Target) matchesCountry(country string) bool {
+	for _, c := range t.Countries {
+		if c == country {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t Target) matchesLanguage(tag string) bool {
+	for _, l := range t.Languages {
+		if language.Match(l, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Destination returns the URL the visitor should be redirected to, and
+// the name of the matching target. Targets are matched in order; the
+// first match wins. If no target matches, the short URL's URL is
+// returned, with an empty target name; callers should then split the
+// visitor between any Variants.
+func (s ShortURL) Destination(v Visitor) (url, target string) {
+	for _, t := range s.Targets {
+		if t.matches(v) {
+			return t.URL, t.Name
+		}
+	}
+
+	return s.URL, ""
+}
+
+// ValidateTargets returns an error if any target is invalid.
+// Every target must have a unique name, at least one condition, and a
+// valid URL. Countries must be upper case.
+func ValidateTargets(targets []Target) error {
+	if len(targets) > maxTargets {
+		return fmt.Errorf("too many targets")
+	}
+
+	names := map[string]bool{}
+	for i, t := range targets {
+		if t.Name == "" {
+			return fmt.Errorf("target %d: missing name", i)
+		}
+		if names[t.Name] {
+			return fmt.Errorf("target %d: duplicate name", i)
+		}
+		names[t.Name] = true
+
+		if t.OS == "" && t.Device == "" &&
+			len(t.Countries) == 0 && len(t.Languages) == 0 {
+			return fmt.Errorf("target %d: missing conditions", i)
+		}
+		if t.OS != "" && !useragent.IsOS(t.OS) {
+			return fmt.Errorf("target %d: invalid os", i)
+		}
+		if t.Device != "" && !useragent.IsDevice(t.Device) {
+			return fmt.Errorf("target %d: invalid device", i)
+		}
+		for _, c := range t.Countries {
+			if !validCountry(c) {
+				return fmt.Errorf("target %d: invalid country", i)
+			}
+		}
+		for _, l := range t.Languages {
+			if !language.Valid(l) {
+				return fmt.Errorf("target %d: invalid language", i)
+			}
+		}
+		if err := validurl.Validate(t.URL); err != nil {
+			return fmt.Errorf("target %d: invalid url: %v", i, err)
+		}
+	}
+
+	return nil
+}
+
+// validCountry reports whether s is an upper case, two letter country
+// code.
+func validCountry(s string) bool {
+	if len(s) != 2 {
+		return false
+	}
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+
+	return true
+}
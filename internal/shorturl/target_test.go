@@ -0,0 +1,152 @@
+package shorturl
+
+import (
+	"testing"
+
+	"github.com/dwrz/url-shortener/pkg/useragent"
+)
+
+func TestDestination(t *testing.T) {
+	s := ShortURL{
+		URL: "https://example.com/",
+		Targets: []Target{
+			{
+				Name: "app-store",
+				OS:   useragent.OSIOS,
+				URL:  "https://apps.apple.com/app/id0",
+			},
+			{
+				Name:   "play-store",
+				OS:     useragent.OSAndroid,
+				Device: useragent.DeviceMobile,
+				URL:    "https://play.google.com/store/apps",
+			},
+			{
+				Name:      "germany",
+				Countries: []string{"AT", "DE"},
+				URL:       "https://example.de/",
+			},
+			{
+				Name:      "portuguese",
+				Languages: []string{"pt"},
+				URL:       "https://example.com.br/",
+			},
+		},
+	}
+
+	var tests = []struct {
+		Input          Visitor
+		ExpectedURL    string
+		ExpectedTarget string
+	}{
+		{
+			Input:          Visitor{OS: useragent.OSWindows, Country: "DE"},
+			ExpectedURL:    "https://example.de/",
+			ExpectedTarget: "germany",
+		},
+		{
+			Input:          Visitor{OS: useragent.OSMacOS, Language: "pt-br"},
+			ExpectedURL:    "https://example.com.br/",
+			ExpectedTarget: "portuguese",
+		},
+		{
+			Input:       Visitor{OS: useragent.OSMacOS, Language: "es"},
+			ExpectedURL: "https://example.com/",
+		},
+		{
+			Input:          Visitor{OS: useragent.OSIOS, Device: useragent.DeviceTablet},
+			ExpectedURL:    "https://apps.apple.com/app/id0",
+			ExpectedTarget: "app-store",
+		},
+		{
+			Input:          Visitor{OS: useragent.OSAndroid, Device: useragent.DeviceMobile},
+			ExpectedURL:    "https://play.google.com/store/apps",
+			ExpectedTarget: "play-store",
+		},
+		{
+			Input:       Visitor{OS: useragent.OSAndroid, Device: useragent.DeviceTablet},
+			ExpectedURL: "https://example.com/",
+		},
+		{
+			Input:       Visitor{OS: useragent.OSWindows, Device: useragent.DeviceDesktop},
+			ExpectedURL: "https://example.com/",
+		},
+	}
+
+	for _, test := range tests {
+		url, target := s.Destination(test.Input)
+		if url != test.ExpectedURL || target != test.ExpectedTarget {
+			t.Errorf(
+				"%+v: expected %q, %q but got %q, %q",
+				test.Input, test.ExpectedURL, test.ExpectedTarget,
+				url, target,
+			)
+		}
+	}
+}
+
+func TestValidateTargets(t *testing.T) {
+	valid := Target{
+		Name: "ios", OS: useragent.OSIOS, URL: "https://example.com/",
+	}
+
+	var tests = []struct {
+		Name    string
+		Input   []Target
+		Invalid bool
+	}{
+		{Name: "none", Input: nil},
+		{Name: "valid", Input: []Target{valid}},
+		{
+			Name:    "duplicate",
+			Input:   []Target{valid, valid},
+			Invalid: true,
+		},
+		{
+			Name:    "missing name",
+			Input:   []Target{{OS: useragent.OSIOS, URL: valid.URL}},
+			Invalid: true,
+		},
+		{
+			Name:    "missing conditions",
+			Input:   []Target{{Name: "any", URL: valid.URL}},
+			Invalid: true,
+		},
+		{
+			Name:    "unknown os",
+			Input:   []Target{{Name: "x", OS: "beos", URL: valid.URL}},
+			Invalid: true,
+		},
+		{
+			Name: "lower case country",
+			Input: []Target{
+				{Name: "x", Countries: []string{"de"}, URL: valid.URL},
+			},
+			Invalid: true,
+		},
+		{
+			Name: "invalid language",
+			Input: []Target{
+				{Name: "x", Languages: []string{"e n"}, URL: valid.URL},
+			},
+			Invalid: true,
+		},
+		{
+			Name: "invalid url",
+			Input: []Target{
+				{Name: "x", OS: useragent.OSIOS, URL: "ftp://example.com"},
+			},
+			Invalid: true,
+		},
+	}
+
+	for _, test := range tests {
+		err := ValidateTargets(test.Input)
+		if test.Invalid && err == nil {
+			t.Errorf("%s: expected error", test.Name)
+		}
+		if !test.Invalid && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package shorturl
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/cache"
+	"github.com/dwrz/url-shortener/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrNotFound is returned when a short URL does not exist.
+var ErrNotFound = fmt.Errorf("short url not found")
+
+type UpdateParams struct {
+	// Cache is invalidated once the short URL is updated.
+	Cache       cache.Cache
+	DB          *mongo.Client
+	Environment string
+
+	// Tenant and Domain are those of the short URL; see ShortURL.
+	Tenant string
+	Domain string
+	Short  string
+
+	// The fields to update. Nil fields are left as they are.
+	LongURL *string
+	Title   *string
+
+	// Tags should be checked with ValidateTags.
+	Tags *[]string
+
+	// ExpiresAt sets the expiry time; RemoveExpiry removes it.
+	ExpiresAt    *time.Time
+	RemoveExpiry bool
+}
+
+func (p UpdateParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if p.Short == "" {
+		return fmt.Errorf("missing short")
+	}
+	if p.LongURL != nil && *p.LongURL == "" {
+		return fmt.Errorf("missing long url")
+	}
+	if p.Tags != nil {
+		if err := ValidateTags(*p.Tags); err != nil {
+			return fmt.Errorf("invalid tags: %v", err)
+		}
+	}
+	if p.ExpiresAt != nil && p.RemoveExpiry {
+		return fmt.Errorf("conflicting expiry")
+	}
+
+	return nil
+}
+
+// update returns the MongoDB update document for the params, or nil if
+// nothing is updated.
+func (p UpdateParams) update() bson.M {
+	set, unset := bson.M{}, bson.M{}
+	if p.LongURL != nil {
+		set["url"] = *p.LongURL
+	}
+	if p.Title != nil {
+		if *p.Title == "" {
+			unset["title"] = ""
+		} else {
+			set["title"] = *p.Title
+		}
+	}
+	if p.Tags != nil {
+		if len(*p.Tags) == 0 {
+			unset["tags"] = ""
+		} else {
+			set["tags"] = *p.Tags
+		}
+	}
+	// A new expiry time may revive an expired short URL; the expiry
+	// sweep marks it again if it has reached its visit limit.
+	if p.ExpiresAt != nil {
+		set["expiresAt"] = *p.ExpiresAt
+		unset["expired"] = ""
+	}
+	if p.RemoveExpiry {
+		unset["expiresAt"] = ""
+		unset["expired"] = ""
+	}
+
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	if len(update) == 0 {
+		return nil
+	}
+
+	return update
+}
+
+// Update changes the fields of a short URL of a tenant set in the
+// params, and invalidates it in the cache. It returns ErrNotFound if the
+// short URL does not exist.
+func Update(ctx context.Context, p UpdateParams) error {
+	if err := p.validate(); err != nil {
+		return fmt.Errorf("invalid params: %v", err)
+	}
+
+	update := p.update()
+	if update == nil {
+		return nil
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+	updateContext, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	res, err := coll.UpdateOne(updateContext, bson.M{
+		"tenant": tenant.Match(p.Tenant),
+		"domain": domainMatch(p.Domain),
+		"short":  p.Short,
+	}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update: %v", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	if err := Invalidate(ctx, p.Cache, p.Environment, p.Domain, p.Short); err != nil {
+		log.Printf("failed to invalidate %s: %v", p.Short, err)
+	}
+
+	return nil
+}
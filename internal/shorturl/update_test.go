@@ -0,0 +1,63 @@
+package shorturl
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestUpdateParamsValidate(t *testing.T) {
+	t.Skip("TODO")
+}
+
+// TestUpdateParamsUpdate checks that only the fields set are updated,
+// and that empty values remove optional fields.
+func TestUpdateParamsUpdate(t *testing.T) {
+	long, title, empty := "https://example.com/", "Example", ""
+	tags, noTags := []string{"launch"}, []string{}
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		Params   UpdateParams
+		Expected bson.M
+	}{
+		{Params: UpdateParams{}, Expected: nil},
+		{
+			Params: UpdateParams{LongURL: &long, Title: &title, Tags: &tags},
+			Expected: bson.M{"$set": bson.M{
+				"url": long, "title": title, "tags": tags,
+			}},
+		},
+		{
+			Params: UpdateParams{Title: &empty, Tags: &noTags},
+			Expected: bson.M{"$unset": bson.M{
+				"title": "", "tags": "",
+			}},
+		},
+		{
+			Params: UpdateParams{ExpiresAt: &expiresAt},
+			Expected: bson.M{
+				"$set":   bson.M{"expiresAt": expiresAt},
+				"$unset": bson.M{"expired": ""},
+			},
+		},
+		{
+			Params: UpdateParams{RemoveExpiry: true},
+			Expected: bson.M{"$unset": bson.M{
+				"expiresAt": "", "expired": "",
+			}},
+		},
+	}
+
+	for i, test := range tests {
+		if got := test.Params.update(); !reflect.DeepEqual(got, test.Expected) {
+			t.Errorf("%d: expected %v but got %v", i, test.Expected, got)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	t.Skip("TODO")
+}
@@ -0,0 +1,116 @@
+package shorturl
+
+import (
+	"fmt"
+
+	"github.com/dwrz/url-shortener/internal/validurl"
+)
+
+const (
+	// maxVariants is the maximum number of variants on a short URL.
+	maxVariants = 10
+
+	// totalWeight is the sum of variant weights; weights are
+	// percentages.
+	totalWeight = 100
+)
+
+// Variant is one of several destinations a short URL splits traffic
+// between.
+type Variant struct {
+	// Name identifies the variant in visit records and cookies.
+	Name string `bson:"name" json:"name"`
+
+	// URL is where visitors assigned to the variant are redirected.
+	URL string `bson:"url" json:"url"`
+
+	// Weight is the percentage of visitors assigned to the variant.
+	Weight int `bson:"weight" json:"weight"`
+}
+
+// Variant returns the variant with the given name, if it exists.
+func (s ShortURL) Variant(name string) (Variant, bool) {
+	for _, v := range s.Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+
+	return Variant{}, false
+}
+
+// PickVariant returns the variant for a roll in [0, 100); a uniformly
+// random roll assigns visitors to variants by weight. It panics if the
+// short URL has no variants.
+func (s ShortURL) PickVariant(roll int) Variant {
+	for _, v := range s.Variants {
+		if roll < v.Weight {
+			return v
+		}
+		roll -= v.Weight
+	}
+
+	// Unreachable with valid weights and rolls.
+	return s.Variants[len(s.Variants)-1]
+}
+
+// ValidateVariants returns an error if the variants are invalid.
+// There must be either no variants, or at least two, with unique names
+// and valid URLs. Weights must be positive, and sum to 100.
+// Names are used in cookies, and are limited to letters, digits, "-"
+// and "_".
+func ValidateVariants(variants []Variant) error {
+	if len(variants) == 0 {
+		return nil
+	}
+	if len(variants) == 1 {
+		return fmt.Errorf("too few variants")
+	}
+	if len(variants) > maxVariants {
+		return fmt.Errorf("too many variants")
+	}
+
+	var sum int
+	names := map[string]bool{}
+	for i, v := range variants {
+		if !validVariantName(v.Name) {
+			return fmt.Errorf("variant %d: invalid name", i)
+		}
+		if names[v.Name] {
+			return fmt.Errorf("variant %d: duplicate name", i)
+		}
+		names[v.Name] = true
+
+		if v.Weight <= 0 {
+			return fmt.Errorf("variant %d: invalid weight", i)
+		}
+		sum += v.Weight
+
+		if err := validurl.Validate(v.URL); err != nil {
+			return fmt.Errorf("variant %d: invalid url: %v", i, err)
+		}
+	}
+	if sum != totalWeight {
+		return fmt.Errorf("weights must sum to %d", totalWeight)
+	}
+
+	return nil
+}
+
+func validVariantName(s string) bool {
+	if s == "" || len(s) > 32 {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z':
+		case r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9':
+		case r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,87 @@
+package shorturl
+
+import "testing"
+
+func TestPickVariant(t *testing.T) {
+	s := ShortURL{Variants: []Variant{
+		{Name: "a", URL: "https://example.com/a", Weight: 20},
+		{Name: "b", URL: "https://example.com/b", Weight: 50},
+		{Name: "c", URL: "https://example.com/c", Weight: 30},
+	}}
+
+	counts := map[string]int{}
+	for roll := 0; roll < totalWeight; roll++ {
+		counts[s.PickVariant(roll).Name]++
+	}
+
+	for _, v := range s.Variants {
+		if counts[v.Name] != v.Weight {
+			t.Errorf(
+				"expected %d rolls for %s but got %d",
+				v.Weight, v.Name, counts[v.Name],
+			)
+		}
+	}
+
+	if v, ok := s.Variant("b"); !ok || v.URL != "https://example.com/b" {
+		t.Errorf("failed to find variant b: %+v", v)
+	}
+	if _, ok := s.Variant("d"); ok {
+		t.Error("found nonexistent variant")
+	}
+}
+
+func TestValidateVariants(t *testing.T) {
+	a := Variant{Name: "a", URL: "https://example.com/a", Weight: 50}
+	b := Variant{Name: "b", URL: "https://example.com/b", Weight: 50}
+
+	var tests = []struct {
+		Name    string
+		Input   []Variant
+		Invalid bool
+	}{
+		{Name: "none", Input: nil},
+		{Name: "valid", Input: []Variant{a, b}},
+		{Name: "single", Input: []Variant{a}, Invalid: true},
+		{Name: "duplicate", Input: []Variant{a, a}, Invalid: true},
+		{
+			Name: "sum",
+			Input: []Variant{
+				a, {Name: "b", URL: b.URL, Weight: 40},
+			},
+			Invalid: true,
+		},
+		{
+			Name: "zero weight",
+			Input: []Variant{
+				{Name: "a", URL: a.URL, Weight: 100},
+				{Name: "b", URL: b.URL},
+			},
+			Invalid: true,
+		},
+		{
+			Name: "invalid name",
+			Input: []Variant{
+				a, {Name: "b;c", URL: b.URL, Weight: 50},
+			},
+			Invalid: true,
+		},
+		{
+			Name: "invalid url",
+			Input: []Variant{
+				a, {Name: "b", URL: "b", Weight: 50},
+			},
+			Invalid: true,
+		},
+	}
+
+	for _, test := range tests {
+		err := ValidateVariants(test.Input)
+		if test.Invalid && err == nil {
+			t.Errorf("%s: expected error", test.Name)
+		}
+		if !test.Invalid && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+		}
+	}
+}
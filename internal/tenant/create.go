@@ -0,0 +1,87 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type CreateParams struct {
+	DB          *mongo.Client
+	Environment string
+
+	// ID identifies the tenant.
+	// It should be checked with ValidateID.
+	ID string
+
+	// Name describes the tenant.
+	Name string
+
+	// Quotas limit the tenant's use of the service.
+	Quotas Quotas
+}
+
+func (p CreateParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if err := ValidateID(p.ID); err != nil {
+		return err
+	}
+	if p.Name == "" || len(p.Name) > maxNameLength {
+		return fmt.Errorf("invalid name")
+	}
+	return p.Quotas.validate()
+}
+
+// Create inserts a new Tenant document. It returns ErrExists if the ID
+// is taken.
+func Create(ctx context.Context, p CreateParams) (*Tenant, error) {
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid params: %v", err)
+	}
+
+	t := &Tenant{
+		ID:      p.ID,
+		Created: time.Now(),
+		Name:    p.Name,
+		Quotas:  p.Quotas,
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+	insertContext, cancel := context.WithTimeout(ctx, insertTimeout)
+	defer cancel()
+
+	if _, err := coll.InsertOne(insertContext, t); err != nil {
+		if isDuplicateKey(err) {
+			return nil, ErrExists
+		}
+		return nil, fmt.Errorf("failed to insert: %v", err)
+	}
+
+	return t, nil
+}
+
+// isDuplicateKey reports whether a write failed because of a unique
+// index.
+func isDuplicateKey(err error) bool {
+	const duplicateKey = 11000
+
+	switch e := err.(type) {
+	case mongo.WriteException:
+		for _, we := range e.WriteErrors {
+			if we.Code == duplicateKey {
+				return true
+			}
+		}
+	case mongo.CommandError:
+		return e.Code == duplicateKey
+	}
+
+	return false
+}
@@ -0,0 +1,77 @@
+package tenant
+
+import (
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestCreateParamsValidate(t *testing.T) {
+	db := &mongo.Client{}
+	long := strings.Repeat("a", maxNameLength+1)
+
+	var tests = []struct {
+		Name   string
+		Params CreateParams
+		Valid  bool
+	}{
+		{
+			Name:   "valid",
+			Params: CreateParams{DB: db, Environment: "test", ID: "acme", Name: "Acme"},
+			Valid:  true,
+		},
+		{
+			Name: "quotas",
+			Params: CreateParams{
+				DB: db, Environment: "test", ID: "acme", Name: "Acme",
+				Quotas: Quotas{Links: 10, Keys: 2},
+			},
+			Valid: true,
+		},
+		{
+			Name:   "missing db",
+			Params: CreateParams{Environment: "test", ID: "acme", Name: "Acme"},
+		},
+		{
+			Name:   "missing env",
+			Params: CreateParams{DB: db, ID: "acme", Name: "Acme"},
+		},
+		{
+			Name:   "invalid id",
+			Params: CreateParams{DB: db, Environment: "test", ID: "Acme", Name: "Acme"},
+		},
+		{
+			Name:   "missing name",
+			Params: CreateParams{DB: db, Environment: "test", ID: "acme"},
+		},
+		{
+			Name:   "long name",
+			Params: CreateParams{DB: db, Environment: "test", ID: "acme", Name: long},
+		},
+		{
+			Name: "negative links quota",
+			Params: CreateParams{
+				DB: db, Environment: "test", ID: "acme", Name: "Acme",
+				Quotas: Quotas{Links: -1},
+			},
+		},
+		{
+			Name: "negative keys quota",
+			Params: CreateParams{
+				DB: db, Environment: "test", ID: "acme", Name: "Acme",
+				Quotas: Quotas{Keys: -1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		if err := test.Params.validate(); (err == nil) != test.Valid {
+			t.Errorf("%s: expected valid %t but got %v", test.Name, test.Valid, err)
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	t.Skip("TODO")
+}
@@ -0,0 +1,166 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Domain represents a document storing a custom domain of a tenant,
+// which its short URLs may be created on, and served from.
+type Domain struct {
+	// Name is the domain; e.g., "go.example.com".
+	Name    string    `bson:"_id" json:"domain"`
+	Tenant  string    `bson:"tenant,omitempty" json:"-"`
+	Created time.Time `bson:"created" json:"created"`
+}
+
+type AddDomainParams struct {
+	DB          *mongo.Client
+	Environment string
+
+	// Tenant is the ID of the tenant the domain belongs to.
+	Tenant string
+
+	// Name is the domain.
+	// It should be checked with ValidateDomain.
+	Name string
+}
+
+func (p AddDomainParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if p.Tenant != DefaultID {
+		if err := ValidateID(p.Tenant); err != nil {
+			return err
+		}
+	}
+
+	return ValidateDomain(p.Name)
+}
+
+// AddDomain inserts a new Domain document. It returns ErrExists if the
+// domain is taken, by any tenant.
+func AddDomain(ctx context.Context, p AddDomainParams) (*Domain, error) {
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid params: %v", err)
+	}
+
+	d := &Domain{
+		Name:    p.Name,
+		Tenant:  p.Tenant,
+		Created: time.Now(),
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(DomainCollection)
+	insertContext, cancel := context.WithTimeout(ctx, insertTimeout)
+	defer cancel()
+
+	if _, err := coll.InsertOne(insertContext, d); err != nil {
+		if isDuplicateKey(err) {
+			return nil, ErrExists
+		}
+		return nil, fmt.Errorf("failed to insert: %v", err)
+	}
+
+	return d, nil
+}
+
+type ListDomainsParams struct {
+	DB          *mongo.Client
+	Environment string
+	Tenant      string
+}
+
+func (p ListDomainsParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+
+	return nil
+}
+
+// ListDomains returns the Domain documents of a tenant, by name.
+func ListDomains(ctx context.Context, p ListDomainsParams) ([]Domain, error) {
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid params: %v", err)
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(DomainCollection)
+	findContext, cancel := context.WithTimeout(ctx, findTimeout)
+	defer cancel()
+
+	cursor, err := coll.Find(
+		findContext,
+		bson.M{"tenant": Match(p.Tenant)},
+		options.Find().SetSort(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find: %v", err)
+	}
+
+	domains := []Domain{}
+	if err := cursor.All(findContext, &domains); err != nil {
+		return nil, fmt.Errorf("failed to decode: %v", err)
+	}
+
+	return domains, nil
+}
+
+type RemoveDomainParams struct {
+	DB          *mongo.Client
+	Environment string
+	Tenant      string
+	Name        string
+}
+
+func (p RemoveDomainParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if p.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+
+	return nil
+}
+
+// RemoveDomain deletes a Domain document of a tenant. The short URLs
+// created on it are kept, but are not served until it is added again.
+// It returns ErrDomainNotFound if the tenant has no such domain.
+func RemoveDomain(ctx context.Context, p RemoveDomainParams) error {
+	if err := p.validate(); err != nil {
+		return fmt.Errorf("invalid params: %v", err)
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(DomainCollection)
+	deleteContext, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
+	res, err := coll.DeleteOne(deleteContext, bson.M{
+		"_id":    p.Name,
+		"tenant": Match(p.Tenant),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete: %v", err)
+	}
+	if res.DeletedCount == 0 {
+		return ErrDomainNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package tenant
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestAddDomainParamsValidate(t *testing.T) {
+	db := &mongo.Client{}
+
+	var tests = []struct {
+		Name   string
+		Params AddDomainParams
+		Valid  bool
+	}{
+		{
+			Name: "valid",
+			Params: AddDomainParams{
+				DB: db, Environment: "test", Tenant: "acme", Name: "go.acme.com",
+			},
+			Valid: true,
+		},
+		{
+			Name: "default tenant",
+			Params: AddDomainParams{
+				DB: db, Environment: "test", Name: "go.example.com",
+			},
+			Valid: true,
+		},
+		{
+			Name: "missing db",
+			Params: AddDomainParams{
+				Environment: "test", Tenant: "acme", Name: "go.acme.com",
+			},
+		},
+		{
+			Name: "missing env",
+			Params: AddDomainParams{
+				DB: db, Tenant: "acme", Name: "go.acme.com",
+			},
+		},
+		{
+			Name: "invalid tenant",
+			Params: AddDomainParams{
+				DB: db, Environment: "test", Tenant: "-acme", Name: "go.acme.com",
+			},
+		},
+		{
+			Name: "missing domain",
+			Params: AddDomainParams{
+				DB: db, Environment: "test", Tenant: "acme",
+			},
+		},
+		{
+			Name: "invalid domain",
+			Params: AddDomainParams{
+				DB: db, Environment: "test", Tenant: "acme", Name: "go.acme.com:8080",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		if err := test.Params.validate(); (err == nil) != test.Valid {
+			t.Errorf("%s: expected valid %t but got %v", test.Name, test.Valid, err)
+		}
+	}
+}
+
+func TestAddDomain(t *testing.T) {
+	t.Skip("TODO")
+}
+
+func TestListDomains(t *testing.T) {
+	t.Skip("TODO")
+}
+
+func TestRemoveDomain(t *testing.T) {
+	t.Skip("TODO")
+}
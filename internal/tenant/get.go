@@ -0,0 +1,95 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type GetParams struct {
+	DB          *mongo.Client
+	Environment string
+	ID          string
+}
+
+func (p GetParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+
+	return nil
+}
+
+// Get retrieves a Tenant document. The default tenant has no document;
+// a Tenant without a name, domain, or quotas is returned for it. It
+// returns ErrNotFound if the tenant does not exist.
+func Get(ctx context.Context, p GetParams) (*Tenant, error) {
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid params: %v", err)
+	}
+	if p.ID == DefaultID {
+		return &Tenant{ID: DefaultID}, nil
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+	findContext, cancel := context.WithTimeout(ctx, findTimeout)
+	defer cancel()
+
+	var t Tenant
+	err := coll.FindOne(findContext, bson.M{"_id": p.ID}).Decode(&t)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find: %v", err)
+	}
+
+	return &t, nil
+}
+
+type ListParams struct {
+	DB          *mongo.Client
+	Environment string
+}
+
+func (p ListParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+
+	return nil
+}
+
+// List returns all Tenant documents, by ID.
+func List(ctx context.Context, p ListParams) ([]Tenant, error) {
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid params: %v", err)
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+	findContext, cancel := context.WithTimeout(ctx, findTimeout)
+	defer cancel()
+
+	cursor, err := coll.Find(
+		findContext, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find: %v", err)
+	}
+
+	var tenants []Tenant
+	if err := cursor.All(findContext, &tenants); err != nil {
+		return nil, fmt.Errorf("failed to decode: %v", err)
+	}
+
+	return tenants, nil
+}
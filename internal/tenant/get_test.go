@@ -0,0 +1,11 @@
+package tenant
+
+import "testing"
+
+func TestGet(t *testing.T) {
+	t.Skip("TODO")
+}
+
+func TestList(t *testing.T) {
+	t.Skip("TODO")
+}
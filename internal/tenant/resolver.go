@@ -0,0 +1,164 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// resolverTTL is how long a Resolver uses the custom domains it loaded.
+// Domains added or changed are resolved within this time.
+const resolverTTL = 1 * time.Minute
+
+// Resolver resolves request hosts to the tenants whose custom domains
+// they are. Custom domains are loaded together, and reloaded
+// periodically, since every redirect resolves its host. It is safe for
+// concurrent use.
+//
+// Domains are read without holding mu, by one caller at a time; other
+// callers use the domains loaded before, or, if there are none yet,
+// wait for the read.
+type Resolver struct {
+	db          *mongo.Client
+	environment string
+
+	mu      sync.Mutex
+	domains map[string]string
+	loaded  time.Time
+
+	// loading is closed when the read in progress, if any, ends. err
+	// is the error of the last read.
+	loading chan struct{}
+	err     error
+
+	// refreshed counts the calls to Refresh, so that a read which
+	// started before one is not taken as fresh.
+	refreshed int
+}
+
+// NewResolver returns a Resolver for the tenants of an environment.
+func NewResolver(db *mongo.Client, environment string) *Resolver {
+	return &Resolver{db: db, environment: environment}
+}
+
+// Resolve returns the ID of the tenant whose custom domain is the
+// domain of a Host header, and whether there is one. Hosts which are
+// not custom domains are served by the service's own domain.
+// If custom domains cannot be reloaded, those loaded before are used.
+func (r *Resolver) Resolve(ctx context.Context, host string) (id string, ok bool, err error) {
+	domains, err := r.load(ctx)
+	if err != nil {
+		return "", false, err
+	}
+
+	id, ok = domains[NormalizeDomain(host)]
+
+	return id, ok, nil
+}
+
+// Refresh causes custom domains to be reloaded when next resolved; e.g.,
+// after a domain is added or removed. Other Resolvers, such as those of
+// other instances, reload them within resolverTTL.
+func (r *Resolver) Refresh() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.loaded = time.Time{}
+	r.refreshed++
+}
+
+// load returns the custom domains of tenants, reloading them if they are
+// older than resolverTTL.
+func (r *Resolver) load(ctx context.Context) (map[string]string, error) {
+	r.mu.Lock()
+	if r.domains != nil && time.Since(r.loaded) < resolverTTL {
+		defer r.mu.Unlock()
+		return r.domains, nil
+	}
+
+	// Another caller is reading the domains.
+	if loading := r.loading; loading != nil {
+		if r.domains != nil {
+			defer r.mu.Unlock()
+			return r.domains, nil
+		}
+		r.mu.Unlock()
+
+		select {
+		case <-loading:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.domains == nil {
+			return nil, r.err
+		}
+		return r.domains, nil
+	}
+
+	loading := make(chan struct{})
+	r.loading = loading
+	refreshed := r.refreshed
+	r.mu.Unlock()
+
+	// The read is shared with other callers, so it is not canceled with
+	// the caller's context.
+	domains, err := r.find(context.Background())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer close(loading)
+	r.loading, r.err = nil, err
+
+	if err != nil {
+		if r.domains == nil {
+			return nil, err
+		}
+		log.Printf("failed to reload tenant domains: %v", err)
+		// Do not retry on every request.
+		r.loaded = time.Now()
+		return r.domains, nil
+	}
+	r.domains = domains
+	if r.refreshed == refreshed {
+		r.loaded = time.Now()
+	}
+
+	return r.domains, nil
+}
+
+// find reads the custom domains of tenants, mapped to their IDs.
+func (r *Resolver) find(ctx context.Context) (map[string]string, error) {
+	coll := r.db.Database(r.environment).Collection(DomainCollection)
+	findContext, cancel := context.WithTimeout(ctx, findTimeout)
+	defer cancel()
+
+	cursor, err := coll.Find(
+		findContext,
+		bson.M{},
+		options.Find().SetProjection(bson.M{"tenant": 1}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find: %v", err)
+	}
+
+	var docs []Domain
+	if err := cursor.All(findContext, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode: %v", err)
+	}
+
+	domains := map[string]string{}
+	for _, d := range docs {
+		domains[d.Name] = d.Tenant
+	}
+
+	return domains, nil
+}
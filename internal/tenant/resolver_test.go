@@ -0,0 +1,76 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestResolverResolve(t *testing.T) {
+	r := &Resolver{
+		domains: map[string]string{"go.acme.com": "acme"},
+		loaded:  time.Now(),
+	}
+
+	var tests = []struct {
+		Host string
+		ID   string
+		OK   bool
+	}{
+		{Host: "go.acme.com", ID: "acme", OK: true},
+		{Host: "GO.acme.com:443", ID: "acme", OK: true},
+		{Host: "short.example.com", ID: "", OK: false},
+	}
+
+	for _, test := range tests {
+		id, ok, err := r.Resolve(context.Background(), test.Host)
+		if err != nil {
+			t.Fatalf("%q: failed to resolve: %v", test.Host, err)
+		}
+		if id != test.ID || ok != test.OK {
+			t.Errorf(
+				"%q: expected %q, %t but got %q, %t",
+				test.Host, test.ID, test.OK, id, ok,
+			)
+		}
+	}
+}
+
+func TestResolverRefresh(t *testing.T) {
+	t.Skip("TODO")
+}
+
+// TestResolverLoading checks that callers do not read domains while
+// another caller does: they use the domains loaded before, or wait for
+// the read, unless their context ends first.
+func TestResolverLoading(t *testing.T) {
+	r := &Resolver{
+		domains: map[string]string{"go.acme.com": "acme"},
+		loading: make(chan struct{}),
+	}
+	id, ok, err := r.Resolve(context.Background(), "go.acme.com")
+	if err != nil || !ok || id != "acme" {
+		t.Errorf("expected stale domain of acme but got %q, %t, %v", id, ok, err)
+	}
+
+	r = &Resolver{loading: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := r.Resolve(ctx, "go.acme.com"); err != context.Canceled {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+
+	// Readers waiting on a read get its result.
+	loading := make(chan struct{})
+	r = &Resolver{loading: loading}
+	go func() {
+		r.mu.Lock()
+		r.domains, r.loading = map[string]string{"go.acme.com": "acme"}, nil
+		r.mu.Unlock()
+		close(loading)
+	}()
+	id, ok, err = r.Resolve(context.Background(), "go.acme.com")
+	if err != nil || !ok || id != "acme" {
+		t.Errorf("expected domain of acme but got %q, %t, %v", id, ok, err)
+	}
+}
@@ -0,0 +1,186 @@
+// Package tenant manages tenants: workspaces within an environment,
+// each with its own API keys, short URLs, stats, quotas, and custom
+// domains.
+//
+// Documents belonging to a tenant carry its ID in a "tenant" field.
+// The default tenant has an empty ID, and its documents have no tenant
+// field, so that documents created before tenants belong to it. It has
+// no Tenant document, and no quotas.
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// Collection is the MongoDB collection for Tenant documents.
+	Collection = "tenants"
+
+	// DomainCollection is the MongoDB collection for Domain documents.
+	DomainCollection = "domains"
+
+	// DefaultID is the ID of the default tenant.
+	DefaultID = ""
+
+	// maxIDLength is the maximum length of a tenant ID.
+	maxIDLength = 63
+
+	// maxNameLength is the maximum length of a tenant name.
+	maxNameLength = 100
+
+	// maxDomainLength is the maximum length of a domain name.
+	maxDomainLength = 253
+
+	// Context timeouts for DB operations.
+	deleteTimeout = 1 * time.Second
+	findTimeout   = 1 * time.Second
+	indexTimeout  = 30 * time.Second
+	insertTimeout = 1 * time.Second
+	updateTimeout = 1 * time.Second
+)
+
+var (
+	// ErrNotFound is returned for tenants which do not exist.
+	ErrNotFound = fmt.Errorf("tenant not found")
+
+	// ErrExists is returned when creating a tenant whose ID is taken,
+	// or adding a domain which is taken.
+	ErrExists = fmt.Errorf("tenant or domain exists")
+
+	// ErrDomainNotFound is returned for domains which do not exist.
+	ErrDomainNotFound = fmt.Errorf("domain not found")
+
+	// ErrQuotaExceeded is returned when a tenant has reached a quota.
+	ErrQuotaExceeded = fmt.Errorf("quota exceeded")
+)
+
+// Tenant represents a document storing a tenant.
+type Tenant struct {
+	// ID identifies the tenant; e.g., "acme". It is lowercase
+	// letters, digits, and "-".
+	ID      string    `bson:"_id" json:"id"`
+	Created time.Time `bson:"created" json:"created"`
+
+	// Name describes the tenant.
+	Name string `bson:"name" json:"name"`
+
+	// Quotas limit the tenant's use of the service.
+	Quotas Quotas `bson:"quotas" json:"quotas"`
+}
+
+// Quotas limit a tenant's use of the service. Zero means no limit.
+type Quotas struct {
+	// Links is the maximum number of short URLs.
+	Links int64 `bson:"links,omitempty" json:"links,omitempty"`
+
+	// Keys is the maximum number of API keys which are not revoked.
+	Keys int64 `bson:"keys,omitempty" json:"keys,omitempty"`
+}
+
+func (q Quotas) validate() error {
+	if q.Links < 0 {
+		return fmt.Errorf("invalid links quota")
+	}
+	if q.Keys < 0 {
+		return fmt.Errorf("invalid keys quota")
+	}
+
+	return nil
+}
+
+// Match returns the value of a query filter on the tenant field of
+// documents, matching the documents of a tenant. The documents of the
+// default tenant have no tenant field.
+func Match(id string) interface{} {
+	if id == DefaultID {
+		return nil
+	}
+
+	return id
+}
+
+// ValidateID returns an error if a tenant ID is empty, too long, or
+// holds characters other than lowercase letters, digits, and "-".
+func ValidateID(id string) error {
+	if id == "" || len(id) > maxIDLength {
+		return fmt.Errorf("invalid id length")
+	}
+	for i, c := range id {
+		switch {
+		case 'a' <= c && c <= 'z', '0' <= c && c <= '9':
+		case c == '-' && i > 0:
+		default:
+			return fmt.Errorf("invalid id character %q", c)
+		}
+	}
+
+	return nil
+}
+
+// NormalizeDomain returns the domain name of a request's Host header:
+// lowercase, without a port or trailing dot.
+func NormalizeDomain(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// ValidateDomain returns an error if a domain is not a normalized, fully
+// qualified, domain name; e.g., "go.example.com". IP addresses are not
+// domains.
+func ValidateDomain(domain string) error {
+	if domain == "" || len(domain) > maxDomainLength {
+		return fmt.Errorf("invalid domain length")
+	}
+	if NormalizeDomain(domain) != domain {
+		return fmt.Errorf("domain not normalized")
+	}
+	if net.ParseIP(domain) != nil {
+		return fmt.Errorf("domain is an ip address")
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return fmt.Errorf("domain not fully qualified")
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 ||
+			label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("invalid domain label %q", label)
+		}
+		for _, c := range label {
+			if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-') {
+				return fmt.Errorf("invalid domain character %q", c)
+			}
+		}
+	}
+
+	return nil
+}
+
+// EnsureIndexes creates the index the domains of a tenant are listed
+// with, if it does not exist. Domains are unique, since they are the ID
+// of their documents.
+func EnsureIndexes(ctx context.Context, db *mongo.Client, env string) error {
+	indexContext, cancel := context.WithTimeout(ctx, indexTimeout)
+	defer cancel()
+
+	if _, err := db.Database(env).Collection(DomainCollection).Indexes().CreateOne(
+		indexContext, mongo.IndexModel{
+			Keys: bson.D{{Key: "tenant", Value: 1}},
+		},
+	); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package tenant
+
+import "testing"
+
+func TestValidateID(t *testing.T) {
+	var tests = []struct {
+		ID    string
+		Valid bool
+	}{
+		{ID: "acme", Valid: true},
+		{ID: "acme-2", Valid: true},
+		{ID: "", Valid: false},
+		{ID: "-acme", Valid: false},
+		{ID: "Acme", Valid: false},
+		{ID: "acme corp", Valid: false},
+		{ID: "acme.com", Valid: false},
+	}
+
+	for _, test := range tests {
+		if err := ValidateID(test.ID); (err == nil) != test.Valid {
+			t.Errorf("%q: expected valid %t but got %v", test.ID, test.Valid, err)
+		}
+	}
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	var tests = []struct {
+		Host     string
+		Expected string
+	}{
+		{Host: "go.example.com", Expected: "go.example.com"},
+		{Host: "Go.Example.com:8080", Expected: "go.example.com"},
+		{Host: "go.example.com.", Expected: "go.example.com"},
+		{Host: "localhost:8080", Expected: "localhost"},
+	}
+
+	for _, test := range tests {
+		if got := NormalizeDomain(test.Host); got != test.Expected {
+			t.Errorf("%q: expected %q but got %q", test.Host, test.Expected, got)
+		}
+	}
+}
+
+func TestValidateDomain(t *testing.T) {
+	var tests = []struct {
+		Domain string
+		Valid  bool
+	}{
+		{Domain: "go.example.com", Valid: true},
+		{Domain: "ex-ample.link", Valid: true},
+		{Domain: "", Valid: false},
+		{Domain: "localhost", Valid: false},
+		{Domain: "Go.example.com", Valid: false},
+		{Domain: "go.example.com:8080", Valid: false},
+		{Domain: "192.0.2.1", Valid: false},
+		{Domain: "-go.example.com", Valid: false},
+		{Domain: "go..example.com", Valid: false},
+		{Domain: "go_links.example.com", Valid: false},
+	}
+
+	for _, test := range tests {
+		if err := ValidateDomain(test.Domain); (err == nil) != test.Valid {
+			t.Errorf("%q: expected valid %t but got %v", test.Domain, test.Valid, err)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	if m := Match(DefaultID); m != nil {
+		t.Errorf("expected nil for the default tenant but got %v", m)
+	}
+	if m := Match("acme"); m != "acme" {
+		t.Errorf("expected acme but got %v", m)
+	}
+}
+
+func TestEnsureIndexes(t *testing.T) {
+	t.Skip("TODO")
+}
@@ -0,0 +1,84 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type UpdateParams struct {
+	DB          *mongo.Client
+	Environment string
+	ID          string
+
+	// The fields to update. Nil fields are left unchanged.
+	Name   *string
+	Quotas *Quotas
+}
+
+func (p UpdateParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if err := ValidateID(p.ID); err != nil {
+		return err
+	}
+	if p.Name != nil && (*p.Name == "" || len(*p.Name) > maxNameLength) {
+		return fmt.Errorf("invalid name")
+	}
+	if p.Quotas != nil {
+		if err := p.Quotas.validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// update returns the update document for the fields to update, or nil
+// if there are none.
+func (p UpdateParams) update() bson.M {
+	set := bson.M{}
+	if p.Name != nil {
+		set["name"] = *p.Name
+	}
+	if p.Quotas != nil {
+		set["quotas"] = *p.Quotas
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	return bson.M{"$set": set}
+}
+
+// Update updates a Tenant document. It returns ErrNotFound if the tenant
+// does not exist.
+func Update(ctx context.Context, p UpdateParams) error {
+	if err := p.validate(); err != nil {
+		return fmt.Errorf("invalid params: %v", err)
+	}
+	update := p.update()
+	if update == nil {
+		return nil
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+	updateContext, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	res, err := coll.UpdateOne(updateContext, bson.M{"_id": p.ID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update: %v", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
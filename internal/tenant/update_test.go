@@ -0,0 +1,104 @@
+package tenant
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestUpdateParamsUpdate(t *testing.T) {
+	name := "Acme"
+
+	var tests = []struct {
+		Params   UpdateParams
+		Expected bson.M
+	}{
+		{Params: UpdateParams{}, Expected: nil},
+		{
+			Params:   UpdateParams{Name: &name},
+			Expected: bson.M{"$set": bson.M{"name": name}},
+		},
+		{
+			Params: UpdateParams{Name: &name, Quotas: &Quotas{Links: 10}},
+			Expected: bson.M{"$set": bson.M{
+				"name": name, "quotas": Quotas{Links: 10},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		if got := test.Params.update(); !reflect.DeepEqual(got, test.Expected) {
+			t.Errorf("%+v: expected %v but got %v", test.Params, test.Expected, got)
+		}
+	}
+}
+
+func TestUpdateParamsValidate(t *testing.T) {
+	db := &mongo.Client{}
+	name, empty := "Acme", ""
+	long := strings.Repeat("a", maxNameLength+1)
+
+	var tests = []struct {
+		Name   string
+		Params UpdateParams
+		Valid  bool
+	}{
+		{
+			Name:   "no fields",
+			Params: UpdateParams{DB: db, Environment: "test", ID: "acme"},
+			Valid:  true,
+		},
+		{
+			Name: "fields",
+			Params: UpdateParams{
+				DB: db, Environment: "test", ID: "acme",
+				Name: &name, Quotas: &Quotas{Links: 10},
+			},
+			Valid: true,
+		},
+		{
+			Name:   "missing db",
+			Params: UpdateParams{Environment: "test", ID: "acme"},
+		},
+		{
+			Name:   "missing env",
+			Params: UpdateParams{DB: db, ID: "acme"},
+		},
+		{
+			Name:   "invalid id",
+			Params: UpdateParams{DB: db, Environment: "test", ID: "acme corp"},
+		},
+		{
+			Name: "empty name",
+			Params: UpdateParams{
+				DB: db, Environment: "test", ID: "acme", Name: &empty,
+			},
+		},
+		{
+			Name: "long name",
+			Params: UpdateParams{
+				DB: db, Environment: "test", ID: "acme", Name: &long,
+			},
+		},
+		{
+			Name: "negative quota",
+			Params: UpdateParams{
+				DB: db, Environment: "test", ID: "acme",
+				Quotas: &Quotas{Keys: -1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		if err := test.Params.validate(); (err == nil) != test.Valid {
+			t.Errorf("%s: expected valid %t but got %v", test.Name, test.Valid, err)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	t.Skip("TODO")
+}
@@ -0,0 +1,191 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Resources limited by quotas. The usage of each is counted in a field
+// of the Tenant document, under "usage".
+const (
+	ResourceKeys  = "keys"
+	ResourceLinks = "links"
+)
+
+type ReserveParams struct {
+	DB          *mongo.Client
+	Environment string
+
+	// ID is the ID of the tenant.
+	ID string
+
+	// Resource is the resource to reserve; e.g., ResourceLinks.
+	Resource string
+
+	// Limit is the tenant's quota of the resource. Zero means no limit.
+	Limit int64
+
+	// Count counts the tenant's resources. It is only called to start
+	// counting their usage; e.g., for resources created before their
+	// quota was set.
+	Count func(ctx context.Context) (int64, error)
+}
+
+func (p ReserveParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if p.Resource != ResourceKeys && p.Resource != ResourceLinks {
+		return fmt.Errorf("invalid resource")
+	}
+	if p.Limit < 0 {
+		return fmt.Errorf("invalid limit")
+	}
+	if p.Count == nil {
+		return fmt.Errorf("missing count")
+	}
+
+	return nil
+}
+
+// Reserve counts a resource about to be created against a tenant's
+// quota, and returns ErrQuotaExceeded if the tenant has reached it.
+// The count is raised only while it is below the quota, in a single
+// update, so that concurrent reservations cannot exceed it. Resources
+// which are not created after all, and resources which are deleted,
+// should be released with Release. The default tenant has no quotas,
+// and reserves nothing.
+func Reserve(ctx context.Context, p ReserveParams) error {
+	if err := p.validate(); err != nil {
+		return fmt.Errorf("invalid params: %v", err)
+	}
+	if p.ID == DefaultID {
+		return nil
+	}
+
+	ok, err := reserve(ctx, p)
+	if err != nil || ok || p.Limit == 0 {
+		return err
+	}
+
+	// The tenant has reached its quota, or its usage has not been
+	// counted yet. Start counting it, unless another caller has, and
+	// try again.
+	n, err := p.Count(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to count %s: %v", p.Resource, err)
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+	updateContext, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	field := usageField(p.Resource)
+	if _, err := coll.UpdateOne(
+		updateContext,
+		bson.M{"_id": p.ID, field: bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{field: n}},
+	); err != nil {
+		return fmt.Errorf("failed to start usage: %v", err)
+	}
+
+	if ok, err = reserve(ctx, p); err != nil {
+		return err
+	}
+	if !ok {
+		return ErrQuotaExceeded
+	}
+
+	return nil
+}
+
+// reserve raises the tenant's usage of a resource, if it is counted and
+// below the limit, and reports whether it did. Without a limit, the
+// usage is only raised if it is counted, so that it stays accurate if
+// a quota is set later.
+func reserve(ctx context.Context, p ReserveParams) (bool, error) {
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+	updateContext, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	res, err := coll.UpdateOne(
+		updateContext,
+		reserveFilter(p.ID, p.Resource, p.Limit),
+		bson.M{"$inc": bson.M{usageField(p.Resource): 1}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve %s: %v", p.Resource, err)
+	}
+
+	return res.MatchedCount > 0, nil
+}
+
+// reserveFilter returns the query filter matching a tenant which may
+// reserve another resource within a limit.
+func reserveFilter(id, resource string, limit int64) bson.M {
+	usage := bson.M{"$exists": true}
+	if limit > 0 {
+		usage = bson.M{"$lt": limit}
+	}
+
+	return bson.M{"_id": id, usageField(resource): usage}
+}
+
+// usageField returns the field of Tenant documents counting the usage
+// of a resource.
+func usageField(resource string) string {
+	return "usage." + resource
+}
+
+type ReleaseParams struct {
+	DB          *mongo.Client
+	Environment string
+	ID          string
+	Resource    string
+}
+
+func (p ReleaseParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if p.Resource != ResourceKeys && p.Resource != ResourceLinks {
+		return fmt.Errorf("invalid resource")
+	}
+
+	return nil
+}
+
+// Release uncounts a resource which was reserved, but not created, or
+// was deleted. It does nothing if the tenant's usage is not counted.
+func Release(ctx context.Context, p ReleaseParams) error {
+	if err := p.validate(); err != nil {
+		return fmt.Errorf("invalid params: %v", err)
+	}
+	if p.ID == DefaultID {
+		return nil
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+	updateContext, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	field := usageField(p.Resource)
+	if _, err := coll.UpdateOne(
+		updateContext,
+		bson.M{"_id": p.ID, field: bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{field: -1}},
+	); err != nil {
+		return fmt.Errorf("failed to release %s: %v", p.Resource, err)
+	}
+
+	return nil
+}
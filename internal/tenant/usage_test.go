@@ -0,0 +1,127 @@
+package tenant
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TestReserveFilter checks that usage is only raised below a limit, or,
+// without one, if it is counted.
+func TestReserveFilter(t *testing.T) {
+	var tests = []struct {
+		Resource string
+		Limit    int64
+		Expected bson.M
+	}{
+		{
+			Resource: ResourceLinks,
+			Limit:    10,
+			Expected: bson.M{
+				"_id": "acme", "usage.links": bson.M{"$lt": int64(10)},
+			},
+		},
+		{
+			Resource: ResourceKeys,
+			Limit:    2,
+			Expected: bson.M{
+				"_id": "acme", "usage.keys": bson.M{"$lt": int64(2)},
+			},
+		},
+		{
+			Resource: ResourceLinks,
+			Expected: bson.M{
+				"_id": "acme", "usage.links": bson.M{"$exists": true},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		got := reserveFilter("acme", test.Resource, test.Limit)
+		if !reflect.DeepEqual(got, test.Expected) {
+			t.Errorf(
+				"%s within %d: expected %v but got %v",
+				test.Resource, test.Limit, test.Expected, got,
+			)
+		}
+	}
+}
+
+func TestReserveParamsValidate(t *testing.T) {
+	db := &mongo.Client{}
+	count := func(context.Context) (int64, error) { return 0, nil }
+
+	var tests = []struct {
+		Name   string
+		Params ReserveParams
+		Valid  bool
+	}{
+		{
+			Name: "valid",
+			Params: ReserveParams{
+				DB: db, Environment: "test", ID: "acme",
+				Resource: ResourceLinks, Limit: 10, Count: count,
+			},
+			Valid: true,
+		},
+		{
+			Name: "no limit",
+			Params: ReserveParams{
+				DB: db, Environment: "test", ID: "acme",
+				Resource: ResourceKeys, Count: count,
+			},
+			Valid: true,
+		},
+		{
+			Name: "missing db",
+			Params: ReserveParams{
+				Environment: "test", ID: "acme",
+				Resource: ResourceLinks, Count: count,
+			},
+		},
+		{
+			Name: "missing env",
+			Params: ReserveParams{
+				DB: db, ID: "acme", Resource: ResourceLinks, Count: count,
+			},
+		},
+		{
+			Name: "unknown resource",
+			Params: ReserveParams{
+				DB: db, Environment: "test", ID: "acme",
+				Resource: "domains", Count: count,
+			},
+		},
+		{
+			Name: "negative limit",
+			Params: ReserveParams{
+				DB: db, Environment: "test", ID: "acme",
+				Resource: ResourceLinks, Limit: -1, Count: count,
+			},
+		},
+		{
+			Name: "missing count",
+			Params: ReserveParams{
+				DB: db, Environment: "test", ID: "acme",
+				Resource: ResourceLinks,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		if err := test.Params.validate(); (err == nil) != test.Valid {
+			t.Errorf("%s: expected valid %t but got %v", test.Name, test.Valid, err)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	t.Skip("TODO")
+}
+
+func TestRelease(t *testing.T) {
+	t.Skip("TODO")
+}
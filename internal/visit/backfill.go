@@ -0,0 +1,511 @@
+package visit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MigrationsCollection is the MongoDB collection for the state of data
+// migrations.
+const MigrationsCollection = "migrations"
+
+// rollupsMigration is the ID of the migration document of the rollup
+// backfill.
+const rollupsMigration = "rollups"
+
+const (
+	// backfillTimeout is the context timeout for the aggregations
+	// of the rollup backfill, which read every visit.
+	backfillTimeout = 1 * time.Hour
+
+	// backfillGrace is how long after its cutoff the rollup backfill
+	// waits, so that visits recorded before the cutoff have been
+	// counted in their rollups.
+	backfillGrace = 10 * time.Minute
+
+	// backfillBatch is the number of rollups written at once.
+	backfillBatch = 1000
+
+	// readyInterval is how often readiness of rollups is checked,
+	// until the backfill has completed.
+	readyInterval = 1 * time.Minute
+)
+
+// ErrBackfillNotDue is returned by BackfillRollups before the cutoff of
+// the backfill, and its grace period, have passed.
+var ErrBackfillNotDue = fmt.Errorf("rollup backfill not due")
+
+// ErrRollupsNotReady is returned when deleting visits before the rollup
+// backfill has completed, since they would not be counted.
+var ErrRollupsNotReady = fmt.Errorf("rollups not backfilled")
+
+// migration is the state of the rollup backfill.
+//
+// Rollups are recorded as visits are, since the first start of an
+// instance which records them. Visits recorded before then are only
+// counted in Visit documents. The backfill recomputes every rollup
+// starting before the Cutoff, the start of the following UTC day, from
+// Visit documents, so that no visit is missed or counted twice; later
+// rollups are left as they are. Until it has completed, stats are
+// counted from Visit documents.
+type migration struct {
+	ID        string     `bson:"_id"`
+	Cutoff    time.Time  `bson:"cutoff"`
+	Completed *time.Time `bson:"completed,omitempty"`
+}
+
+// StartRollups records when rollups were first recorded, if it is not
+// recorded yet, and returns the cutoff of the rollup backfill. It must
+// be called before visits are recorded. In an environment without
+// visits, there is nothing to backfill, so the backfill is completed.
+func StartRollups(ctx context.Context, db *mongo.Client, env string) (time.Time, error) {
+	database := db.Database(env)
+	migrations := database.Collection(MigrationsCollection)
+	findContext, cancel := context.WithTimeout(ctx, aggregateTimeout)
+	defer cancel()
+
+	var m migration
+	err := migrations.FindOne(
+		findContext, bson.M{"_id": rollupsMigration},
+	).Decode(&m)
+	if err == nil {
+		return m.Cutoff, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return time.Time{}, fmt.Errorf("failed to find migration: %v", err)
+	}
+
+	now := time.Now()
+	m = migration{ID: rollupsMigration, Cutoff: PeriodDay.start(now).AddDate(0, 0, 1)}
+	n, err := database.Collection(Collection).CountDocuments(
+		findContext, bson.M{}, options.Count().SetLimit(1),
+	)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to count visits: %v", err)
+	}
+	if n == 0 {
+		m.Cutoff, m.Completed = now, &now
+	}
+
+	// Another instance may start at the same time; the first cutoff
+	// recorded is kept.
+	if _, err := migrations.UpdateOne(
+		findContext,
+		bson.M{"_id": rollupsMigration},
+		bson.M{"$setOnInsert": m},
+		options.Update().SetUpsert(true),
+	); err != nil {
+		return time.Time{}, fmt.Errorf("failed to record migration: %v", err)
+	}
+	if err := migrations.FindOne(
+		findContext, bson.M{"_id": rollupsMigration},
+	).Decode(&m); err != nil {
+		return time.Time{}, fmt.Errorf("failed to find migration: %v", err)
+	}
+
+	return m.Cutoff, nil
+}
+
+// RollupsReady reports whether the rollup backfill has completed, so
+// that stats may be counted from rollups. Completion is checked at most
+// every readyInterval, and remembered once it is seen.
+func RollupsReady(ctx context.Context, db *mongo.Client, env string) (bool, error) {
+	ready.Lock()
+	if ready.done[env] {
+		ready.Unlock()
+		return true, nil
+	}
+	if time.Since(ready.checked[env]) < readyInterval {
+		ready.Unlock()
+		return false, nil
+	}
+	ready.checked[env] = time.Now()
+	ready.Unlock()
+
+	findContext, cancel := context.WithTimeout(ctx, aggregateTimeout)
+	defer cancel()
+
+	var m migration
+	err := db.Database(env).Collection(MigrationsCollection).FindOne(
+		findContext, bson.M{"_id": rollupsMigration},
+	).Decode(&m)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to find migration: %v", err)
+	}
+	if m.Completed == nil {
+		return false, nil
+	}
+
+	ready.Lock()
+	ready.done[env] = true
+	ready.Unlock()
+
+	return true, nil
+}
+
+// ready caches the completion of the rollup backfill, by environment.
+var ready = struct {
+	sync.Mutex
+	done    map[string]bool
+	checked map[string]time.Time
+}{done: map[string]bool{}, checked: map[string]time.Time{}}
+
+// useRollups reports whether visits may be counted from rollups: if the
+// rollup backfill has completed. If it cannot be checked, visits are
+// counted from Visit documents.
+func useRollups(ctx context.Context, db *mongo.Client, env string) bool {
+	ok, err := RollupsReady(ctx, db, env)
+
+	return ok && err == nil
+}
+
+type BackfillRollupsParams struct {
+	DB          *mongo.Client
+	Environment string
+
+	// URLs is the collection of short URLs, whose creation times are
+	// counted in the daily rollups of their tenants.
+	URLs string
+}
+
+func (p BackfillRollupsParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if p.URLs == "" {
+		return fmt.Errorf("missing urls collection")
+	}
+
+	return nil
+}
+
+// BackfillRollups recomputes the rollups starting before the cutoff
+// recorded by StartRollups from Visit documents, and the short URLs
+// created before it, then marks the backfill completed. Rollups are
+// replaced rather than incremented, so an interrupted backfill may be
+// run again. It returns ErrBackfillNotDue until the cutoff, and its
+// grace period, have passed, and does nothing once completed.
+func BackfillRollups(ctx context.Context, p BackfillRollupsParams) error {
+	if err := p.validate(); err != nil {
+		return fmt.Errorf("invalid params: %v", err)
+	}
+
+	database := p.DB.Database(p.Environment)
+	migrations := database.Collection(MigrationsCollection)
+
+	var m migration
+	if err := migrations.FindOne(
+		ctx, bson.M{"_id": rollupsMigration},
+	).Decode(&m); err != nil {
+		return fmt.Errorf("failed to find migration: %v", err)
+	}
+	if m.Completed != nil {
+		return nil
+	}
+	if time.Now().Before(m.Cutoff.Add(backfillGrace)) {
+		return ErrBackfillNotDue
+	}
+
+	backfillContext, cancel := context.WithTimeout(ctx, backfillTimeout)
+	defer cancel()
+
+	tenants, err := backfillLinks(backfillContext, database, m.Cutoff)
+	if err != nil {
+		return err
+	}
+	created, err := countCreated(
+		backfillContext,
+		database.Collection(p.URLs),
+		bson.M{"created": bson.M{"$lt": m.Cutoff}},
+	)
+	if err != nil {
+		return err
+	}
+	if err := writeTenantRollups(backfillContext, database, tenants, created); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if _, err := migrations.UpdateOne(
+		ctx,
+		bson.M{"_id": rollupsMigration},
+		bson.M{"$set": bson.M{"completed": now}},
+	); err != nil {
+		return fmt.Errorf("failed to complete migration: %v", err)
+	}
+
+	return nil
+}
+
+// rollupKey identifies a rollup.
+type rollupKey struct {
+	Tenant  string
+	ShortID primitive.ObjectID
+	Period  Period
+	Start   time.Time
+}
+
+// add counts n visits like v in the rollup, as rollupUpdate does.
+func (r *rollup) add(v Visit, n int) {
+	values := map[string]string{
+		"browser":  v.Browser,
+		"country":  v.Country,
+		"device":   v.Device,
+		"language": v.Language,
+		"os":       v.OS,
+		"referrer": v.Referrer,
+		"target":   v.Target,
+		"variant":  v.Variant,
+	}
+
+	dims := &r.Dimensions
+	if v.Bot {
+		r.Bots += n
+		dims = &r.BotDimensions
+	} else {
+		r.Count += n
+	}
+	if *dims == nil {
+		*dims = map[string]map[string]int{}
+	}
+	for _, dimension := range rollupDimensions {
+		if (*dims)[dimension] == nil {
+			(*dims)[dimension] = map[string]int{}
+		}
+		(*dims)[dimension][dimensionKey(values[dimension])] += n
+	}
+}
+
+// backfillLinks recomputes the hourly and daily rollups of each short
+// URL before the cutoff, and returns the daily visits to each tenant.
+// Visits are grouped by short URL, hour, and the value of every
+// dimension, and are read by short URL, so that only the rollups of one
+// short URL are held at a time.
+func backfillLinks(ctx context.Context, database *mongo.Database, cutoff time.Time) (map[rollupKey]*rollup, error) {
+	parts := bson.M{"$dateToParts": bson.M{"date": "$time"}}
+	id := bson.M{
+		"tenant":  "$tenant",
+		"shortId": "$shortId",
+		"year":    "$parts.year",
+		"month":   "$parts.month",
+		"day":     "$parts.day",
+		"hour":    "$parts.hour",
+		"bot":     "$bot",
+	}
+	for _, dimension := range rollupDimensions {
+		id[dimension] = "$" + dimension
+	}
+
+	cursor, err := database.Collection(Collection).Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"time": bson.M{"$lt": cutoff}}},
+		{"$addFields": bson.M{"parts": parts}},
+		{"$group": bson.M{"_id": id, "count": bson.M{"$sum": 1}}},
+		{"$sort": bson.D{
+			{Key: "_id.tenant", Value: 1},
+			{Key: "_id.shortId", Value: 1},
+		}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate visits: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var (
+		tenants = map[rollupKey]*rollup{}
+		link    = map[rollupKey]*rollup{}
+		current rollupKey
+	)
+	for cursor.Next(ctx) {
+		var row struct {
+			ID struct {
+				Visit `bson:",inline"`
+				Year  int `bson:"year"`
+				Month int `bson:"month"`
+				Day   int `bson:"day"`
+				Hour  int `bson:"hour"`
+			} `bson:"_id"`
+			Count int `bson:"count"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, fmt.Errorf("failed to decode visits: %v", err)
+		}
+		v := row.ID.Visit
+		hour := time.Date(
+			row.ID.Year, time.Month(row.ID.Month), row.ID.Day,
+			row.ID.Hour, 0, 0, 0, time.UTC,
+		)
+
+		if v.Tenant != current.Tenant || v.ShortID != current.ShortID {
+			if err := writeRollups(ctx, database, link); err != nil {
+				return nil, err
+			}
+			link = map[rollupKey]*rollup{}
+			current = rollupKey{Tenant: v.Tenant, ShortID: v.ShortID}
+		}
+
+		for _, period := range []Period{PeriodHour, PeriodDay} {
+			key := rollupKey{v.Tenant, v.ShortID, period, period.start(hour)}
+			if link[key] == nil {
+				link[key] = &rollup{}
+			}
+			link[key].add(v, row.Count)
+		}
+
+		key := rollupKey{v.Tenant, environmentID, PeriodDay, PeriodDay.start(hour)}
+		if tenants[key] == nil {
+			tenants[key] = &rollup{}
+		}
+		if v.Bot {
+			tenants[key].Bots += row.Count
+		} else {
+			tenants[key].Count += row.Count
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read visits: %v", err)
+	}
+	if err := writeRollups(ctx, database, link); err != nil {
+		return nil, err
+	}
+
+	return tenants, nil
+}
+
+// writeRollups replaces the counts of rollups.
+func writeRollups(ctx context.Context, database *mongo.Database, rollups map[rollupKey]*rollup) error {
+	var models []mongo.WriteModel
+	for key, r := range rollups {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(key.filter()).
+			SetUpdate(bson.M{"$set": bson.M{
+				"count": r.Count,
+				"bots":  r.Bots,
+				"d":     r.Dimensions,
+				"b":     r.BotDimensions,
+			}}).
+			SetUpsert(true),
+		)
+	}
+
+	return bulkWrite(ctx, database, models)
+}
+
+// filter returns the query filter matching the rollup.
+func (k rollupKey) filter() bson.M {
+	return bson.M{
+		"tenant":  tenant.Match(k.Tenant),
+		"shortId": k.ShortID,
+		"period":  k.Period,
+		"start":   k.Start,
+	}
+}
+
+// bulkWrite writes models in batches of backfillBatch.
+func bulkWrite(ctx context.Context, database *mongo.Database, models []mongo.WriteModel) error {
+	coll := database.Collection(RollupsCollection)
+	for len(models) > 0 {
+		n := len(models)
+		if n > backfillBatch {
+			n = backfillBatch
+		}
+		if _, err := coll.BulkWrite(
+			ctx, models[:n], options.BulkWrite().SetOrdered(false),
+		); err != nil {
+			return fmt.Errorf("failed to write rollups: %v", err)
+		}
+		models = models[n:]
+	}
+
+	return nil
+}
+
+// countCreated counts the short URLs matching a $match stage, by tenant
+// and UTC day, keyed by the daily rollup of the tenant. The caller sets
+// the timeout on ctx.
+func countCreated(ctx context.Context, urls *mongo.Collection, match bson.M) (map[rollupKey]int, error) {
+	cursor, err := urls.Aggregate(ctx, []bson.M{
+		{"$match": match},
+		{"$project": bson.M{
+			"tenant": 1,
+			"parts":  bson.M{"$dateToParts": bson.M{"date": "$created"}},
+		}},
+		{"$group": bson.M{
+			"_id": bson.M{
+				"tenant": "$tenant",
+				"year":   "$parts.year",
+				"month":  "$parts.month",
+				"day":    "$parts.day",
+			},
+			"count": bson.M{"$sum": 1},
+		}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate short urls: %v", err)
+	}
+
+	var res []struct {
+		ID struct {
+			Tenant string `bson:"tenant"`
+			Year   int    `bson:"year"`
+			Month  int    `bson:"month"`
+			Day    int    `bson:"day"`
+		} `bson:"_id"`
+		Count int `bson:"count"`
+	}
+	if err := cursor.All(ctx, &res); err != nil {
+		return nil, fmt.Errorf("failed to decode short urls: %v", err)
+	}
+
+	created := map[rollupKey]int{}
+	for _, r := range res {
+		day := time.Date(r.ID.Year, time.Month(r.ID.Month), r.ID.Day, 0, 0, 0, 0, time.UTC)
+		created[rollupKey{r.ID.Tenant, environmentID, PeriodDay, day}] = r.Count
+	}
+
+	return created, nil
+}
+
+// writeTenantRollups replaces the counts of the daily rollups of
+// tenants.
+func writeTenantRollups(
+	ctx context.Context,
+	database *mongo.Database,
+	visits map[rollupKey]*rollup,
+	created map[rollupKey]int,
+) error {
+	set := map[rollupKey]bson.M{}
+	for key, r := range visits {
+		set[key] = bson.M{"count": r.Count, "bots": r.Bots, "created": 0}
+	}
+	for key, n := range created {
+		if set[key] == nil {
+			set[key] = bson.M{"count": 0, "bots": 0}
+		}
+		set[key]["created"] = n
+	}
+
+	var models []mongo.WriteModel
+	for key, fields := range set {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(key.filter()).
+			SetUpdate(bson.M{"$set": fields}).
+			SetUpsert(true),
+		)
+	}
+
+	return bulkWrite(ctx, database, models)
+}
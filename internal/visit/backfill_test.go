@@ -0,0 +1,70 @@
+package visit
+
+import (
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TestRollupAdd checks that rollups recomputed by the backfill count
+// visits as the updates recorded with each visit do.
+func TestRollupAdd(t *testing.T) {
+	visits := []Visit{
+		{Browser: "firefox", Referrer: "news.example.com"},
+		{Browser: "firefox", Country: "US"},
+		{Bot: true, Browser: "other"},
+	}
+
+	var r rollup
+	expected := map[string]int{}
+	for _, v := range visits {
+		r.add(v, 2)
+		for field, n := range rollupUpdate(v)["$inc"].(bson.M) {
+			expected[field] += 2 * n.(int)
+		}
+	}
+
+	got := map[string]int{"count": r.Count, "bots": r.Bots}
+	for prefix, dims := range map[string]map[string]map[string]int{
+		"d": r.Dimensions, "b": r.BotDimensions,
+	} {
+		for dimension, values := range dims {
+			for key, n := range values {
+				got[strings.Join([]string{prefix, dimension, key}, ".")] = n
+			}
+		}
+	}
+	for field, n := range expected {
+		if got[field] != n {
+			t.Errorf("%s: expected %d but got %d", field, n, got[field])
+		}
+	}
+	for field, n := range got {
+		if _, ok := expected[field]; !ok && n != 0 {
+			t.Errorf("%s: unexpected count %d", field, n)
+		}
+	}
+}
+
+func TestBackfillRollupsParamsValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		p     BackfillRollupsParams
+		valid bool
+	}{
+		{"valid", BackfillRollupsParams{DB: &mongo.Client{}, Environment: "test", URLs: "urls"}, true},
+		{"missing db", BackfillRollupsParams{Environment: "test", URLs: "urls"}, false},
+		{"missing env", BackfillRollupsParams{DB: &mongo.Client{}, URLs: "urls"}, false},
+		{"missing urls", BackfillRollupsParams{DB: &mongo.Client{}, Environment: "test"}, false},
+	} {
+		if err := tc.p.validate(); (err == nil) != tc.valid {
+			t.Errorf("%s: expected valid %v but got %v", tc.name, tc.valid, err)
+		}
+	}
+}
+
+func TestBackfillRollups(t *testing.T) {
+	t.Skip("TODO")
+}
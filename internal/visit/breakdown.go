@@ -0,0 +1,252 @@
+package visit
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/dwrz/url-shortener/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// DefaultTop is the default number of values in a Breakdown.
+	DefaultTop = 10
+
+	// MaxTop is the maximum number of values in a Breakdown.
+	MaxTop = 100
+)
+
+// dimensions maps the dimensions visits may be broken down by to their
+// Visit document fields.
+var dimensions = map[string]string{
+	"browser":  "browser",
+	"country":  "country",
+	"device":   "device",
+	"language": "language",
+	"os":       "os",
+	"referrer": "referrer",
+}
+
+// IsDimension reports whether visits may be broken down by s.
+func IsDimension(s string) bool {
+	_, ok := dimensions[s]
+	return ok
+}
+
+// BreakdownItem is the count of visits with a value of a dimension.
+// An empty value counts visits where the dimension is unknown; e.g.,
+// direct visits have no referrer.
+type BreakdownItem struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Breakdown ranks the values of a dimension by their count of visits.
+type Breakdown struct {
+	By    string          `json:"by"`
+	Items []BreakdownItem `json:"items"`
+
+	// Other is the count of visits with values outside the top items.
+	Other int `json:"other"`
+
+	// Total is the count of all visits, including Other.
+	Total int `json:"total"`
+}
+
+type GetBreakdownParams struct {
+	DB          *mongo.Client
+	Environment string
+	Tenant      string
+	ShortID     primitive.ObjectID
+
+	// By is the dimension to break visits down by.
+	By string
+
+	// Top is the number of values to rank; the remainder are counted
+	// as Other.
+	Top int
+
+	// Range restricts the visits counted. Optional; if nil, all visits
+	// are counted.
+	Range *Range
+
+	// Filter restricts the visits counted. Optional.
+	Filter Filter
+}
+
+func (p GetBreakdownParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if len(p.ShortID) == 0 {
+		return fmt.Errorf("missing document id")
+	}
+	if !IsDimension(p.By) {
+		return fmt.Errorf("invalid dimension %q", p.By)
+	}
+	if p.Top < 1 || p.Top > MaxTop {
+		return fmt.Errorf("invalid top")
+	}
+	if p.Range != nil {
+		if err := p.Range.validate(); err != nil {
+			return fmt.Errorf("invalid range: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// GetBreakdown counts the visits to a short URL by each value of a
+// dimension, and returns the values with the most visits.
+// Visits are counted from daily rollups, or hourly rollups for a range,
+// which is extended to start on the hour. Filtered visits, and visits
+// before rollups have been backfilled, are counted from Visit documents
+// instead, which only cover the retention window.
+func GetBreakdown(ctx context.Context, p GetBreakdownParams) (b Breakdown, err error) {
+	if err := p.validate(); err != nil {
+		return b, fmt.Errorf("invalid params: %v", err)
+	}
+
+	if p.Filter.HasDimensions() || !useRollups(ctx, p.DB, p.Environment) {
+		return rawBreakdown(ctx, p)
+	}
+
+	params := findRollupsParams{
+		DB:          p.DB,
+		Environment: p.Environment,
+		Tenant:      p.Tenant,
+		ShortID:     p.ShortID,
+		Period:      PeriodDay,
+		Dimensions:  []string{dimensions[p.By]},
+	}
+	if p.Range != nil {
+		params.Period = PeriodHour
+		params.From = PeriodHour.start(p.Range.From)
+		params.To = p.Range.To
+	}
+
+	rollups, err := findRollups(ctx, params)
+	if err != nil {
+		return b, err
+	}
+
+	var total int
+	values := map[string]int{}
+	for _, r := range rollups {
+		total += r.count(Filter{IncludeBots: p.Filter.IncludeBots})
+		for value, n := range r.values(dimensions[p.By], p.Filter.IncludeBots) {
+			values[value] += n
+		}
+	}
+
+	return rank(p.By, values, total, p.Top), nil
+}
+
+// rank returns a Breakdown of the top values by count. Ties are ranked
+// by value, so that results are stable.
+func rank(by string, values map[string]int, total, top int) Breakdown {
+	b := Breakdown{By: by, Items: []BreakdownItem{}, Total: total}
+	for value, n := range values {
+		b.Items = append(b.Items, BreakdownItem{Value: value, Count: n})
+	}
+	sort.Slice(b.Items, func(i, j int) bool {
+		if b.Items[i].Count != b.Items[j].Count {
+			return b.Items[i].Count > b.Items[j].Count
+		}
+		return b.Items[i].Value < b.Items[j].Value
+	})
+	if len(b.Items) > top {
+		b.Items = b.Items[:top]
+	}
+
+	b.Other = total
+	for _, item := range b.Items {
+		b.Other -= item.Count
+	}
+
+	return b
+}
+
+// rawBreakdown counts the visits to a short URL by each value of a
+// dimension, by aggregating Visit documents.
+func rawBreakdown(ctx context.Context, p GetBreakdownParams) (b Breakdown, err error) {
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+
+	match := bson.M{"tenant": tenant.Match(p.Tenant), "shortId": p.ShortID}
+	p.Filter.apply(match)
+	if p.Range != nil {
+		p.Range.apply(match)
+	}
+
+	// Count visits by value, then in parallel take the top values,
+	// and sum all counts for the total. Ties are ranked by value, so
+	// that results are stable.
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$group": bson.M{
+			"_id":   "$" + dimensions[p.By],
+			"count": bson.M{"$sum": 1},
+		}},
+		{"$facet": bson.M{
+			"items": []bson.M{
+				{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+				{"$limit": p.Top},
+			},
+			"total": []bson.M{
+				{"$group": bson.M{
+					"_id":   nil,
+					"count": bson.M{"$sum": "$count"},
+				}},
+			},
+		}},
+	}
+
+	aggregateContext, cancel := context.WithTimeout(ctx, aggregateTimeout)
+	defer cancel()
+
+	cursor, err := coll.Aggregate(aggregateContext, pipeline)
+	if err != nil {
+		return b, fmt.Errorf("failed to aggregate breakdown: %v", err)
+	}
+
+	var res []struct {
+		Items []struct {
+			Value string `bson:"_id"`
+			Count int    `bson:"count"`
+		} `bson:"items"`
+		Total []struct {
+			Count int `bson:"count"`
+		} `bson:"total"`
+	}
+	if err = cursor.All(ctx, &res); err != nil {
+		return b, fmt.Errorf("failed to decode breakdown: %v", err)
+	}
+
+	b = Breakdown{By: p.By, Items: []BreakdownItem{}}
+	if len(res) == 0 {
+		return b, nil
+	}
+
+	if len(res[0].Total) > 0 {
+		b.Total = res[0].Total[0].Count
+	}
+
+	// Values missing from a document group together as null, which
+	// decodes as an empty string.
+	b.Other = b.Total
+	for _, item := range res[0].Items {
+		b.Items = append(b.Items, BreakdownItem{
+			Value: item.Value,
+			Count: item.Count,
+		})
+		b.Other -= item.Count
+	}
+
+	return b, nil
+}
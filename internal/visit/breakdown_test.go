@@ -0,0 +1,41 @@
+package visit
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestGetBreakdownParamsValidate(t *testing.T) {
+	valid := GetBreakdownParams{
+		DB:          &mongo.Client{},
+		Environment: "test",
+		ShortID:     primitive.NewObjectID(),
+		By:          "referrer",
+		Top:         DefaultTop,
+	}
+	if err := valid.validate(); err != nil {
+		t.Errorf("expected valid params but got %v", err)
+	}
+
+	now := time.Now()
+	var tests = []func(p *GetBreakdownParams){
+		func(p *GetBreakdownParams) { p.By = "ipHash" },
+		func(p *GetBreakdownParams) { p.Top = 0 },
+		func(p *GetBreakdownParams) { p.Top = MaxTop + 1 },
+		func(p *GetBreakdownParams) { p.Range = &Range{From: now, To: now} },
+	}
+	for i, modify := range tests {
+		p := valid
+		modify(&p)
+		if err := p.validate(); err == nil {
+			t.Errorf("%d: expected invalid params", i)
+		}
+	}
+}
+
+func TestGetBreakdown(t *testing.T) {
+	t.Skip("TODO")
+}
@@ -0,0 +1,162 @@
+package visit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/cache"
+	"github.com/dwrz/url-shortener/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// counterTTL is how long a cached visit counter is kept before it is
+// reseeded from the database.
+const counterTTL = 24 * time.Hour
+
+type CountParams struct {
+	DB          *mongo.Client
+	Environment string
+	Tenant      string
+	ShortID     primitive.ObjectID
+}
+
+func (p CountParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if len(p.ShortID) == 0 {
+		return fmt.Errorf("missing document id")
+	}
+
+	return nil
+}
+
+// Count returns the number of visits to a short URL, from its daily
+// rollups. Until rollups have been backfilled, visits are counted from
+// Visit documents instead.
+func Count(ctx context.Context, p CountParams) (int64, error) {
+	if err := p.validate(); err != nil {
+		return 0, fmt.Errorf("invalid params: %v", err)
+	}
+
+	countContext, cancel := context.WithTimeout(ctx, countTimeout)
+	defer cancel()
+
+	database := p.DB.Database(p.Environment)
+	if !useRollups(ctx, p.DB, p.Environment) {
+		n, err := database.Collection(Collection).CountDocuments(
+			countContext, bson.M{
+				"tenant":  tenant.Match(p.Tenant),
+				"shortId": p.ShortID,
+				"bot":     bson.M{"$ne": true},
+			},
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count: %v", err)
+		}
+
+		return n, nil
+	}
+
+	coll := database.Collection(RollupsCollection)
+
+	cursor, err := coll.Aggregate(countContext, []bson.M{
+		{"$match": bson.M{
+			"tenant":  tenant.Match(p.Tenant),
+			"shortId": p.ShortID,
+			"period":  PeriodDay,
+		}},
+		{"$group": bson.M{"_id": nil, "count": bson.M{"$sum": "$count"}}},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count: %v", err)
+	}
+
+	var res []struct {
+		Count int64 `bson:"count"`
+	}
+	if err := cursor.All(countContext, &res); err != nil {
+		return 0, fmt.Errorf("failed to decode count: %v", err)
+	}
+	if len(res) == 0 {
+		return 0, nil
+	}
+
+	return res[0].Count, nil
+}
+
+type IncrementParams struct {
+	Cache       cache.Cache
+	DB          *mongo.Client
+	Environment string
+	Tenant      string
+	ShortID     primitive.ObjectID
+}
+
+func (p IncrementParams) validate() error {
+	if p.Cache == nil {
+		return fmt.Errorf("missing cache")
+	}
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if len(p.ShortID) == 0 {
+		return fmt.Errorf("missing document id")
+	}
+
+	return nil
+}
+
+// Increment increments and returns a cached count of visits to a short
+// URL, so that visit limits can be enforced without querying the
+// database on every visit.
+// If the counter is not cached, it is seeded from the database. The
+// counter may briefly undercount if visits are recorded between the
+// seed and the increment, but it converges once reseeded.
+func Increment(ctx context.Context, p IncrementParams) (int64, error) {
+	if err := p.validate(); err != nil {
+		return 0, fmt.Errorf("invalid params: %v", err)
+	}
+
+	key := fmt.Sprintf(
+		"%s:%s:%s", p.Environment, Collection, p.ShortID.Hex(),
+	)
+
+	n, err := p.Cache.IncrBy(ctx, key, 1, counterTTL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment counter: %v", err)
+	}
+
+	// A count of one means the counter was just created.
+	// Add any visits already recorded in the database.
+	if n == 1 {
+		count, err := Count(ctx, CountParams{
+			DB:          p.DB,
+			Environment: p.Environment,
+			Tenant:      p.Tenant,
+			ShortID:     p.ShortID,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to seed counter: %v", err)
+		}
+		if count > 0 {
+			n, err = p.Cache.IncrBy(ctx, key, count, counterTTL)
+			if err != nil {
+				return 0, fmt.Errorf(
+					"failed to seed counter: %v", err,
+				)
+			}
+		}
+	}
+
+	return n, nil
+}
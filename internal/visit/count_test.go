@@ -0,0 +1,39 @@
+package visit
+
+import (
+	"testing"
+
+	"github.com/dwrz/url-shortener/internal/cache"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestCountParamsValidate(t *testing.T) {
+	t.Skip("TODO")
+}
+
+func TestCount(t *testing.T) {
+	t.Skip("TODO")
+}
+
+func TestIncrementParamsValidate(t *testing.T) {
+	valid := IncrementParams{
+		Cache:       cache.NewLocal(0),
+		DB:          &mongo.Client{},
+		Environment: "test",
+		ShortID:     primitive.NewObjectID(),
+	}
+	if err := valid.validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	missingCache := valid
+	missingCache.Cache = nil
+	if err := missingCache.validate(); err == nil {
+		t.Error("expected error for missing cache")
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	t.Skip("TODO")
+}
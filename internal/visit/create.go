@@ -3,7 +3,9 @@ package visit
 import (
 	"context"
 	"fmt"
+	"log"
 	"time"
+	"unicode/utf8"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -12,7 +14,49 @@ import (
 type CreateParams struct {
 	DB          *mongo.Client
 	Environment string
+	Tenant      string
 	ShortID     primitive.ObjectID
+
+	// ID is the ID of the visit document. Optional; if zero, one is
+	// generated. It is set to the ID of a click which may convert.
+	ID primitive.ObjectID
+
+	// Target is the name of the target the visitor matched, if any.
+	Target string
+
+	// Country is the visitor's country code, if resolved.
+	Country string
+
+	// Variant is the name of the variant the visitor was redirected
+	// to, if any.
+	Variant string
+
+	// Referrer is the host name of the referring page, if any.
+	Referrer string
+
+	// UserAgent is the visitor's User-Agent header.
+	// Browser, OS, and Device are its classification.
+	UserAgent string
+	Browser   string
+	OS        string
+	Device    string
+
+	// Language is the visitor's preferred language, if any.
+	Language string
+
+	// IPHash is the hashed visitor IP address; never the address.
+	IPHash string
+
+	// Visitor identifies the visitor on every day, to estimate unique
+	// visitors; e.g., a visitor hash of the IP address. It is not
+	// stored. See package iphash.
+	Visitor string
+
+	// Bot is set if the visitor is an automated client.
+	Bot bool
+
+	// Time is when the visit occurred. Optional; defaults to now.
+	Time time.Time
 }
 
 func (p CreateParams) validate() error {
@@ -29,7 +73,8 @@ func (p CreateParams) validate() error {
 	return nil
 }
 
-// Create creates a Visit document in MongoDB.
+// Create creates a Visit document in MongoDB, and counts it in the
+// short URL's rollups and unique visitors.
 func Create(ctx context.Context, p CreateParams) error {
 	if err := p.validate(); err != nil {
 		return fmt.Errorf("invalid params: %v", err)
@@ -40,12 +85,61 @@ func Create(ctx context.Context, p CreateParams) error {
 	insertContext, cancel := context.WithTimeout(ctx, insertTimeout)
 	defer cancel()
 
-	if _, err := coll.InsertOne(insertContext, Visit{
-		ShortID: p.ShortID,
-		Time:    time.Now(),
-	}); err != nil {
+	v := Visit{
+		ID:        p.ID,
+		ShortID:   p.ShortID,
+		Tenant:    p.Tenant,
+		Time:      p.Time,
+		Target:    p.Target,
+		Country:   p.Country,
+		Variant:   p.Variant,
+		Referrer:  p.Referrer,
+		UserAgent: truncate(p.UserAgent, maxUserAgentLength),
+		Browser:   p.Browser,
+		OS:        p.OS,
+		Device:    p.Device,
+		Language:  p.Language,
+		IPHash:    p.IPHash,
+		Bot:       p.Bot,
+	}
+	if v.Time.IsZero() {
+		v.Time = time.Now()
+	}
+	if _, err := coll.InsertOne(insertContext, v); err != nil {
 		return fmt.Errorf("failed to insert access record: %v", err)
 	}
 
+	// Count the visit in its rollups, and add the visitor to the
+	// unique visitor sketch, unless it is a bot. The visit is already
+	// recorded, so failures are only logged.
+	if err := addRollups(ctx, p.DB, p.Environment, v); err != nil {
+		log.Printf("failed to add visit to rollups: %v", err)
+	}
+	if p.Visitor != "" && !p.Bot {
+		if err := addUnique(ctx, addUniqueParams{
+			DB:          p.DB,
+			Environment: p.Environment,
+			Tenant:      p.Tenant,
+			ShortID:     p.ShortID,
+			Time:        v.Time,
+			Visitor:     p.Visitor,
+		}); err != nil {
+			log.Printf("failed to add unique visitor: %v", err)
+		}
+	}
+
 	return nil
 }
+
+// truncate returns the first n bytes of s, without splitting a UTF-8
+// encoded rune.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
@@ -0,0 +1,437 @@
+package visit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// DefaultDashboardDays is the default number of days covered by a
+	// Dashboard.
+	DefaultDashboardDays = 30
+
+	// MaxDashboardDays is the maximum number of days covered by a
+	// Dashboard.
+	MaxDashboardDays = 365
+)
+
+// DashboardDay counts the visits to all short URLs on a UTC day, and the
+// short URLs created.
+type DashboardDay struct {
+	Day     time.Time `json:"day"`
+	Visits  int       `json:"visits"`
+	Created int       `json:"created"`
+}
+
+// LinkVisits is the count of visits to a short URL.
+type LinkVisits struct {
+	ShortID primitive.ObjectID `json:"-"`
+	Visits  int                `json:"visits"`
+}
+
+// Dashboard summarizes the activity across an environment, or across a
+// set of short URLs, over a range of UTC days.
+type Dashboard struct {
+	Range
+
+	// Visits and Created are the totals of Days.
+	Visits  int `json:"visits"`
+	Created int `json:"created"`
+
+	// Days has an entry for every day in the range, in order.
+	Days []DashboardDay `json:"days"`
+
+	// Top are the short URLs with the most visits in the range, in
+	// descending order.
+	Top []LinkVisits `json:"top"`
+}
+
+type GetDashboardParams struct {
+	DB          *mongo.Client
+	Environment string
+	Tenant      string
+
+	// Days is the number of UTC days covered, ending today.
+	Days int
+
+	// Top is the number of short URLs to rank by visits.
+	Top int
+
+	// IncludeBots counts visits by bots.
+	IncludeBots bool
+
+	// ShortIDs restricts the dashboard to those short URLs; e.g., to
+	// those a principal may access. It is ignored if All is set.
+	ShortIDs []primitive.ObjectID
+
+	// All covers all short URLs of the tenant.
+	All bool
+
+	// URLs is the collection of short URLs. Until rollups have been
+	// backfilled, the short URLs of a tenant created each day are
+	// counted from it.
+	URLs string
+}
+
+func (p GetDashboardParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if p.Days < 1 || p.Days > MaxDashboardDays {
+		return fmt.Errorf("invalid days")
+	}
+	if p.Top < 1 || p.Top > MaxTop {
+		return fmt.Errorf("invalid top")
+	}
+	if p.All && p.URLs == "" {
+		return fmt.Errorf("missing urls collection")
+	}
+
+	return nil
+}
+
+// shortIDs adds the conditions on the tenant and short URLs covered to
+// a $match stage.
+func (p GetDashboardParams) shortIDs(match bson.M) {
+	match["tenant"] = tenant.Match(p.Tenant)
+	if p.All {
+		return
+	}
+
+	ids := p.ShortIDs
+	if ids == nil {
+		ids = []primitive.ObjectID{}
+	}
+	match["shortId"] = bson.M{"$in": ids}
+}
+
+// GetDashboard assembles a Dashboard from daily rollups. For all short
+// URLs of a tenant, daily totals come from the rollups for the tenant,
+// so they cost a document per day. For a set of short URLs, daily
+// totals are summed from their own daily rollups. The top short URLs
+// are ranked from their own daily rollups. Until rollups have been
+// backfilled, the Dashboard is counted from Visit documents instead.
+func GetDashboard(ctx context.Context, p GetDashboardParams) (d Dashboard, err error) {
+	if err := p.validate(); err != nil {
+		return d, fmt.Errorf("invalid params: %v", err)
+	}
+
+	today := PeriodDay.start(time.Now())
+	rg := Range{
+		From: today.AddDate(0, 0, 1-p.Days),
+		To:   today.AddDate(0, 0, 1),
+	}
+
+	if !useRollups(ctx, p.DB, p.Environment) {
+		return rawDashboard(ctx, p, rg)
+	}
+
+	var rollups []rollup
+	if p.All {
+		rollups, err = findRollups(ctx, findRollupsParams{
+			DB:          p.DB,
+			Environment: p.Environment,
+			Tenant:      p.Tenant,
+			ShortID:     environmentID,
+			Period:      PeriodDay,
+			From:        rg.From,
+			To:          rg.To,
+		})
+	} else {
+		rollups, err = linkDays(ctx, p, rg)
+	}
+	if err != nil {
+		return d, err
+	}
+
+	top, err := topLinks(ctx, p, rg)
+	if err != nil {
+		return d, err
+	}
+
+	d = dashboardDays(rg, rollups, p.IncludeBots)
+	d.Top = top
+
+	return d, nil
+}
+
+// dashboardDays returns a Dashboard with an entry for every day in the
+// range, counted from the rollups for the environment.
+func dashboardDays(rg Range, rollups []rollup, includeBots bool) Dashboard {
+	byDay := map[time.Time]rollup{}
+	for _, r := range rollups {
+		day := PeriodDay.start(r.Start)
+		existing := byDay[day]
+		existing.Count += r.Count
+		existing.Bots += r.Bots
+		existing.Created += r.Created
+		byDay[day] = existing
+	}
+
+	d := Dashboard{Range: rg, Days: []DashboardDay{}, Top: []LinkVisits{}}
+	for day := rg.From; day.Before(rg.To); day = day.AddDate(0, 0, 1) {
+		r := byDay[day]
+		dd := DashboardDay{
+			Day:     day,
+			Visits:  r.count(Filter{IncludeBots: includeBots}),
+			Created: r.Created,
+		}
+		d.Days = append(d.Days, dd)
+		d.Visits += dd.Visits
+		d.Created += dd.Created
+	}
+
+	return d
+}
+
+// linkDays returns a rollup for each day in the range with visits to the
+// short URLs in the params, summed from their daily rollups, and with
+// the short URLs created that day.
+func linkDays(ctx context.Context, p GetDashboardParams, rg Range) ([]rollup, error) {
+	coll := p.DB.Database(p.Environment).Collection(RollupsCollection)
+
+	match := bson.M{
+		"period": PeriodDay,
+		"start":  bson.M{"$gte": rg.From, "$lt": rg.To},
+	}
+	p.shortIDs(match)
+
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$group": bson.M{
+			"_id":   "$start",
+			"count": bson.M{"$sum": "$count"},
+			"bots":  bson.M{"$sum": "$bots"},
+		}},
+		{"$project": bson.M{
+			"_id": 0, "start": "$_id", "count": 1, "bots": 1,
+		}},
+	}
+
+	aggregateContext, cancel := context.WithTimeout(ctx, aggregateTimeout)
+	defer cancel()
+
+	cursor, err := coll.Aggregate(aggregateContext, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate rollups: %v", err)
+	}
+
+	var rollups []rollup
+	if err := cursor.All(aggregateContext, &rollups); err != nil {
+		return nil, fmt.Errorf("failed to decode rollups: %v", err)
+	}
+
+	return append(rollups, idDays(p.ShortIDs, rg)...), nil
+}
+
+// idDays returns a rollup counting the creation of each short URL
+// created in the range, on the day it was created; dashboardDays sums
+// the rollups of each day. Short URLs are created when their IDs are
+// generated, so the time of creation is read from the IDs.
+func idDays(ids []primitive.ObjectID, rg Range) []rollup {
+	var rollups []rollup
+	for _, id := range ids {
+		created := id.Timestamp()
+		if created.Before(rg.From) || !created.Before(rg.To) {
+			continue
+		}
+		rollups = append(rollups, rollup{
+			Start:   PeriodDay.start(created),
+			Created: 1,
+		})
+	}
+
+	return rollups
+}
+
+// topLinks ranks the short URLs by their visits in the range, from their
+// daily rollups. Ties are ranked by ID, so that results are stable.
+func topLinks(ctx context.Context, p GetDashboardParams, rg Range) ([]LinkVisits, error) {
+	coll := p.DB.Database(p.Environment).Collection(RollupsCollection)
+
+	visits := bson.M{"$sum": "$count"}
+	if p.IncludeBots {
+		visits = bson.M{"$sum": bson.M{"$add": bson.A{
+			bson.M{"$ifNull": bson.A{"$count", 0}},
+			bson.M{"$ifNull": bson.A{"$bots", 0}},
+		}}}
+	}
+
+	match := bson.M{
+		"shortId": bson.M{"$ne": environmentID},
+		"period":  PeriodDay,
+		"start":   bson.M{"$gte": rg.From, "$lt": rg.To},
+	}
+	p.shortIDs(match)
+
+	return rankLinks(ctx, coll, []bson.M{
+		{"$match": match},
+		// Project the counts alone, so that dimensions are not read.
+		{"$project": bson.M{"shortId": 1, "count": 1, "bots": 1}},
+		{"$group": bson.M{"_id": "$shortId", "visits": visits}},
+	}, p.Top)
+}
+
+// rankLinks ranks the short URLs counted by a pipeline, which groups
+// them by ID with their "visits". Ties are ranked by ID, so that results
+// are stable.
+func rankLinks(ctx context.Context, coll *mongo.Collection, pipeline []bson.M, top int) ([]LinkVisits, error) {
+	pipeline = append(pipeline,
+		bson.M{"$match": bson.M{"visits": bson.M{"$gt": 0}}},
+		bson.M{"$sort": bson.D{{Key: "visits", Value: -1}, {Key: "_id", Value: 1}}},
+		bson.M{"$limit": top},
+	)
+
+	aggregateContext, cancel := context.WithTimeout(ctx, aggregateTimeout)
+	defer cancel()
+
+	cursor, err := coll.Aggregate(
+		aggregateContext, pipeline, options.Aggregate().SetAllowDiskUse(true),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate top links: %v", err)
+	}
+
+	var res []struct {
+		ShortID primitive.ObjectID `bson:"_id"`
+		Visits  int                `bson:"visits"`
+	}
+	if err := cursor.All(aggregateContext, &res); err != nil {
+		return nil, fmt.Errorf("failed to decode top links: %v", err)
+	}
+
+	links := []LinkVisits{}
+	for _, r := range res {
+		links = append(links, LinkVisits{ShortID: r.ShortID, Visits: r.Visits})
+	}
+
+	return links, nil
+}
+
+// rawDashboard assembles a Dashboard by aggregating Visit documents, and
+// for all short URLs of a tenant, the short URLs created.
+func rawDashboard(ctx context.Context, p GetDashboardParams, rg Range) (d Dashboard, err error) {
+	database := p.DB.Database(p.Environment)
+	coll := database.Collection(Collection)
+
+	match := bson.M{}
+	p.shortIDs(match)
+	Filter{IncludeBots: p.IncludeBots}.apply(match)
+	rg.apply(match)
+
+	aggregateContext, cancel := context.WithTimeout(ctx, aggregateTimeout)
+	defer cancel()
+
+	counts, err := aggregateTimeSeriesCounts(aggregateContext, coll, match, Day, time.UTC)
+	if err != nil {
+		return d, err
+	}
+	var rollups []rollup
+	for day, n := range counts {
+		rollups = append(rollups, rollup{Start: day, Count: n})
+	}
+
+	if p.All {
+		created, err := createdDays(ctx, database.Collection(p.URLs), p.Tenant, rg)
+		if err != nil {
+			return d, err
+		}
+		rollups = append(rollups, created...)
+	} else {
+		rollups = append(rollups, idDays(p.ShortIDs, rg)...)
+	}
+
+	top, err := rankLinks(ctx, coll, []bson.M{
+		{"$match": match},
+		{"$group": bson.M{"_id": "$shortId", "visits": bson.M{"$sum": 1}}},
+	}, p.Top)
+	if err != nil {
+		return d, err
+	}
+
+	d = dashboardDays(rg, rollups, false)
+	d.Top = top
+
+	return d, nil
+}
+
+// createdDays returns a rollup for each day in the range with the short
+// URLs of a tenant created that day.
+func createdDays(ctx context.Context, urls *mongo.Collection, t string, rg Range) ([]rollup, error) {
+	aggregateContext, cancel := context.WithTimeout(ctx, aggregateTimeout)
+	defer cancel()
+
+	created, err := countCreated(aggregateContext, urls, bson.M{
+		"tenant":  tenant.Match(t),
+		"created": bson.M{"$gte": rg.From, "$lt": rg.To},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var rollups []rollup
+	for key, n := range created {
+		rollups = append(rollups, rollup{Start: key.Start, Created: n})
+	}
+
+	return rollups, nil
+}
+
+type AddCreatedParams struct {
+	DB          *mongo.Client
+	Environment string
+	Tenant      string
+	Time        time.Time
+}
+
+func (p AddCreatedParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if p.Time.IsZero() {
+		return fmt.Errorf("missing time")
+	}
+
+	return nil
+}
+
+// AddCreated counts a short URL created at Time in the daily rollup for
+// its tenant.
+func AddCreated(ctx context.Context, p AddCreatedParams) error {
+	if err := p.validate(); err != nil {
+		return fmt.Errorf("invalid params: %v", err)
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(RollupsCollection)
+	updateContext, cancel := context.WithTimeout(ctx, insertTimeout)
+	defer cancel()
+
+	if _, err := coll.UpdateOne(
+		updateContext,
+		bson.M{
+			"tenant":  tenant.Match(p.Tenant),
+			"shortId": environmentID,
+			"period":  PeriodDay,
+			"start":   PeriodDay.start(p.Time),
+		},
+		bson.M{"$inc": bson.M{"created": 1}},
+		options.Update().SetUpsert(true),
+	); err != nil {
+		return fmt.Errorf("failed to update rollup: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package visit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// exportBatchSize is the number of documents read from the
+	// database at a time when exporting.
+	exportBatchSize = 1000
+
+	// exportTimeout is the timeout for aggregating exported buckets,
+	// which may cover every short URL.
+	exportTimeout = 30 * time.Second
+)
+
+type ExportParams struct {
+	DB          *mongo.Client
+	Environment string
+	Tenant      string
+
+	// ShortIDs are the short URLs whose visits are exported.
+	// It is ignored if All is set.
+	ShortIDs []primitive.ObjectID
+
+	// All exports the visits to all short URLs of the tenant.
+	All bool
+
+	Range Range
+
+	// Filter restricts the visits exported. Optional.
+	Filter Filter
+}
+
+func (p ExportParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if err := p.Range.validate(); err != nil {
+		return fmt.Errorf("invalid range: %v", err)
+	}
+
+	return nil
+}
+
+// shortIDs adds the conditions on the tenant and short URLs exported to
+// a $match stage.
+func (p ExportParams) shortIDs(match bson.M) {
+	match["tenant"] = tenant.Match(p.Tenant)
+	if p.All {
+		return
+	}
+
+	ids := p.ShortIDs
+	if ids == nil {
+		ids = []primitive.ObjectID{}
+	}
+	match["shortId"] = bson.M{"$in": ids}
+}
+
+// ExportVisits calls fn with each Visit matching the params, in the
+// order they were recorded. Visits are read with a cursor, in batches,
+// so that any number can be exported without holding them in memory.
+// It stops at the first error returned by fn, and returns it.
+// Visits are only kept for the retention window.
+func ExportVisits(ctx context.Context, p ExportParams, fn func(Visit) error) error {
+	if err := p.validate(); err != nil {
+		return fmt.Errorf("invalid params: %v", err)
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+
+	match := bson.M{}
+	p.shortIDs(match)
+	p.Filter.apply(match)
+	p.Range.apply(match)
+
+	// Sort by ID, which follows the time of insertion, and is always
+	// indexed; sorting by time could exceed the memory allowed for
+	// sorts on large exports.
+	cursor, err := coll.Find(ctx, match, options.Find().
+		SetSort(bson.M{"_id": 1}).
+		SetBatchSize(exportBatchSize),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to find visits: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var v Visit
+		if err := cursor.Decode(&v); err != nil {
+			return fmt.Errorf("failed to decode visit: %v", err)
+		}
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to read visits: %v", err)
+	}
+
+	return nil
+}
+
+// ExportBuckets counts the visits matching the params in buckets of an
+// interval, in the location loc, as GetTimeSeries does for a short URL.
+func ExportBuckets(ctx context.Context, p ExportParams, i Interval, loc *time.Location) ([]Bucket, error) {
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid params: %v", err)
+	}
+	if _, err := ParseInterval(string(i)); err != nil {
+		return nil, fmt.Errorf("invalid params: %v", err)
+	}
+	if loc == nil {
+		return nil, fmt.Errorf("invalid params: missing location")
+	}
+
+	// Reject ranges with too many buckets before querying.
+	if _, err := Buckets(p.Range, i, loc, nil); err != nil {
+		return nil, err
+	}
+
+	var (
+		counts map[time.Time]int
+		err    error
+	)
+	if canUseRollups(p.Filter) && useRollups(ctx, p.DB, p.Environment) {
+		counts, err = exportRollupCounts(ctx, p)
+	} else {
+		match := bson.M{}
+		p.shortIDs(match)
+		p.Filter.apply(match)
+		p.Range.apply(match)
+
+		coll := p.DB.Database(p.Environment).Collection(Collection)
+		aggregateContext, cancel := context.WithTimeout(ctx, exportTimeout)
+		defer cancel()
+
+		counts, err = aggregateTimeSeriesCounts(
+			aggregateContext, coll, match, i, loc,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return Buckets(p.Range, i, loc, counts)
+}
+
+// exportRollupCounts returns the counts of visits matching the params by
+// UTC hour, summing the hourly rollups of the short URLs in the
+// database. The range is extended to start on the hour.
+func exportRollupCounts(ctx context.Context, p ExportParams) (map[time.Time]int, error) {
+	coll := p.DB.Database(p.Environment).Collection(RollupsCollection)
+
+	match := bson.M{
+		"period": PeriodHour,
+		"start": bson.M{
+			"$gte": PeriodHour.start(p.Range.From),
+			"$lt":  p.Range.To,
+		},
+	}
+	p.shortIDs(match)
+
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$group": bson.M{
+			"_id":   "$start",
+			"count": bson.M{"$sum": rollupCountExpression(p.Filter)},
+		}},
+	}
+
+	aggregateContext, cancel := context.WithTimeout(ctx, exportTimeout)
+	defer cancel()
+
+	cursor, err := coll.Aggregate(aggregateContext, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate rollups: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	counts := map[time.Time]int{}
+	for cursor.Next(aggregateContext) {
+		var res struct {
+			Start time.Time `bson:"_id"`
+			Count int       `bson:"count"`
+		}
+		if err := cursor.Decode(&res); err != nil {
+			return nil, fmt.Errorf("failed to decode rollups: %v", err)
+		}
+		counts[res.Start] += res.Count
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rollups: %v", err)
+	}
+
+	return counts, nil
+}
+
+// rollupCountExpression returns an aggregation expression for the count
+// of visits matching the filter in a rollup, as rollup.count computes
+// it. The filter must restrict at most one dimension.
+func rollupCountExpression(f Filter) bson.M {
+	count, bots := "$count", "$bots"
+	for field, value := range f.fields() {
+		key := dimensionKey(value)
+		count = "$d." + field + "." + key
+		bots = "$b." + field + "." + key
+	}
+
+	fields := bson.A{bson.M{"$ifNull": bson.A{count, 0}}}
+	if f.IncludeBots {
+		fields = append(fields, bson.M{"$ifNull": bson.A{bots, 0}})
+	}
+
+	return bson.M{"$add": fields}
+}
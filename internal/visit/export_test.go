@@ -0,0 +1,49 @@
+package visit
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// TestRollupCountExpression checks that the expression reads the same
+// fields as rollup.count.
+func TestRollupCountExpression(t *testing.T) {
+	var tests = []struct {
+		Filter   Filter
+		Expected bson.M
+	}{
+		{
+			Filter: Filter{},
+			Expected: bson.M{"$add": bson.A{
+				bson.M{"$ifNull": bson.A{"$count", 0}},
+			}},
+		},
+		{
+			Filter: Filter{IncludeBots: true},
+			Expected: bson.M{"$add": bson.A{
+				bson.M{"$ifNull": bson.A{"$count", 0}},
+				bson.M{"$ifNull": bson.A{"$bots", 0}},
+			}},
+		},
+		{
+			Filter: Filter{Referrer: "news.example.com", IncludeBots: true},
+			Expected: bson.M{"$add": bson.A{
+				bson.M{"$ifNull": bson.A{"$d.referrer._news%2Eexample%2Ecom", 0}},
+				bson.M{"$ifNull": bson.A{"$b.referrer._news%2Eexample%2Ecom", 0}},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		got := rollupCountExpression(test.Filter)
+		if !reflect.DeepEqual(got, test.Expected) {
+			t.Errorf("%+v: expected %v but got %v", test.Filter, test.Expected, got)
+		}
+	}
+}
+
+func TestExportVisits(t *testing.T) {
+	t.Skip("TODO")
+}
@@ -0,0 +1,80 @@
+package visit
+
+import (
+	"net/url"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Filter restricts the visits counted in stats to those matching every
+// non-empty field. Visits by bots are excluded, unless IncludeBots is
+// set.
+type Filter struct {
+	Browser  string
+	Country  string
+	Device   string
+	Language string
+	OS       string
+	Referrer string
+	Target   string
+	Variant  string
+
+	IncludeBots bool
+}
+
+// FilterFromQuery returns the Filter described by the query parameters
+// "browser", "country", "device", "language", "os", "referrer",
+// "target", and "variant". Bots are included if "includeBots" is
+// "true".
+func FilterFromQuery(q url.Values) Filter {
+	return Filter{
+		Browser:  q.Get("browser"),
+		Country:  q.Get("country"),
+		Device:   q.Get("device"),
+		Language: q.Get("language"),
+		OS:       q.Get("os"),
+		Referrer: q.Get("referrer"),
+		Target:   q.Get("target"),
+		Variant:  q.Get("variant"),
+
+		IncludeBots: q.Get("includeBots") == "true",
+	}
+}
+
+// fields returns the Visit document fields the filter restricts, and
+// their values.
+func (f Filter) fields() map[string]string {
+	fields := map[string]string{}
+	for field, value := range map[string]string{
+		"browser":  f.Browser,
+		"country":  f.Country,
+		"device":   f.Device,
+		"language": f.Language,
+		"os":       f.OS,
+		"referrer": f.Referrer,
+		"target":   f.Target,
+		"variant":  f.Variant,
+	} {
+		if value != "" {
+			fields[field] = value
+		}
+	}
+
+	return fields
+}
+
+// HasDimensions reports whether the filter restricts any dimension of
+// visits. Bots are not a dimension.
+func (f Filter) HasDimensions() bool {
+	return len(f.fields()) > 0
+}
+
+// apply adds the filter's conditions to a $match stage.
+func (f Filter) apply(match bson.M) {
+	for field, value := range f.fields() {
+		match[field] = value
+	}
+	if !f.IncludeBots {
+		match["bot"] = bson.M{"$ne": true}
+	}
+}
@@ -0,0 +1,66 @@
+package visit
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// TestFilter checks that only the query parameters present are added
+// to a $match stage, and that bots are excluded unless requested.
+func TestFilter(t *testing.T) {
+	q := url.Values{
+		"browser":  {"firefox"},
+		"country":  {"DE"},
+		"referrer": {"example.com"},
+		"ignored":  {"value"},
+	}
+
+	match := bson.M{"shortId": "id"}
+	FilterFromQuery(q).apply(match)
+
+	expected := bson.M{
+		"shortId":  "id",
+		"browser":  "firefox",
+		"country":  "DE",
+		"referrer": "example.com",
+		"bot":      bson.M{"$ne": true},
+	}
+	if !reflect.DeepEqual(match, expected) {
+		t.Errorf("expected %v but got %v", expected, match)
+	}
+
+	q.Set("includeBots", "true")
+	match = bson.M{"shortId": "id"}
+	FilterFromQuery(q).apply(match)
+
+	delete(expected, "bot")
+	if !reflect.DeepEqual(match, expected) {
+		t.Errorf("expected %v but got %v", expected, match)
+	}
+}
+
+// TestTruncateString checks that truncation does not split runes.
+func TestTruncateString(t *testing.T) {
+	var tests = []struct {
+		Input    string
+		N        int
+		Expected string
+	}{
+		{Input: "abc", N: 5, Expected: "abc"},
+		{Input: "abcdef", N: 3, Expected: "abc"},
+		{Input: "aé", N: 2, Expected: "a"},
+		{Input: "aé", N: 3, Expected: "aé"},
+	}
+
+	for _, test := range tests {
+		if got := truncate(test.Input, test.N); got != test.Expected {
+			t.Errorf(
+				"truncate(%q, %d): expected %q but got %q",
+				test.Input, test.N, test.Expected, got,
+			)
+		}
+	}
+}
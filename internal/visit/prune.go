@@ -0,0 +1,67 @@
+package visit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// deleteTimeout is the context timeout for pruning visits.
+const deleteTimeout = 30 * time.Second
+
+type PruneParams struct {
+	DB          *mongo.Client
+	Environment string
+
+	// Before is the time before which visits are deleted.
+	Before time.Time
+}
+
+func (p PruneParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if p.Before.IsZero() {
+		return fmt.Errorf("missing before")
+	}
+
+	return nil
+}
+
+// Prune deletes Visit documents older than p.Before, and returns the
+// number deleted. Rollups and unique visitor sketches are kept, so
+// stats are unaffected, except for filters on several dimensions. It
+// returns ErrRollupsNotReady, and deletes nothing, before the rollup
+// backfill has completed.
+func Prune(ctx context.Context, p PruneParams) (int64, error) {
+	if err := p.validate(); err != nil {
+		return 0, fmt.Errorf("invalid params: %v", err)
+	}
+
+	ok, err := RollupsReady(ctx, p.DB, p.Environment)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, ErrRollupsNotReady
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+	deleteContext, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
+	res, err := coll.DeleteMany(deleteContext, bson.M{
+		"time": bson.M{"$lt": p.Before},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete visits: %v", err)
+	}
+
+	return res.DeletedCount, nil
+}
@@ -0,0 +1,157 @@
+package visit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// timeIndexKey is the key of the index on visit times.
+var timeIndexKey = bson.D{{Key: "time", Value: 1}}
+
+// indexAction is the change needed to bring the visit time index to the
+// desired TTL.
+type indexAction int
+
+const (
+	indexKeep indexAction = iota
+	indexCreate
+	indexUpdate
+	indexReplace
+)
+
+// planTimeIndex returns the change needed for the time index, given
+// whether it exists, and its expireAfterSeconds, if it is a TTL index.
+// A TTL may be changed in place, but an index can only become, or stop
+// being, a TTL index by being replaced.
+func planTimeIndex(exists bool, expireAfter *int64, ttl int64) indexAction {
+	switch {
+	case !exists:
+		return indexCreate
+	case expireAfter == nil && ttl == 0:
+		return indexKeep
+	case expireAfter == nil || ttl == 0:
+		return indexReplace
+	case *expireAfter == ttl:
+		return indexKeep
+	default:
+		return indexUpdate
+	}
+}
+
+type EnsureTimeIndexParams struct {
+	DB          *mongo.Client
+	Environment string
+
+	// TTL is how long visits are kept before MongoDB deletes them.
+	// Zero keeps them indefinitely.
+	TTL time.Duration
+}
+
+func (p EnsureTimeIndexParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if p.TTL < 0 || p.TTL.Seconds() > math.MaxInt32 {
+		return fmt.Errorf("invalid ttl")
+	}
+
+	return nil
+}
+
+// EnsureTimeIndex ensures that Visit documents are indexed by time, and,
+// if a TTL is set, that the index is a TTL index, so that MongoDB
+// deletes visits once they are older than the TTL. An existing index is
+// changed to match the TTL. Rollups and unique visitor sketches are
+// kept, as with Prune. It returns ErrRollupsNotReady for a TTL set
+// before the rollup backfill has completed, and leaves the index as it
+// is.
+func EnsureTimeIndex(ctx context.Context, p EnsureTimeIndexParams) error {
+	if err := p.validate(); err != nil {
+		return fmt.Errorf("invalid params: %v", err)
+	}
+	if p.TTL > 0 {
+		ok, err := RollupsReady(ctx, p.DB, p.Environment)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrRollupsNotReady
+		}
+	}
+
+	db := p.DB.Database(p.Environment)
+	indexes := db.Collection(Collection).Indexes()
+	indexContext, cancel := context.WithTimeout(ctx, indexTimeout)
+	defer cancel()
+
+	// Find the existing index on time, if any.
+	cursor, err := indexes.List(indexContext)
+	if err != nil {
+		return fmt.Errorf("failed to list indexes: %v", err)
+	}
+	var specs []struct {
+		Name               string `bson:"name"`
+		Key                bson.D `bson:"key"`
+		ExpireAfterSeconds *int64 `bson:"expireAfterSeconds"`
+	}
+	if err := cursor.All(indexContext, &specs); err != nil {
+		return fmt.Errorf("failed to decode indexes: %v", err)
+	}
+
+	var (
+		exists      bool
+		name        string
+		expireAfter *int64
+	)
+	for _, spec := range specs {
+		if len(spec.Key) == 1 && spec.Key[0].Key == "time" {
+			exists, name, expireAfter = true, spec.Name, spec.ExpireAfterSeconds
+			break
+		}
+	}
+
+	ttl := int64(p.TTL / time.Second)
+	switch planTimeIndex(exists, expireAfter, ttl) {
+	case indexKeep:
+		return nil
+
+	case indexUpdate:
+		if err := db.RunCommand(indexContext, bson.D{
+			{Key: "collMod", Value: Collection},
+			{Key: "index", Value: bson.M{
+				"keyPattern":         timeIndexKey,
+				"expireAfterSeconds": ttl,
+			}},
+		}).Err(); err != nil {
+			return fmt.Errorf("failed to update ttl index: %v", err)
+		}
+		return nil
+
+	case indexReplace:
+		if _, err := indexes.DropOne(indexContext, name); err != nil {
+			return fmt.Errorf("failed to drop time index: %v", err)
+		}
+	}
+
+	opts := options.Index()
+	if ttl > 0 {
+		opts.SetExpireAfterSeconds(int32(ttl))
+	}
+	if _, err := indexes.CreateOne(indexContext, mongo.IndexModel{
+		Keys:    timeIndexKey,
+		Options: opts,
+	}); err != nil {
+		return fmt.Errorf("failed to create time index: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package visit
+
+import "testing"
+
+func TestPlanTimeIndex(t *testing.T) {
+	day := int64(24 * 60 * 60)
+	week := 7 * day
+
+	var tests = []struct {
+		Exists      bool
+		ExpireAfter *int64
+		TTL         int64
+		Expected    indexAction
+	}{
+		{Exists: false, TTL: 0, Expected: indexCreate},
+		{Exists: false, TTL: day, Expected: indexCreate},
+		{Exists: true, TTL: 0, Expected: indexKeep},
+		{Exists: true, ExpireAfter: &day, TTL: day, Expected: indexKeep},
+		{Exists: true, ExpireAfter: &day, TTL: week, Expected: indexUpdate},
+		{Exists: true, TTL: day, Expected: indexReplace},
+		{Exists: true, ExpireAfter: &day, TTL: 0, Expected: indexReplace},
+	}
+
+	for _, test := range tests {
+		got := planTimeIndex(test.Exists, test.ExpireAfter, test.TTL)
+		if got != test.Expected {
+			t.Errorf("%+v: expected %d but got %d", test, test.Expected, got)
+		}
+	}
+}
+
+func TestEnsureTimeIndex(t *testing.T) {
+	t.Skip("TODO")
+}
@@ -0,0 +1,306 @@
+package visit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RollupsCollection is the MongoDB collection for visit rollups.
+//
+// A rollup counts the visits to a short URL in a UTC hour or day, in
+// total, and by the value of each dimension, with visits by bots
+// counted separately. Rollups are incremented as visits are recorded,
+// so stats are computed from a document per hour or day, rather than a
+// document per visit. Unlike visits, rollups are kept indefinitely.
+//
+// Daily rollups with the environmentID count the visits to all short
+// URLs of a tenant, and the short URLs it created, without dimensions.
+// Rollups hold the tenant of their short URLs; see package tenant.
+const RollupsCollection = "rollups"
+
+// environmentID is the short URL ID of rollups for the tenants of the
+// environment.
+var environmentID = primitive.NilObjectID
+
+// Period is the span of time counted by a rollup.
+type Period string
+
+// Periods.
+const (
+	PeriodHour Period = "hour"
+	PeriodDay  Period = "day"
+)
+
+// start returns the start of the period containing t, in UTC.
+func (p Period) start(t time.Time) time.Time {
+	if p == PeriodHour {
+		return t.UTC().Truncate(time.Hour)
+	}
+
+	return utcDay(t)
+}
+
+// rollupDimensions are the Visit fields counted by value in rollups.
+var rollupDimensions = []string{
+	"browser", "country", "device", "language", "os", "referrer",
+	"target", "variant",
+}
+
+// rollup is a document counting visits to a short URL in a period.
+type rollup struct {
+	Tenant  string             `bson:"tenant,omitempty"`
+	ShortID primitive.ObjectID `bson:"shortId"`
+	Period  Period             `bson:"period"`
+	Start   time.Time          `bson:"start"`
+	Count   int                `bson:"count"`
+	Bots    int                `bson:"bots"`
+
+	// Created counts the short URLs created in the period. It is only
+	// set on rollups for a tenant.
+	Created int `bson:"created"`
+
+	// Dimensions maps each dimension to the counts of its values.
+	// Values are encoded with dimensionKey. BotDimensions holds the
+	// same for visits by bots.
+	Dimensions    map[string]map[string]int `bson:"d"`
+	BotDimensions map[string]map[string]int `bson:"b"`
+}
+
+// keyReplacer escapes characters which may not appear in MongoDB field
+// names, or which separate them.
+var keyReplacer = strings.NewReplacer("%", "%25", ".", "%2E", "$", "%24")
+
+var keyUnreplacer = strings.NewReplacer("%2E", ".", "%24", "$", "%25", "%")
+
+// dimensionKey encodes a dimension value as a field name. Keys are
+// prefixed, so that empty values are valid field names.
+func dimensionKey(value string) string {
+	return "_" + keyReplacer.Replace(value)
+}
+
+// dimensionValue decodes a field name encoded with dimensionKey.
+func dimensionValue(key string) string {
+	return keyUnreplacer.Replace(strings.TrimPrefix(key, "_"))
+}
+
+// values returns the counts of the values of a dimension.
+func (r rollup) values(dimension string, includeBots bool) map[string]int {
+	values := map[string]int{}
+	for key, n := range r.Dimensions[dimension] {
+		values[dimensionValue(key)] += n
+	}
+	if includeBots {
+		for key, n := range r.BotDimensions[dimension] {
+			values[dimensionValue(key)] += n
+		}
+	}
+
+	return values
+}
+
+// count returns the count of visits matching the filter, which must
+// restrict at most one dimension.
+func (r rollup) count(f Filter) int {
+	n := r.Count
+	if f.IncludeBots {
+		n += r.Bots
+	}
+
+	for field, value := range f.fields() {
+		key := dimensionKey(value)
+		n = r.Dimensions[field][key]
+		if f.IncludeBots {
+			n += r.BotDimensions[field][key]
+		}
+	}
+
+	return n
+}
+
+// canUseRollups reports whether visits matching the filter can be
+// counted from rollups. Rollups count the values of each dimension
+// independently, so they can restrict at most one.
+func canUseRollups(f Filter) bool {
+	return len(f.fields()) <= 1
+}
+
+// rollupUpdate returns the update incrementing a rollup for the visit.
+func rollupUpdate(v Visit) bson.M {
+	values := map[string]string{
+		"browser":  v.Browser,
+		"country":  v.Country,
+		"device":   v.Device,
+		"language": v.Language,
+		"os":       v.OS,
+		"referrer": v.Referrer,
+		"target":   v.Target,
+		"variant":  v.Variant,
+	}
+
+	count, prefix := "count", "d."
+	if v.Bot {
+		count, prefix = "bots", "b."
+	}
+
+	inc := bson.M{count: 1}
+	for _, dimension := range rollupDimensions {
+		inc[prefix+dimension+"."+dimensionKey(values[dimension])] = 1
+	}
+
+	return bson.M{"$inc": inc}
+}
+
+// environmentUpdate returns the update incrementing the daily rollup
+// for the tenant of the visit.
+func environmentUpdate(v Visit) bson.M {
+	if v.Bot {
+		return bson.M{"$inc": bson.M{"bots": 1}}
+	}
+
+	return bson.M{"$inc": bson.M{"count": 1}}
+}
+
+// addRollups increments the hourly and daily rollups for a visit, and
+// the daily rollup for its tenant.
+func addRollups(ctx context.Context, db *mongo.Client, env string, v Visit) error {
+	coll := db.Database(env).Collection(RollupsCollection)
+	updateContext, cancel := context.WithTimeout(ctx, insertTimeout)
+	defer cancel()
+
+	update := rollupUpdate(v)
+	var models []mongo.WriteModel
+	for _, period := range []Period{PeriodHour, PeriodDay} {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{
+				"tenant":  tenant.Match(v.Tenant),
+				"shortId": v.ShortID,
+				"period":  period,
+				"start":   period.start(v.Time),
+			}).
+			SetUpdate(update).
+			SetUpsert(true),
+		)
+	}
+	models = append(models, mongo.NewUpdateOneModel().
+		SetFilter(bson.M{
+			"tenant":  tenant.Match(v.Tenant),
+			"shortId": environmentID,
+			"period":  PeriodDay,
+			"start":   PeriodDay.start(v.Time),
+		}).
+		SetUpdate(environmentUpdate(v)).
+		SetUpsert(true),
+	)
+
+	if _, err := coll.BulkWrite(
+		updateContext, models, options.BulkWrite().SetOrdered(false),
+	); err != nil {
+		return fmt.Errorf("failed to update rollups: %v", err)
+	}
+
+	return nil
+}
+
+// EnsureRollupIndexes creates the index rollups are incremented and
+// found with, if it does not exist. It is unique, so that concurrent
+// first visits in a period cannot create more than one rollup for it.
+func EnsureRollupIndexes(ctx context.Context, db *mongo.Client, env string) error {
+	indexContext, cancel := context.WithTimeout(ctx, indexTimeout)
+	defer cancel()
+
+	if _, err := db.Database(env).Collection(RollupsCollection).Indexes().CreateOne(
+		indexContext, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "tenant", Value: 1},
+				{Key: "shortId", Value: 1},
+				{Key: "period", Value: 1},
+				{Key: "start", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+	); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	return nil
+}
+
+type findRollupsParams struct {
+	DB          *mongo.Client
+	Environment string
+	Tenant      string
+	ShortID     primitive.ObjectID
+	Period      Period
+
+	// From and To bound the starts of the rollups found; From
+	// inclusive and To exclusive. Either may be zero for no bound.
+	From time.Time
+	To   time.Time
+
+	// Dimensions are the dimensions to retrieve counts for.
+	// Other dimensions are left out, to keep documents small.
+	Dimensions []string
+}
+
+// findRollups returns the rollups for a short URL in a period.
+func findRollups(ctx context.Context, p findRollupsParams) ([]rollup, error) {
+	coll := p.DB.Database(p.Environment).Collection(RollupsCollection)
+
+	filter := bson.M{
+		"tenant":  tenant.Match(p.Tenant),
+		"shortId": p.ShortID,
+		"period":  p.Period,
+	}
+	start := bson.M{}
+	if !p.From.IsZero() {
+		start["$gte"] = p.From
+	}
+	if !p.To.IsZero() {
+		start["$lt"] = p.To
+	}
+	if len(start) > 0 {
+		filter["start"] = start
+	}
+
+	projection := bson.M{"start": 1, "count": 1, "bots": 1, "created": 1}
+	for _, dimension := range p.Dimensions {
+		projection["d."+dimension] = 1
+		projection["b."+dimension] = 1
+	}
+
+	findContext, cancel := context.WithTimeout(ctx, aggregateTimeout)
+	defer cancel()
+
+	cursor, err := coll.Find(
+		findContext, filter, options.Find().SetProjection(projection),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find rollups: %v", err)
+	}
+
+	var rollups []rollup
+	if err := cursor.All(findContext, &rollups); err != nil {
+		return nil, fmt.Errorf("failed to decode rollups: %v", err)
+	}
+
+	return rollups, nil
+}
+
+// filterDimensions returns the dimensions restricted by a filter, to
+// retrieve with findRollups.
+func filterDimensions(f Filter) []string {
+	var dimensions []string
+	for field := range f.fields() {
+		dimensions = append(dimensions, field)
+	}
+
+	return dimensions
+}
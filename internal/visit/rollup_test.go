@@ -0,0 +1,153 @@
+package visit
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// TestDimensionKey checks that dimension values round trip through
+// valid field names.
+func TestDimensionKey(t *testing.T) {
+	for _, value := range []string{
+		"", "chrome", "news.example.com", "$where", "100%", "%2E",
+	} {
+		key := dimensionKey(value)
+		for _, c := range key {
+			if c == '.' || c == '$' {
+				t.Errorf("%q: invalid key %q", value, key)
+			}
+		}
+		if key == "" {
+			t.Errorf("%q: empty key", value)
+		}
+		if got := dimensionValue(key); got != value {
+			t.Errorf("%q: decoded as %q", value, got)
+		}
+	}
+}
+
+// TestRollupUpdate checks that every dimension is incremented, with
+// empty values counted under their own key.
+func TestRollupUpdate(t *testing.T) {
+	update := rollupUpdate(Visit{
+		Browser:  "firefox",
+		Referrer: "news.example.com",
+	})
+	inc, ok := update["$inc"].(bson.M)
+	if !ok {
+		t.Fatalf("expected $inc but got %v", update)
+	}
+
+	expected := bson.M{
+		"count":                            1,
+		"d.browser._firefox":               1,
+		"d.country._":                      1,
+		"d.device._":                       1,
+		"d.language._":                     1,
+		"d.os._":                           1,
+		"d.referrer._news%2Eexample%2Ecom": 1,
+		"d.target._":                       1,
+		"d.variant._":                      1,
+	}
+	if !reflect.DeepEqual(inc, expected) {
+		t.Errorf("expected %v but got %v", expected, inc)
+	}
+
+	// Bots are counted separately.
+	update = rollupUpdate(Visit{Bot: true, Browser: "other"})
+	inc = update["$inc"].(bson.M)
+	if inc["bots"] != 1 || inc["b.browser._other"] != 1 || inc["count"] != nil {
+		t.Errorf("unexpected bot update %v", inc)
+	}
+}
+
+// TestRollupCount checks counting with filters.
+func TestRollupCount(t *testing.T) {
+	r := rollup{
+		Count: 10,
+		Bots:  4,
+		Dimensions: map[string]map[string]int{
+			"browser": {"_firefox": 3, "_chrome": 7},
+		},
+		BotDimensions: map[string]map[string]int{
+			"browser": {"_other": 3, "_chrome": 1},
+		},
+	}
+
+	var tests = []struct {
+		Filter   Filter
+		Expected int
+	}{
+		{Filter: Filter{}, Expected: 10},
+		{Filter: Filter{Browser: "firefox"}, Expected: 3},
+		{Filter: Filter{Browser: "safari"}, Expected: 0},
+		{Filter: Filter{Country: "DE"}, Expected: 0},
+		{Filter: Filter{IncludeBots: true}, Expected: 14},
+		{Filter: Filter{Browser: "chrome", IncludeBots: true}, Expected: 8},
+	}
+	for _, test := range tests {
+		if got := r.count(test.Filter); got != test.Expected {
+			t.Errorf("%+v: expected %d but got %d", test.Filter, test.Expected, got)
+		}
+	}
+
+	if !canUseRollups(Filter{Browser: "firefox"}) {
+		t.Error("expected rollups for a single dimension")
+	}
+	if canUseRollups(Filter{Browser: "firefox", Country: "DE"}) {
+		t.Error("expected no rollups for several dimensions")
+	}
+}
+
+// TestTally checks that rollups are counted in the periods they start
+// in.
+func TestTally(t *testing.T) {
+	now := time.Date(2020, 3, 29, 12, 0, 0, 0, time.UTC)
+	w := statsWindows{
+		day:  now.Add(-23 * time.Hour),
+		week: now.Add(-167 * time.Hour),
+		year: now.AddDate(0, 0, -364),
+	}
+
+	hourly := []rollup{
+		{Start: now, Count: 1},
+		{Start: now.Add(-24 * time.Hour), Count: 2},
+	}
+	daily := []rollup{
+		{Start: now.AddDate(0, 0, -1), Count: 3},
+		{Start: now.AddDate(-2, 0, 0), Count: 4},
+	}
+
+	got := w.tally(hourly, daily, func(r rollup) int { return r.Count })
+	expected := Stats{Day: 1, Week: 3, Year: 3, All: 7}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v but got %+v", expected, got)
+	}
+}
+
+// TestRank checks ranking, ties, and the other bucket.
+func TestRank(t *testing.T) {
+	got := rank("browser", map[string]int{
+		"chrome": 5, "firefox": 3, "safari": 3, "": 1,
+	}, 12, 2)
+
+	expected := Breakdown{
+		By: "browser",
+		Items: []BreakdownItem{
+			{Value: "chrome", Count: 5},
+			{Value: "firefox", Count: 3},
+		},
+		Other: 4,
+		Total: 12,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v but got %+v", expected, got)
+	}
+
+	if got := rank("os", nil, 0, 10); got.Items == nil || len(got.Items) != 0 {
+		t.Errorf("expected empty items but got %v", got.Items)
+	}
+}
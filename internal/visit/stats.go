@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/dwrz/url-shortener/internal/tenant"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -13,7 +14,11 @@ import (
 type GetStatsParams struct {
 	DB          *mongo.Client
 	Environment string
+	Tenant      string
 	ShortID     primitive.ObjectID
+
+	// Filter restricts the visits counted. Optional.
+	Filter Filter
 }
 
 func (p GetStatsParams) validate() error {
@@ -30,13 +35,140 @@ func (p GetStatsParams) validate() error {
 	return nil
 }
 
-// GetStats assembles Stats for a short URL by aggregating Visit
-// documents.
+// GetStats assembles Stats for a short URL from its rollups.
+// The day and week are counted by the hour, and the year by the UTC
+// day. Filters on more than one dimension, and visits before rollups
+// have been backfilled, are counted from Visit documents instead, which
+// only cover the retention window.
 func GetStats(ctx context.Context, p GetStatsParams) (stats Stats, err error) {
 	if err := p.validate(); err != nil {
 		return stats, fmt.Errorf("invalid params: %v", err)
 	}
 
+	if canUseRollups(p.Filter) && useRollups(ctx, p.DB, p.Environment) {
+		stats, err = rollupStats(ctx, p)
+	} else {
+		stats, err = rawStats(ctx, p)
+	}
+	if err != nil {
+		return stats, err
+	}
+
+	// Unique visitors are only counted for all visits, since sketches
+	// do not record visit dimensions. Bots are never counted.
+	if !p.Filter.HasDimensions() {
+		uniques, err := GetUniques(ctx, GetUniquesParams{
+			DB:          p.DB,
+			Environment: p.Environment,
+			Tenant:      p.Tenant,
+			ShortID:     p.ShortID,
+		})
+		if err != nil {
+			return stats, fmt.Errorf("failed to get uniques: %v", err)
+		}
+		stats.Uniques = &uniques
+	}
+
+	return stats, nil
+}
+
+// rollupStats assembles Stats for a short URL from its rollups.
+func rollupStats(ctx context.Context, p GetStatsParams) (stats Stats, err error) {
+	now := time.Now()
+	hour := PeriodHour.start(now)
+	w := statsWindows{
+		day:  hour.Add(-23 * time.Hour),
+		week: hour.Add(-7*24*time.Hour + time.Hour),
+		year: PeriodDay.start(now).AddDate(0, 0, -364),
+	}
+
+	dimensions := append(filterDimensions(p.Filter), "variant")
+	hourly, err := findRollups(ctx, findRollupsParams{
+		DB:          p.DB,
+		Environment: p.Environment,
+		Tenant:      p.Tenant,
+		ShortID:     p.ShortID,
+		Period:      PeriodHour,
+		From:        w.week,
+		Dimensions:  dimensions,
+	})
+	if err != nil {
+		return stats, err
+	}
+	daily, err := findRollups(ctx, findRollupsParams{
+		DB:          p.DB,
+		Environment: p.Environment,
+		Tenant:      p.Tenant,
+		ShortID:     p.ShortID,
+		Period:      PeriodDay,
+		Dimensions:  dimensions,
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	stats = w.tally(hourly, daily, func(r rollup) int {
+		return r.count(p.Filter)
+	})
+
+	// Variants are counted independently of other dimensions, so they
+	// can only be broken down for all visits.
+	if p.Filter.HasDimensions() {
+		return stats, nil
+	}
+	for _, r := range daily {
+		for variant := range r.values("variant", p.Filter.IncludeBots) {
+			if variant == "" {
+				continue
+			}
+			if stats.Variants == nil {
+				stats.Variants = map[string]Stats{}
+			}
+			if _, ok := stats.Variants[variant]; ok {
+				continue
+			}
+			f := Filter{Variant: variant, IncludeBots: p.Filter.IncludeBots}
+			stats.Variants[variant] = w.tally(hourly, daily, func(r rollup) int {
+				return r.count(f)
+			})
+		}
+	}
+
+	return stats, nil
+}
+
+// statsWindows are the starts of the periods counted in Stats.
+type statsWindows struct {
+	day, week, year time.Time
+}
+
+// tally counts Stats from hourly rollups for the day and week, and
+// daily rollups for the year and all time, with the count of each
+// rollup.
+func (w statsWindows) tally(hourly, daily []rollup, count func(rollup) int) (stats Stats) {
+	for _, r := range hourly {
+		n := count(r)
+		if !r.Start.Before(w.week) {
+			stats.Week += n
+		}
+		if !r.Start.Before(w.day) {
+			stats.Day += n
+		}
+	}
+	for _, r := range daily {
+		n := count(r)
+		stats.All += n
+		if !r.Start.Before(w.year) {
+			stats.Year += n
+		}
+	}
+
+	return stats
+}
+
+// rawStats assembles Stats for a short URL by aggregating Visit
+// documents.
+func rawStats(ctx context.Context, p GetStatsParams) (stats Stats, err error) {
 	coll := p.DB.Database(p.Environment).Collection(Collection)
 
 	// Create the aggregation.
@@ -65,19 +197,20 @@ func GetStats(ctx context.Context, p GetStatsParams) (stats Stats, err error) {
 		0,
 	}}
 
-	// Match documents created within the last year for this URL.
-	// Then, group them by timestamp, incrementing by the value
+	// Match documents for this URL, and any filtered dimensions.
+	// Then, group them by variant, incrementing by the value
 	// specified in the above conditions.
+	match := bson.M{"tenant": tenant.Match(p.Tenant), "shortId": p.ShortID}
+	p.Filter.apply(match)
+
 	pipeline := []bson.M{
-		{"$match": bson.M{
-			"shortId": p.ShortID,
-			"time":    bson.M{"$gt": oneYearAgo},
-		}},
+		{"$match": match},
 		{"$group": bson.M{
-			"_id":  "stats",
+			"_id":  "$variant",
 			"day":  bson.M{"$sum": matchDay},
 			"week": bson.M{"$sum": matchWeek},
 			"year": bson.M{"$sum": matchYear},
+			"all":  bson.M{"$sum": 1},
 		}},
 	}
 
@@ -90,19 +223,212 @@ func GetStats(ctx context.Context, p GetStatsParams) (stats Stats, err error) {
 		return stats, fmt.Errorf("failed to aggregate stats: %v", err)
 	}
 
-	var res []Stats
+	var res []struct {
+		Variant string `bson:"_id"`
+		Stats   `bson:",inline"`
+	}
 	if err = cursor.All(ctx, &res); err != nil {
 		return stats, fmt.Errorf("failed to decode stats: %v", err)
 	}
 
 	// If no document was returned, there were no visits.
 	// Return the default Stats value, with zero visits as default.
-	if len(res) == 0 {
-		return stats, nil
+	// Otherwise, sum the counts for each variant. Visits without a
+	// variant are grouped under an empty string, and only counted in
+	// the total.
+	for _, r := range res {
+		stats.add(r.Stats)
+
+		if r.Variant == "" {
+			continue
+		}
+		if stats.Variants == nil {
+			stats.Variants = map[string]Stats{}
+		}
+		stats.Variants[r.Variant] = r.Stats
+	}
+
+	return stats, nil
+}
+
+// Range is a span of time, from From inclusive to To exclusive.
+type Range struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+func (r Range) validate() error {
+	if r.From.IsZero() || r.To.IsZero() {
+		return fmt.Errorf("missing range bound")
+	}
+	if !r.To.After(r.From) {
+		return fmt.Errorf("range ends before it starts")
+	}
+
+	return nil
+}
+
+// hours returns the range extended to whole UTC hours: from the start of
+// the hour of From to the end of the hour of To, unless To is on the
+// hour.
+func (r Range) hours() Range {
+	to := PeriodHour.start(r.To)
+	if to.Before(r.To) {
+		to = to.Add(time.Hour)
+	}
+
+	return Range{From: PeriodHour.start(r.From), To: to}
+}
+
+// apply adds the range's conditions to a $match stage.
+func (r Range) apply(match bson.M) {
+	match["time"] = bson.M{"$gte": r.From, "$lt": r.To}
+}
+
+// RangeStats represent a count of visits to a short URL within a Range.
+type RangeStats struct {
+	Range
+	Count int `json:"count"`
+
+	// Variants breaks down the count by the variant visitors were
+	// redirected to. It is omitted for short URLs without variants.
+	Variants map[string]int `json:"variants,omitempty"`
+
+	// Conversions counts the conversions in the range by event. It is
+	// omitted for short URLs without conversions.
+	Conversions map[string]Conversions `json:"conversions,omitempty"`
+}
+
+// SetConversions sets the Conversions of the stats from the counts of
+// conversions in the range, by event and variant.
+func (s *RangeStats) SetConversions(counts map[string]map[string]int) {
+	s.Conversions = conversionRates(totalEvents(counts), s.Count)
+}
+
+type GetRangeStatsParams struct {
+	DB          *mongo.Client
+	Environment string
+	Tenant      string
+	ShortID     primitive.ObjectID
+	Range       Range
+
+	// Filter restricts the visits counted. Optional.
+	Filter Filter
+}
+
+func (p GetRangeStatsParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if len(p.ShortID) == 0 {
+		return fmt.Errorf("missing document id")
+	}
+	if err := p.Range.validate(); err != nil {
+		return fmt.Errorf("invalid range: %v", err)
+	}
+
+	return nil
+}
+
+// GetRangeStats counts the visits to a short URL within a Range, from
+// its hourly rollups. The range is extended to whole hours, and the
+// stats hold the range counted.
+// Filters on more than one dimension, and visits before rollups have
+// been backfilled, are counted from Visit documents instead, which only
+// cover the retention window.
+func GetRangeStats(ctx context.Context, p GetRangeStatsParams) (stats RangeStats, err error) {
+	if err := p.validate(); err != nil {
+		return stats, fmt.Errorf("invalid params: %v", err)
+	}
+
+	if !canUseRollups(p.Filter) || !useRollups(ctx, p.DB, p.Environment) {
+		return rawRangeStats(ctx, p)
+	}
+
+	stats.Range = p.Range.hours()
+	hourly, err := findRollups(ctx, findRollupsParams{
+		DB:          p.DB,
+		Environment: p.Environment,
+		Tenant:      p.Tenant,
+		ShortID:     p.ShortID,
+		Period:      PeriodHour,
+		From:        stats.Range.From,
+		To:          stats.Range.To,
+		Dimensions:  append(filterDimensions(p.Filter), "variant"),
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	for _, r := range hourly {
+		stats.Count += r.count(p.Filter)
+
+		// Variants can only be broken down for all visits.
+		if p.Filter.HasDimensions() {
+			continue
+		}
+		for variant, n := range r.values("variant", p.Filter.IncludeBots) {
+			if variant == "" {
+				continue
+			}
+			if stats.Variants == nil {
+				stats.Variants = map[string]int{}
+			}
+			stats.Variants[variant] += n
+		}
+	}
+
+	return stats, nil
+}
+
+// rawRangeStats counts the visits to a short URL within a Range by
+// aggregating Visit documents.
+func rawRangeStats(ctx context.Context, p GetRangeStatsParams) (stats RangeStats, err error) {
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+
+	match := bson.M{"tenant": tenant.Match(p.Tenant), "shortId": p.ShortID}
+	p.Filter.apply(match)
+	p.Range.apply(match)
+
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$group": bson.M{
+			"_id":   "$variant",
+			"count": bson.M{"$sum": 1},
+		}},
+	}
+
+	aggregateContext, cancel := context.WithTimeout(ctx, aggregateTimeout)
+	defer cancel()
+
+	cursor, err := coll.Aggregate(aggregateContext, pipeline)
+	if err != nil {
+		return stats, fmt.Errorf("failed to aggregate stats: %v", err)
+	}
+
+	var res []struct {
+		Variant string `bson:"_id"`
+		Count   int    `bson:"count"`
+	}
+	if err = cursor.All(ctx, &res); err != nil {
+		return stats, fmt.Errorf("failed to decode stats: %v", err)
+	}
+
+	stats.Range = p.Range
+	for _, r := range res {
+		stats.Count += r.Count
+
+		if r.Variant == "" {
+			continue
+		}
+		if stats.Variants == nil {
+			stats.Variants = map[string]int{}
+		}
+		stats.Variants[r.Variant] = r.Count
 	}
 
-	// Otherwise, return the assembled statistics.
-	// The aggregation should only return a single stats document,
-	// since the final stage is $group.
-	return res[0], nil
+	return stats, nil
 }
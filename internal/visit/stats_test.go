@@ -1,6 +1,10 @@
 package visit
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+	"time"
+)
 
 func TestGetStatsParamsValidate(t *testing.T) {
 	t.Skip("TODO")
@@ -9,3 +13,130 @@ func TestGetStatsParamsValidate(t *testing.T) {
 func TestGetStats(t *testing.T) {
 	t.Skip("TODO")
 }
+
+// TestRangeValidate checks that ranges must be bounded and ordered.
+func TestRangeValidate(t *testing.T) {
+	from := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+
+	var tests = []struct {
+		Range Range
+		Valid bool
+	}{
+		{Range: Range{From: from, To: to}, Valid: true},
+		{Range: Range{From: from}, Valid: false},
+		{Range: Range{To: to}, Valid: false},
+		{Range: Range{From: to, To: from}, Valid: false},
+		{Range: Range{From: from, To: from}, Valid: false},
+	}
+
+	for _, test := range tests {
+		if err := test.Range.validate(); (err == nil) != test.Valid {
+			t.Errorf("%+v: expected valid %t but got %v", test.Range, test.Valid, err)
+		}
+	}
+}
+
+// TestRangeHours checks that ranges are extended to whole UTC hours.
+func TestRangeHours(t *testing.T) {
+	hour := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+	next := hour.Add(time.Hour)
+
+	var tests = []struct {
+		Range    Range
+		Expected Range
+	}{
+		{
+			Range:    Range{From: hour, To: next},
+			Expected: Range{From: hour, To: next},
+		},
+		{
+			Range:    Range{From: hour.Add(15 * time.Minute), To: next},
+			Expected: Range{From: hour, To: next},
+		},
+		{
+			Range:    Range{From: hour, To: hour.Add(30 * time.Minute)},
+			Expected: Range{From: hour, To: next},
+		},
+		{
+			Range: Range{
+				From: hour.In(time.FixedZone("UTC-5", -5*60*60)),
+				To:   next.Add(time.Second),
+			},
+			Expected: Range{From: hour, To: next.Add(time.Hour)},
+		},
+	}
+
+	for _, test := range tests {
+		got := test.Range.hours()
+		if !got.From.Equal(test.Expected.From) || !got.To.Equal(test.Expected.To) {
+			t.Errorf("%+v: expected %+v but got %+v", test.Range, test.Expected, got)
+		}
+	}
+}
+
+func TestGetRangeStats(t *testing.T) {
+	t.Skip("TODO")
+}
+
+// TestSetConversions checks that conversion rates are computed against
+// all visits, overall and by variant.
+func TestSetConversions(t *testing.T) {
+	counts := map[string]map[string]int{
+		"signup":   {"a": 2, "b": 1},
+		"purchase": {"b": 1},
+	}
+
+	s := Stats{
+		All: 10,
+		Variants: map[string]Stats{
+			"a": {All: 8},
+			"b": {All: 2},
+			"c": {All: 0},
+		},
+	}
+	s.SetConversions(counts)
+
+	var tests = []struct {
+		Name     string
+		Got      map[string]Conversions
+		Expected map[string]Conversions
+	}{
+		{
+			Name: "all",
+			Got:  s.Conversions,
+			Expected: map[string]Conversions{
+				"signup":   {Count: 3, Rate: 0.3},
+				"purchase": {Count: 1, Rate: 0.1},
+			},
+		},
+		{
+			Name: "a",
+			Got:  s.Variants["a"].Conversions,
+			Expected: map[string]Conversions{
+				"signup": {Count: 2, Rate: 0.25},
+			},
+		},
+		{
+			Name: "b",
+			Got:  s.Variants["b"].Conversions,
+			Expected: map[string]Conversions{
+				"signup":   {Count: 1, Rate: 0.5},
+				"purchase": {Count: 1, Rate: 0.5},
+			},
+		},
+		{Name: "c", Got: s.Variants["c"].Conversions, Expected: nil},
+	}
+
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.Got, test.Expected) {
+			t.Errorf("%s: expected %v but got %v", test.Name, test.Expected, test.Got)
+		}
+	}
+
+	rs := RangeStats{Count: 0}
+	rs.SetConversions(counts)
+	if c := rs.Conversions["signup"]; c.Count != 3 || c.Rate != 0 {
+		t.Errorf("expected 3 signups at rate 0 but got %v", c)
+	}
+}
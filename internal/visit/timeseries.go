@@ -0,0 +1,325 @@
+package visit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MaxBuckets is the maximum number of buckets in a time series.
+const MaxBuckets = 10000
+
+// Interval is the width of the buckets in a time series.
+type Interval string
+
+// Intervals.
+const (
+	Hour  Interval = "hour"
+	Day   Interval = "day"
+	Week  Interval = "week"
+	Month Interval = "month"
+)
+
+// ParseInterval returns the Interval named by s.
+func ParseInterval(s string) (Interval, error) {
+	switch i := Interval(s); i {
+	case Hour, Day, Week, Month:
+		return i, nil
+	default:
+		return "", fmt.Errorf("unknown interval %q", s)
+	}
+}
+
+// DefaultSpan returns the start of the default range of a time series
+// ending at to.
+func (i Interval) DefaultSpan(to time.Time) time.Time {
+	switch i {
+	case Hour:
+		return to.Add(-48 * time.Hour)
+	case Week:
+		return to.AddDate(0, 0, -7*26)
+	case Month:
+		return to.AddDate(-1, 0, 0)
+	default:
+		return to.AddDate(0, 0, -30)
+	}
+}
+
+// Truncate returns the start of the bucket containing t, in the
+// location loc. Buckets follow the wall clock in loc: days start at
+// midnight, weeks on Monday, and months on the first day, whatever the
+// offset from UTC. Days and months may therefore be longer or shorter
+// than usual across daylight saving time changes.
+func Truncate(t time.Time, i Interval, loc *time.Location) time.Time {
+	t = t.In(loc)
+
+	switch i {
+	case Hour:
+		// Subtract rather than calling time.Date, which would pick
+		// the wrong instant for an hour repeated when clocks fall
+		// back. Offsets which are not whole hours truncate to the
+		// local hour.
+		return t.Add(-time.Duration(t.Minute())*time.Minute -
+			time.Duration(t.Second())*time.Second -
+			time.Duration(t.Nanosecond()))
+	case Day:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	case Week:
+		// Weekdays count from Sunday; shift them to count from
+		// Monday.
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, loc)
+	case Month:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	default:
+		return t
+	}
+}
+
+// next returns the start of the bucket after the one starting at t.
+func next(t time.Time, i Interval, loc *time.Location) time.Time {
+	switch i {
+	case Hour:
+		// Hours are the only buckets which may repeat, when clocks
+		// fall back; both share one key, and so one bucket.
+		return Truncate(t.Add(time.Hour), i, loc)
+	case Day:
+		return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+	case Week:
+		return time.Date(t.Year(), t.Month(), t.Day()+7, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+	}
+}
+
+// bucketKey identifies a bucket by the wall clock time of its start.
+// A repeated hour has a single key.
+func bucketKey(t time.Time) string {
+	return t.Format("2006-01-02T15")
+}
+
+// Bucket is a count of visits starting at a time.
+type Bucket struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+// Buckets returns zero-filled buckets covering the range, with counts
+// from the map of bucket starts to counts. Bucket starts may be any
+// time within a bucket; counts in the same bucket are summed. The first
+// bucket starts at or before the start of the range.
+func Buckets(r Range, i Interval, loc *time.Location, counts map[time.Time]int) ([]Bucket, error) {
+	sums := map[string]int{}
+	for t, n := range counts {
+		sums[bucketKey(Truncate(t, i, loc))] += n
+	}
+
+	var buckets []Bucket
+	seen := map[string]bool{}
+	for t := Truncate(r.From, i, loc); t.Before(r.To); t = next(t, i, loc) {
+		key := bucketKey(t)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if len(buckets) == MaxBuckets {
+			return nil, fmt.Errorf("more than %d buckets", MaxBuckets)
+		}
+		buckets = append(buckets, Bucket{Start: t, Count: sums[key]})
+	}
+
+	return buckets, nil
+}
+
+// TimeSeries is a series of visit counts in buckets of equal intervals.
+type TimeSeries struct {
+	Range
+	Interval Interval `json:"interval"`
+	TimeZone string   `json:"timeZone"`
+	Buckets  []Bucket `json:"buckets"`
+}
+
+type GetTimeSeriesParams struct {
+	DB          *mongo.Client
+	Environment string
+	Tenant      string
+	ShortID     primitive.ObjectID
+	Range       Range
+	Interval    Interval
+	Location    *time.Location
+
+	// Filter restricts the visits counted. Optional.
+	Filter Filter
+}
+
+func (p GetTimeSeriesParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if len(p.ShortID) == 0 {
+		return fmt.Errorf("missing document id")
+	}
+	if err := p.Range.validate(); err != nil {
+		return fmt.Errorf("invalid range: %v", err)
+	}
+	if _, err := ParseInterval(string(p.Interval)); err != nil {
+		return err
+	}
+	if p.Location == nil {
+		return fmt.Errorf("missing location")
+	}
+
+	return nil
+}
+
+// GetTimeSeries counts the visits to a short URL within a Range, in
+// buckets of the requested Interval.
+//
+// Visits are counted from hourly rollups, which are summed into
+// buckets by Buckets; in time zones whose offset is not a whole number
+// of hours, visits are counted in the local hour in which their UTC
+// hour started. Filters on more than one dimension, and visits before
+// rollups have been backfilled, are counted from Visit documents
+// instead, which only cover the retention window.
+func GetTimeSeries(ctx context.Context, p GetTimeSeriesParams) (ts TimeSeries, err error) {
+	if err := p.validate(); err != nil {
+		return ts, fmt.Errorf("invalid params: %v", err)
+	}
+
+	var counts map[time.Time]int
+	if canUseRollups(p.Filter) && useRollups(ctx, p.DB, p.Environment) {
+		counts, err = rollupTimeSeriesCounts(ctx, p)
+	} else {
+		counts, err = rawTimeSeriesCounts(ctx, p)
+	}
+	if err != nil {
+		return ts, err
+	}
+
+	buckets, err := Buckets(p.Range, p.Interval, p.Location, counts)
+	if err != nil {
+		return ts, err
+	}
+
+	return TimeSeries{
+		Range:    p.Range,
+		Interval: p.Interval,
+		TimeZone: p.Location.String(),
+		Buckets:  buckets,
+	}, nil
+}
+
+// rollupTimeSeriesCounts returns the counts of visits by UTC hour, from
+// hourly rollups. The range is extended to start on the hour.
+func rollupTimeSeriesCounts(ctx context.Context, p GetTimeSeriesParams) (map[time.Time]int, error) {
+	hourly, err := findRollups(ctx, findRollupsParams{
+		DB:          p.DB,
+		Environment: p.Environment,
+		Tenant:      p.Tenant,
+		ShortID:     p.ShortID,
+		Period:      PeriodHour,
+		From:        PeriodHour.start(p.Range.From),
+		To:          p.Range.To,
+		Dimensions:  filterDimensions(p.Filter),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[time.Time]int{}
+	for _, r := range hourly {
+		counts[r.Start] += r.count(p.Filter)
+	}
+
+	return counts, nil
+}
+
+// rawTimeSeriesCounts returns the counts of visits by local hour, or
+// day, by aggregating Visit documents.
+func rawTimeSeriesCounts(ctx context.Context, p GetTimeSeriesParams) (map[time.Time]int, error) {
+	match := bson.M{"tenant": tenant.Match(p.Tenant), "shortId": p.ShortID}
+	p.Filter.apply(match)
+	p.Range.apply(match)
+
+	coll := p.DB.Database(p.Environment).Collection(Collection)
+	aggregateContext, cancel := context.WithTimeout(ctx, aggregateTimeout)
+	defer cancel()
+
+	return aggregateTimeSeriesCounts(
+		aggregateContext, coll, match, p.Interval, p.Location,
+	)
+}
+
+// aggregateTimeSeriesCounts returns the counts of the Visit documents
+// matching a $match stage, by local hour, or day. The caller sets the
+// timeout on ctx.
+func aggregateTimeSeriesCounts(
+	ctx context.Context,
+	coll *mongo.Collection,
+	match bson.M,
+	i Interval,
+	loc *time.Location,
+) (map[time.Time]int, error) {
+	// Group by the local date, and the hour for hourly intervals.
+	// Coarser intervals are summed by Buckets, which keeps the query
+	// independent of week and month boundaries.
+	parts := bson.M{"$dateToParts": bson.M{
+		"date":     "$time",
+		"timezone": loc.String(),
+	}}
+	id := bson.M{
+		"year":  "$parts.year",
+		"month": "$parts.month",
+		"day":   "$parts.day",
+	}
+	if i == Hour {
+		id["hour"] = "$parts.hour"
+	}
+
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$project": bson.M{"parts": parts}},
+		{"$group": bson.M{
+			"_id":   id,
+			"count": bson.M{"$sum": 1},
+		}},
+	}
+
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate time series: %v", err)
+	}
+
+	var res []struct {
+		ID struct {
+			Year  int `bson:"year"`
+			Month int `bson:"month"`
+			Day   int `bson:"day"`
+			Hour  int `bson:"hour"`
+		} `bson:"_id"`
+		Count int `bson:"count"`
+	}
+	if err = cursor.All(ctx, &res); err != nil {
+		return nil, fmt.Errorf("failed to decode time series: %v", err)
+	}
+
+	counts := map[time.Time]int{}
+	for _, r := range res {
+		t := time.Date(
+			r.ID.Year, time.Month(r.ID.Month), r.ID.Day, r.ID.Hour,
+			0, 0, 0, loc,
+		)
+		counts[t] += r.Count
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,203 @@
+package visit
+
+import (
+	"testing"
+	"time"
+)
+
+// loadLocation loads a time zone, skipping the test if the time zone
+// database is unavailable.
+func loadLocation(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s unavailable: %v", name, err)
+	}
+
+	return loc
+}
+
+// TestTruncate checks bucket starts, including across daylight saving
+// time changes.
+func TestTruncate(t *testing.T) {
+	ny := loadLocation(t, "America/New_York")
+	kolkata := loadLocation(t, "Asia/Kolkata")
+
+	var tests = []struct {
+		Name     string
+		Time     time.Time
+		Interval Interval
+		Location *time.Location
+		Expected time.Time
+	}{
+		{
+			Name:     "hour",
+			Time:     time.Date(2020, 3, 5, 14, 35, 10, 5, time.UTC),
+			Interval: Hour,
+			Location: time.UTC,
+			Expected: time.Date(2020, 3, 5, 14, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:     "hour with half hour offset",
+			Time:     time.Date(2020, 3, 5, 14, 15, 0, 0, time.UTC),
+			Interval: Hour,
+			Location: kolkata,
+			// 19:45 local.
+			Expected: time.Date(2020, 3, 5, 13, 30, 0, 0, time.UTC),
+		},
+		{
+			// 01:30 EST, the second 01:30 on fall back.
+			Name:     "repeated hour",
+			Time:     time.Date(2020, 11, 1, 6, 30, 0, 0, time.UTC),
+			Interval: Hour,
+			Location: ny,
+			Expected: time.Date(2020, 11, 1, 6, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:     "day in time zone",
+			Time:     time.Date(2020, 3, 5, 3, 0, 0, 0, time.UTC),
+			Interval: Day,
+			Location: ny,
+			// 22:00 EST on the 4th.
+			Expected: time.Date(2020, 3, 4, 0, 0, 0, 0, ny),
+		},
+		{
+			// The day clocks spring forward is 23 hours long.
+			Name:     "day after spring forward",
+			Time:     time.Date(2020, 3, 8, 23, 0, 0, 0, ny),
+			Interval: Day,
+			Location: ny,
+			Expected: time.Date(2020, 3, 8, 5, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:     "week",
+			Time:     time.Date(2020, 3, 8, 12, 0, 0, 0, time.UTC),
+			Interval: Week,
+			Location: time.UTC,
+			// Sunday the 8th is in the week of Monday the 2nd.
+			Expected: time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:     "week across months",
+			Time:     time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC),
+			Interval: Week,
+			Location: time.UTC,
+			Expected: time.Date(2020, 2, 24, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:     "month",
+			Time:     time.Date(2020, 4, 1, 2, 0, 0, 0, time.UTC),
+			Interval: Month,
+			Location: ny,
+			// 22:00 EDT on March 31st.
+			Expected: time.Date(2020, 3, 1, 0, 0, 0, 0, ny),
+		},
+	}
+
+	for _, test := range tests {
+		got := Truncate(test.Time, test.Interval, test.Location)
+		if !got.Equal(test.Expected) {
+			t.Errorf("%s: expected %v but got %v", test.Name, test.Expected, got)
+		}
+	}
+}
+
+// TestBuckets checks that buckets are zero-filled, and that counts are
+// summed into their buckets.
+func TestBuckets(t *testing.T) {
+	ny := loadLocation(t, "America/New_York")
+
+	t.Run("days", func(t *testing.T) {
+		r := Range{
+			From: time.Date(2020, 3, 7, 12, 0, 0, 0, ny),
+			To:   time.Date(2020, 3, 10, 0, 0, 0, 0, ny),
+		}
+		counts := map[time.Time]int{
+			time.Date(2020, 3, 7, 0, 0, 0, 0, ny):  1,
+			time.Date(2020, 3, 7, 23, 0, 0, 0, ny): 2,
+			time.Date(2020, 3, 9, 8, 0, 0, 0, ny):  3,
+		}
+
+		buckets, err := Buckets(r, Day, ny, counts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []Bucket{
+			{Start: time.Date(2020, 3, 7, 0, 0, 0, 0, ny), Count: 3},
+			{Start: time.Date(2020, 3, 8, 0, 0, 0, 0, ny), Count: 0},
+			{Start: time.Date(2020, 3, 9, 0, 0, 0, 0, ny), Count: 3},
+		}
+		checkBuckets(t, expected, buckets)
+	})
+
+	t.Run("fall back", func(t *testing.T) {
+		// The hour from 01:00 is repeated; both share one bucket.
+		r := Range{
+			From: time.Date(2020, 11, 1, 4, 0, 0, 0, time.UTC),
+			To:   time.Date(2020, 11, 1, 8, 0, 0, 0, time.UTC),
+		}
+		counts := map[time.Time]int{
+			time.Date(2020, 11, 1, 5, 15, 0, 0, time.UTC): 1,
+			time.Date(2020, 11, 1, 6, 15, 0, 0, time.UTC): 2,
+		}
+
+		buckets, err := Buckets(r, Hour, ny, counts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []Bucket{
+			{Start: time.Date(2020, 11, 1, 4, 0, 0, 0, time.UTC), Count: 0},
+			{Start: time.Date(2020, 11, 1, 5, 0, 0, 0, time.UTC), Count: 3},
+			{Start: time.Date(2020, 11, 1, 7, 0, 0, 0, time.UTC), Count: 0},
+		}
+		checkBuckets(t, expected, buckets)
+	})
+
+	t.Run("spring forward", func(t *testing.T) {
+		// The hour from 02:00 does not exist.
+		r := Range{
+			From: time.Date(2020, 3, 8, 0, 0, 0, 0, ny),
+			To:   time.Date(2020, 3, 8, 4, 0, 0, 0, ny),
+		}
+
+		buckets, err := Buckets(r, Hour, ny, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []Bucket{
+			{Start: time.Date(2020, 3, 8, 0, 0, 0, 0, ny)},
+			{Start: time.Date(2020, 3, 8, 1, 0, 0, 0, ny)},
+			{Start: time.Date(2020, 3, 8, 3, 0, 0, 0, ny)},
+		}
+		checkBuckets(t, expected, buckets)
+	})
+
+	t.Run("too many", func(t *testing.T) {
+		r := Range{
+			From: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+			To:   time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		}
+		if _, err := Buckets(r, Hour, time.UTC, nil); err == nil {
+			t.Error("expected error for too many buckets")
+		}
+	})
+}
+
+func checkBuckets(t *testing.T, expected, got []Bucket) {
+	t.Helper()
+
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d buckets but got %d: %v", len(expected), len(got), got)
+	}
+	for i := range expected {
+		if !got[i].Start.Equal(expected[i].Start) || got[i].Count != expected[i].Count {
+			t.Errorf("bucket %d: expected %+v but got %+v", i, expected[i], got[i])
+		}
+	}
+}
+
+func TestGetTimeSeries(t *testing.T) {
+	t.Skip("TODO")
+}
@@ -0,0 +1,195 @@
+package visit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dwrz/url-shortener/internal/tenant"
+	"github.com/dwrz/url-shortener/pkg/hyperloglog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UniquesCollection is the MongoDB collection for daily unique visitor
+// sketches.
+//
+// Each document holds a HyperLogLog sketch of the visitors to a short
+// URL on a UTC day, as a map of register index to rank, for registers
+// which are set. Registers are raised with $max, so concurrent visits
+// never lose an update. A unique index keeps concurrent upserts from
+// creating more than one document for a day; see EnsureUniquesIndex.
+const UniquesCollection = "uniques"
+
+// Uniques are estimated counts of distinct visitors to a short URL.
+//
+// Visitors are identified by a keyed hash of their IP address which,
+// unlike the hash stored on visits, does not rotate, so that the daily
+// sketches of a week or year may be merged without counting a
+// returning visitor on each day.
+type Uniques struct {
+	Day  uint64 `json:"day"`
+	Week uint64 `json:"week"`
+	Year uint64 `json:"year"`
+}
+
+// uniquesDoc is a daily unique visitor sketch document.
+type uniquesDoc struct {
+	ShortID   primitive.ObjectID `bson:"shortId"`
+	Day       time.Time          `bson:"day"`
+	Registers map[string]uint8   `bson:"r"`
+}
+
+// sketch returns the document's registers as a sketch.
+func (d uniquesDoc) sketch() *hyperloglog.Sketch {
+	var s hyperloglog.Sketch
+	for k, rank := range d.Registers {
+		register, err := strconv.Atoi(k)
+		if err != nil {
+			continue
+		}
+		s.Set(register, rank)
+	}
+
+	return &s
+}
+
+// utcDay returns the start of the UTC day containing t.
+func utcDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+type addUniqueParams struct {
+	DB          *mongo.Client
+	Environment string
+	Tenant      string
+	ShortID     primitive.ObjectID
+	Time        time.Time
+
+	// Visitor identifies the visitor on every day; e.g., a visitor
+	// hash of the IP address.
+	Visitor string
+}
+
+// addUnique adds a visitor to the short URL's sketch for the day.
+func addUnique(ctx context.Context, p addUniqueParams) error {
+	coll := p.DB.Database(p.Environment).Collection(UniquesCollection)
+	updateContext, cancel := context.WithTimeout(ctx, insertTimeout)
+	defer cancel()
+
+	register, rank := hyperloglog.Position([]byte(p.Visitor))
+	if _, err := coll.UpdateOne(
+		updateContext,
+		bson.M{
+			"tenant":  tenant.Match(p.Tenant),
+			"shortId": p.ShortID,
+			"day":     utcDay(p.Time),
+		},
+		bson.M{"$max": bson.M{"r." + strconv.Itoa(register): rank}},
+		options.Update().SetUpsert(true),
+	); err != nil {
+		return fmt.Errorf("failed to update sketch: %v", err)
+	}
+
+	return nil
+}
+
+// EnsureUniquesIndex creates the index unique visitor sketches are
+// updated and found with, if it does not exist.
+func EnsureUniquesIndex(ctx context.Context, db *mongo.Client, env string) error {
+	indexContext, cancel := context.WithTimeout(ctx, indexTimeout)
+	defer cancel()
+
+	if _, err := db.Database(env).Collection(UniquesCollection).Indexes().CreateOne(
+		indexContext, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "tenant", Value: 1},
+				{Key: "shortId", Value: 1},
+				{Key: "day", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+	); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	return nil
+}
+
+type GetUniquesParams struct {
+	DB          *mongo.Client
+	Environment string
+	Tenant      string
+	ShortID     primitive.ObjectID
+}
+
+func (p GetUniquesParams) validate() error {
+	if p.DB == nil {
+		return fmt.Errorf("missing db client")
+	}
+	if p.Environment == "" {
+		return fmt.Errorf("invalid env")
+	}
+	if len(p.ShortID) == 0 {
+		return fmt.Errorf("missing document id")
+	}
+
+	return nil
+}
+
+// GetUniques estimates the distinct visitors to a short URL today,
+// in the last 7 days, and in the last 365 days, in UTC, by merging its
+// daily sketches.
+func GetUniques(ctx context.Context, p GetUniquesParams) (u Uniques, err error) {
+	if err := p.validate(); err != nil {
+		return u, fmt.Errorf("invalid params: %v", err)
+	}
+
+	coll := p.DB.Database(p.Environment).Collection(UniquesCollection)
+
+	today := utcDay(time.Now())
+	weekStart := today.AddDate(0, 0, -6)
+	yearStart := today.AddDate(0, 0, -364)
+
+	findContext, cancel := context.WithTimeout(ctx, aggregateTimeout)
+	defer cancel()
+
+	cursor, err := coll.Find(findContext, bson.M{
+		"tenant":  tenant.Match(p.Tenant),
+		"shortId": p.ShortID,
+		"day":     bson.M{"$gte": yearStart},
+	})
+	if err != nil {
+		return u, fmt.Errorf("failed to find sketches: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var day, week, year hyperloglog.Sketch
+	for cursor.Next(findContext) {
+		var doc uniquesDoc
+		if err := cursor.Decode(&doc); err != nil {
+			return u, fmt.Errorf("failed to decode sketch: %v", err)
+		}
+
+		s := doc.sketch()
+		year.Merge(s)
+		if !doc.Day.Before(weekStart) {
+			week.Merge(s)
+		}
+		if !doc.Day.Before(today) {
+			day.Merge(s)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return u, fmt.Errorf("failed to read sketches: %v", err)
+	}
+
+	return Uniques{
+		Day:  day.Count(),
+		Week: week.Count(),
+		Year: year.Count(),
+	}, nil
+}
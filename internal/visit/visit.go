@@ -9,8 +9,14 @@ import (
 const (
 	// Context timeouts for DB operations.
 	aggregateTimeout = 2 * time.Second
+	countTimeout     = 1 * time.Second
+	indexTimeout     = 30 * time.Second
 	insertTimeout    = 1 * time.Second
 
+	// maxUserAgentLength is the maximum length of a stored
+	// User-Agent header.
+	maxUserAgentLength = 512
+
 	// collection is the MongoDB collection for Visit documents.
 	Collection = "visits"
 )
@@ -20,6 +26,46 @@ type Visit struct {
 	ID      primitive.ObjectID `bson:"_id,omitempty"`
 	ShortID primitive.ObjectID `bson:"shortId"`
 	Time    time.Time          `bson:"time"`
+
+	// Tenant is the tenant of the short URL; see package tenant.
+	Tenant string `bson:"tenant,omitempty"`
+
+	// Target is the name of the short URL target which the visitor
+	// matched, if any.
+	Target string `bson:"target,omitempty"`
+
+	// Country is the ISO 3166-1 alpha-2 country code resolved from
+	// the visitor's IP address, if any.
+	Country string `bson:"country,omitempty"`
+
+	// Variant is the name of the short URL variant the visitor was
+	// redirected to, if any.
+	Variant string `bson:"variant,omitempty"`
+
+	// Referrer is the host name of the referring page, if any.
+	Referrer string `bson:"referrer,omitempty"`
+
+	// UserAgent is the visitor's User-Agent header, truncated to
+	// maxUserAgentLength.
+	UserAgent string `bson:"userAgent,omitempty"`
+
+	// Browser, OS, and Device classify the visitor's user agent.
+	// See package useragent for their values.
+	Browser string `bson:"browser,omitempty"`
+	OS      string `bson:"os,omitempty"`
+	Device  string `bson:"device,omitempty"`
+
+	// Language is the visitor's preferred language, from the
+	// Accept-Language header.
+	Language string `bson:"language,omitempty"`
+
+	// IPHash is a pseudonymous hash of the visitor's IP address.
+	// The address itself is never stored. See package iphash.
+	IPHash string `bson:"ipHash,omitempty"`
+
+	// Bot is set for visits by crawlers, link previewers, and other
+	// automated clients. They are excluded from stats by default.
+	Bot bool `bson:"bot,omitempty"`
 }
 
 // Stats represent counts of visits to short URLs.
@@ -27,4 +73,89 @@ type Stats struct {
 	Day  int `bson:"day" json:"day"`
 	Week int `bson:"week" json:"week"`
 	Year int `bson:"year" json:"year"`
+	All  int `bson:"all" json:"all"`
+
+	// Variants breaks down visits by the variant visitors were
+	// redirected to. It is omitted for short URLs without variants.
+	Variants map[string]Stats `bson:"-" json:"variants,omitempty"`
+
+	// Uniques estimates the distinct visitors in the same periods.
+	// It is omitted when stats are filtered, and for variants.
+	Uniques *Uniques `bson:"-" json:"uniques,omitempty"`
+
+	// Conversions counts the conversions of all visits by event. It is
+	// omitted for short URLs without conversions.
+	Conversions map[string]Conversions `bson:"-" json:"conversions,omitempty"`
+}
+
+// Conversions are the conversions of visits for an event.
+type Conversions struct {
+	Count int `json:"count"`
+
+	// Rate is the count as a fraction of visits.
+	Rate float64 `json:"rate"`
+}
+
+// conversionRates returns the Conversions for counts by event, out of
+// a number of visits. It returns nil if there are no counts.
+func conversionRates(events map[string]int, visits int) map[string]Conversions {
+	if len(events) == 0 {
+		return nil
+	}
+
+	conversions := map[string]Conversions{}
+	for event, n := range events {
+		c := Conversions{Count: n}
+		if visits > 0 {
+			c.Rate = float64(n) / float64(visits)
+		}
+		conversions[event] = c
+	}
+
+	return conversions
+}
+
+// variantEvents returns the counts of conversions by event for a
+// variant, from counts by event and variant.
+func variantEvents(counts map[string]map[string]int, variant string) map[string]int {
+	events := map[string]int{}
+	for event, variants := range counts {
+		if n := variants[variant]; n > 0 {
+			events[event] = n
+		}
+	}
+
+	return events
+}
+
+// totalEvents returns the counts of conversions by event, from counts by
+// event and variant.
+func totalEvents(counts map[string]map[string]int) map[string]int {
+	events := map[string]int{}
+	for event, variants := range counts {
+		for _, n := range variants {
+			events[event] += n
+		}
+	}
+
+	return events
+}
+
+// SetConversions sets the Conversions of the stats, and of each variant,
+// from the counts of conversions by event and variant. Rates are out of
+// all visits.
+func (s *Stats) SetConversions(counts map[string]map[string]int) {
+	s.Conversions = conversionRates(totalEvents(counts), s.All)
+	for name, v := range s.Variants {
+		v.Conversions = conversionRates(variantEvents(counts, name), v.All)
+		s.Variants[name] = v
+	}
+}
+
+// add adds the counts in o to s. Variants are not added.
+func (s *Stats) add(o Stats) {
+	s.Day += o.Day
+	s.Week += o.Week
+	s.Year += o.Year
+	s.All += o.All
 }
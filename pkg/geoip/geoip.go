@@ -0,0 +1,129 @@
+// Package geoip resolves IP addresses to countries with a local
+// database file, without any network calls.
+//
+// The database uses the GeoIP Country CSV format, with one IP range per
+// line, as follows:
+//
+//	"1.0.0.0","1.0.0.255","16777216","16777471","AU","Australia"
+//
+// The first two columns are the first and last addresses of the range,
+// and the fifth column is the ISO 3166-1 alpha-2 country code. The
+// remaining columns are ignored. IPv4 and IPv6 ranges may be mixed.
+package geoip
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DB is an in-memory database of IP ranges.
+// It is safe for concurrent use.
+type DB struct {
+	ranges []ipRange
+}
+
+type ipRange struct {
+	first   net.IP
+	last    net.IP
+	country string
+}
+
+// Open loads the database file at path.
+func Open(path string) (*DB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Load(f)
+}
+
+// Load reads a database from r.
+func Load(r io.Reader) (*DB, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	var ranges []ipRange
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if len(record) < 5 {
+			return nil, fmt.Errorf("line %d: too few columns", line)
+		}
+
+		first := net.ParseIP(strings.TrimSpace(record[0]))
+		last := net.ParseIP(strings.TrimSpace(record[1]))
+		if first == nil || last == nil {
+			return nil, fmt.Errorf("line %d: invalid ip", line)
+		}
+		first, last = first.To16(), last.To16()
+		if bytes.Compare(first, last) > 0 {
+			return nil, fmt.Errorf("line %d: invalid range", line)
+		}
+
+		country := strings.ToUpper(strings.TrimSpace(record[4]))
+		if len(country) != 2 {
+			return nil, fmt.Errorf("line %d: invalid country", line)
+		}
+
+		ranges = append(ranges, ipRange{
+			first: first, last: last, country: country,
+		})
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return bytes.Compare(ranges[i].first, ranges[j].first) < 0
+	})
+
+	for i := 1; i < len(ranges); i++ {
+		if bytes.Compare(ranges[i].first, ranges[i-1].last) <= 0 {
+			return nil, fmt.Errorf(
+				"overlapping ranges starting at %s and %s",
+				ranges[i-1].first, ranges[i].first,
+			)
+		}
+	}
+
+	return &DB{ranges: ranges}, nil
+}
+
+// Country returns the country code for an IP address, or an empty
+// string if the address is not in the database.
+func (db *DB) Country(ip net.IP) string {
+	if db == nil || ip == nil {
+		return ""
+	}
+	ip = ip.To16()
+
+	// Find the last range starting at or before the address.
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return bytes.Compare(db.ranges[i].first, ip) > 0
+	}) - 1
+	if i < 0 || bytes.Compare(ip, db.ranges[i].last) > 0 {
+		return ""
+	}
+
+	return db.ranges[i].country
+}
+
+// Len returns the number of ranges in the database.
+func (db *DB) Len() int {
+	if db == nil {
+		return 0
+	}
+
+	return len(db.ranges)
+}
@@ -0,0 +1,72 @@
+package geoip
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+const testDB = `"1.0.0.0","1.0.0.255","16777216","16777471","AU","Australia"
+"2.16.0.0","2.16.5.255","34603008","34604543","FR","France"
+"2001:db8::","2001:db8::ffff","0","0","DE","Germany"
+`
+
+func TestLoad(t *testing.T) {
+	db, err := Load(strings.NewReader(testDB))
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	if db.Len() != 3 {
+		t.Errorf("expected 3 ranges but got %d", db.Len())
+	}
+
+	var invalid = []string{
+		`"1.0.0.0","1.0.0.255"`,
+		`"1.0.0.x","1.0.0.255","0","0","AU","Australia"`,
+		`"1.0.0.255","1.0.0.0","0","0","AU","Australia"`,
+		`"1.0.0.0","1.0.0.255","0","0","AUS","Australia"`,
+		`"1.0.0.0","1.0.0.255","0","0","AU","Australia"
+"1.0.0.128","1.0.1.0","0","0","AU","Australia"`,
+	}
+	for _, input := range invalid {
+		if _, err := Load(strings.NewReader(input)); err == nil {
+			t.Errorf("expected error loading %q", input)
+		}
+	}
+}
+
+func TestCountry(t *testing.T) {
+	db, err := Load(strings.NewReader(testDB))
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+
+	var tests = []struct {
+		Input    string
+		Expected string
+	}{
+		{Input: "1.0.0.0", Expected: "AU"},
+		{Input: "1.0.0.128", Expected: "AU"},
+		{Input: "1.0.0.255", Expected: "AU"},
+		{Input: "1.0.1.0", Expected: ""},
+		{Input: "0.255.255.255", Expected: ""},
+		{Input: "2.16.3.4", Expected: "FR"},
+		{Input: "2001:db8::1", Expected: "DE"},
+		{Input: "2001:db8::1:0", Expected: ""},
+		{Input: "255.255.255.255", Expected: ""},
+	}
+
+	for _, test := range tests {
+		if got := db.Country(net.ParseIP(test.Input)); got != test.Expected {
+			t.Errorf(
+				"%s: expected %q but got %q",
+				test.Input, test.Expected, got,
+			)
+		}
+	}
+
+	var empty *DB
+	if got := empty.Country(net.ParseIP("1.0.0.1")); got != "" {
+		t.Errorf("expected nil db to return empty country, got %q", got)
+	}
+}
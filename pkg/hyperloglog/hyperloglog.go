@@ -0,0 +1,118 @@
+// Package hyperloglog estimates the number of distinct items in a set,
+// in a fixed amount of memory, with the HyperLogLog algorithm.
+//
+// Sketches use 2^12 registers, for a standard error of about 1.6%.
+// Each register holds the highest rank seen for the items hashed to it;
+// the rank of an item is the position of the first set bit in the rest
+// of its hash. Sketches are merged by taking the maximum of each
+// register, so a register may also be updated in place by any store
+// supporting an atomic maximum.
+package hyperloglog
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+const (
+	// Precision is the number of hash bits used to pick a register.
+	Precision = 12
+
+	// Registers is the number of registers in a sketch.
+	Registers = 1 << Precision
+
+	// MaxRank is the highest rank a register can hold.
+	MaxRank = 64 - Precision + 1
+)
+
+// Sketch is a HyperLogLog sketch. The zero value is an empty sketch.
+// It is not safe for concurrent use.
+type Sketch struct {
+	registers [Registers]uint8
+}
+
+// Position returns the register and rank for an item.
+func Position(item []byte) (register int, rank uint8) {
+	return positionHash(hash(item))
+}
+
+func positionHash(h uint64) (register int, rank uint8) {
+	register = int(h >> (64 - Precision))
+
+	// The remaining bits, shifted to the top. A sentinel bit bounds
+	// the rank when they are all zero.
+	rest := h<<Precision | 1<<(Precision-1)
+	rank = uint8(bits.LeadingZeros64(rest) + 1)
+
+	return register, rank
+}
+
+// Add adds an item to the sketch.
+func (s *Sketch) Add(item []byte) {
+	s.Set(Position(item))
+}
+
+// Set raises a register to rank, if it is lower. Registers or ranks out
+// of range are ignored.
+func (s *Sketch) Set(register int, rank uint8) {
+	if register < 0 || register >= Registers || rank > MaxRank {
+		return
+	}
+	if rank > s.registers[register] {
+		s.registers[register] = rank
+	}
+}
+
+// Merge adds the items of o to the sketch.
+func (s *Sketch) Merge(o *Sketch) {
+	for i, rank := range o.registers {
+		if rank > s.registers[i] {
+			s.registers[i] = rank
+		}
+	}
+}
+
+// Count returns the estimated number of distinct items in the sketch.
+func (s *Sketch) Count() uint64 {
+	var (
+		sum   float64
+		zeros int
+	)
+	for _, rank := range s.registers {
+		sum += 1 / float64(uint64(1)<<rank)
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	const m = float64(Registers)
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+
+	// Small cardinalities are estimated more accurately by linear
+	// counting of the empty registers. With 64-bit hashes, no large
+	// range correction is needed.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(estimate + 0.5)
+}
+
+// hash returns a 64-bit hash of item. FNV-1a is fast but mixes its
+// high bits poorly, which the register index is taken from; the
+// finalizer from SplitMix64 spreads them.
+func hash(item []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(item)
+	x := h.Sum64()
+
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+
+	return x
+}
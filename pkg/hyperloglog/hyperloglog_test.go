@@ -0,0 +1,82 @@
+package hyperloglog
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// TestCount checks that estimates are within a few standard errors of
+// the true cardinality.
+func TestCount(t *testing.T) {
+	var s Sketch
+	if n := s.Count(); n != 0 {
+		t.Errorf("expected 0 for an empty sketch but got %d", n)
+	}
+
+	for _, n := range []int{1, 10, 100, 1000, 10000, 100000} {
+		var s Sketch
+		for i := 0; i < n; i++ {
+			s.Add([]byte(fmt.Sprintf("item-%d", i)))
+			// Duplicates must not change the estimate.
+			s.Add([]byte(fmt.Sprintf("item-%d", i)))
+		}
+
+		checkEstimate(t, n, s.Count())
+	}
+}
+
+// TestMerge checks that a merged sketch estimates the union.
+func TestMerge(t *testing.T) {
+	var a, b Sketch
+	for i := 0; i < 6000; i++ {
+		a.Add([]byte(fmt.Sprintf("item-%d", i)))
+	}
+	for i := 4000; i < 10000; i++ {
+		b.Add([]byte(fmt.Sprintf("item-%d", i)))
+	}
+
+	a.Merge(&b)
+	checkEstimate(t, 10000, a.Count())
+}
+
+// TestSet checks that registers only rise, and that invalid positions
+// are ignored.
+func TestSet(t *testing.T) {
+	var s Sketch
+	s.Set(1, 5)
+	s.Set(1, 3)
+	if s.registers[1] != 5 {
+		t.Errorf("expected rank 5 but got %d", s.registers[1])
+	}
+
+	s.Set(-1, 1)
+	s.Set(Registers, 1)
+	s.Set(2, MaxRank+1)
+	if s.registers[2] != 0 {
+		t.Errorf("expected rank 0 but got %d", s.registers[2])
+	}
+}
+
+// TestPosition checks the bounds of registers and ranks.
+func TestPosition(t *testing.T) {
+	register, rank := positionHash(0)
+	if register != 0 || rank != MaxRank {
+		t.Errorf("expected register 0, rank %d but got %d, %d", MaxRank, register, rank)
+	}
+
+	register, rank = positionHash(math.MaxUint64)
+	if register != Registers-1 || rank != 1 {
+		t.Errorf("expected register %d, rank 1 but got %d, %d", Registers-1, register, rank)
+	}
+}
+
+func checkEstimate(t *testing.T, n int, got uint64) {
+	t.Helper()
+
+	// Allow four standard errors, plus one for tiny sets.
+	tolerance := 4*1.04/math.Sqrt(Registers)*float64(n) + 1
+	if math.Abs(float64(got)-float64(n)) > tolerance {
+		t.Errorf("expected about %d but got %d", n, got)
+	}
+}
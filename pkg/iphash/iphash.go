@@ -0,0 +1,111 @@
+// Package iphash pseudonymizes IP addresses, so that visitors may be
+// counted without storing their addresses.
+//
+// Addresses are hashed with HMAC-SHA256 under a key derived from a
+// secret and the current UTC date. The key rotates daily, so the hashes
+// of an address on different days cannot be linked, and the hashes
+// cannot be reversed without the secret.
+//
+// Visitor hashes are keyed with the secret alone, so that distinct
+// visitors may be counted over several days. They identify a visitor
+// for as long as the secret is kept, and must not be stored; e.g., only
+// their position in a HyperLogLog sketch should be.
+package iphash
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// hashLength is the number of bytes of the HMAC kept in a hash.
+const hashLength = 16
+
+// visitorLabel derives the key of visitor hashes from the secret, so
+// that it differs from the key of any day.
+const visitorLabel = "visitor"
+
+// Hasher hashes IP addresses with a daily rotating key.
+// It is safe for concurrent use.
+type Hasher struct {
+	secret     []byte
+	visitorKey []byte
+
+	mu  sync.Mutex
+	day string
+	key []byte
+}
+
+// New returns a Hasher using secret. If secret is empty, a random
+// secret is generated; hashes will then differ between processes.
+func New(secret []byte) (*Hasher, error) {
+	if len(secret) == 0 {
+		secret = make([]byte, sha256.Size)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate secret: %v", err)
+		}
+	}
+
+	return &Hasher{secret: secret, visitorKey: derive(secret, visitorLabel)}, nil
+}
+
+// Hash returns the hex encoded hash of ip at time t.
+// It returns an empty string for a nil Hasher or IP.
+func (h *Hasher) Hash(ip net.IP, t time.Time) string {
+	if h == nil || ip == nil {
+		return ""
+	}
+
+	return sum(h.dayKey(t), ip)
+}
+
+// Visitor returns the hex encoded visitor hash of ip, which is the same
+// on every day. It returns an empty string for a nil Hasher or IP.
+func (h *Hasher) Visitor(ip net.IP) string {
+	if h == nil || ip == nil {
+		return ""
+	}
+
+	return sum(h.visitorKey, ip)
+}
+
+// dayKey returns the key for the UTC date of t.
+func (h *Hasher) dayKey(t time.Time) []byte {
+	day := t.UTC().Format("2006-01-02")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if day != h.day {
+		h.day, h.key = day, derive(h.secret, day)
+	}
+
+	return h.key
+}
+
+// derive returns the key derived from secret for a label; e.g., a date.
+func derive(secret []byte, label string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(label))
+
+	return mac.Sum(nil)
+}
+
+// sum returns the hex encoded hash of ip under key.
+func sum(key []byte, ip net.IP) string {
+	// Hash IPv4 addresses in their 4-byte form, so that the hash does
+	// not depend on how the address was parsed.
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(ip)
+
+	return hex.EncodeToString(mac.Sum(nil)[:hashLength])
+}
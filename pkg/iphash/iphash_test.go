@@ -0,0 +1,96 @@
+package iphash
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// TestHash checks that hashes are stable within a day, and differ
+// between days, addresses, and secrets.
+func TestHash(t *testing.T) {
+	h, err := New([]byte("secret"))
+	if err != nil {
+		t.Fatalf("failed to create hasher: %v", err)
+	}
+	other, err := New([]byte("other"))
+	if err != nil {
+		t.Fatalf("failed to create hasher: %v", err)
+	}
+
+	ip := net.ParseIP("203.0.113.7")
+	morning := time.Date(2020, 3, 1, 1, 0, 0, 0, time.UTC)
+	evening := time.Date(2020, 3, 1, 23, 0, 0, 0, time.UTC)
+	nextDay := time.Date(2020, 3, 2, 1, 0, 0, 0, time.UTC)
+
+	got := h.Hash(ip, morning)
+	if len(got) != 2*hashLength {
+		t.Errorf("expected a %d character hash but got %q", 2*hashLength, got)
+	}
+	if h.Hash(ip, evening) != got {
+		t.Error("expected the same hash within a day")
+	}
+	if h.Hash(net.ParseIP("::ffff:203.0.113.7"), morning) != got {
+		t.Error("expected the same hash for an IPv4-mapped address")
+	}
+	if h.Hash(ip, nextDay) == got {
+		t.Error("expected a different hash on the next day")
+	}
+	if h.Hash(net.ParseIP("203.0.113.8"), morning) == got {
+		t.Error("expected a different hash for a different address")
+	}
+	if other.Hash(ip, morning) == got {
+		t.Error("expected a different hash for a different secret")
+	}
+
+	// Returning to an earlier day should rederive the same key.
+	if h.Hash(ip, morning) != got {
+		t.Error("expected the same hash after rotating back")
+	}
+
+	if h.Hash(nil, morning) != "" {
+		t.Error("expected an empty hash for a nil ip")
+	}
+	var nilHasher *Hasher
+	if nilHasher.Hash(ip, morning) != "" {
+		t.Error("expected an empty hash for a nil hasher")
+	}
+}
+
+// TestVisitor checks that visitor hashes are stable across days, and
+// differ from daily hashes, and between addresses and secrets.
+func TestVisitor(t *testing.T) {
+	h, err := New([]byte("secret"))
+	if err != nil {
+		t.Fatalf("failed to create hasher: %v", err)
+	}
+	other, err := New([]byte("other"))
+	if err != nil {
+		t.Fatalf("failed to create hasher: %v", err)
+	}
+
+	ip := net.ParseIP("203.0.113.7")
+	day := time.Date(2020, 3, 1, 1, 0, 0, 0, time.UTC)
+
+	got := h.Visitor(ip)
+	if len(got) != 2*hashLength {
+		t.Errorf("expected a %d character hash but got %q", 2*hashLength, got)
+	}
+	if h.Visitor(net.ParseIP("::ffff:203.0.113.7")) != got {
+		t.Error("expected the same hash for an IPv4-mapped address")
+	}
+	if h.Hash(ip, day) == got || h.Hash(ip, day.AddDate(0, 0, 1)) == got {
+		t.Error("expected a visitor hash to differ from daily hashes")
+	}
+	if h.Visitor(net.ParseIP("203.0.113.8")) == got {
+		t.Error("expected a different hash for a different address")
+	}
+	if other.Visitor(ip) == got {
+		t.Error("expected a different hash for a different secret")
+	}
+
+	var nilHasher *Hasher
+	if nilHasher.Visitor(ip) != "" || h.Visitor(nil) != "" {
+		t.Error("expected an empty hash for a nil hasher or ip")
+	}
+}
@@ -0,0 +1,189 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// minRSABits is the minimum size of RSA keys accepted.
+const minRSABits = 2048
+
+// KeySet is a set of public keys, parsed from a JSON Web Key Set
+// (RFC 7517).
+type KeySet struct {
+	keys []key
+}
+
+// key is a public key of a KeySet.
+type key struct {
+	id  string
+	alg string
+	pub crypto.PublicKey
+}
+
+// jwk is a JSON Web Key, as encoded in a key set.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+
+	// RSA keys.
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC keys.
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// curves maps the names of supported curves to their curves.
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// ParseKeySet parses a JSON Web Key Set. RSA and EC keys for signatures
+// are kept; keys of other types, or for encryption, are skipped, so that
+// key sets shared with other uses may be read. It returns an error if no
+// keys are kept, or if a kept key is invalid.
+func ParseKeySet(data []byte) (*KeySet, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to decode key set: %v", err)
+	}
+
+	ks := &KeySet{}
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var (
+			pub crypto.PublicKey
+			err error
+		)
+		switch k.Kty {
+		case "RSA":
+			pub, err = parseRSA(k)
+		case "EC":
+			pub, err = parseEC(k)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %d (%q): %v", i, k.Kid, err)
+		}
+
+		ks.keys = append(ks.keys, key{id: k.Kid, alg: k.Alg, pub: pub})
+	}
+	if len(ks.keys) == 0 {
+		return nil, fmt.Errorf("no signing keys in key set")
+	}
+
+	return ks, nil
+}
+
+// Len returns the number of keys in the set.
+func (ks *KeySet) Len() int {
+	if ks == nil {
+		return 0
+	}
+
+	return len(ks.keys)
+}
+
+// find returns the public key to verify a token signed with alg by the
+// key with the ID kid. Tokens without a key ID are verified with the
+// only key of the set suited to alg, if there is exactly one.
+func (ks *KeySet) find(kid string, alg algorithm) (crypto.PublicKey, bool) {
+	if ks == nil {
+		return nil, false
+	}
+
+	var (
+		found crypto.PublicKey
+		n     int
+	)
+	for _, k := range ks.keys {
+		if kid != "" && k.id != kid {
+			continue
+		}
+		if k.alg != "" && k.alg != alg.name {
+			continue
+		}
+		if !alg.suits(k.pub) {
+			continue
+		}
+		found = k.pub
+		n++
+	}
+	if kid == "" && n != 1 {
+		return nil, false
+	}
+
+	return found, found != nil
+}
+
+func parseRSA(k jwk) (*rsa.PublicKey, error) {
+	n, err := decodeInt(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %v", err)
+	}
+	e, err := decodeInt(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %v", err)
+	}
+	if n.BitLen() < minRSABits {
+		return nil, fmt.Errorf("modulus too small")
+	}
+	if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 || e.Bit(0) == 0 {
+		return nil, fmt.Errorf("invalid exponent")
+	}
+
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func parseEC(k jwk) (*ecdsa.PublicKey, error) {
+	curve, ok := curves[k.Crv]
+	if !ok {
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+	x, err := decodeInt(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x: %v", err)
+	}
+	y, err := decodeInt(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("invalid y: %v", err)
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("point not on curve")
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// decodeInt decodes an unsigned big-endian integer encoded as unpadded
+// URL-safe base64.
+func decodeInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, fmt.Errorf("missing value")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
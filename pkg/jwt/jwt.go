@@ -0,0 +1,286 @@
+// Package jwt verifies JSON Web Tokens (RFC 7519) signed with RSA or
+// ECDSA keys from a JSON Web Key Set, as issued by OpenID Connect
+// providers.
+//
+// Only asymmetric algorithms are supported: RS256, RS384, RS512, ES256,
+// ES384, and ES512. Tokens signed with any other algorithm, including
+// "none" and HMAC, are rejected, so that a public key can never be
+// used as an HMAC secret.
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	// Register the hash functions used by the algorithms.
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// maxTokenLength is the maximum length of a token. Tokens issued for
+// access are far smaller; the limit bounds the work done for garbage.
+const maxTokenLength = 16 << 10
+
+var (
+	// ErrMalformed is returned for tokens which cannot be decoded.
+	ErrMalformed = fmt.Errorf("malformed token")
+
+	// ErrUnsupportedAlgorithm is returned for tokens signed with an
+	// algorithm which is not supported.
+	ErrUnsupportedAlgorithm = fmt.Errorf("unsupported algorithm")
+
+	// ErrUnknownKey is returned for tokens signed with a key which is
+	// not in the key set. The key set may need to be refreshed.
+	ErrUnknownKey = fmt.Errorf("unknown key")
+
+	// ErrInvalidSignature is returned for tokens whose signature does
+	// not match.
+	ErrInvalidSignature = fmt.Errorf("invalid signature")
+
+	// ErrExpired is returned for tokens past their expiry time, or
+	// without one.
+	ErrExpired = fmt.Errorf("token expired")
+
+	// ErrNotYetValid is returned for tokens used before their "nbf"
+	// time.
+	ErrNotYetValid = fmt.Errorf("token not yet valid")
+
+	// ErrInvalidIssuer is returned for tokens from another issuer.
+	ErrInvalidIssuer = fmt.Errorf("invalid issuer")
+
+	// ErrInvalidAudience is returned for tokens intended for another
+	// audience.
+	ErrInvalidAudience = fmt.Errorf("invalid audience")
+)
+
+// algorithm is a supported signing algorithm.
+type algorithm struct {
+	name string
+	hash crypto.Hash
+
+	// curve is the name of the curve of ECDSA algorithms; empty for
+	// RSA algorithms.
+	curve string
+}
+
+// suits reports whether a public key may verify signatures made with
+// the algorithm.
+func (a algorithm) suits(pub crypto.PublicKey) bool {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return a.curve == ""
+	case *ecdsa.PublicKey:
+		return a.curve != "" && k.Curve.Params().Name == a.curve
+	default:
+		return false
+	}
+}
+
+var algorithms = map[string]algorithm{
+	"RS256": {name: "RS256", hash: crypto.SHA256},
+	"RS384": {name: "RS384", hash: crypto.SHA384},
+	"RS512": {name: "RS512", hash: crypto.SHA512},
+	"ES256": {name: "ES256", hash: crypto.SHA256, curve: "P-256"},
+	"ES384": {name: "ES384", hash: crypto.SHA384, curve: "P-384"},
+	"ES512": {name: "ES512", hash: crypto.SHA512, curve: "P-521"},
+}
+
+// Header is the header of a token.
+type Header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// Token is a parsed token. Its claims must not be trusted until it is
+// verified.
+type Token struct {
+	Header Header
+	Claims Claims
+
+	// signed is the signing input: the encoded header and payload.
+	signed    []byte
+	signature []byte
+}
+
+// Parse decodes a token in its compact serialization, without verifying
+// it.
+func Parse(s string) (*Token, error) {
+	if len(s) > maxTokenLength {
+		return nil, ErrMalformed
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	t := &Token{signed: []byte(parts[0] + "." + parts[1])}
+
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	if err := json.Unmarshal(header, &t.Header); err != nil {
+		return nil, ErrMalformed
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	d := json.NewDecoder(bytes.NewReader(payload))
+	d.UseNumber()
+	if err := d.Decode(&t.Claims); err != nil || t.Claims == nil {
+		return nil, ErrMalformed
+	}
+
+	if t.signature, err = base64.RawURLEncoding.DecodeString(parts[2]); err != nil {
+		return nil, ErrMalformed
+	}
+
+	return t, nil
+}
+
+// Verify verifies the signature of the token with a key from the set.
+func (t *Token) Verify(keys *KeySet) error {
+	alg, ok := algorithms[t.Header.Alg]
+	if !ok {
+		return ErrUnsupportedAlgorithm
+	}
+
+	pub, ok := keys.find(t.Header.Kid, alg)
+	if !ok {
+		return ErrUnknownKey
+	}
+
+	h := alg.hash.New()
+	h.Write(t.signed)
+	digest := h.Sum(nil)
+
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(k, alg.hash, digest, t.signature) != nil {
+			return ErrInvalidSignature
+		}
+	case *ecdsa.PublicKey:
+		// ECDSA signatures are the concatenated, fixed size, r and s.
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(t.signature) != 2*size {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(t.signature[:size])
+		s := new(big.Int).SetBytes(t.signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return ErrInvalidSignature
+		}
+	default:
+		return ErrUnknownKey
+	}
+
+	return nil
+}
+
+// Expected are the values a token's registered claims are validated
+// against.
+type Expected struct {
+	// Issuer must match the "iss" claim.
+	Issuer string
+
+	// Audience must be one of the "aud" claim.
+	Audience string
+
+	// Time is the time of validation. Optional; defaults to now.
+	Time time.Time
+
+	// Leeway allows for clock skew when checking "exp" and "nbf".
+	Leeway time.Duration
+}
+
+// Validate validates the registered claims of the token: that it is
+// from the issuer, for the audience, and is used between its "nbf" and
+// "exp" times. Tokens must have an expiry time.
+func (t *Token) Validate(e Expected) error {
+	now := e.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	if iss, _ := t.Claims.String("iss"); iss == "" || iss != e.Issuer {
+		return ErrInvalidIssuer
+	}
+
+	audience := false
+	for _, aud := range t.Claims.Strings("aud") {
+		if aud != "" && aud == e.Audience {
+			audience = true
+			break
+		}
+	}
+	if !audience {
+		return ErrInvalidAudience
+	}
+
+	exp, ok := t.Claims.Time("exp")
+	if !ok || !now.Before(exp.Add(e.Leeway)) {
+		return ErrExpired
+	}
+	if nbf, ok := t.Claims.Time("nbf"); ok && now.Add(e.Leeway).Before(nbf) {
+		return ErrNotYetValid
+	}
+
+	return nil
+}
+
+// Claims are the claims in the payload of a token. Numbers are decoded
+// as json.Number.
+type Claims map[string]interface{}
+
+// String returns the value of a string claim.
+func (c Claims) String(name string) (string, bool) {
+	s, ok := c[name].(string)
+
+	return s, ok
+}
+
+// Strings returns the values of a claim which is a string, or an array
+// of strings; e.g., "aud". Values which are not strings are skipped.
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var values []string
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// Time returns the value of a claim which is a NumericDate; a number of
+// seconds since the Unix epoch.
+func (c Claims) Time(name string) (time.Time, bool) {
+	n, ok := c[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*1e9)).UTC(), true
+}
@@ -0,0 +1,220 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	rsaKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _  = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+)
+
+func encodeInt(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+// keySet returns a key set with the public keys of rsaKey, as "rsa", and
+// ecKey, as "ec".
+func keySet(t *testing.T) *KeySet {
+	data := fmt.Sprintf(`{"keys": [
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": %q, "e": "AQAB"},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": %q, "y": %q},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "", "e": ""},
+		{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"}
+	]}`,
+		encodeInt(rsaKey.N), encodeInt(ecKey.X), encodeInt(ecKey.Y),
+	)
+	ks, err := ParseKeySet([]byte(data))
+	if err != nil {
+		t.Fatalf("failed to parse key set: %v", err)
+	}
+
+	return ks
+}
+
+// sign returns a token with the claims, signed by key with alg.
+func sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+
+	h := algorithms[alg].hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, algorithms[alg].hash, digest); err != nil {
+			t.Fatalf("failed to sign: %v", err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest)
+		if err != nil {
+			t.Fatalf("failed to sign: %v", err)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		sig = make([]byte, 2*size)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[size-len(rb):size], rb)
+		copy(sig[2*size-len(sb):], sb)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestParseKeySet(t *testing.T) {
+	if n := keySet(t).Len(); n != 2 {
+		t.Errorf("expected 2 signing keys but got %d", n)
+	}
+
+	var tests = []struct {
+		name string
+		data string
+	}{
+		{"invalid json", `{"keys":`},
+		{"no keys", `{"keys": []}`},
+		{"only encryption keys", `{"keys": [{"kty": "RSA", "use": "enc"}]}`},
+		{"small modulus", `{"keys": [{"kty": "RSA", "n": "AQAB", "e": "AQAB"}]}`},
+		{"unknown curve", `{"keys": [{"kty": "EC", "crv": "P-192", "x": "AQ", "y": "AQ"}]}`},
+		{"point not on curve", `{"keys": [{"kty": "EC", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`},
+	}
+	for _, test := range tests {
+		if _, err := ParseKeySet([]byte(test.data)); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ks := keySet(t)
+	claims := map[string]interface{}{"sub": "alice"}
+	otherRSA, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	var tests = []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"RS256", sign(t, "RS256", "rsa", rsaKey, claims), nil},
+		{"RS512", sign(t, "RS512", "rsa", rsaKey, claims), nil},
+		{"ES256", sign(t, "ES256", "ec", ecKey, claims), nil},
+		{"ES256 without kid", sign(t, "ES256", "", ecKey, claims), nil},
+		{"RS256 without kid", sign(t, "RS256", "", rsaKey, claims), nil},
+		{"unknown kid", sign(t, "RS256", "other", rsaKey, claims), ErrUnknownKey},
+		{"wrong key type for kid", sign(t, "ES256", "rsa", ecKey, claims), ErrUnknownKey},
+		{"wrong key", sign(t, "RS256", "rsa", otherRSA, claims), ErrInvalidSignature},
+		{"unsupported curve", sign(t, "ES384", "ec", ecKey, claims), ErrUnknownKey},
+		{
+			"none",
+			"eyJhbGciOiJub25lIn0." +
+				base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"alice"}`)) + ".",
+			ErrUnsupportedAlgorithm,
+		},
+	}
+	for _, test := range tests {
+		token, err := Parse(test.token)
+		if err != nil {
+			t.Errorf("%s: failed to parse: %v", test.name, err)
+			continue
+		}
+		if err := token.Verify(ks); err != test.err {
+			t.Errorf("%s: expected %v but got %v", test.name, test.err, err)
+		}
+	}
+
+	// Tampering with the payload invalidates the signature.
+	parts := strings.Split(sign(t, "RS256", "rsa", rsaKey, claims), ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"mallory"}`))
+	token, err := Parse(strings.Join(parts, "."))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if err := token.Verify(ks); err != ErrInvalidSignature {
+		t.Errorf("expected %v for a tampered token but got %v", ErrInvalidSignature, err)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	var tests = []string{
+		"",
+		"a.b",
+		"a.b.c.d",
+		"!!.e30.",
+		"e30.!!.",
+		"e30.e30.!!",
+		"e30.bnVsbA.",
+		strings.Repeat("a", maxTokenLength+1),
+	}
+	for _, test := range tests {
+		if _, err := Parse(test); err != ErrMalformed {
+			t.Errorf("%q: expected %v but got %v", test, ErrMalformed, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	expected := Expected{
+		Issuer:   "https://issuer.example.com",
+		Audience: "url-shortener",
+		Time:     now,
+		Leeway:   time.Minute,
+	}
+	valid := func() Claims {
+		return Claims{
+			"iss": "https://issuer.example.com",
+			"aud": "url-shortener",
+			"exp": json.Number(fmt.Sprint(now.Add(time.Hour).Unix())),
+		}
+	}
+
+	var tests = []struct {
+		name   string
+		modify func(Claims)
+		err    error
+	}{
+		{"valid", func(c Claims) {}, nil},
+		{"audience array", func(c Claims) {
+			c["aud"] = []interface{}{"other", "url-shortener"}
+		}, nil},
+		{"wrong issuer", func(c Claims) { c["iss"] = "https://other.example.com" }, ErrInvalidIssuer},
+		{"missing issuer", func(c Claims) { delete(c, "iss") }, ErrInvalidIssuer},
+		{"wrong audience", func(c Claims) { c["aud"] = "other" }, ErrInvalidAudience},
+		{"missing audience", func(c Claims) { delete(c, "aud") }, ErrInvalidAudience},
+		{"missing expiry", func(c Claims) { delete(c, "exp") }, ErrExpired},
+		{"expired", func(c Claims) {
+			c["exp"] = json.Number(fmt.Sprint(now.Add(-2 * time.Minute).Unix()))
+		}, ErrExpired},
+		{"expired within leeway", func(c Claims) {
+			c["exp"] = json.Number(fmt.Sprint(now.Add(-30 * time.Second).Unix()))
+		}, nil},
+		{"not yet valid", func(c Claims) {
+			c["nbf"] = json.Number(fmt.Sprint(now.Add(2 * time.Minute).Unix()))
+		}, ErrNotYetValid},
+		{"not yet valid within leeway", func(c Claims) {
+			c["nbf"] = json.Number(fmt.Sprint(now.Add(30 * time.Second).Unix()))
+		}, nil},
+	}
+	for _, test := range tests {
+		claims := valid()
+		test.modify(claims)
+		token := &Token{Claims: claims}
+		if err := token.Validate(expected); err != test.err {
+			t.Errorf("%s: expected %v but got %v", test.name, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Package language parses HTTP Accept-Language headers, and matches
+// language tags against one another.
+package language
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxTags is the maximum number of tags parsed from a header.
+// It guards against excessively long headers.
+const maxTags = 16
+
+// Preferred returns the client's most preferred language tag in an
+// Accept-Language header, in lower case; e.g., "en-us". It returns an
+// empty string if the header has no usable tags. The wildcard "*" is
+// ignored.
+func Preferred(header string) string {
+	tags := Parse(header)
+	if len(tags) == 0 {
+		return ""
+	}
+
+	return tags[0]
+}
+
+// Parse returns the language tags in an Accept-Language header, in lower
+// case, ordered by descending quality. Tags with equal quality retain
+// their order. Tags with a quality of zero, and the wildcard "*", are
+// omitted.
+func Parse(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		if len(tags) == maxTags {
+			break
+		}
+
+		fields := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" || tag == "*" || !Valid(tag) {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			v, err := strconv.ParseFloat(param[2:], 64)
+			if err != nil || v < 0 || v > 1 {
+				v = 0
+			}
+			q = v
+		}
+		if q == 0 {
+			continue
+		}
+
+		tags = append(tags, weighted{tag: tag, q: q})
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+
+	result := make([]string, len(tags))
+	for i, t := range tags {
+		result[i] = t.tag
+	}
+
+	return result
+}
+
+// Match reports whether a tag matches a language range, ignoring case.
+// A range matches the tag itself, and any tag it is a prefix of; e.g.,
+// "pt" matches "pt" and "pt-BR", but "pt-BR" does not match "pt".
+func Match(languageRange, tag string) bool {
+	languageRange = strings.ToLower(languageRange)
+	tag = strings.ToLower(tag)
+
+	return tag == languageRange ||
+		strings.HasPrefix(tag, languageRange+"-")
+}
+
+// Valid reports whether s is a well-formed language tag, consisting of
+// alphanumeric subtags of one to eight characters, separated by
+// hyphens, with a leading alphabetic subtag.
+func Valid(s string) bool {
+	subtags := strings.Split(s, "-")
+	for i, subtag := range subtags {
+		if len(subtag) == 0 || len(subtag) > 8 {
+			return false
+		}
+		for _, r := range subtag {
+			isAlpha := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+			isDigit := r >= '0' && r <= '9'
+			if !isAlpha && (i == 0 || !isDigit) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
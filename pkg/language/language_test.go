@@ -0,0 +1,67 @@
+package language
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	var tests = []struct {
+		Input    string
+		Expected []string
+	}{
+		{Input: "", Expected: []string{}},
+		{Input: "en-US", Expected: []string{"en-us"}},
+		{
+			Input:    "fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5",
+			Expected: []string{"fr-ch", "fr", "en", "de"},
+		},
+		{
+			Input:    "de;q=0.5, en;q=0.9, pt",
+			Expected: []string{"pt", "en", "de"},
+		},
+		{Input: "en;q=0, de", Expected: []string{"de"}},
+		{Input: "en;q=abc, de", Expected: []string{"de"}},
+		{Input: "<script>, es", Expected: []string{"es"}},
+	}
+
+	for _, test := range tests {
+		if got := Parse(test.Input); !reflect.DeepEqual(got, test.Expected) {
+			t.Errorf(
+				"%q: expected %v but got %v",
+				test.Input, test.Expected, got,
+			)
+		}
+	}
+
+	if got := Preferred("de;q=0.5, en;q=0.9"); got != "en" {
+		t.Errorf("expected preferred language en, but got %q", got)
+	}
+	if got := Preferred("*"); got != "" {
+		t.Errorf("expected no preferred language, but got %q", got)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	var tests = []struct {
+		Range    string
+		Tag      string
+		Expected bool
+	}{
+		{Range: "pt", Tag: "pt", Expected: true},
+		{Range: "pt", Tag: "pt-br", Expected: true},
+		{Range: "pt-BR", Tag: "pt-br", Expected: true},
+		{Range: "pt-br", Tag: "pt", Expected: false},
+		{Range: "p", Tag: "pt", Expected: false},
+		{Range: "en", Tag: "", Expected: false},
+	}
+
+	for _, test := range tests {
+		if got := Match(test.Range, test.Tag); got != test.Expected {
+			t.Errorf(
+				"%q, %q: expected %v but got %v",
+				test.Range, test.Tag, test.Expected, got,
+			)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+// Package resp implements a small client for the Redis serialization
+// protocol (RESP). It supports the request/reply commands and the
+// publish/subscribe messages used by this service, and nothing more.
+package resp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	// dialTimeout is how long to wait before giving up on
+	// connecting to the server, if the context has no deadline.
+	dialTimeout = 3 * time.Second
+
+	// maxIdle is the number of idle connections kept in the pool.
+	maxIdle = 16
+)
+
+// ErrNil is returned when the server replies with a null value; e.g.,
+// a GET for a key that does not exist.
+var ErrNil = errors.New("resp: nil reply")
+
+// Error is an error reply returned by the server.
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+// Client holds a pool of connections to a RESP server.
+// It is safe for concurrent use.
+type Client struct {
+	addr string
+	pool chan *conn
+}
+
+// Dial returns a Client for the server at addr, after verifying that
+// the server responds to a PING.
+func Dial(ctx context.Context, addr string) (*Client, error) {
+	c := &Client{addr: addr, pool: make(chan *conn, maxIdle)}
+
+	if _, err := c.Do(ctx, "PING"); err != nil {
+		return nil, fmt.Errorf("failed to ping: %v", err)
+	}
+
+	return c, nil
+}
+
+// Do sends a command to the server and returns its reply.
+// Replies are decoded as follows:
+// simple strings as string, integers as int64, bulk strings as []byte,
+// and arrays as []interface{}. A null reply returns ErrNil, and an
+// error reply returns an Error.
+func (c *Client) Do(ctx context.Context, args ...string) (interface{}, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := cn.do(ctx, args)
+	if err != nil {
+		// Server errors leave the connection in a usable state;
+		// anything else means we can't trust it.
+		if _, ok := err.(Error); !ok && err != ErrNil {
+			cn.Close()
+			return nil, err
+		}
+	}
+	c.put(cn)
+
+	return reply, err
+}
+
+// Close closes all idle connections in the pool.
+func (c *Client) Close() error {
+	for {
+		select {
+		case cn := <-c.pool:
+			cn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case cn := <-c.pool:
+		return cn, nil
+	default:
+		return dial(ctx, c.addr)
+	}
+}
+
+func (c *Client) put(cn *conn) {
+	select {
+	case c.pool <- cn:
+	default:
+		cn.Close()
+	}
+}
+
+// Message is a message received on a subscribed channel.
+type Message struct {
+	Channel string
+	Payload string
+}
+
+// Subscription receives messages published to one or more channels.
+type Subscription struct {
+	conn *conn
+
+	// Messages delivers published messages. It is closed when the
+	// subscription is closed, or when the connection fails.
+	Messages <-chan Message
+}
+
+// Subscribe opens a dedicated connection, and subscribes it to the
+// requested channels. The context is only used for establishing the
+// subscription; call Close on the Subscription to end it.
+func (c *Client) Subscribe(ctx context.Context, channels ...string) (*Subscription, error) {
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("missing channels")
+	}
+
+	cn, err := dial(ctx, c.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	args := append([]string{"SUBSCRIBE"}, channels...)
+	if err := cn.write(ctx, args); err != nil {
+		cn.Close()
+		return nil, err
+	}
+
+	// Each channel is confirmed with its own reply.
+	for range channels {
+		if _, err := cn.read(); err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("failed to subscribe: %v", err)
+		}
+	}
+
+	// Clear the deadline; messages may take any time to arrive.
+	cn.SetDeadline(time.Time{})
+
+	messages := make(chan Message)
+	go func() {
+		defer close(messages)
+		for {
+			reply, err := cn.read()
+			if err != nil {
+				return
+			}
+
+			// Messages are arrays of: "message", channel, payload.
+			a, ok := reply.([]interface{})
+			if !ok || len(a) != 3 {
+				continue
+			}
+			if kind, _ := a[0].([]byte); string(kind) != "message" {
+				continue
+			}
+			channel, _ := a[1].([]byte)
+			payload, _ := a[2].([]byte)
+
+			messages <- Message{
+				Channel: string(channel),
+				Payload: string(payload),
+			}
+		}
+	}()
+
+	return &Subscription{conn: cn, Messages: messages}, nil
+}
+
+// Close ends the subscription and closes its connection.
+// Any undelivered messages are dropped.
+func (s *Subscription) Close() error {
+	err := s.conn.Close()
+
+	// Drain messages, so the reading goroutine can exit.
+	for range s.Messages {
+	}
+
+	return err
+}
+
+// conn is a single connection to a RESP server.
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func dial(ctx context.Context, addr string) (*conn, error) {
+	dialer := net.Dialer{Timeout: dialTimeout}
+
+	nc, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial: %v", err)
+	}
+
+	return &conn{
+		Conn: nc,
+		r:    bufio.NewReader(nc),
+		w:    bufio.NewWriter(nc),
+	}, nil
+}
+
+func (cn *conn) do(ctx context.Context, args []string) (interface{}, error) {
+	if err := cn.write(ctx, args); err != nil {
+		return nil, err
+	}
+
+	return cn.read()
+}
+
+// write sends a command as an array of bulk strings.
+func (cn *conn) write(ctx context.Context, args []string) error {
+	deadline, _ := ctx.Deadline()
+	if err := cn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cn.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(cn.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	return cn.w.Flush()
+}
+
+// read decodes a single reply.
+func (cn *conn) read() (interface{}, error) {
+	return ReadReply(cn.r)
+}
+
+// ReadReply decodes a single RESP value from r.
+// It is exported for use by servers and test doubles.
+func ReadReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, fmt.Errorf("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+
+	case '-':
+		return nil, Error(line[1:])
+
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer reply: %v", err)
+		}
+		return n, nil
+
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulk length: %v", err)
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid array length: %v", err)
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+
+		a := make([]interface{}, n)
+		for i := range a {
+			v, err := ReadReply(r)
+			switch err.(type) {
+			case nil:
+			case Error:
+				v = err
+			default:
+				if err != ErrNil {
+					return nil, err
+				}
+			}
+			a[i] = v
+		}
+		return a, nil
+
+	default:
+		return nil, fmt.Errorf("unknown reply type %q", line[0])
+	}
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("malformed line")
+	}
+
+	return line[:len(line)-2], nil
+}
+
+// Bytes is a helper that converts a reply to a byte slice.
+func Bytes(reply interface{}, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := reply.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	default:
+		return nil, fmt.Errorf("unexpected reply type %T", reply)
+	}
+}
+
+// Int64 is a helper that converts a reply to an integer.
+func Int64(reply interface{}, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+
+	switch v := reply.(type) {
+	case int64:
+		return v, nil
+	case []byte:
+		return strconv.ParseInt(string(v), 10, 64)
+	default:
+		return 0, fmt.Errorf("unexpected reply type %T", reply)
+	}
+}
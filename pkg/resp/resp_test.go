@@ -0,0 +1,101 @@
+package resp_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dwrz/url-shortener/pkg/resp"
+	"github.com/dwrz/url-shortener/pkg/resp/resptest"
+)
+
+func TestClient(t *testing.T) {
+	t.Run("do", testDo)
+	t.Run("subscribe", testSubscribe)
+}
+
+// testDo checks that commands are sent, and replies decoded.
+func testDo(t *testing.T) {
+	s := resptest.NewServer()
+	defer s.Close()
+
+	ctx := context.Background()
+
+	c, err := resp.Dial(ctx, s.Addr)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := resp.Bytes(c.Do(ctx, "GET", "missing")); err != resp.ErrNil {
+		t.Errorf("expected ErrNil for missing key, but got %v", err)
+	}
+
+	if _, err := c.Do(ctx, "SET", "key", "value"); err != nil {
+		t.Fatalf("failed to set: %v", err)
+	}
+
+	value, err := resp.Bytes(c.Do(ctx, "GET", "key"))
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	if string(value) != "value" {
+		t.Errorf("expected %q but got %q", "value", value)
+	}
+
+	n, err := resp.Int64(c.Do(ctx, "DEL", "key", "missing"))
+	if err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 deleted key but got %d", n)
+	}
+
+	// Error replies should be returned, and leave the client usable.
+	if _, err := c.Do(ctx, "NOPE"); err == nil {
+		t.Error("expected error for unknown command")
+	} else if _, ok := err.(resp.Error); !ok {
+		t.Errorf("expected resp.Error but got %T", err)
+	}
+	if _, err := c.Do(ctx, "PING"); err != nil {
+		t.Errorf("failed to ping after error reply: %v", err)
+	}
+}
+
+// testSubscribe checks that published messages are delivered to
+// subscribers.
+func testSubscribe(t *testing.T) {
+	s := resptest.NewServer()
+	defer s.Close()
+
+	ctx := context.Background()
+
+	c, err := resp.Dial(ctx, s.Addr)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer c.Close()
+
+	sub, err := c.Subscribe(ctx, "channel")
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	n, err := resp.Int64(c.Do(ctx, "PUBLISH", "channel", "payload"))
+	if err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 receiver but got %d", n)
+	}
+
+	select {
+	case msg := <-sub.Messages:
+		if msg.Channel != "channel" || msg.Payload != "payload" {
+			t.Errorf("unexpected message: %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Error("timed out waiting for message")
+	}
+}
@@ -0,0 +1,345 @@
+// Package resptest provides an in-memory RESP server for use in tests.
+// It implements a small subset of Redis commands, sufficient to stand
+// in for a real server when testing clients in this repository.
+package resptest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dwrz/url-shortener/pkg/resp"
+)
+
+// Server is an in-memory RESP server listening on a local port.
+type Server struct {
+	// Addr is the address the server is listening on.
+	Addr string
+
+	listener net.Listener
+
+	mu          sync.Mutex
+	data        map[string]entry
+	subscribers map[string]map[*client]struct{}
+	clients     map[*client]struct{}
+
+	wg sync.WaitGroup
+}
+
+type entry struct {
+	value   []byte
+	expires time.Time
+}
+
+func (e entry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+type client struct {
+	conn net.Conn
+
+	// mu serializes writes, since published messages are written
+	// from the publisher's goroutine.
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+// NewServer starts and returns a Server on a random local port.
+// The caller should call Close when finished.
+func NewServer() *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("resptest: failed to listen: %v", err))
+	}
+
+	s := &Server{
+		Addr:        l.Addr().String(),
+		listener:    l,
+		data:        map[string]entry{},
+		subscribers: map[string]map[*client]struct{}{},
+		clients:     map[*client]struct{}{},
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s
+}
+
+// Close stops the server and closes all client connections.
+func (s *Server) Close() {
+	s.listener.Close()
+
+	s.mu.Lock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// Get returns the value stored at key, for inspection in tests.
+func (s *Server) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.data[key]
+	if !ok || e.expired(time.Now()) {
+		return nil, false
+	}
+
+	return e.value, true
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		c := &client{conn: conn, w: bufio.NewWriter(conn)}
+
+		s.mu.Lock()
+		s.clients[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(c)
+	}
+}
+
+func (s *Server) handle(c *client) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		for _, subs := range s.subscribers {
+			delete(subs, c)
+		}
+		s.mu.Unlock()
+		c.conn.Close()
+	}()
+
+	r := bufio.NewReader(c.conn)
+	for {
+		reply, err := resp.ReadReply(r)
+		if err != nil {
+			return
+		}
+
+		a, ok := reply.([]interface{})
+		if !ok || len(a) == 0 {
+			c.write(resp.Error("ERR invalid command"))
+			continue
+		}
+
+		args := make([]string, len(a))
+		for i, v := range a {
+			b, _ := v.([]byte)
+			args[i] = string(b)
+		}
+
+		s.exec(c, strings.ToUpper(args[0]), args[1:])
+	}
+}
+
+func (s *Server) exec(c *client, cmd string, args []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	get := func(key string) (entry, bool) {
+		e, ok := s.data[key]
+		if ok && e.expired(now) {
+			delete(s.data, key)
+			return entry{}, false
+		}
+		return e, ok
+	}
+
+	switch cmd {
+	case "PING":
+		c.write("PONG")
+
+	case "GET":
+		if len(args) != 1 {
+			c.write(errArgs(cmd))
+			return
+		}
+		e, ok := get(args[0])
+		if !ok {
+			c.write(nil)
+			return
+		}
+		c.write(e.value)
+
+	case "SET":
+		if len(args) < 2 {
+			c.write(errArgs(cmd))
+			return
+		}
+		e := entry{value: []byte(args[1])}
+		var nx bool
+		for i := 2; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				nx = true
+			case "PX", "EX":
+				if i+1 >= len(args) {
+					c.write(errArgs(cmd))
+					return
+				}
+				n, err := strconv.ParseInt(args[i+1], 10, 64)
+				if err != nil || n <= 0 {
+					c.write(resp.Error("ERR invalid expire time"))
+					return
+				}
+				unit := time.Millisecond
+				if strings.ToUpper(args[i]) == "EX" {
+					unit = time.Second
+				}
+				e.expires = now.Add(time.Duration(n) * unit)
+				i++
+			default:
+				c.write(resp.Error("ERR syntax error"))
+				return
+			}
+		}
+		if _, ok := get(args[0]); ok && nx {
+			c.write(nil)
+			return
+		}
+		s.data[args[0]] = e
+		c.write("OK")
+
+	case "DEL":
+		var n int64
+		for _, key := range args {
+			if _, ok := get(key); ok {
+				delete(s.data, key)
+				n++
+			}
+		}
+		c.write(n)
+
+	case "INCRBY":
+		if len(args) != 2 {
+			c.write(errArgs(cmd))
+			return
+		}
+		delta, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			c.write(resp.Error("ERR value is not an integer or out of range"))
+			return
+		}
+		e, _ := get(args[0])
+		var n int64
+		if e.value != nil {
+			n, err = strconv.ParseInt(string(e.value), 10, 64)
+			if err != nil {
+				c.write(resp.Error("ERR value is not an integer or out of range"))
+				return
+			}
+		}
+		n += delta
+		e.value = []byte(strconv.FormatInt(n, 10))
+		s.data[args[0]] = e
+		c.write(n)
+
+	case "PEXPIRE":
+		if len(args) != 2 {
+			c.write(errArgs(cmd))
+			return
+		}
+		ms, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			c.write(resp.Error("ERR value is not an integer or out of range"))
+			return
+		}
+		e, ok := get(args[0])
+		if !ok {
+			c.write(int64(0))
+			return
+		}
+		e.expires = now.Add(time.Duration(ms) * time.Millisecond)
+		s.data[args[0]] = e
+		c.write(int64(1))
+
+	case "PUBLISH":
+		if len(args) != 2 {
+			c.write(errArgs(cmd))
+			return
+		}
+		subs := s.subscribers[args[0]]
+		for sub := range subs {
+			sub.write([]interface{}{
+				[]byte("message"), []byte(args[0]), []byte(args[1]),
+			})
+		}
+		c.write(int64(len(subs)))
+
+	case "SUBSCRIBE":
+		if len(args) == 0 {
+			c.write(errArgs(cmd))
+			return
+		}
+		for i, channel := range args {
+			if s.subscribers[channel] == nil {
+				s.subscribers[channel] = map[*client]struct{}{}
+			}
+			s.subscribers[channel][c] = struct{}{}
+			c.write([]interface{}{
+				[]byte("subscribe"), []byte(channel), int64(i + 1),
+			})
+		}
+
+	default:
+		c.write(resp.Error(fmt.Sprintf("ERR unknown command '%s'", cmd)))
+	}
+}
+
+func errArgs(cmd string) resp.Error {
+	return resp.Error(fmt.Sprintf(
+		"ERR wrong number of arguments for '%s' command",
+		strings.ToLower(cmd),
+	))
+}
+
+// write encodes and sends a reply to the client.
+func (c *client) write(v interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	encode(c.w, v)
+	c.w.Flush()
+}
+
+func encode(w *bufio.Writer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case string:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case resp.Error:
+		fmt.Fprintf(w, "-%s\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case []byte:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, e := range v {
+			encode(w, e)
+		}
+	default:
+		panic(fmt.Sprintf("resptest: cannot encode %T", v))
+	}
+}
@@ -0,0 +1,82 @@
+package useragent
+
+import "strings"
+
+// botPatterns are lower case substrings of the User-Agent strings of
+// crawlers, link previewers, monitors, and HTTP libraries.
+//
+// Keep the list sorted, and add to it as new agents appear in visit
+// records; a generic pattern such as "bot" is preferred over the names
+// of individual bots where it is unambiguous.
+var botPatterns = []string{
+	"adsbot",
+	"ahrefs",
+	"apache-httpclient",
+	"applebot",
+	"axios/",
+	"bingpreview",
+	"bot/",
+	"bot;",
+	"bytespider",
+	"crawler",
+	"curl/",
+	"discordbot",
+	"embedly",
+	"facebookcatalog",
+	"facebookexternalhit",
+	"feedfetcher",
+	"go-http-client",
+	"google-inspectiontool",
+	"googlebot",
+	"headlesschrome",
+	"httpie/",
+	"java/",
+	"libwww-perl",
+	"lighthouse",
+	"linkedinbot",
+	"mediapartners-google",
+	"node-fetch",
+	"okhttp",
+	"petalbot",
+	"phantomjs",
+	"pingdom",
+	"pinterest",
+	"python-requests",
+	"python-urllib",
+	"qwantify",
+	"redditbot",
+	"scrapy",
+	"semrush",
+	"skypeuripreview",
+	"slack-imgproxy",
+	"slackbot",
+	"slurp",
+	"spider",
+	"statuscake",
+	"telegrambot",
+	"twitterbot",
+	"uptimerobot",
+	"vkshare",
+	"wget/",
+	"whatsapp",
+	"yandex",
+}
+
+// IsBot reports whether a User-Agent string belongs to a crawler, link
+// previewer, monitor, or HTTP library, rather than a person's browser.
+// An empty User-Agent is considered a bot, since browsers always send
+// one.
+func IsBot(s string) bool {
+	if s == "" {
+		return true
+	}
+
+	ua := strings.ToLower(s)
+	for _, pattern := range botPatterns {
+		if strings.Contains(ua, pattern) {
+			return true
+		}
+	}
+
+	return false
+}
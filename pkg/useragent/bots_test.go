@@ -0,0 +1,46 @@
+package useragent
+
+import (
+	"sort"
+	"testing"
+)
+
+// TestIsBot checks the classification of common bot and browser
+// User-Agent strings.
+func TestIsBot(t *testing.T) {
+	var tests = []struct {
+		Input    string
+		Expected bool
+	}{
+		{Input: "", Expected: true},
+		{Input: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", Expected: true},
+		{Input: "facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", Expected: true},
+		{Input: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", Expected: true},
+		{Input: "Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)", Expected: true},
+		{Input: "Twitterbot/1.0", Expected: true},
+		{Input: "WhatsApp/2.19.81 A", Expected: true},
+		{Input: "TelegramBot (like TwitterBot)", Expected: true},
+		{Input: "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/80.0.3987.0 Safari/537.36", Expected: true},
+		{Input: "curl/7.68.0", Expected: true},
+		{Input: "Go-http-client/1.1", Expected: true},
+		{Input: "python-requests/2.23.0", Expected: true},
+		{Input: "Mozilla/5.0 (iPhone; CPU iPhone OS 13_3 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/13.0.5 Mobile/15E148 Safari/604.1", Expected: false},
+		{Input: "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:74.0) Gecko/20100101 Firefox/74.0", Expected: false},
+		{Input: "Mozilla/5.0 (Linux; Android 10; Pixel 3) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/80.0.3987.149 Mobile Safari/537.36", Expected: false},
+		// Cubot is a phone maker, not a bot.
+		{Input: "Mozilla/5.0 (Linux; Android 9; CUBOT X19) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/80.0.3987.149 Mobile Safari/537.36", Expected: false},
+	}
+
+	for _, test := range tests {
+		if got := IsBot(test.Input); got != test.Expected {
+			t.Errorf("%q: expected %t but got %t", test.Input, test.Expected, got)
+		}
+	}
+}
+
+// TestBotPatternsSorted keeps the rule list easy to maintain.
+func TestBotPatternsSorted(t *testing.T) {
+	if !sort.StringsAreSorted(botPatterns) {
+		t.Error("bot patterns are not sorted")
+	}
+}
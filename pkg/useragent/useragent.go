@@ -0,0 +1,161 @@
+// Package useragent classifies HTTP User-Agent strings by browser,
+// operating system, and device class. It uses simple substring rules,
+// which are sufficient for routing decisions, but not for exhaustive
+// analytics.
+package useragent
+
+import "strings"
+
+// Browsers.
+const (
+	BrowserChrome  = "chrome"
+	BrowserEdge    = "edge"
+	BrowserFirefox = "firefox"
+	BrowserIE      = "ie"
+	BrowserOpera   = "opera"
+	BrowserSafari  = "safari"
+	BrowserSamsung = "samsung"
+	BrowserOther   = "other"
+)
+
+// Operating systems.
+const (
+	OSAndroid  = "android"
+	OSChromeOS = "chromeos"
+	OSIOS      = "ios"
+	OSLinux    = "linux"
+	OSMacOS    = "macos"
+	OSWindows  = "windows"
+	OSOther    = "other"
+)
+
+// Device classes.
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceOther   = "other"
+)
+
+// Browsers lists the browsers returned by Parse.
+var Browsers = []string{
+	BrowserChrome, BrowserEdge, BrowserFirefox, BrowserIE, BrowserOpera,
+	BrowserSafari, BrowserSamsung, BrowserOther,
+}
+
+// OSes lists the operating systems returned by Parse.
+var OSes = []string{
+	OSAndroid, OSChromeOS, OSIOS, OSLinux, OSMacOS, OSWindows, OSOther,
+}
+
+// Devices lists the device classes returned by Parse.
+var Devices = []string{
+	DeviceDesktop, DeviceMobile, DeviceTablet, DeviceOther,
+}
+
+// UserAgent describes the client identified by a User-Agent string.
+type UserAgent struct {
+	Browser string
+	OS      string
+	Device  string
+}
+
+// Parse classifies a User-Agent string.
+// Unrecognized values are classified as BrowserOther, OSOther and
+// DeviceOther.
+func Parse(s string) UserAgent {
+	ua := strings.ToLower(s)
+
+	result := parsePlatform(ua)
+	result.Browser = parseBrowser(ua)
+
+	return result
+}
+
+// parseBrowser classifies the browser in a lower case User-Agent.
+// Most browsers include the tokens of those they derive from, so the
+// order of the checks matters; e.g., Edge includes "chrome" and
+// "safari", and Chrome includes "safari".
+func parseBrowser(ua string) string {
+	switch {
+	case strings.Contains(ua, "edg/"), strings.Contains(ua, "edge/"),
+		strings.Contains(ua, "edga/"), strings.Contains(ua, "edgios/"):
+		return BrowserEdge
+	case strings.Contains(ua, "opr/"), strings.Contains(ua, "opera"):
+		return BrowserOpera
+	case strings.Contains(ua, "samsungbrowser/"):
+		return BrowserSamsung
+	case strings.Contains(ua, "firefox/"), strings.Contains(ua, "fxios/"):
+		return BrowserFirefox
+	case strings.Contains(ua, "chrome/"), strings.Contains(ua, "crios/"):
+		return BrowserChrome
+	case strings.Contains(ua, "msie "), strings.Contains(ua, "trident/"):
+		return BrowserIE
+	case strings.Contains(ua, "safari/"):
+		return BrowserSafari
+	default:
+		return BrowserOther
+	}
+}
+
+// parsePlatform classifies the operating system and device class in a
+// lower case User-Agent.
+func parsePlatform(ua string) UserAgent {
+	switch {
+	// iPadOS reports itself as macOS by default, and can't be told
+	// apart from a Mac by its User-Agent alone.
+	case strings.Contains(ua, "ipad"):
+		return UserAgent{OS: OSIOS, Device: DeviceTablet}
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipod"):
+		return UserAgent{OS: OSIOS, Device: DeviceMobile}
+
+	// Android tablets omit "mobile".
+	case strings.Contains(ua, "android"):
+		if strings.Contains(ua, "mobile") {
+			return UserAgent{OS: OSAndroid, Device: DeviceMobile}
+		}
+		return UserAgent{OS: OSAndroid, Device: DeviceTablet}
+
+	case strings.Contains(ua, "windows phone"):
+		return UserAgent{OS: OSWindows, Device: DeviceMobile}
+	case strings.Contains(ua, "windows"):
+		return UserAgent{OS: OSWindows, Device: DeviceDesktop}
+	case strings.Contains(ua, "cros"):
+		return UserAgent{OS: OSChromeOS, Device: DeviceDesktop}
+	case strings.Contains(ua, "macintosh"), strings.Contains(ua, "mac os x"):
+		return UserAgent{OS: OSMacOS, Device: DeviceDesktop}
+	case strings.Contains(ua, "linux"), strings.Contains(ua, "x11"):
+		return UserAgent{OS: OSLinux, Device: DeviceDesktop}
+
+	default:
+		return UserAgent{OS: OSOther, Device: DeviceOther}
+	}
+}
+
+// IsBrowser reports whether s is one of the browsers returned by
+// Parse.
+func IsBrowser(s string) bool {
+	return contains(Browsers, s)
+}
+
+// IsOS reports whether s is one of the operating systems returned by
+// Parse.
+func IsOS(s string) bool {
+	return contains(OSes, s)
+}
+
+// IsDevice reports whether s is one of the device classes returned by
+// Parse.
+func IsDevice(s string) bool {
+	return contains(Devices, s)
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,77 @@
+package useragent
+
+import "testing"
+
+// TestParse checks the classification of common User-Agent strings.
+func TestParse(t *testing.T) {
+	var tests = []struct {
+		Input    string
+		Expected UserAgent
+	}{
+		{
+			Input:    "Mozilla/5.0 (iPhone; CPU iPhone OS 13_3 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/13.0.5 Mobile/15E148 Safari/604.1",
+			Expected: UserAgent{Browser: BrowserSafari, OS: OSIOS, Device: DeviceMobile},
+		},
+		{
+			Input:    "Mozilla/5.0 (iPad; CPU OS 12_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148",
+			Expected: UserAgent{Browser: BrowserOther, OS: OSIOS, Device: DeviceTablet},
+		},
+		{
+			Input:    "Mozilla/5.0 (Linux; Android 10; Pixel 3) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/80.0.3987.149 Mobile Safari/537.36",
+			Expected: UserAgent{Browser: BrowserChrome, OS: OSAndroid, Device: DeviceMobile},
+		},
+		{
+			Input:    "Mozilla/5.0 (Linux; Android 9; SM-T820) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/80.0.3987.132 Safari/537.36",
+			Expected: UserAgent{Browser: BrowserChrome, OS: OSAndroid, Device: DeviceTablet},
+		},
+		{
+			Input:    "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:74.0) Gecko/20100101 Firefox/74.0",
+			Expected: UserAgent{Browser: BrowserFirefox, OS: OSWindows, Device: DeviceDesktop},
+		},
+		{
+			Input:    "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_3) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/13.0.5 Safari/605.1.15",
+			Expected: UserAgent{Browser: BrowserSafari, OS: OSMacOS, Device: DeviceDesktop},
+		},
+		{
+			Input:    "Mozilla/5.0 (X11; CrOS x86_64 12871.102.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/81.0.4044.141 Safari/537.36",
+			Expected: UserAgent{Browser: BrowserChrome, OS: OSChromeOS, Device: DeviceDesktop},
+		},
+		{
+			Input:    "Mozilla/5.0 (X11; Linux x86_64; rv:74.0) Gecko/20100101 Firefox/74.0",
+			Expected: UserAgent{Browser: BrowserFirefox, OS: OSLinux, Device: DeviceDesktop},
+		},
+		{
+			Input:    "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/80.0.3987.149 Safari/537.36 Edg/80.0.361.69",
+			Expected: UserAgent{Browser: BrowserEdge, OS: OSWindows, Device: DeviceDesktop},
+		},
+		{
+			Input:    "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/80.0.3987.149 Safari/537.36 OPR/67.0.3575.115",
+			Expected: UserAgent{Browser: BrowserOpera, OS: OSWindows, Device: DeviceDesktop},
+		},
+		{
+			Input:    "Mozilla/5.0 (Linux; Android 9; SAMSUNG SM-G960F) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/11.1 Chrome/75.0.3770.143 Mobile Safari/537.36",
+			Expected: UserAgent{Browser: BrowserSamsung, OS: OSAndroid, Device: DeviceMobile},
+		},
+		{
+			Input:    "Mozilla/5.0 (Windows NT 10.0; Trident/7.0; rv:11.0) like Gecko",
+			Expected: UserAgent{Browser: BrowserIE, OS: OSWindows, Device: DeviceDesktop},
+		},
+		{
+			Input:    "curl/7.68.0",
+			Expected: UserAgent{Browser: BrowserOther, OS: OSOther, Device: DeviceOther},
+		},
+		{
+			Input:    "",
+			Expected: UserAgent{Browser: BrowserOther, OS: OSOther, Device: DeviceOther},
+		},
+	}
+
+	for _, test := range tests {
+		if got := Parse(test.Input); got != test.Expected {
+			t.Errorf(
+				"%q: expected %+v but got %+v",
+				test.Input, test.Expected, got,
+			)
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/dwrz/url-shortener/internal/apikey"
 	"github.com/dwrz/url-shortener/internal/config"
 	"github.com/dwrz/url-shortener/internal/db"
 	"github.com/dwrz/url-shortener/internal/shorturl"
@@ -21,6 +22,11 @@ import (
 var (
 	cfg        = config.New()
 	serviceURL = fmt.Sprintf("http://localhost:%s", cfg.Port)
+
+	// apiKey is issued for the test, and sent by apiClient with
+	// requests to create short URLs and get stats.
+	apiKey    string
+	apiClient = &http.Client{Transport: apiKeyTransport{}}
 )
 
 type shortURL struct {
@@ -38,6 +44,29 @@ func main() {
 	}
 	log.Println("checked status endpoint")
 
+	// Issue an API key for the test.
+	if err := issueAPIKey(); err != nil {
+		log.Printf("ERROR: failed to issue api key: %v", err)
+		log.Fatal("failed to issue api key")
+	}
+	log.Println("issued api key")
+
+	// Test that creating short URLs requires an API key.
+	res, err := http.PostForm(serviceURL, url.Values{"url": {"http://dwrz.net"}})
+	if err != nil {
+		log.Printf("ERROR: failed to post long url: %v", err)
+		log.Fatal("failed to check api key requirement")
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		log.Printf(
+			"ERROR: expected status code %d without api key, but got %d",
+			http.StatusUnauthorized, res.StatusCode,
+		)
+		log.Fatal("failed to check api key requirement")
+	}
+	log.Println("OK: rejected request without api key")
+
 	// Test short URL creation.
 	var url = "http://dwrz.net"
 
@@ -127,6 +156,13 @@ func main() {
 		"OK: concurrently got stats for %d short URLs", len(shortURLs),
 	)
 
+	// Test visit limits.
+	if err := checkMaxVisits(); err != nil {
+		log.Printf("ERROR: failed visit limit: %v", err)
+		log.Fatal("failed visit limit")
+	}
+	log.Println("OK: expired short URL after visit limit")
+
 	if err := testVisitStats(); err != nil {
 		log.Printf("ERROR: failed to get correct stats: %v", err)
 		log.Fatal("failed to get correct stats")
@@ -205,7 +241,7 @@ func createShortURLs() (urls []shortURL, err error) {
 }
 
 func createShortURL(longURL string) (shortURL, error) {
-	res, err := http.PostForm(
+	res, err := apiClient.PostForm(
 		serviceURL, url.Values{"url": {longURL}},
 	)
 	if err != nil {
@@ -268,8 +304,59 @@ func ignoreRedirect(req *http.Request, via []*http.Request) error {
 	return http.ErrUseLastResponse
 }
 
+// browserUserAgent is sent with visits, since the service does not
+// count visits by bots, including Go's default User-Agent.
+const browserUserAgent = "Mozilla/5.0 (X11; Linux x86_64; rv:74.0) Gecko/20100101 Firefox/74.0"
+
+// browserTransport sets a browser User-Agent on requests.
+type browserTransport struct{}
+
+func (browserTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", browserUserAgent)
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// apiKeyTransport sets the test API key on requests.
+type apiKeyTransport struct{}
+
+func (apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// issueAPIKey issues an API key with all scopes for apiClient.
+func issueAPIKey() error {
+	db, err := db.Connect(context.TODO(), cfg.MongoURI)
+	if err != nil {
+		return fmt.Errorf("failed to connect to db: %v", err)
+	}
+
+	apiKey, _, err = apikey.Issue(context.TODO(), apikey.IssueParams{
+		DB:          db,
+		Environment: cfg.Environment,
+		Name:        "test",
+		Owner:       "test",
+		Scopes:      []string{apikey.ScopeLinksWrite, apikey.ScopeStatsRead},
+	})
+
+	return err
+}
+
+// visitClient returns a client which visits short URLs as a browser,
+// without following redirects.
+func visitClient() *http.Client {
+	return &http.Client{
+		CheckRedirect: ignoreRedirect,
+		Transport:     browserTransport{},
+	}
+}
+
 func checkRedirect(shortURL shortURL) error {
-	client := &http.Client{CheckRedirect: ignoreRedirect}
+	client := visitClient()
 
 	url := fmt.Sprintf("%s/%s", serviceURL, shortURL.Short)
 
@@ -311,6 +398,52 @@ func checkRedirect(shortURL shortURL) error {
 	return nil
 }
 
+func checkMaxVisits() error {
+	res, err := apiClient.PostForm(serviceURL, url.Values{
+		"url":       {"https://go.dev/"},
+		"maxVisits": {"1"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to post long url: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated {
+		return fmt.Errorf(
+			"expected status code of %d, but got %d",
+			http.StatusCreated, res.StatusCode,
+		)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %v", err)
+	}
+	short := shortURL{Short: string(body), Long: "https://go.dev/"}
+
+	// The first visit is within the limit, and the second exceeds it.
+	// Short URLs with a limit are redirected temporarily.
+	client := visitClient()
+	for _, expected := range []int{http.StatusFound, http.StatusGone} {
+		res, err := client.Get(
+			fmt.Sprintf("%s/%s", serviceURL, short.Short),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to get with short url: %v", err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != expected {
+			return fmt.Errorf(
+				"expected status code of %d, but got %d",
+				expected, res.StatusCode,
+			)
+		}
+	}
+
+	return nil
+}
+
 func checkAllStats(shortURLs []shortURL) error {
 	var (
 		errs = make(chan error, len(shortURLs))
@@ -346,7 +479,7 @@ func checkAllStats(shortURLs []shortURL) error {
 func checkStats(shortURL shortURL) error {
 	url := fmt.Sprintf("%s/%s/stats", serviceURL, shortURL.Short)
 
-	res, err := http.Get(url)
+	res, err := apiClient.Get(url)
 
 	if err != nil {
 		return fmt.Errorf("failed to get stats: %v", err)
@@ -381,6 +514,12 @@ func checkStats(shortURL shortURL) error {
 			stats.Year, err,
 		)
 	}
+	if stats.All != 1 {
+		return fmt.Errorf(
+			"expected 1 visit in all time, but got %d: %v",
+			stats.All, err,
+		)
+	}
 
 	return nil
 }
@@ -419,13 +558,16 @@ func testVisitStats() error {
 		return fmt.Errorf("non-zero visits on new short url")
 	}
 
-	// Insert some visits to test timespans.
-	coll := db.Database(cfg.Environment).Collection(visit.Collection)
+	// Record some visits to test timespans.
+	// Visits are recorded with visit.Create, which counts them in
+	// rollups.
 
-	// Insert a visit from more than one year ago.
-	if _, err := coll.InsertOne(context.TODO(), visit.Visit{
-		ShortID: shortURL.ID,
-		Time:    time.Now().AddDate(-1, 0, -1),
+	// Record a visit from more than one year ago.
+	if err := visit.Create(context.TODO(), visit.CreateParams{
+		DB:          db,
+		Environment: cfg.Environment,
+		ShortID:     shortURL.ID,
+		Time:        time.Now().AddDate(-1, 0, -1),
 	}); err != nil {
 		return fmt.Errorf("failed to insert access record: %v", err)
 	}
@@ -443,10 +585,12 @@ func testVisitStats() error {
 		)
 	}
 
-	// Insert a visit from six months ago.
-	if _, err := coll.InsertOne(context.TODO(), visit.Visit{
-		ShortID: shortURL.ID,
-		Time:    time.Now().AddDate(0, -6, 0),
+	// Record a visit from six months ago.
+	if err := visit.Create(context.TODO(), visit.CreateParams{
+		DB:          db,
+		Environment: cfg.Environment,
+		ShortID:     shortURL.ID,
+		Time:        time.Now().AddDate(0, -6, 0),
 	}); err != nil {
 		return fmt.Errorf("failed to insert access record: %v", err)
 	}
@@ -476,10 +620,12 @@ func testVisitStats() error {
 		)
 	}
 
-	// Insert a visit from 8 days ago.
-	if _, err := coll.InsertOne(context.TODO(), visit.Visit{
-		ShortID: shortURL.ID,
-		Time:    time.Now().AddDate(0, 0, -8),
+	// Record a visit from 8 days ago.
+	if err := visit.Create(context.TODO(), visit.CreateParams{
+		DB:          db,
+		Environment: cfg.Environment,
+		ShortID:     shortURL.ID,
+		Time:        time.Now().AddDate(0, 0, -8),
 	}); err != nil {
 		return fmt.Errorf("failed to insert access record: %v", err)
 	}
@@ -509,10 +655,12 @@ func testVisitStats() error {
 		)
 	}
 
-	// Insert a visit from 3 days ago.
-	if _, err := coll.InsertOne(context.TODO(), visit.Visit{
-		ShortID: shortURL.ID,
-		Time:    time.Now().AddDate(0, 0, -3),
+	// Record a visit from 3 days ago.
+	if err := visit.Create(context.TODO(), visit.CreateParams{
+		DB:          db,
+		Environment: cfg.Environment,
+		ShortID:     shortURL.ID,
+		Time:        time.Now().AddDate(0, 0, -3),
 	}); err != nil {
 		return fmt.Errorf("failed to insert access record: %v", err)
 	}
@@ -542,10 +690,12 @@ func testVisitStats() error {
 		)
 	}
 
-	// Insert a visit from today.
-	if _, err := coll.InsertOne(context.TODO(), visit.Visit{
-		ShortID: shortURL.ID,
-		Time:    time.Now(),
+	// Record a visit from today.
+	if err := visit.Create(context.TODO(), visit.CreateParams{
+		DB:          db,
+		Environment: cfg.Environment,
+		ShortID:     shortURL.ID,
+		Time:        time.Now(),
 	}); err != nil {
 		return fmt.Errorf("failed to insert access record: %v", err)
 	}